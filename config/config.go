@@ -13,8 +13,31 @@ type FirebaseConfig struct {
 	WebApiKey       string `yaml:"web_api_key"`
 }
 
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Bucket    string `yaml:"bucket"`
+	Region    string `yaml:"region"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+type StorageConfig struct {
+	Backend       string   `yaml:"backend"`
+	LocalPath     string   `yaml:"local_path"`
+	MaxAssetSize  int64    `yaml:"max_asset_size"`
+	MaxBundleSize int64    `yaml:"max_bundle_size"`
+	S3            S3Config `yaml:"s3"`
+}
+
+type StrokesConfig struct {
+	SimplifyTolerance float64 `yaml:"simplify_tolerance"`
+	Smoothing         bool    `yaml:"smoothing"`
+}
+
 type Config struct {
 	Firebase FirebaseConfig `yaml:"firebase"`
+	Storage  StorageConfig  `yaml:"storage"`
+	Strokes  StrokesConfig  `yaml:"strokes"`
 }
 
 var config Config
@@ -65,3 +88,36 @@ func FirebaseWebAPIKey() string {
 	loadConfig()
 	return config.Firebase.WebApiKey
 }
+
+// Storage Return the blob storage configuration, local storage in data/blobs with 10 MiB assets and 200 MiB
+// bundles by default
+func Storage() StorageConfig {
+	loadConfig()
+	storage := config.Storage
+	if storage.Backend == "" {
+		storage.Backend = "local"
+	}
+	if storage.LocalPath == "" {
+		storage.LocalPath = "data/blobs"
+	}
+	if storage.MaxAssetSize <= 0 {
+		storage.MaxAssetSize = 10 << 20
+	}
+	if storage.MaxBundleSize <= 0 {
+		storage.MaxBundleSize = 200 << 20
+	}
+	if storage.S3.Region == "" {
+		storage.S3.Region = "us-east-1"
+	}
+	return storage
+}
+
+// Strokes Return the processing of freehand strokes, a 0.5 units simplification by default, negative to disable it
+func Strokes() StrokesConfig {
+	loadConfig()
+	strokes := config.Strokes
+	if strokes.SimplifyTolerance == 0 {
+		strokes.SimplifyTolerance = 0.5
+	}
+	return strokes
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"phaint/config"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+	"phaint/models"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const assetsCollection = "assets"
+
+type AssetHandler struct{}
+
+// uploadAsset stores the "file" part of a multipart upload along with a thumbnail
+func (a *AssetHandler) uploadAsset(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+
+	uid, err := requireProjectMember(r, projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	maxSize := config.Storage().MaxAssetSize
+	// leave room for the multipart envelope, the file itself is checked below
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Asset is too large"))
+			return
+		}
+		writeError(w, newHTTPError(http.StatusBadRequest, `A multipart "file" field is required`))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Asset is too large"))
+		return
+	}
+
+	contentType, err := services.SniffAssetType(data)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusUnsupportedMediaType, err.Error()))
+		return
+	}
+	thumbnail, width, height, err := services.ImageThumbnail(data, services.AssetThumbnailSize)
+	if errors.Is(err, services.ErrImageTooLarge) {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "Asset is not a valid image"))
+		return
+	}
+
+	asset := models.Asset{
+		ID:          utils.GenerateRandomString(20),
+		ProjectID:   projectID,
+		UserID:      uid,
+		Name:        header.Filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Width:       width,
+		Height:      height,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	blobs := services.Blobs()
+	if err := blobs.Put(ctx, services.AssetKey(projectID, asset.ID), data, contentType); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := blobs.Put(ctx, services.AssetThumbnailKey(projectID, asset.ID), thumbnail, "image/png"); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+		return
+	}
+	if _, err := docRef.Collection(assetsCollection).Doc(asset.ID).Set(ctx, asset); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, asset)
+}
+
+// getAsset serves an asset, or its thumbnail, to the members of its project
+func (a *AssetHandler) getAsset(w http.ResponseWriter, r *http.Request, thumbnail bool) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+	assetID := r.PathValue("aid")
+
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	asset, err := loadAsset(projectID, assetID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	key, contentType := services.AssetKey(projectID, asset.ID), asset.ContentType
+	if thumbnail {
+		key, contentType = services.AssetThumbnailKey(projectID, asset.ID), "image/png"
+	}
+	data, err := services.Blobs().Get(ctx, key)
+	if errors.Is(err, services.ErrBlobNotFound) {
+		writeError(w, newHTTPError(http.StatusNotFound, "Asset content not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// assets are immutable, only the members check prevents public caching
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func loadAsset(projectID string, assetID string) (models.Asset, error) {
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return models.Asset{}, newHTTPError(http.StatusNotFound, "Project not found")
+	}
+	docSnap, err := docRef.Collection(assetsCollection).Doc(assetID).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return models.Asset{}, newHTTPError(http.StatusNotFound, "Asset not found")
+	}
+	if err != nil {
+		return models.Asset{}, err
+	}
+	var asset models.Asset
+	err = docSnap.DataTo(&asset)
+	return asset, err
+}
+
+func (a *AssetHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assetID := r.PathValue("aid")
+	variant := r.PathValue("variant")
+	switch {
+	case assetID == "" && r.Method == http.MethodPost:
+		a.uploadAsset(w, r)
+	case variant != "" && variant != "thumbnail":
+		http.NotFound(w, r)
+	case assetID != "" && r.Method == http.MethodGet:
+		a.getAsset(w, r, variant == "thumbnail")
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
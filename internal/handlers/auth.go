@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"phaint/internal/services"
+	"strings"
+)
+
+// authenticate returns the UID of the user owning the Firebase ID token of the request. The token is read
+// from the "Authorization: Bearer" header, or from the "token" query parameter for plain links such as images
+func authenticate(r *http.Request) (string, error) {
+	ctx := context.Background()
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if token == "" {
+		return "", newHTTPError(http.StatusUnauthorized, "Authentication required")
+	}
+
+	authClient, err := services.FirebaseDb().GetApp().Auth(ctx)
+	if err != nil {
+		return "", err
+	}
+	verified, err := authClient.VerifyIDToken(ctx, token)
+	if err != nil {
+		return "", newHTTPError(http.StatusUnauthorized, "Invalid token")
+	}
+
+	// Firebase accounts and application users are linked by their mail
+	mail, _ := verified.Claims["email"].(string)
+	docs, err := services.FirebaseDb().GetClient().Collection("users").Where("mail", "==", mail).Limit(1).Documents(ctx).GetAll()
+	if err != nil {
+		return "", err
+	}
+	if len(docs) == 0 {
+		return "", newHTTPError(http.StatusUnauthorized, "Unknown user")
+	}
+	uid, _ := docs[0].Data()["UID"].(string)
+	return uid, nil
+}
+
+// requireProjectMember authenticates the request and checks that the user owns or collaborates on the project
+func requireProjectMember(r *http.Request, projectID string) (string, error) {
+	uid, err := authenticate(r)
+	if err != nil {
+		return "", err
+	}
+
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return "", newHTTPError(http.StatusNotFound, "Project not found")
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		return "", err
+	}
+	var projectData struct {
+		UID           string   `firestore:"UID"`
+		Collaborators []string `firestore:"Collaborators"`
+	}
+	if err := docSnap.DataTo(&projectData); err != nil {
+		return "", err
+	}
+
+	if projectData.UID == uid {
+		return uid, nil
+	}
+	for _, collaborator := range projectData.Collaborators {
+		if collaborator == uid {
+			return uid, nil
+		}
+	}
+	return "", newHTTPError(http.StatusForbidden, "Not a member of this project")
+}
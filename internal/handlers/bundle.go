@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"phaint/config"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+	"phaint/models"
+	"slices"
+	"sort"
+	"time"
+)
+
+type BundleHandler struct{}
+
+// bundleImportResult describes the project created from a bundle
+type bundleImportResult struct {
+	ProjectID   string `json:"pid"`
+	ProjectName string `json:"projectName"`
+	Canvases    int    `json:"canvases"`
+	Assets      int    `json:"assets"`
+	Comments    int    `json:"comments"`
+	// Members lists the usernames of the exported project, who get access only when they are invited
+	Members []string `json:"members"`
+}
+
+// bundleMembers lists the owner then the collaborators of a raw project document
+func bundleMembers(rawData map[string]interface{}) []services.BundleMember {
+	usernames := loadProjectMembers(rawData)
+	members := []services.BundleMember{}
+	if owner, ok := rawData["UID"].(string); ok && owner != "" {
+		members = append(members, services.BundleMember{UID: owner, Username: usernames[owner], Owner: true})
+	}
+	if collaborators, ok := rawData["Collaborators"].([]interface{}); ok {
+		for _, collaborator := range collaborators {
+			if uid, ok := collaborator.(string); ok && uid != "" {
+				members = append(members, services.BundleMember{UID: uid, Username: usernames[uid]})
+			}
+		}
+	}
+	return members
+}
+
+// exportBundle serves a project with its canvases, assets, comments and members as a .phaint archive
+func (b *BundleHandler) exportBundle(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+		return
+	}
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	rawData := docSnap.Data()
+	workBoard, err := projectWorkBoard(projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	bundle := services.Bundle{AssetData: make(map[string][]byte)}
+	bundle.Manifest.ExportedAt = time.Now().UTC()
+	bundle.Manifest.Project.Name, _ = rawData["ProjectName"].(string)
+	bundle.Manifest.Project.CreationDate, _ = rawData["CreationDate"].(string)
+	bundle.Manifest.Members = bundleMembers(rawData)
+	bundle.Manifest.StyleLibrary = loadStyleLibrary(rawData)
+
+	assetDocs, err := docRef.Collection(assetsCollection).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, doc := range assetDocs {
+		var asset models.Asset
+		if err := doc.DataTo(&asset); err != nil {
+			log.Println("Error decoding asset:", err)
+			continue
+		}
+		data, err := services.Blobs().Get(ctx, services.AssetKey(projectID, asset.ID))
+		if err != nil {
+			log.Printf("Asset %s of project %s left out of its bundle: %v", asset.ID, projectID, err)
+			continue
+		}
+		bundle.Manifest.Assets = append(bundle.Manifest.Assets, asset)
+		bundle.AssetData[asset.ID] = data
+	}
+
+	commentDocs, err := docRef.Collection(commentsCollection).Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, doc := range commentDocs {
+		var comment models.Comment
+		if err := doc.DataTo(&comment); err != nil {
+			log.Println("Error decoding comment:", err)
+			continue
+		}
+		bundle.Comments = append(bundle.Comments, comment)
+	}
+	sort.Slice(bundle.Comments, func(i, j int) bool {
+		return bundle.Comments[i].CreatedAt.Before(bundle.Comments[j].CreatedAt)
+	})
+
+	data, err := workBoard.ExportBundle(bundle)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeExport(w, "application/zip", projectID+services.BundleExtension, data)
+}
+
+// importBundle creates a project owned by the caller out of an uploaded .phaint archive
+func (b *BundleHandler) importBundle(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	uid, err := authenticate(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	maxSize := config.Storage().MaxBundleSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Bundle is too large"))
+			return
+		}
+		writeError(w, newHTTPError(http.StatusBadRequest, `A multipart "file" field is required`))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Bundle is too large"))
+		return
+	}
+
+	bundle, err := services.ReadBundle(data, maxSize)
+	switch {
+	case errors.Is(err, services.ErrBundleTooLarge):
+		writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, err.Error()))
+		return
+	case err != nil:
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	projectID := utils.GenerateRandomString(32)
+	// generated IDs are checked for duplicates as the generator is seeded with the clock
+	used := make(map[string]bool)
+	bundle.Remap(projectID, func() string {
+		id := utils.GenerateRandomString(20)
+		for used[id] {
+			id = utils.GenerateRandomString(20)
+		}
+		used[id] = true
+		return id
+	}, uid)
+
+	result := bundleImportResult{
+		ProjectID:   projectID,
+		ProjectName: bundle.Manifest.Project.Name,
+		Canvases:    len(bundle.Canvases),
+		Comments:    len(bundle.Comments),
+		Members:     []string{},
+	}
+	for _, member := range bundle.Manifest.Members {
+		if member.Username != "" && !slices.Contains(result.Members, member.Username) {
+			result.Members = append(result.Members, member.Username)
+		}
+	}
+	if name := r.FormValue("name"); name != "" {
+		result.ProjectName = name
+	}
+
+	// the content is stored first so that the project never references missing assets
+	blobs := services.Blobs()
+	assets := []models.Asset{}
+	for _, asset := range bundle.Manifest.Assets {
+		content, found := bundle.AssetData[asset.ID]
+		if !found {
+			continue
+		}
+		contentType, err := services.SniffAssetType(content)
+		if err != nil {
+			log.Printf("Asset %s of an imported bundle left out: %v", asset.Name, err)
+			continue
+		}
+		thumbnail, width, height, err := services.ImageThumbnail(content, services.AssetThumbnailSize)
+		if err != nil {
+			log.Printf("Asset %s of an imported bundle left out: %v", asset.Name, err)
+			continue
+		}
+		asset.ContentType, asset.Size, asset.Width, asset.Height = contentType, int64(len(content)), width, height
+		if err := blobs.Put(ctx, services.AssetKey(projectID, asset.ID), content, contentType); err != nil {
+			writeError(w, err)
+			return
+		}
+		if err := blobs.Put(ctx, services.AssetThumbnailKey(projectID, asset.ID), thumbnail, "image/png"); err != nil {
+			writeError(w, err)
+			return
+		}
+		assets = append(assets, asset)
+	}
+	result.Assets = len(assets)
+
+	docRef, _, err := services.FirebaseDb().GetClient().Collection("projects").Add(ctx, map[string]interface{}{
+		"UID":             uid,
+		"PID":             projectID,
+		"ProjectName":     result.ProjectName,
+		"CreationDate":    bundle.Manifest.Project.CreationDate,
+		"Collaborators":   []string{},
+		canvasOrderField:  []string{},
+		styleLibraryField: bundle.Manifest.StyleLibrary,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, asset := range assets {
+		if _, err := docRef.Collection(assetsCollection).Doc(asset.ID).Set(ctx, asset); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	for _, comment := range bundle.Comments {
+		if _, err := docRef.Collection(commentsCollection).Doc(comment.ID).Set(ctx, comment); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	workBoard := services.NewCanvasService()
+	for _, canvas := range bundle.Canvases {
+		workBoard.AddOrUpdateCanvas(canvas)
+	}
+	if err := saveProjectCanvases(projectID, workBoard); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, result)
+}
+
+func (b *BundleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.PathValue("pid") != "":
+		b.exportBundle(w, r)
+	case r.Method == http.MethodPost && r.PathValue("pid") == "":
+		b.importBundle(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"phaint/internal/services"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	canvasesCollection = "canvases"
+	chunksCollection   = "chunks"
+	// canvasOrderField lists the canvas IDs of a project document in the order of its pages
+	canvasOrderField = "CanvasOrder"
+	// legacyCanvasesField held every canvas inside the project document before they had their own
+	legacyCanvasesField = "CanvasesData"
+	// migrationAttempts bounds the retries of a migration racing with updates of the project document
+	migrationAttempts = 5
+)
+
+// canvasMigrations runs the migrations of projects one at a time, so that a project is migrated once
+var canvasMigrations sync.Mutex
+
+// storedCanvas is the document of a canvas. Its elements are inline, or split into the chunk documents
+// named after the revision when they are too large for a single document
+type storedCanvas struct {
+	ID         string              `firestore:"id"`
+	VectorData services.VectorData `firestore:"vectorData"`
+	Revision   string              `firestore:"revision,omitempty"`
+	Chunks     int                 `firestore:"chunks"`
+}
+
+func chunkDocumentID(revision string, index int) string {
+	return fmt.Sprintf("%s-%d", revision, index)
+}
+
+// saveCanvas writes the document of a canvas, then deletes the chunks it no longer points to
+func saveCanvas(ctx context.Context, canvasesRef *firestore.CollectionRef, canvas services.Canvas) error {
+	chunks, err := services.SplitElements(canvas.VectorData.Elements, services.CanvasChunkSize)
+	if err != nil {
+		return err
+	}
+	docRef := canvasesRef.Doc(services.CanvasDocumentID(canvas.ID))
+	stored := storedCanvas{ID: canvas.ID, VectorData: canvas.VectorData}
+	if stored.VectorData.Elements == nil {
+		stored.VectorData.Elements = []services.VectorElement{}
+	}
+	if len(chunks) > 1 {
+		// chunks get a new revision so that readers never mix elements of two saves
+		stored.Revision = strconv.FormatInt(time.Now().UnixNano(), 36)
+		stored.Chunks = len(chunks)
+		stored.VectorData.Elements = []services.VectorElement{}
+		for i, chunk := range chunks {
+			if _, err := docRef.Collection(chunksCollection).Doc(chunkDocumentID(stored.Revision, i)).Set(ctx, map[string]interface{}{"elements": chunk}); err != nil {
+				return err
+			}
+		}
+	}
+	if _, err := docRef.Set(ctx, stored); err != nil {
+		return err
+	}
+	return deleteChunks(ctx, docRef, stored.Revision)
+}
+
+// deleteChunks deletes the chunks of a canvas document but the ones of revision
+func deleteChunks(ctx context.Context, docRef *firestore.DocumentRef, revision string) error {
+	refs, err := docRef.Collection(chunksCollection).DocumentRefs(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if revision != "" && strings.HasPrefix(ref.ID, revision+"-") {
+			continue
+		}
+		if _, err := ref.Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveCanvasChanges writes the modified canvases of a project and deletes its removed ones
+func saveCanvasChanges(ctx context.Context, projectRef *firestore.DocumentRef, changes services.CanvasChanges) error {
+	canvasesRef := projectRef.Collection(canvasesCollection)
+	for _, canvas := range changes.Canvases {
+		if err := saveCanvas(ctx, canvasesRef, canvas); err != nil {
+			return fmt.Errorf("saving canvas %s: %w", canvas.ID, err)
+		}
+	}
+	for _, id := range changes.Removed {
+		docRef := canvasesRef.Doc(services.CanvasDocumentID(id))
+		if err := deleteChunks(ctx, docRef, ""); err != nil {
+			return fmt.Errorf("deleting canvas %s: %w", id, err)
+		}
+		if _, err := docRef.Delete(ctx); err != nil {
+			return fmt.Errorf("deleting canvas %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// saveProjectCanvases stores the canvases of a project changed since they were last saved, along with its
+// order and listed fields. Nothing is written when nothing changed
+func saveProjectCanvases(projectID string, workBoard *services.CanvasService) error {
+	ctx := context.Background()
+	changes := workBoard.TakeChanges()
+	if changes.Empty() {
+		return nil
+	}
+	docRef, err := GetProjectById(projectID)
+	if err == nil {
+		err = saveCanvasChanges(ctx, docRef, changes)
+	}
+	if err != nil {
+		workBoard.RequeueChanges(changes)
+		return err
+	}
+
+	updates := projectSummaryUpdates(projectID, workBoard)
+	if changes.Order != nil {
+		updates = append(updates, firestore.Update{Path: canvasOrderField, Value: changes.Order})
+	}
+	if _, err := docRef.Update(ctx, updates); err != nil {
+		workBoard.RequeueChanges(services.CanvasChanges{Order: changes.Order})
+		return err
+	}
+	return nil
+}
+
+// migrateCanvasesData moves the canvases of a project out of its document into their own documents, and
+// returns their order. Projects already migrated are left as they are
+func migrateCanvasesData(ctx context.Context, docRef *firestore.DocumentRef) ([]string, error) {
+	canvasMigrations.Lock()
+	defer canvasMigrations.Unlock()
+
+	for attempt := 1; ; attempt++ {
+		order, err := migrateCanvasesDataOnce(ctx, docRef)
+		// the document was updated meanwhile, it is read again until the legacy field is gone
+		if status.Code(err) != codes.FailedPrecondition || attempt == migrationAttempts {
+			return order, err
+		}
+	}
+}
+
+// migrateCanvasesDataOnce runs a migration from a fresh read of the project document. Canvases which already
+// have a document are kept, as they were migrated or saved since, the legacy field only being removed when the
+// project document did not change meanwhile
+func migrateCanvasesDataOnce(ctx context.Context, docRef *firestore.DocumentRef) ([]string, error) {
+	// the document is read again as another load may have migrated it meanwhile
+	docSnap, err := docRef.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rawData := docSnap.Data()
+	if _, legacy := rawData[legacyCanvasesField]; !legacy {
+		return stringList(rawData[canvasOrderField]), nil
+	}
+
+	workBoard := services.NewCanvasService()
+	if err := loadCanvasesData(workBoard, rawData); err != nil {
+		return nil, err
+	}
+	changes := workBoard.TakeChanges()
+	refs := make([]*firestore.DocumentRef, len(changes.Canvases))
+	for i, canvas := range changes.Canvases {
+		refs[i] = docRef.Collection(canvasesCollection).Doc(services.CanvasDocumentID(canvas.ID))
+	}
+	stored := []*firestore.DocumentSnapshot{}
+	if len(refs) > 0 {
+		if stored, err = services.FirebaseDb().GetClient().GetAll(ctx, refs); err != nil {
+			return nil, err
+		}
+	}
+	missing := changes.Canvases[:0]
+	for i, canvas := range changes.Canvases {
+		if !stored[i].Exists() {
+			missing = append(missing, canvas)
+		}
+	}
+	changes.Canvases = missing
+	if err := saveCanvasChanges(ctx, docRef, changes); err != nil {
+		return nil, err
+	}
+
+	order := workBoard.ListCanvasIDs()
+	_, err = docRef.Update(ctx, []firestore.Update{
+		{Path: canvasOrderField, Value: order},
+		{Path: legacyCanvasesField, Value: firestore.Delete},
+	}, firestore.LastUpdateTime(docSnap.UpdateTime))
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("Moved %d canvases of project %s to their own documents", len(missing), docRef.ID)
+	return order, nil
+}
+
+// loadProjectCanvases fills a canvas service with the canvases of a project document, migrating them first
+// when they are still inside it. Every canvas is read up front, chunks included, since the hub serves the
+// whole workboard to clients as they connect; the chunks are only read for the canvases split into some
+func loadProjectCanvases(ctx context.Context, docSnap *firestore.DocumentSnapshot, workBoard *services.CanvasService) error {
+	rawData := docSnap.Data()
+	order := stringList(rawData[canvasOrderField])
+	if _, legacy := rawData[legacyCanvasesField]; legacy {
+		migrated, err := migrateCanvasesData(ctx, docSnap.Ref)
+		if err != nil {
+			return fmt.Errorf("migrating canvases: %w", err)
+		}
+		order = migrated
+	}
+
+	docs, err := docSnap.Ref.Collection(canvasesCollection).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	canvases := make(map[string]map[string]interface{}, len(docs))
+	unlisted := []string{}
+	for _, doc := range docs {
+		data := doc.Data()
+		id, _ := data["id"].(string)
+		if id == "" {
+			log.Printf("Canvas document %s has no id", doc.Ref.Path)
+			continue
+		}
+		if chunks, _ := data["chunks"].(int64); chunks > 0 {
+			if err := loadChunks(ctx, doc.Ref, data, int(chunks)); err != nil {
+				log.Printf("Error loading the elements of canvas %s: %v", id, err)
+				continue
+			}
+		}
+		canvases[id] = data
+		if !slices.Contains(order, id) {
+			unlisted = append(unlisted, id)
+		}
+	}
+
+	// canvases saved without their order, as when a save was interrupted, end the project
+	sort.Strings(unlisted)
+	for _, id := range append(order, unlisted...) {
+		if data, found := canvases[id]; found {
+			loadCanvas(workBoard, data)
+			delete(canvases, id)
+		}
+	}
+	return nil
+}
+
+// loadChunks puts the elements of the chunk documents of a canvas back into its data
+func loadChunks(ctx context.Context, docRef *firestore.DocumentRef, data map[string]interface{}, count int) error {
+	revision, _ := data["revision"].(string)
+	refs := make([]*firestore.DocumentRef, count)
+	for i := range refs {
+		refs[i] = docRef.Collection(chunksCollection).Doc(chunkDocumentID(revision, i))
+	}
+	chunks, err := services.FirebaseDb().GetClient().GetAll(ctx, refs)
+	if err != nil {
+		return err
+	}
+	elements := []interface{}{}
+	for _, chunk := range chunks {
+		if !chunk.Exists() {
+			return fmt.Errorf("chunk %s is missing", chunk.Ref.ID)
+		}
+		part, _ := chunk.Data()["elements"].([]interface{})
+		elements = append(elements, part...)
+	}
+	vectorData, ok := data["vectorData"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("canvas has no vectorData")
+	}
+	vectorData["elements"] = elements
+	return nil
+}
+
+// stringList reads a list of strings of a raw document
+func stringList(value interface{}) []string {
+	values, _ := value.([]interface{})
+	list := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+	"phaint/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+const (
+	chatCollection      = "chat"
+	chatDefaultPageSize = 50
+	chatMaxPageSize     = 100
+)
+
+type ChatHandler struct{}
+
+type chatMessageRequest struct {
+	Text string `json:"text"`
+}
+
+type chatTypingRequest struct {
+	Typing bool `json:"typing"`
+}
+
+// getChatHistory returns a page of chat messages in chronological order, older pages are reached with ?before=<messageId>
+func (c *ChatHandler) getChatHistory(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	limit := chatDefaultPageSize
+	if rawLimit := r.URL.Query().Get("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, chatMaxPageSize)
+	}
+
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	}
+
+	query := docRef.Collection(chatCollection).OrderBy("CreatedAt", firestore.Desc)
+	if before := r.URL.Query().Get("before"); before != "" {
+		cursor, err := docRef.Collection(chatCollection).Doc(before).Get(ctx)
+		if err != nil {
+			http.Error(w, "Unknown message cursor", http.StatusBadRequest)
+			return
+		}
+		query = query.StartAfter(cursor)
+	}
+
+	docs, err := query.Limit(limit).Documents(ctx).GetAll()
+	if err != nil {
+		log.Println("Error querying chat history:", err)
+		http.Error(w, "Error loading chat history", http.StatusInternalServerError)
+		return
+	}
+
+	messages := make([]models.ChatMessage, len(docs))
+	for i, doc := range docs {
+		// documents come newest first, the page is returned oldest first
+		if err := doc.DataTo(&messages[len(docs)-1-i]); err != nil {
+			log.Println("Error decoding chat message:", err)
+		}
+	}
+
+	nextBefore := ""
+	if len(docs) == limit {
+		nextBefore = docs[len(docs)-1].Ref.ID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"messages":   messages,
+		"nextBefore": nextBefore,
+	})
+}
+
+func (c *ChatHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet:
+		c.getChatHistory(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func saveChatMessage(message models.ChatMessage) error {
+	docRef, err := GetProjectById(message.ProjectID)
+	if err != nil {
+		return err
+	}
+	_, err = docRef.Collection(chatCollection).Doc(message.ID).Set(context.Background(), message)
+	return err
+}
+
+// loadProjectMembers returns the usernames of the owner and collaborators of a project by UID
+func loadProjectMembers(rawData map[string]interface{}) map[string]string {
+	members := make(map[string]string)
+	uids := []string{}
+	if ownerID, ok := rawData["UID"].(string); ok && ownerID != "" {
+		uids = append(uids, ownerID)
+	}
+	if collaborators, ok := rawData["Collaborators"].([]interface{}); ok {
+		for _, collaborator := range collaborators {
+			if uid, ok := collaborator.(string); ok && uid != "" {
+				uids = append(uids, uid)
+			}
+		}
+	}
+	if len(uids) == 0 {
+		return members
+	}
+
+	client := services.FirebaseDb().GetClient()
+	ctx := context.Background()
+	// Firestore limits "in" filters to 30 values
+	for start := 0; start < len(uids); start += 30 {
+		end := min(start+30, len(uids))
+		docs, err := client.Collection("users").Where("UID", "in", uids[start:end]).Documents(ctx).GetAll()
+		if err != nil {
+			log.Println("Error loading project members:", err)
+			continue
+		}
+		for _, doc := range docs {
+			uid, _ := doc.Data()["UID"].(string)
+			username, _ := doc.Data()["username"].(string)
+			members[uid] = username
+		}
+	}
+	return members
+}
+
+// reloadHubMembers refreshes the members of the live hub of a project, if any, after its collaborators changed
+func reloadHubMembers(projectID string) {
+	hub, live := liveHub(projectID)
+	if !live {
+		return
+	}
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		log.Println("Error reloading project members:", err)
+		return
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		log.Println("Error reloading project members:", err)
+		return
+	}
+	members := loadProjectMembers(docSnap.Data())
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.members = members
+}
+
+// resolveMentions maps mentioned usernames to the UIDs of project members
+func (h *Hub) resolveMentions(usernames []string) []string {
+	uids := []string{}
+	for _, username := range usernames {
+		for uid, memberName := range h.members {
+			if strings.EqualFold(memberName, username) {
+				uids = append(uids, uid)
+				break
+			}
+		}
+	}
+	return uids
+}
+
+// handleChat persists chat messages and relays typing indicators
+func (h *Hub) handleChat(msg Message) bool {
+	presence, ok := h.sessions[msg.SessionID]
+	if !ok {
+		return false
+	}
+
+	switch msg.Subtype {
+	case "message":
+		var request chatMessageRequest
+		if err := decodeMessageData(msg, &request); err != nil {
+			h.sendError(msg.SessionID, "invalid chat message")
+			return false
+		}
+		if err := models.ValidateChatText(request.Text); err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
+		}
+		// messages are stored under the username of the member, not the one the connection gave
+		username, member := h.members[presence.UserID]
+		if !member {
+			h.sendError(msg.SessionID, "only project members can chat")
+			return false
+		}
+		message := models.ChatMessage{
+			ID:        utils.GenerateRandomString(20),
+			ProjectID: h.projectID,
+			UserID:    presence.UserID,
+			Username:  username,
+			Text:      request.Text,
+			Mentions:  h.resolveMentions(models.ParseMentions(request.Text)),
+			CreatedAt: time.Now().UTC(),
+		}
+		// the hub loop must not wait for Firestore
+		go func() {
+			if err := saveChatMessage(message); err != nil {
+				log.Println("Error saving chat message:", err)
+			}
+		}()
+		h.relayMessage(Message{Type: "chat", Subtype: "message", Data: message, UserID: presence.UserID, SessionID: presence.SessionID})
+	case "typing":
+		var request chatTypingRequest
+		if err := decodeMessageData(msg, &request); err != nil {
+			h.sendError(msg.SessionID, "invalid typing indicator")
+			return false
+		}
+		h.relayMessage(Message{
+			Type:      "chat",
+			Subtype:   "typing",
+			Data:      map[string]interface{}{"typing": request.Typing, "username": presence.Username},
+			UserID:    presence.UserID,
+			SessionID: presence.SessionID,
+		})
+	default:
+		h.sendError(msg.SessionID, "unknown chat subtype: "+msg.Subtype)
+	}
+	return false
+}
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+	"phaint/models"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const commentsCollection = "comments"
+
+type CommentHandler struct{}
+
+type commentRequest struct {
+	// UID is the authenticated member sending the request, never read from its body
+	UID    string               `json:"-"`
+	Text   string               `json:"text"`
+	Anchor models.CommentAnchor `json:"anchor"`
+}
+
+// decodeCommentRequest authenticates a project member and reads the body of the request
+func decodeCommentRequest(r *http.Request) (commentRequest, error) {
+	uid, err := requireProjectMember(r, r.PathValue("pid"))
+	if err != nil {
+		return commentRequest{}, err
+	}
+	var request commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return commentRequest{}, newHTTPError(http.StatusBadRequest, "Invalid request body")
+	}
+	request.UID = uid
+	return request, nil
+}
+
+func commentsRef(projectID string) (*firestore.CollectionRef, error) {
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return nil, newHTTPError(http.StatusNotFound, "Project not found")
+	}
+	return docRef.Collection(commentsCollection), nil
+}
+
+// updateComment applies a change to a comment thread inside a transaction and returns the updated thread
+func updateComment(projectID, commentID string, change func(comment *models.Comment) error) (models.Comment, error) {
+	ref, err := commentsRef(projectID)
+	if err != nil {
+		return models.Comment{}, err
+	}
+	docRef := ref.Doc(commentID)
+
+	var comment models.Comment
+	err = services.FirebaseDb().GetClient().RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return newHTTPError(http.StatusNotFound, "Comment not found")
+		}
+		if err != nil {
+			return err
+		}
+		comment = models.Comment{}
+		if err := docSnap.DataTo(&comment); err != nil {
+			return err
+		}
+		if err := change(&comment); err != nil {
+			return err
+		}
+		return tx.Set(docRef, comment)
+	})
+	return comment, err
+}
+
+// followAnchor places the anchor of a thread on the current position of its element
+func followAnchor(workBoard *services.CanvasService, comment *models.Comment) bool {
+	origin, exists := workBoard.FindElementOrigin(comment.Anchor.CanvasID, comment.Anchor.ElementID)
+	return comment.Anchor.Follow(origin.X, origin.Y, exists)
+}
+
+func (c *CommentHandler) getComments(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+	ref, err := commentsRef(projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	query := ref.Query
+	if canvasID := r.URL.Query().Get("canvasId"); canvasID != "" {
+		query = ref.Where("Anchor.CanvasID", "==", canvasID)
+	}
+	docs, err := query.Documents(ctx).GetAll()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	workBoard, err := projectWorkBoard(projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	comments := make([]models.Comment, 0, len(docs))
+	for _, doc := range docs {
+		var comment models.Comment
+		if err := doc.DataTo(&comment); err != nil {
+			log.Println("Error decoding comment:", err)
+			continue
+		}
+		if followAnchor(workBoard, &comment) {
+			// remember the last known position so orphaned threads stay where their element was
+			go func(docRef *firestore.DocumentRef, anchor models.CommentAnchor) {
+				if _, err := docRef.Update(context.Background(), []firestore.Update{{Path: "Anchor", Value: anchor}}); err != nil {
+					log.Println("Error updating comment anchor:", err)
+				}
+			}(doc.Ref, comment.Anchor)
+		}
+		comments = append(comments, comment)
+	}
+	sort.Slice(comments, func(i, j int) bool {
+		return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+	})
+
+	writeJSON(w, http.StatusOK, comments)
+}
+
+func (c *CommentHandler) createComment(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("pid")
+
+	request, err := decodeCommentRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := models.ValidateCommentText(request.Text); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	workBoard, err := projectWorkBoard(projectID)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+		return
+	}
+	anchor := request.Anchor
+	if workBoard.GetCanvas(anchor.CanvasID) == nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "Unknown canvas"))
+		return
+	}
+	// a comment dropped on an element follows the topmost one
+	if anchor.ElementID == "" {
+		if hits := workBoard.HitTest(anchor.CanvasID, services.Point{X: anchor.X, Y: anchor.Y}, 0); len(hits) > 0 {
+			anchor.ElementID = hits[0].ElementID
+		}
+	}
+	if anchor.ElementID != "" {
+		origin, exists := workBoard.FindElementOrigin(anchor.CanvasID, anchor.ElementID)
+		if !exists {
+			writeError(w, newHTTPError(http.StatusBadRequest, "Unknown element"))
+			return
+		}
+		anchor.Attach(origin.X, origin.Y)
+	}
+
+	now := time.Now().UTC()
+	comment := models.Comment{
+		ID:        utils.GenerateRandomString(20),
+		ProjectID: projectID,
+		UserID:    request.UID,
+		Text:      request.Text,
+		Anchor:    anchor,
+		Replies:   []models.CommentReply{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ref, err := commentsRef(projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if _, err := ref.Doc(comment.ID).Set(context.Background(), comment); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	publishComment(projectID, "created", comment, request.UID)
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+func (c *CommentHandler) editComment(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeCommentRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := models.ValidateCommentText(request.Text); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.changeComment(w, r, request.UID, func(comment *models.Comment) error {
+		if comment.UserID != request.UID {
+			return newHTTPError(http.StatusForbidden, "Only the author can edit a comment")
+		}
+		comment.Text = request.Text
+		comment.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+func (c *CommentHandler) resolveComment(w http.ResponseWriter, r *http.Request, resolved bool) {
+	uid, err := requireProjectMember(r, r.PathValue("pid"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c.changeComment(w, r, uid, func(comment *models.Comment) error {
+		if comment.Resolved == resolved {
+			return newHTTPError(http.StatusConflict, "Comment is already in the requested state")
+		}
+		if resolved {
+			comment.Resolve(uid, time.Now().UTC())
+		} else {
+			comment.Reopen(time.Now().UTC())
+		}
+		return nil
+	})
+}
+
+func (c *CommentHandler) addReply(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeCommentRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := models.ValidateCommentText(request.Text); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.changeComment(w, r, request.UID, func(comment *models.Comment) error {
+		now := time.Now().UTC()
+		comment.Replies = append(comment.Replies, models.CommentReply{
+			ID:        utils.GenerateRandomString(20),
+			UserID:    request.UID,
+			Text:      request.Text,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		comment.UpdatedAt = now
+		return nil
+	})
+}
+
+func (c *CommentHandler) editReply(w http.ResponseWriter, r *http.Request) {
+	request, err := decodeCommentRequest(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := models.ValidateCommentText(request.Text); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	c.changeComment(w, r, request.UID, func(comment *models.Comment) error {
+		i := comment.FindReply(r.PathValue("rid"))
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Reply not found")
+		}
+		if comment.Replies[i].UserID != request.UID {
+			return newHTTPError(http.StatusForbidden, "Only the author can edit a reply")
+		}
+		now := time.Now().UTC()
+		comment.Replies[i].Text = request.Text
+		comment.Replies[i].UpdatedAt = now
+		comment.UpdatedAt = now
+		return nil
+	})
+}
+
+func (c *CommentHandler) deleteReply(w http.ResponseWriter, r *http.Request) {
+	uid, err := requireProjectMember(r, r.PathValue("pid"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	c.changeComment(w, r, uid, func(comment *models.Comment) error {
+		i := comment.FindReply(r.PathValue("rid"))
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Reply not found")
+		}
+		if comment.Replies[i].UserID != uid {
+			return newHTTPError(http.StatusForbidden, "Only the author can delete a reply")
+		}
+		comment.Replies = append(comment.Replies[:i], comment.Replies[i+1:]...)
+		comment.UpdatedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// changeComment runs a thread update and reports the new thread to the caller and to the live project
+func (c *CommentHandler) changeComment(w http.ResponseWriter, r *http.Request, uid string, change func(comment *models.Comment) error) {
+	projectID := r.PathValue("pid")
+	comment, err := updateComment(projectID, r.PathValue("cid"), change)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	publishComment(projectID, "updated", comment, uid)
+	writeJSON(w, http.StatusOK, comment)
+}
+
+func (c *CommentHandler) deleteComment(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+	projectID := r.PathValue("pid")
+	commentID := r.PathValue("cid")
+
+	uid, err := requireProjectMember(r, projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	ref, err := commentsRef(projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	docSnap, err := ref.Doc(commentID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		writeError(w, newHTTPError(http.StatusNotFound, "Comment not found"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var comment models.Comment
+	if err := docSnap.DataTo(&comment); err != nil {
+		writeError(w, err)
+		return
+	}
+	// the project owner can moderate every thread
+	if comment.UserID != uid && projectOwner(projectID) != uid {
+		writeError(w, newHTTPError(http.StatusForbidden, "Only the author can delete a comment"))
+		return
+	}
+	if _, err := docSnap.Ref.Delete(ctx); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	publishComment(projectID, "deleted", map[string]string{"id": commentID}, uid)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// projectOwner returns the UID of the owner of a project, empty when it cannot be found
+func projectOwner(projectID string) string {
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return ""
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		return ""
+	}
+	owner, _ := docSnap.Data()["UID"].(string)
+	return owner
+}
+
+func publishComment(projectID string, subtype string, data interface{}, uid string) {
+	publishToProject(projectID, Message{
+		Type:      "comment",
+		Subtype:   subtype,
+		Data:      data,
+		UserID:    uid,
+		ProjectID: projectID,
+	})
+}
+
+func (c *CommentHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	commentID := r.PathValue("cid")
+	action := r.PathValue("action")
+	replyID := r.PathValue("rid")
+
+	switch {
+	case commentID == "" && r.Method == http.MethodGet:
+		c.getComments(w, r)
+	case commentID == "" && r.Method == http.MethodPost:
+		c.createComment(w, r)
+	case replyID != "" && r.Method == http.MethodPatch:
+		c.editReply(w, r)
+	case replyID != "" && r.Method == http.MethodDelete:
+		c.deleteReply(w, r)
+	case replyID != "":
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	case action == "resolve" && r.Method == http.MethodPost:
+		c.resolveComment(w, r, true)
+	case action == "reopen" && r.Method == http.MethodPost:
+		c.resolveComment(w, r, false)
+	case action == "replies" && r.Method == http.MethodPost:
+		c.addReply(w, r)
+	case action != "":
+		http.NotFound(w, r)
+	case r.Method == http.MethodPatch:
+		c.editComment(w, r)
+	case r.Method == http.MethodDelete:
+		c.deleteComment(w, r)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"phaint/internal/services"
+	"strconv"
+)
+
+// cssPixelsPerInch converts export resolutions to scales, a canvas unit being a CSS pixel
+const cssPixelsPerInch = 96
+
+type ExportHandler struct{}
+
+// assetDataURIs embeds the images of a project in its exports, loading each asset once
+func assetDataURIs(projectID string) func(assetId string) (string, bool) {
+	cache := make(map[string]string)
+	return func(assetId string) (string, bool) {
+		if uri, loaded := cache[assetId]; loaded {
+			return uri, uri != ""
+		}
+		data, err := services.Blobs().Get(context.Background(), services.AssetKey(projectID, assetId))
+		if err != nil {
+			cache[assetId] = ""
+			return "", false
+		}
+		contentType, err := services.SniffAssetType(data)
+		if err != nil {
+			cache[assetId] = ""
+			return "", false
+		}
+		cache[assetId] = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+		return cache[assetId], true
+	}
+}
+
+// assetImages decodes the images of a project for raster exports, loading each asset once
+func assetImages(projectID string) func(assetId string) (image.Image, bool) {
+	cache := make(map[string]image.Image)
+	return func(assetId string) (image.Image, bool) {
+		if img, loaded := cache[assetId]; loaded {
+			return img, img != nil
+		}
+		cache[assetId] = nil
+		data, err := services.Blobs().Get(context.Background(), services.AssetKey(projectID, assetId))
+		if err != nil {
+			return nil, false
+		}
+		img, err := services.DecodeAssetImage(data)
+		if err != nil {
+			return nil, false
+		}
+		cache[assetId] = img
+		return img, true
+	}
+}
+
+// rasterOptions reads the resolution of a raster export from ?scale= or ?dpi=, and ?transparent=true
+func rasterOptions(r *http.Request) (services.RasterOptions, error) {
+	options := services.RasterOptions{Scale: 1, Image: assetImages(r.PathValue("pid"))}
+	query := r.URL.Query()
+	if rawScale := query.Get("scale"); rawScale != "" {
+		scale, err := strconv.ParseFloat(rawScale, 64)
+		if err != nil || scale <= 0 {
+			return options, newHTTPError(http.StatusBadRequest, "Invalid scale")
+		}
+		options.Scale = scale
+	}
+	if rawDPI := query.Get("dpi"); rawDPI != "" {
+		dpi, err := strconv.ParseFloat(rawDPI, 64)
+		if err != nil || dpi <= 0 {
+			return options, newHTTPError(http.StatusBadRequest, "Invalid dpi")
+		}
+		options.Scale = dpi / cssPixelsPerInch
+	}
+	if rawTransparent := query.Get("transparent"); rawTransparent != "" {
+		transparent, err := strconv.ParseBool(rawTransparent)
+		if err != nil {
+			return options, newHTTPError(http.StatusBadRequest, "Invalid transparent flag")
+		}
+		options.Transparent = transparent
+	}
+	return options, nil
+}
+
+// rasterError tells clients asking for too many pixels to lower the resolution
+func rasterError(err error) error {
+	if errors.Is(err, services.ErrRasterTooLarge) {
+		return newHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return err
+}
+
+// exportCanvas serves a single canvas, as export.svg or export.png
+func (e *ExportHandler) exportCanvas(w http.ResponseWriter, r *http.Request, workBoard *services.CanvasService) {
+	projectID := r.PathValue("pid")
+	canvasID := r.PathValue("cid")
+
+	switch r.PathValue("file") {
+	case "export.svg":
+		data, exists := workBoard.ExportSVG(canvasID, services.SVGOptions{ImageHref: assetDataURIs(projectID)})
+		if !exists {
+			writeError(w, newHTTPError(http.StatusNotFound, "Canvas not found"))
+			return
+		}
+		writeExport(w, "image/svg+xml", fmt.Sprintf("%s.svg", canvasID), data)
+	case "export.png":
+		options, err := rasterOptions(r)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		data, exists, err := workBoard.ExportPNG(canvasID, options)
+		if !exists {
+			writeError(w, newHTTPError(http.StatusNotFound, "Canvas not found"))
+			return
+		}
+		if err != nil {
+			writeError(w, rasterError(err))
+			return
+		}
+		writeExport(w, "image/png", fmt.Sprintf("%s.png", canvasID), data)
+	default:
+		writeError(w, newHTTPError(http.StatusNotFound, "Unknown export format"))
+	}
+}
+
+// exportProject serves every canvas of a project in a zip archive, of SVG files or of PNG ones with ?format=png
+func (e *ExportHandler) exportProject(w http.ResponseWriter, r *http.Request, workBoard *services.CanvasService) {
+	projectID := r.PathValue("pid")
+	var data []byte
+	var err error
+
+	switch r.URL.Query().Get("format") {
+	case "", "svg":
+		options := services.SVGOptions{ImageHref: assetDataURIs(projectID)}
+		data, err = workBoard.ExportArchive("svg", func(canvasId string) ([]byte, bool) {
+			return workBoard.ExportSVG(canvasId, options)
+		})
+	case "png":
+		options, optionsErr := rasterOptions(r)
+		if optionsErr != nil {
+			writeError(w, optionsErr)
+			return
+		}
+		var renderErr error
+		data, err = workBoard.ExportArchive("png", func(canvasId string) ([]byte, bool) {
+			if renderErr != nil {
+				return nil, false
+			}
+			png, exists, err := workBoard.ExportPNG(canvasId, options)
+			if err != nil {
+				renderErr = err
+				return nil, false
+			}
+			return png, exists
+		})
+		if renderErr != nil {
+			err = rasterError(renderErr)
+		}
+	default:
+		err = newHTTPError(http.StatusBadRequest, "Unknown export format")
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeExport(w, "application/zip", fmt.Sprintf("%s.zip", projectID), data)
+}
+
+// projectName reads the name of a project for the title of its exports, its ID when it cannot be read
+func projectName(projectID string) string {
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return projectID
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		return projectID
+	}
+	if name, ok := docSnap.Data()["ProjectName"].(string); ok && name != "" {
+		return name
+	}
+	return projectID
+}
+
+// exportPDF serves every canvas of a project as the pages of a PDF document
+func (e *ExportHandler) exportPDF(w http.ResponseWriter, r *http.Request, workBoard *services.CanvasService) {
+	projectID := r.PathValue("pid")
+	data := workBoard.ExportPDF(services.PDFOptions{Title: projectName(projectID), Image: assetImages(projectID)})
+	writeExport(w, "application/pdf", fmt.Sprintf("%s.pdf", projectID), data)
+}
+
+func writeExport(w http.ResponseWriter, contentType string, filename string, data []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (e *ExportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	projectID := r.PathValue("pid")
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+	workBoard, err := projectWorkBoard(projectID)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+		return
+	}
+
+	if r.PathValue("cid") != "" {
+		e.exportCanvas(w, r, workBoard)
+		return
+	}
+	switch r.PathValue("file") {
+	case "export.zip":
+		e.exportProject(w, r, workBoard)
+	case "export.pdf":
+		e.exportPDF(w, r, workBoard)
+	default:
+		writeError(w, newHTTPError(http.StatusNotFound, "Unknown export format"))
+	}
+}
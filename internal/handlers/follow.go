@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+)
+
+// Viewport is the visible area of a canvas for a single session
+type Viewport struct {
+	CanvasId string  `json:"canvasId"`
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Width    float64 `json:"width"`
+	Height   float64 `json:"height"`
+	Zoom     float64 `json:"zoom"`
+}
+
+type followRequest struct {
+	UserID string `json:"userId"`
+}
+
+// decodeMessageData converts the generic data of a message into the given struct
+func decodeMessageData(msg Message, target interface{}) error {
+	jsonData, err := json.Marshal(msg.Data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(jsonData, target)
+}
+
+// handleViewport stores the viewport of the sending session, followers mirror it from the relayed message
+func (h *Hub) handleViewport(msg Message) {
+	presence, ok := h.sessions[msg.SessionID]
+	if !ok {
+		return
+	}
+	var viewport Viewport
+	if err := decodeMessageData(msg, &viewport); err != nil {
+		return
+	}
+	presence.Viewport = &viewport
+	h.viewports[presence.UserID] = &viewport
+}
+
+// handleFollow starts or stops following a user, the result is shared through users_state
+func (h *Hub) handleFollow(msg Message) bool {
+	presence, ok := h.sessions[msg.SessionID]
+	if !ok {
+		return false
+	}
+
+	switch msg.Subtype {
+	case "start":
+		var request followRequest
+		if err := decodeMessageData(msg, &request); err != nil || request.UserID == "" {
+			h.sendError(msg.SessionID, "follow requires a userId")
+			return false
+		}
+		if request.UserID == presence.UserID {
+			h.sendError(msg.SessionID, "cannot follow yourself")
+			return false
+		}
+		if !h.isUserConnected(request.UserID) {
+			h.sendError(msg.SessionID, "user is not connected to this project")
+			return false
+		}
+		presence.Following = request.UserID
+		// bring the follower to the current position of the followed user straight away
+		if viewport, ok := h.viewports[request.UserID]; ok {
+			h.sendToSession(msg.SessionID, Message{Type: "viewport", Data: viewport, UserID: request.UserID})
+		}
+	case "stop":
+		presence.Following = ""
+	default:
+		h.sendError(msg.SessionID, "unknown follow subtype: "+msg.Subtype)
+		return false
+	}
+
+	h.broadcastUsersState()
+	return false
+}
+
+// handlePresenter lets the project owner drive every other participant
+func (h *Hub) handlePresenter(msg Message) bool {
+	presence, ok := h.sessions[msg.SessionID]
+	if !ok {
+		return false
+	}
+
+	switch msg.Subtype {
+	case "start":
+		if h.ownerID == "" || presence.UserID != h.ownerID {
+			h.sendError(msg.SessionID, "only the project owner can present")
+			return false
+		}
+		if current, ok := h.sessions[h.presenter]; ok {
+			current.Presenter = false
+		}
+		h.presenter = msg.SessionID
+		presence.Presenter = true
+		h.summon(presence, "start")
+	case "summon":
+		if msg.SessionID != h.presenter {
+			h.sendError(msg.SessionID, "only the presenter can summon participants")
+			return false
+		}
+		h.summon(presence, "summon")
+	case "stop":
+		if msg.SessionID != h.presenter && presence.UserID != h.ownerID {
+			h.sendError(msg.SessionID, "only the presenter can stop presenting")
+			return false
+		}
+		h.stopPresenting()
+	default:
+		h.sendError(msg.SessionID, "unknown presenter subtype: "+msg.Subtype)
+		return false
+	}
+
+	h.broadcastUsersState()
+	return false
+}
+
+// summon makes every participant follow the presenter and jump to its viewport
+func (h *Hub) summon(presenter *UserPresence, subtype string) {
+	for _, participant := range h.sessions {
+		if participant.UserID != presenter.UserID {
+			participant.Following = presenter.UserID
+		}
+	}
+	h.relayMessage(Message{
+		Type:      "presenter",
+		Subtype:   subtype,
+		Data:      map[string]interface{}{"viewport": presenter.Viewport},
+		UserID:    presenter.UserID,
+		SessionID: presenter.SessionID,
+	})
+}
+
+func (h *Hub) stopPresenting() {
+	presenter, ok := h.sessions[h.presenter]
+	h.presenter = ""
+	if !ok {
+		return
+	}
+	presenter.Presenter = false
+	for _, participant := range h.sessions {
+		if participant.Following == presenter.UserID {
+			participant.Following = ""
+		}
+	}
+	h.relayMessage(Message{
+		Type:      "presenter",
+		Subtype:   "stop",
+		UserID:    presenter.UserID,
+		SessionID: presenter.SessionID,
+	})
+}
+
+// releaseFollowers ends presenting and following that depend on a closed session
+func (h *Hub) releaseFollowers(client *Client) {
+	presenting := client.sessionID == h.presenter
+	if presenting {
+		h.presenter = ""
+		h.relayMessage(Message{Type: "presenter", Subtype: "stop", UserID: client.userID, SessionID: client.sessionID})
+	}
+	if h.isUserConnected(client.userID) && !presenting {
+		return
+	}
+	if !h.isUserConnected(client.userID) {
+		delete(h.viewports, client.userID)
+	}
+	for _, participant := range h.sessions {
+		if participant.Following == client.userID {
+			participant.Following = ""
+		}
+	}
+}
+
+func (h *Hub) isUserConnected(userID string) bool {
+	for _, presence := range h.sessions {
+		if presence.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
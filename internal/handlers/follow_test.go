@@ -0,0 +1,84 @@
+package handlers
+
+import "testing"
+
+func TestOnlyTheOwnerPresents(t *testing.T) {
+	h := newTestHub()
+	h.ownerID = "owner"
+	connect(h, "owner", "s1", 16)
+	connect(h, "guest", "s2", 16)
+
+	for _, msg := range []Message{
+		{Type: "presenter", Subtype: "start", UserID: "guest", SessionID: "s2"},
+		{Type: "presenter", Subtype: "summon", UserID: "guest", SessionID: "s2"},
+	} {
+		h.handlePresenter(msg)
+		if h.presenter != "" || h.sessions["s2"].Presenter {
+			t.Fatalf("Expected a collaborator not to %s presenting", msg.Subtype)
+		}
+	}
+
+	h.handlePresenter(Message{Type: "presenter", Subtype: "start", UserID: "owner", SessionID: "s1"})
+	if h.presenter != "s1" || !h.sessions["s1"].Presenter {
+		t.Fatal("Expected the owner to present")
+	}
+	if h.sessions["s2"].Following != "owner" {
+		t.Error("Expected the participants to follow the presenter")
+	}
+
+	h.handlePresenter(Message{Type: "presenter", Subtype: "stop", UserID: "guest", SessionID: "s2"})
+	if h.presenter != "s1" {
+		t.Error("Expected a participant not to stop the presentation")
+	}
+}
+
+func TestOwnerlessProjectsHaveNoPresenter(t *testing.T) {
+	h := newTestHub()
+	connect(h, "", "s1", 16)
+
+	h.handlePresenter(Message{Type: "presenter", Subtype: "start", SessionID: "s1"})
+	if h.presenter != "" {
+		t.Error("Expected no presenter without a known owner")
+	}
+}
+
+func TestFollowersReleasedOnDisconnect(t *testing.T) {
+	h := newTestHub()
+	h.ownerID = "owner"
+	owner := connect(h, "owner", "s1", 16)
+	connect(h, "guest", "s2", 16)
+	h.handleViewport(Message{Type: "viewport", SessionID: "s1", Data: Viewport{CanvasId: "c1", Width: 10, Height: 10, Zoom: 1}})
+	h.handlePresenter(Message{Type: "presenter", Subtype: "start", UserID: "owner", SessionID: "s1"})
+
+	h.unregisterClient(owner)
+	if h.presenter != "" {
+		t.Error("Expected the presentation to end with its session")
+	}
+	if h.sessions["s2"].Following != "" {
+		t.Error("Expected the participants to stop following")
+	}
+	if _, kept := h.viewports["owner"]; kept {
+		t.Error("Expected the viewport of a gone user to be forgotten")
+	}
+}
+
+func TestFollowingSurvivesAnotherSessionOfTheUser(t *testing.T) {
+	h := newTestHub()
+	first := connect(h, "u1", "s1", 16)
+	second := connect(h, "u1", "s2", 16)
+	connect(h, "u2", "s3", 16)
+
+	h.handleFollow(Message{Type: "follow", Subtype: "start", UserID: "u2", SessionID: "s3", Data: followRequest{UserID: "u1"}})
+	if h.sessions["s3"].Following != "u1" {
+		t.Fatal("Expected u2 to follow u1")
+	}
+
+	h.unregisterClient(first)
+	if h.sessions["s3"].Following != "u1" {
+		t.Error("Expected the follower to stay while the user has another session")
+	}
+	h.unregisterClient(second)
+	if h.sessions["s3"].Following != "" {
+		t.Error("Expected the follower to be released once the user left")
+	}
+}
@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"phaint/config"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+)
+
+type ImportHandler struct{}
+
+// importResult tells the uploader what was imported and what was left out
+type importResult struct {
+	CanvasId    string   `json:"canvasId"`
+	Created     bool     `json:"created"`
+	Elements    int      `json:"elements"`
+	Unsupported []string `json:"unsupported"`
+}
+
+// importSVG adds the shapes of the uploaded "file" SVG document to a canvas, which is created when missing,
+// and sends the canvas to the connected clients
+func (i *ImportHandler) importSVG(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("pid")
+	canvasID := r.PathValue("cid")
+
+	uid, err := requireProjectMember(r, projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	maxSize := config.Storage().MaxAssetSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Document is too large"))
+			return
+		}
+		writeError(w, newHTTPError(http.StatusBadRequest, `A multipart "file" field is required`))
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if int64(len(data)) > maxSize {
+		writeError(w, newHTTPError(http.StatusRequestEntityTooLarge, "Document is too large"))
+		return
+	}
+
+	imported, err := services.ImportSVG(bytes.NewReader(data), utils.GenerateRandomString(12))
+	if errors.Is(err, services.ErrNotSVG) {
+		writeError(w, newHTTPError(http.StatusUnsupportedMediaType, err.Error()))
+		return
+	}
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+
+	result := importResult{CanvasId: canvasID, Elements: len(imported.Elements), Unsupported: imported.Unsupported}
+	if hub, live := liveHub(projectID); live {
+		// the hub lock orders the import with the operations of the connected clients
+		hub.mutex.Lock()
+		if hub.workBoard.LayerLocked(canvasID, "") {
+			hub.mutex.Unlock()
+			writeError(w, newHTTPError(http.StatusConflict, "The bottom layer of the canvas is locked"))
+			return
+		}
+		var canvas services.Canvas
+		canvas, result.Created = hub.workBoard.ImportCanvas(canvasID, imported)
+		hub.relayMessage(Message{
+			Type:      "operation",
+			Subtype:   "add",
+			Data:      canvas,
+			UserID:    uid,
+			ProjectID: projectID,
+		})
+		hub.mutex.Unlock()
+		err = hub.projectHandler.updateProjectCanvasesData(hub)
+	} else {
+		var workBoard *services.CanvasService
+		if workBoard, err = projectWorkBoard(projectID); err != nil {
+			writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+			return
+		}
+		if workBoard.LayerLocked(canvasID, "") {
+			writeError(w, newHTTPError(http.StatusConflict, "The bottom layer of the canvas is locked"))
+			return
+		}
+		_, result.Created = workBoard.ImportCanvas(canvasID, imported)
+		err = saveProjectCanvases(projectID, workBoard)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	status := http.StatusOK
+	if result.Created {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, result)
+}
+
+func (i *ImportHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	i.importSVG(w, r)
+}
@@ -131,6 +131,12 @@ func (i *InvitationHandler) acceptInvitation(w http.ResponseWriter, r *http.Requ
 			Value: firestore.ArrayUnion(invitation.UID),
 		},
 	})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	// the new collaborator can be mentioned and chat in the open project right away
+	reloadHubMembers(projectID)
 }
 
 func (i *InvitationHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
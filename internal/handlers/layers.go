@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"fmt"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+)
+
+type layerRequest struct {
+	CanvasId string `json:"canvasId"`
+	LayerId  string `json:"layerId"`
+	services.LayerPatch
+	Position   int      `json:"position"`
+	ElementIds []string `json:"elementIds"`
+}
+
+// checkLayerLocks rejects operations changing elements of locked layers, or adding elements to them
+func (h *Hub) checkLayerLocks(msg Message) error {
+	switch msg.Subtype {
+	case "add", "load":
+		for _, canvas := range replacedCanvases(msg) {
+			if err := h.workBoard.LockedReplacement(canvas); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "remove":
+		for _, canvas := range replacedCanvases(msg) {
+			if h.workBoard.HasLockedLayer(canvas.ID) {
+				return fmt.Errorf("canvas %s has locked layers", canvas.ID)
+			}
+		}
+		return nil
+	case "canvas":
+		// the background lies under the bottom layer
+		if dataMap, ok := msg.Data.(map[string]interface{}); ok {
+			if id, _ := dataMap["id"].(string); h.workBoard.LayerLocked(id, "") {
+				return fmt.Errorf("canvas %s has its bottom layer locked", id)
+			}
+		}
+		return nil
+	}
+
+	target, ok := decodeOperationTarget(msg)
+	if !ok {
+		return nil
+	}
+
+	if msg.Subtype == "shape" || msg.Subtype == "stroke_begin" {
+		layerId, _ := target.Stroke["layer"].(string)
+		if h.workBoard.LayerLocked(target.Id, layerId) {
+			return fmt.Errorf("layer %s is locked", layerId)
+		}
+		return nil
+	}
+
+	if id, locked := h.workBoard.LockedElement(target.CanvasId, target.elementIds()); locked {
+		return fmt.Errorf("element %s is on a locked layer", id)
+	}
+	return nil
+}
+
+// handleLayerOperation creates, updates, reorders and deletes layers, and moves elements between them
+func (h *Hub) handleLayerOperation(msg Message) bool {
+	var request layerRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid layer operation")
+		return false
+	}
+
+	var err error
+	switch msg.Subtype {
+	case "layer_create":
+		if request.LayerId == "" {
+			request.LayerId = utils.GenerateRandomString(16)
+		}
+		var layer services.Layer
+		if layer, err = h.workBoard.CreateLayer(request.CanvasId, request.LayerId, request.LayerPatch); err == nil {
+			h.relayLayer(msg, request.CanvasId, layer)
+			return false
+		}
+	case "layer_update":
+		var layer services.Layer
+		if layer, err = h.workBoard.UpdateLayer(request.CanvasId, request.LayerId, request.LayerPatch); err == nil {
+			h.relayLayer(msg, request.CanvasId, layer)
+			return false
+		}
+	case "layer_reorder":
+		err = h.workBoard.ReorderLayer(request.CanvasId, request.LayerId, request.Position)
+	case "layer_delete":
+		err = h.workBoard.DeleteLayer(request.CanvasId, request.LayerId)
+	case "layer_elements":
+		err = h.workBoard.MoveElementsToLayer(request.CanvasId, request.ElementIds, request.LayerId)
+	}
+	if err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	return true
+}
+
+// relayLayer sends the resulting layer so that every client ends with the same properties and ID
+func (h *Hub) relayLayer(msg Message, canvasId string, layer services.Layer) {
+	h.relayMessage(Message{
+		Type:    "operation",
+		Subtype: msg.Subtype,
+		Data: map[string]interface{}{
+			"canvasId": canvasId,
+			"layer":    layer,
+		},
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
+}
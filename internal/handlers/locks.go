@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"phaint/internal/services"
+	"time"
+)
+
+// operationTarget holds the fields naming the elements an operation touches
+type operationTarget struct {
+	Id              string                 `json:"id"`
+	CanvasId        string                 `json:"canvasId"`
+	ElementId       string                 `json:"elementId"`
+	VectorElementId string                 `json:"vectorElementId"`
+	ElementIds      []string               `json:"elementIds"`
+	GroupId         string                 `json:"groupId"`
+	Stroke          map[string]interface{} `json:"stroke"`
+}
+
+// decodeOperationTarget reads the target of the operations changing elements, false for the other ones
+func decodeOperationTarget(msg Message) (operationTarget, bool) {
+	var target operationTarget
+	switch msg.Subtype {
+	case "shape", "stroke_begin", "action", "text_insert", "text_delete", "group", "ungroup", "move_to_group", "transform",
+		"layer_elements", services.ZOrderForward, services.ZOrderBackward, services.ZOrderFront, services.ZOrderBack:
+	default:
+		return target, false
+	}
+	if err := decodeMessageData(msg, &target); err != nil {
+		return target, false
+	}
+	return target, true
+}
+
+func (t operationTarget) elementIds() []string {
+	ids := append([]string{}, t.ElementIds...)
+	for _, id := range []string{t.ElementId, t.VectorElementId, t.GroupId} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type lockRequest struct {
+	CanvasId   string   `json:"canvasId"`
+	ElementIds []string `json:"elementIds"`
+}
+
+// LockOwner is the session editing a locked element, shown to the other users
+type LockOwner struct {
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+	Username  string `json:"username"`
+	Color     string `json:"color"`
+}
+
+type lockedElement struct {
+	CanvasID  string    `json:"canvasId"`
+	ElementID string    `json:"elementId"`
+	LockedBy  LockOwner `json:"locked_by"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// lockOwner describes the holder of a lock, from its live presence when there is one
+func (h *Hub) lockOwner(lock services.ElementLock) LockOwner {
+	owner := LockOwner{UserID: lock.UserID, SessionID: lock.SessionID, Username: h.members[lock.UserID], Color: h.userColor(lock.UserID)}
+	if presence, ok := h.sessions[lock.SessionID]; ok {
+		owner.Username = presence.Username
+	}
+	return owner
+}
+
+func (h *Hub) locksState() []lockedElement {
+	locks := h.locks.Locks(time.Now())
+	state := make([]lockedElement, 0, len(locks))
+	for _, lock := range locks {
+		state = append(state, lockedElement{
+			CanvasID:  lock.CanvasID,
+			ElementID: lock.ElementID,
+			LockedBy:  h.lockOwner(lock),
+			ExpiresAt: lock.ExpiresAt,
+		})
+	}
+	return state
+}
+
+// broadcastLocks sends the current locks to every client, like the users state; the caller must hold the
+// hub mutex
+func (h *Hub) broadcastLocks() {
+	h.relayMessage(Message{Type: "lock", Subtype: "state", Data: h.locksState()})
+}
+
+// lockError explains to the user who is editing the element an operation was refused for
+func (h *Hub) lockError(err error) string {
+	var locked *services.ErrElementLocked
+	if errors.As(err, &locked) {
+		return fmt.Sprintf("element %s is being edited by %s", locked.Lock.ElementID, h.lockOwner(locked.Lock).Username)
+	}
+	return err.Error()
+}
+
+// handleLock acquires, renews or releases the locks of the sending session. Clients renew their locks
+// before the lease ends while they keep editing
+func (h *Hub) handleLock(msg Message) bool {
+	if msg.Subtype == "state" {
+		// only the hub publishes the state
+		return false
+	}
+
+	var request lockRequest
+	if err := decodeMessageData(msg, &request); err != nil || len(request.ElementIds) == 0 || len(request.ElementIds) > services.MaxLockElements {
+		h.sendError(msg.SessionID, "invalid lock request")
+		return false
+	}
+	switch msg.Subtype {
+	case "acquire":
+		if err := h.workBoard.LockableElements(request.CanvasId, request.ElementIds); err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
+		}
+		// the session cannot lock a group whose elements another one edits, nor an element of its group
+		now := time.Now()
+		if err := h.locks.Check(request.CanvasId, msg.SessionID, h.workBoard.ElementFamily(request.CanvasId, request.ElementIds), now); err != nil {
+			h.sendError(msg.SessionID, h.lockError(err))
+			return false
+		}
+		if _, err := h.locks.Acquire(request.CanvasId, msg.UserID, msg.SessionID, request.ElementIds, now); err != nil {
+			h.sendError(msg.SessionID, h.lockError(err))
+			return false
+		}
+	case "release":
+		if len(h.locks.Release(request.CanvasId, msg.SessionID, request.ElementIds)) == 0 {
+			return false
+		}
+	default:
+		h.sendError(msg.SessionID, "unknown lock request")
+		return false
+	}
+	h.broadcastLocks()
+	return false
+}
+
+// checkElementLocks rejects operations on elements locked by another session, including canvases replaced
+// or removed with such elements
+func (h *Hub) checkElementLocks(msg Message) error {
+	now := time.Now()
+	if msg.Subtype == "add" || msg.Subtype == "load" || msg.Subtype == "remove" {
+		for _, canvas := range replacedCanvases(msg) {
+			if err := h.locks.Check(canvas.ID, msg.SessionID, h.workBoard.ChangedElements(canvas), now); err != nil {
+				return errors.New(h.lockError(err))
+			}
+		}
+		return nil
+	}
+
+	target, ok := decodeOperationTarget(msg)
+	if !ok {
+		return nil
+	}
+	canvasId := target.CanvasId
+	if msg.Subtype == "shape" || msg.Subtype == "stroke_begin" {
+		canvasId = target.Id
+		if id, _ := target.Stroke["id"].(string); id != "" {
+			target.ElementIds = append(target.ElementIds, id)
+		}
+	}
+	// moving or transforming a group changes its elements, and changing an element changes its groups
+	if err := h.locks.Check(canvasId, msg.SessionID, h.workBoard.ElementFamily(canvasId, target.elementIds()), now); err != nil {
+		return errors.New(h.lockError(err))
+	}
+	return nil
+}
+
+// expireLocks drops the locks whose holder stopped renewing them
+func (h *Hub) expireLocks() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if len(h.locks.Expire(time.Now())) > 0 {
+		h.broadcastLocks()
+	}
+}
@@ -29,10 +29,11 @@ func (p *ProjectHandler) getProjects(w http.ResponseWriter, r *http.Request) {
 		uid = newUid
 	}
 
-	iter := client.Collection("projects").Documents(ctx)
+	// the canvases are left out of listings, which show thumbnails instead
+	iter := client.Collection("projects").Select(projectSummaryFields...).Documents(ctx)
 	defer iter.Stop()
 
-	var arr []map[string]interface{}
+	var arr []projectSummary
 	for {
 		doc, err := iter.Next()
 		if errors.Is(err, iterator.Done) {
@@ -40,9 +41,15 @@ func (p *ProjectHandler) getProjects(w http.ResponseWriter, r *http.Request) {
 		}
 		if err != nil {
 			log.Println("Err during collection iteration")
+			break
+		}
+		summary, err := summarizeProject(doc)
+		if err != nil {
+			log.Println("Error decoding project:", err)
+			continue
 		}
-		if uid == "" || doc.Data()["UID"] == uid {
-			arr = append(arr, doc.Data())
+		if uid == "" || summary.UID == uid {
+			arr = append(arr, summary)
 		}
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -65,7 +72,7 @@ func (p *ProjectHandler) addProject(w http.ResponseWriter, r *http.Request) {
 		"ProjectName":  project.ProjectName,
 		"CreationDate": project.CreationDate,
 		"Collaborators": []string{},
-		"CanvasesData": []services.Canvas{},
+		canvasOrderField: []string{},
 	})
 	if err != nil {
 		log.Println(err)
@@ -96,26 +103,13 @@ func GetProjectById(id string) (*firestore.DocumentRef, error) {
 }
 
 func (p *ProjectHandler) updateProjectCanvasesData(hub *Hub) error {
-	ctx := context.Background()
-
-    docRef, err := GetProjectById(hub.projectID)
-    if err != nil {
-        return err
-    }
-
-    // Get all canvases from the CanvasService
-    canvases := hub.workBoard.GetAllCanvases()
-
-    // Update "CanvasesData" field with current canvases
-    _, err = docRef.Update(ctx, []firestore.Update{
-        {
-            Path:  "CanvasesData",
-            Value: canvases,
-        },
-    })
+    hub.saving.Lock()
+    defer hub.saving.Unlock()
 
+    // Only the canvases changed since the previous save are written
+    err := saveProjectCanvases(hub.projectID, hub.workBoard)
     if err != nil {
-        log.Println("Failed to update CanvasesData:", err)
+        log.Println("Failed to save canvases:", err)
         return err
     }
 
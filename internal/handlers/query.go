@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"math"
+	"phaint/internal/services"
+)
+
+// maxQueryCoordinate bounds the coordinates and tolerances of queries and viewports, far beyond any canvas
+const maxQueryCoordinate = 1e7
+
+// validQueryValues tells whether values are numbers within maxQueryCoordinate
+func validQueryValues(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.Abs(v) > maxQueryCoordinate {
+			return false
+		}
+	}
+	return true
+}
+
+// validQueryRect tells whether a rectangle of a query or viewport is ordered and within maxQueryCoordinate
+func validQueryRect(r services.Rect) bool {
+	return validQueryValues(r.MinX, r.MinY, r.MaxX, r.MaxY) && r.MaxX >= r.MinX && r.MaxY >= r.MinY
+}
+
+type queryRequest struct {
+	RequestId string  `json:"requestId"`
+	CanvasId  string  `json:"canvasId"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Tolerance float64 `json:"tolerance"`
+	services.Rect
+	Contained bool `json:"contained"`
+}
+
+// handleQuery answers geometry queries used for selection to the asking session only: "at_point" returns the
+// elements under a point topmost first, "in_rect" the IDs of the elements in a rectangle bottom to top
+func (h *Hub) handleQuery(msg Message) bool {
+	var request queryRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid query")
+		return false
+	}
+
+	result := map[string]interface{}{
+		"requestId": request.RequestId,
+		"canvasId":  request.CanvasId,
+	}
+	switch msg.Subtype {
+	case "at_point":
+		if !validQueryValues(request.X, request.Y, request.Tolerance) || request.Tolerance < 0 {
+			h.sendError(msg.SessionID, "invalid query point")
+			return false
+		}
+		result["hits"] = h.workBoard.HitTest(request.CanvasId, services.Point{X: request.X, Y: request.Y}, request.Tolerance)
+	case "in_rect":
+		if !validQueryRect(request.Rect) {
+			h.sendError(msg.SessionID, "invalid query rectangle")
+			return false
+		}
+		ids := []string{}
+		for _, element := range h.workBoard.ElementsInRect(request.CanvasId, request.Rect, request.Contained) {
+			ids = append(ids, services.ElementID(element))
+		}
+		result["elementIds"] = ids
+	default:
+		h.sendError(msg.SessionID, "unknown query")
+		return false
+	}
+
+	h.sendToSession(msg.SessionID, Message{Type: "query", Subtype: msg.Subtype, Data: result})
+	return false
+}
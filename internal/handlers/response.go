@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// httpError is an error carrying the HTTP status it should be reported with
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func newHTTPError(status int, message string) error {
+	return &httpError{status: status, message: message}
+}
+
+// writeError reports an error to the client, unexpected errors are logged and hidden behind a 500
+func writeError(w http.ResponseWriter, err error) {
+	var statusErr *httpError
+	if errors.As(err, &statusErr) {
+		http.Error(w, statusErr.message, statusErr.status)
+		return
+	}
+	log.Println(err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"phaint/config"
 	"phaint/internal/services"
+	"phaint/internal/utils"
+	"sort"
 	"sync"
 	"time"
 
@@ -20,19 +23,31 @@ type Hub struct {
 	broadcast      chan []byte
 	register       chan *Client
 	unregister     chan *Client
-	users          map[string]*UserPresence
+	sessions       map[string]*UserPresence
 	mutex          sync.RWMutex
 	projectID      string
+	ownerID        string
+	presenter      string
+	viewports      map[string]*Viewport
+	members        map[string]string
+	locks          *services.LockTable
+	strokes        services.StrokeProcessing
+	drafts         *services.StrokeDrafts
 	workBoard      *services.CanvasService
 	projectHandler *ProjectHandler
+	// saving orders the saves of the canvases, which write what changed since the previous one
+	saving sync.Mutex
 }
 
 type Client struct {
-	hub      *Hub
-	conn     *websocket.Conn
-	send     chan []byte
-	userID   string
-	username string
+	hub       *Hub
+	conn      *websocket.Conn
+	send      chan []byte
+	userID    string
+	username  string
+	sessionID string
+	// viewport limits the elements sent to the client to an area of a canvas, nil to send them all
+	viewport *services.ViewportSubscription
 }
 
 type Point struct {
@@ -45,13 +60,27 @@ type CanvasEvent struct {
 	Position Point  `json:"position"`
 }
 
+// UserPresence is the presence of a single connection (session) of a user
 type UserPresence struct {
 	UserID    string      `json:"userId"`
+	SessionID string      `json:"sessionId"`
 	Cursor    *Point      `json:"cursor"`
 	Color     string      `json:"color"`
 	Username  string      `json:"username"`
 	IsDrawing bool        `json:"isDrawing"`
 	LastSeen  CanvasEvent `json:"lastSeen"`
+	Viewport  *Viewport   `json:"viewport,omitempty"`
+	Following string      `json:"following,omitempty"`
+	Presenter bool        `json:"presenter,omitempty"`
+}
+
+// UserSessions aggregates every live session of a single user
+type UserSessions struct {
+	UserID       string          `json:"userId"`
+	Username     string          `json:"username"`
+	Color        string          `json:"color"`
+	SessionCount int             `json:"sessionCount"`
+	Sessions     []*UserPresence `json:"sessions"`
 }
 
 type Message struct {
@@ -59,6 +88,7 @@ type Message struct {
 	Subtype   string      `json:"subtype,omitempty"`
 	Data      interface{} `json:"data"`
 	UserID    string      `json:"userId,omitempty"`
+	SessionID string      `json:"sessionId,omitempty"`
 	ProjectID string      `json:"projectId,omitempty"`
 }
 
@@ -76,13 +106,18 @@ var hubsMutex = sync.RWMutex{}
 
 func (wh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	projectID := r.URL.Query().Get("projectId")
-	userID := r.URL.Query().Get("userId")
 	username := r.URL.Query().Get("username")
 
 	if projectID == "" {
 		http.Error(w, "Project ID required", http.StatusBadRequest)
 		return
 	}
+	// the user is the owner of the token rather than a query parameter, since ownership grants presenting
+	userID, err := requireProjectMember(r, projectID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 
 	// Get or create hub for this project
 	hub := getOrCreateHub(projectID)
@@ -94,25 +129,22 @@ func (wh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		hub:      hub,
-		conn:     conn,
-		send:     make(chan []byte, 256),
-		userID:   userID,
-		username: username,
+		hub:       hub,
+		conn:      conn,
+		send:      make(chan []byte, 256),
+		userID:    userID,
+		username:  username,
+		sessionID: utils.GenerateRandomString(16),
+	}
+	// viewport synchronized clients get the canvases without their elements, then subscribe to an area
+	if r.URL.Query().Get("sync") == "viewport" {
+		client.viewport = services.NewViewportSubscription("", services.Rect{})
 	}
 
 	client.hub.register <- client
 
 	go client.writePump()
 	go client.readPump()
-
-	workBoard := hub.getCurrentWorkboard()
-	jsonData, err := json.Marshal(workBoard)
-	if err != nil {
-		log.Println("Error marshaling current workboard:", err)
-	} else {
-		client.send <- jsonData
-	}
 }
 
 func initializeHubCanvasData(hub *Hub) error {
@@ -127,24 +159,40 @@ func initializeHubCanvasData(hub *Hub) error {
 		return err
 	}
 
-	// Assuming your Firestore doc has a field "CanvasesData" which is a slice or map of canvases
 	var rawData map[string]interface{}
 	if err := docSnap.DataTo(&rawData); err != nil {
 		return err
 	}
 
-	canvasesData, ok := rawData["CanvasesData"]
+	if ownerID, ok := rawData["UID"].(string); ok {
+		hub.ownerID = ownerID
+	}
+	hub.members = loadProjectMembers(rawData)
+
+	if err := loadProjectCanvases(context.Background(), docSnap, hub.workBoard); err != nil {
+		return err
+	}
+	hub.workBoard.ApplyStyleLibrary(loadStyleLibrary(rawData))
+	// the loaded canvases are saved already
+	hub.workBoard.MarkSaved()
+	return nil
+}
+
+// loadCanvasesData fills a canvas service with the CanvasesData field that project documents had before
+// their canvases were moved to their own documents
+func loadCanvasesData(workBoard *services.CanvasService, rawData map[string]interface{}) error {
+	canvasesData, ok := rawData[legacyCanvasesField]
 	if !ok {
 		return fmt.Errorf("CanvasesData field not found")
 	}
 
 	switch data := canvasesData.(type) {
 	case map[string]interface{}:
-		hub.processSingleCanvas(data)
+		loadCanvas(workBoard, data)
 	case []interface{}:
 		for _, item := range data {
 			if canvasMap, ok := item.(map[string]interface{}); ok {
-				hub.processSingleCanvas(canvasMap)
+				loadCanvas(workBoard, canvasMap)
 			} else {
 				log.Printf("handleDrawingOperation: array item is not map: %T", item)
 			}
@@ -156,6 +204,54 @@ func initializeHubCanvasData(hub *Hub) error {
 	return nil
 }
 
+// projectWorkBoard returns the live canvases of a project, or the persisted ones when its hub is not running
+func projectWorkBoard(projectID string) (*services.CanvasService, error) {
+	if hub, live := liveHub(projectID); live {
+		return hub.workBoard, nil
+	}
+
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return nil, err
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	var rawData map[string]interface{}
+	if err := docSnap.DataTo(&rawData); err != nil {
+		return nil, err
+	}
+
+	workBoard := services.NewCanvasService()
+	if err := loadProjectCanvases(context.Background(), docSnap, workBoard); err != nil {
+		log.Printf("Error loading canvas data for project %s: %v", projectID, err)
+	}
+	workBoard.ApplyStyleLibrary(loadStyleLibrary(rawData))
+	workBoard.MarkSaved()
+	return workBoard, nil
+}
+
+// liveHub returns the hub of a project when clients are connected to it
+func liveHub(projectID string) (*Hub, bool) {
+	hubsMutex.RLock()
+	defer hubsMutex.RUnlock()
+	hub, live := projectHubs[projectID]
+	return hub, live
+}
+
+// publishToProject relays a server side event to every client connected to a project, if any
+func publishToProject(projectID string, msg Message) {
+	hub, live := liveHub(projectID)
+	if !live {
+		return
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+	hub.relayMessage(msg)
+}
+
 func getOrCreateHub(projectID string) *Hub {
 	hubsMutex.Lock()
 	defer hubsMutex.Unlock()
@@ -169,7 +265,12 @@ func getOrCreateHub(projectID string) *Hub {
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
 		clients:        make(map[*Client]bool),
-		users:          make(map[string]*UserPresence),
+		sessions:       make(map[string]*UserPresence),
+		viewports:      make(map[string]*Viewport),
+		members:        make(map[string]string),
+		locks:          services.NewLockTable(services.DefaultLockLease),
+		strokes:        strokeProcessing(),
+		drafts:         services.NewStrokeDrafts(),
 		projectID:      projectID,
 		workBoard:      services.NewCanvasService(),
 		projectHandler: &ProjectHandler{},
@@ -187,19 +288,25 @@ func getOrCreateHub(projectID string) *Hub {
 	return hub
 }
 
-func (h *Hub) getCurrentWorkboard() map[string]interface{} {
+// getCurrentWorkboard returns every canvas of the hub, with their elements or with none of them
+func (h *Hub) getCurrentWorkboard(withElements bool) map[string]interface{} {
 	canvases := h.workBoard.GetAllCanvases()
 	transformed := make([]map[string]interface{}, 0, len(canvases))
 
 	for _, c := range canvases {
 		v := c.VectorData
+		elements := []interface{}{}
+		if withElements {
+			elements = v.MarshalElements()
+		}
 		transformed = append(transformed, map[string]interface{}{
 			"id": c.ID,
 			"vectorData": map[string]interface{}{
 				"width":          v.Width,
 				"height":         v.Height,
 				"backgroundFill": v.BackgroundFill,
-				"elements":       v.MarshalElements(),
+				"layers":         v.Layers,
+				"elements":       elements,
 				"timestamp":      v.Timestamp,
 				"version":        v.Version,
 			},
@@ -213,6 +320,8 @@ func (h *Hub) getCurrentWorkboard() map[string]interface{} {
 }
 
 func (h *Hub) run() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
 		select {
 		case client := <-h.register:
@@ -221,6 +330,8 @@ func (h *Hub) run() {
 			h.unregisterClient(client)
 		case message := <-h.broadcast:
 			h.broadcastMessage(message)
+		case <-ticker.C:
+			h.expireLocks()
 		}
 	}
 }
@@ -230,17 +341,33 @@ func (h *Hub) registerClient(client *Client) {
 	defer h.mutex.Unlock()
 
 	h.clients[client] = true
-	h.users[client.userID] = &UserPresence{
-		UserID:   client.userID,
-		Color:    fmt.Sprintf("#%06x", time.Now().UnixNano()%0xFFFFFF),
-		Username: client.username,
-		LastSeen: CanvasEvent{},
+	h.sessions[client.sessionID] = &UserPresence{
+		UserID:    client.userID,
+		SessionID: client.sessionID,
+		Color:     h.userColor(client.userID),
+		Username:  client.username,
+		LastSeen:  CanvasEvent{},
+	}
+	log.Printf("Client %s (session %s) connected to project %s. Total clients: %d", client.userID, client.sessionID, h.projectID, len(h.clients))
+	// the session and the canvases are queued under the mutex, which closes the channels of dropped clients
+	sessionData, err := json.Marshal(Message{
+		Type:      "session",
+		Data:      map[string]string{"sessionId": client.sessionID, "userId": client.userID},
+		UserID:    client.userID,
+		SessionID: client.sessionID,
+	})
+	if err == nil {
+		h.deliver(client, sessionData)
+	}
+	jsonData, err := json.Marshal(h.getCurrentWorkboard(client.viewport == nil))
+	if err != nil {
+		log.Println("Error marshaling current workboard:", err)
+	} else {
+		h.deliver(client, jsonData)
 	}
-	log.Printf("Client %s connected to project %s. Total clients: %d", client.userID, h.projectID, len(h.clients))
 	// Send current users state
-	usersData, _ := json.Marshal(Message{Type: "users_state", Data: h.users})
-
-	h.broadcast <- usersData
+	h.broadcastUsersState()
+	h.broadcastLocks()
 }
 
 func (h *Hub) unregisterClient(client *Client) {
@@ -248,59 +375,230 @@ func (h *Hub) unregisterClient(client *Client) {
 	defer h.mutex.Unlock()
 
 	if _, ok := h.clients[client]; ok {
-		delete(h.clients, client)
-		delete(h.users, client.userID)
-		close(client.send)
-		log.Printf("Client %s disconnected from project %s", client.userID, h.projectID)
-		usersData, _ := json.Marshal(Message{Type: "users_state", Data: h.users})
-		h.broadcast <- usersData
+		h.removeClient(client)
+		log.Printf("Client %s (session %s) disconnected from project %s", client.userID, client.sessionID, h.projectID)
+		h.broadcastUsersState()
+	}
+}
+
+// removeClient drops a client and its session presence, once; the caller must hold the hub mutex
+func (h *Hub) removeClient(client *Client) {
+	if !h.clients[client] {
+		return
+	}
+	delete(h.clients, client)
+	delete(h.sessions, client.sessionID)
+	close(client.send)
+	h.releaseFollowers(client)
+	if len(h.locks.ReleaseSession(client.sessionID)) > 0 {
+		h.broadcastLocks()
+	}
+	h.discardStrokes(client)
+}
+
+// broadcastUsersState sends the connected users to every client; the caller must hold the hub mutex
+func (h *Hub) broadcastUsersState() {
+	h.relayMessage(Message{Type: "users_state", Data: h.usersState()})
+}
+
+// sendToSession delivers a message to a single session only
+func (h *Hub) sendToSession(sessionID string, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Error marshaling message:", err)
+		return
+	}
+	for client := range h.clients {
+		if client.sessionID == sessionID {
+			h.deliver(client, data)
+		}
+	}
+}
+
+// sendError notifies a session that its message was rejected
+func (h *Hub) sendError(sessionID string, reason string) {
+	h.sendToSession(sessionID, Message{
+		Type:      "error",
+		Data:      map[string]string{"message": reason},
+		SessionID: sessionID,
+	})
+}
+
+// userColor keeps the same cursor color across every session of a user
+func (h *Hub) userColor(userID string) string {
+	for _, presence := range h.sessions {
+		if presence.UserID == userID {
+			return presence.Color
+		}
 	}
+	return fmt.Sprintf("#%06x", time.Now().UnixNano()%0xFFFFFF)
+}
+
+// usersState aggregates the session presences per user
+func (h *Hub) usersState() map[string]*UserSessions {
+	users := make(map[string]*UserSessions)
+	for _, presence := range h.sessions {
+		user, ok := users[presence.UserID]
+		if !ok {
+			user = &UserSessions{
+				UserID:   presence.UserID,
+				Username: presence.Username,
+				Color:    presence.Color,
+				Sessions: []*UserPresence{},
+			}
+			users[presence.UserID] = user
+		}
+		user.Sessions = append(user.Sessions, presence)
+		user.SessionCount++
+	}
+	for _, user := range users {
+		sort.Slice(user.Sessions, func(i, j int) bool {
+			return user.Sessions[i].SessionID < user.Sessions[j].SessionID
+		})
+	}
+	return users
 }
 
 func (h *Hub) broadcastMessage(message []byte) {
-	h.mutex.RLock()
-	defer h.mutex.RUnlock()
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
 	var msg Message
+	relay := true
 	if err := json.Unmarshal(message, &msg); err == nil {
 		switch msg.Type {
 		case "operation":
-			h.handleOperations(msg)
+			relay = h.handleOperations(msg)
 		case "users_state":
+			// only the hub publishes the users state
+			relay = false
+		case "session":
 		case "cursor_move":
-			break
+			h.handleCursorMove(msg)
+		case "viewport":
+			h.handleViewport(msg)
+		case "follow":
+			relay = h.handleFollow(msg)
+		case "presenter":
+			relay = h.handlePresenter(msg)
+		case "chat":
+			relay = h.handleChat(msg)
+		case "lock":
+			relay = h.handleLock(msg)
+		case "query":
+			relay = h.handleQuery(msg)
+		case "subscribe":
+			relay = h.handleSubscribe(msg)
 		default:
 			log.Printf("Unknown message type: %s", msg.Type)
 		}
 	}
+	if !relay {
+		return
+	}
+
+	h.relay(message)
+}
 
+// relay fans a message out to every connected client, viewport synchronized clients only get the part
+// concerning their area; the caller must hold the hub mutex
+func (h *Hub) relay(message []byte) {
+	var scope *operationScope
 	for client := range h.clients {
-		select {
-		case client.send <- message:
-		default:
-			close(client.send)
-			delete(h.clients, client)
-			delete(h.users, client.userID)
+		if client.viewport == nil {
+			h.deliver(client, message)
+			continue
+		}
+		if scope == nil {
+			scope = newOperationScope(message)
 		}
+		h.relayToViewport(client, message, scope)
+	}
+}
+
+// deliver queues a message for a client, dropping the client when it does not keep up. It returns false
+// when the client is gone, its channel being closed
+func (h *Hub) deliver(client *Client, message []byte) bool {
+	if !h.clients[client] {
+		return false
+	}
+	select {
+	case client.send <- message:
+		return true
+	default:
+		h.removeClient(client)
+		return false
 	}
 }
 
-func (h *Hub) handleOperations(msg Message) {
+// relayMessage fans out a message produced by the hub itself without handling it again
+func (h *Hub) relayMessage(msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Println("Error marshaling message:", err)
+		return
+	}
+	h.relay(data)
+}
+
+// handleCursorMove records the last cursor position of the sending session
+func (h *Hub) handleCursorMove(msg Message) {
+	presence, ok := h.sessions[msg.SessionID]
+	if !ok {
+		return
+	}
+	var event CanvasEvent
+	if err := decodeMessageData(msg, &event); err != nil {
+		return
+	}
+	presence.LastSeen = event
+	presence.Cursor = &Point{X: event.Position.X, Y: event.Position.Y}
+}
+
+// handleOperations applies a drawing operation, it returns false when the operation must not be relayed as is
+func (h *Hub) handleOperations(msg Message) bool {
+	if err := h.checkLayerLocks(msg); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	if err := h.checkElementLocks(msg); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
 	switch msg.Subtype {
 	case "load":
-		h.handleDrawingOperation(msg)
+		return h.handleDrawingOperation(msg)
 	case "shape":
-		h.handleSingleStroke(msg)
+		return h.handleSingleStroke(msg)
 	case "canvas":
 		h.handleCanvasBackground(msg)
 	case "add":
-		h.handleDrawingOperation(msg)
+		return h.handleDrawingOperation(msg)
 	case "remove":
 		h.handleRemoveCanvas(msg)
 	case "action":
 		h.handleAddAction(msg)
+	case "text_insert":
+		return h.handleTextOperation(msg, services.TextInsert)
+	case "text_delete":
+		return h.handleTextOperation(msg, services.TextDelete)
+	case "group":
+		return h.handleGroup(msg)
+	case "ungroup":
+		return h.handleUngroup(msg)
+	case "move_to_group":
+		return h.handleMoveToGroup(msg)
+	case "transform":
+		return h.handleTransform(msg)
+	case "layer_create", "layer_update", "layer_reorder", "layer_delete", "layer_elements":
+		return h.handleLayerOperation(msg)
+	case services.ZOrderForward, services.ZOrderBackward, services.ZOrderFront, services.ZOrderBack:
+		return h.handleReorder(msg)
+	case "stroke_begin", "stroke_points", "stroke_end", "stroke_cancel":
+		return h.handleStrokeStream(msg)
 	default:
 		log.Printf("Unknown operation subtype: %s", msg.Subtype)
 	}
+	return true
 }
 
 func (h *Hub) handleCanvasBackground(msg Message) {
@@ -325,7 +623,7 @@ func (h *Hub) handleRemoveCanvas(msg Message) {
 	}
 }
 
-func (h *Hub) handleSingleStroke(msg Message) {
+func (h *Hub) handleSingleStroke(msg Message) bool {
 	var canvasId string
 	var stroke services.VectorElement
 	if dataMap, ok := msg.Data.(map[string]interface{}); ok {
@@ -336,33 +634,74 @@ func (h *Hub) handleSingleStroke(msg Message) {
 			stroke = services.ParseSingleStrokeFromRaw(strokeData)
 		}
 	}
-	h.workBoard.UpdateCanvasElement(canvasId, stroke)
+	if stroke == nil {
+		h.sendError(msg.SessionID, "invalid shape")
+		return false
+	}
+	if err := services.ValidateStyle(stroke); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	path, isPath := stroke.(services.VectorPath)
+	if !isPath {
+		h.workBoard.UpdateCanvasElement(canvasId, stroke)
+		return true
+	}
+	h.commitPath(msg, canvasId, path)
+	return false
+}
 
+// commitPath stores a freehand stroke and relays it as a shape operation, simplified rather than with every
+// pointer sample
+func (h *Hub) commitPath(msg Message, canvasId string, path services.VectorPath) {
+	path = services.ProcessStroke(path, h.strokes)
+	h.workBoard.UpdateCanvasElement(canvasId, path)
+	h.relayMessage(Message{
+		Type:      "operation",
+		Subtype:   "shape",
+		Data:      map[string]interface{}{"id": canvasId, "stroke": path},
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
 }
 
-func (h *Hub) handleDrawingOperation(msg Message) {
-	switch data := msg.Data.(type) {
-	case map[string]interface{}:
-		h.processSingleCanvas(data)
-	case []interface{}:
-		for _, item := range data {
-			if canvasMap, ok := item.(map[string]interface{}); ok {
-				h.processSingleCanvas(canvasMap)
-			} else {
-				log.Printf("handleDrawingOperation: array item is not map: %T", item)
-			}
+// strokeProcessing reads the configured processing of freehand strokes
+func strokeProcessing() services.StrokeProcessing {
+	strokes := config.Strokes()
+	return services.StrokeProcessing{Tolerance: strokes.SimplifyTolerance, Smooth: strokes.Smoothing}
+}
+
+// handleDrawingOperation stores the canvases of an "add" or "load" operation, none of them when an element
+// has an invalid style
+func (h *Hub) handleDrawingOperation(msg Message) bool {
+	canvases := replacedCanvases(msg)
+	for _, canvas := range canvases {
+		// elements stored before styles were validated are sent back as they are with the rest of the canvas
+		if err := services.ValidateElementsStyle(h.workBoard.SentElements(canvas)); err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
 		}
-	default:
-		log.Printf("handleDrawingOperation: unexpected data type: %T", data)
+	}
+	for _, canvas := range canvases {
+		h.workBoard.AddOrUpdateCanvas(canvas)
+	}
+	return true
+}
+
+// loadCanvas parses a raw canvas and stores it in a canvas service
+func loadCanvas(workBoard *services.CanvasService, dataMap map[string]interface{}) {
+	if canvas, ok := parseCanvas(dataMap); ok {
+		workBoard.AddOrUpdateCanvas(canvas)
 	}
 }
 
-func (h *Hub) processSingleCanvas(dataMap map[string]interface{}) {
+// parseCanvas parses a raw canvas with its elements
+func parseCanvas(dataMap map[string]interface{}) (services.Canvas, bool) {
 	// Marshal entire dataMap back to JSON bytes
 	jsonData, err := json.Marshal(dataMap)
 	if err != nil {
 		log.Printf("Error marshaling dataMap: %v", err)
-		return
+		return services.Canvas{}, false
 	}
 
 	var canvas services.Canvas
@@ -370,12 +709,36 @@ func (h *Hub) processSingleCanvas(dataMap map[string]interface{}) {
 	// Unmarshal JSON bytes into Canvas struct
 	if err := json.Unmarshal(jsonData, &canvas); err != nil {
 		log.Printf("Error unmarshaling to Canvas: %v", err)
-		return
+		return services.Canvas{}, false
 	}
 
 	canvas.VectorData.Elements = services.ParseVectorElementsFromRaw(dataMap)
+	return canvas, true
+}
 
-	h.workBoard.AddOrUpdateCanvas(canvas)
+// replacedCanvases returns the canvases an "add" or "load" operation stores, or the canvas a "remove" one
+// deletes without its content
+func replacedCanvases(msg Message) []services.Canvas {
+	canvases := []services.Canvas{}
+	switch msg.Subtype {
+	case "add", "load":
+		items, isList := msg.Data.([]interface{})
+		if !isList {
+			items = []interface{}{msg.Data}
+		}
+		for _, item := range items {
+			if canvasMap, ok := item.(map[string]interface{}); ok {
+				if canvas, ok := parseCanvas(canvasMap); ok {
+					canvases = append(canvases, canvas)
+				}
+			}
+		}
+	case "remove":
+		if id, ok := msg.Data.(string); ok {
+			canvases = append(canvases, services.Canvas{ID: id})
+		}
+	}
+	return canvases
 }
 
 func (h *Hub) handleAddAction(msg Message) {
@@ -399,6 +762,174 @@ func (h *Hub) handleAddAction(msg Message) {
 	}
 }
 
+type textOperationRequest struct {
+	CanvasId  string `json:"canvasId"`
+	ElementId string `json:"elementId"`
+	Index     int    `json:"index"`
+	Text      string `json:"text"`
+	Length    int    `json:"length"`
+	Revision  int    `json:"revision"`
+}
+
+// handleTextOperation applies a collaborative text edit and relays the operations actually applied,
+// which may differ from the request when it was made against an older revision
+func (h *Hub) handleTextOperation(msg Message, kind string) bool {
+	var request textOperationRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid text operation")
+		return false
+	}
+
+	applied, err := h.workBoard.ApplyTextOperation(request.CanvasId, request.ElementId, services.TextOperation{
+		Kind:     kind,
+		Index:    request.Index,
+		Text:     request.Text,
+		Length:   request.Length,
+		Revision: request.Revision,
+	})
+	if err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+
+	h.relayMessage(Message{
+		Type:    "operation",
+		Subtype: msg.Subtype,
+		Data: map[string]interface{}{
+			"canvasId":   request.CanvasId,
+			"elementId":  request.ElementId,
+			"operations": applied,
+		},
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
+	return false
+}
+
+type groupRequest struct {
+	CanvasId   string   `json:"canvasId"`
+	GroupId    string   `json:"groupId"`
+	ElementIds []string `json:"elementIds"`
+}
+
+// handleGroup wraps elements in a new group, the group ID is generated when the client does not provide one
+func (h *Hub) handleGroup(msg Message) bool {
+	var request groupRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid group operation")
+		return false
+	}
+	if request.GroupId == "" {
+		request.GroupId = utils.GenerateRandomString(16)
+	}
+	if err := h.workBoard.GroupElements(request.CanvasId, request.GroupId, request.ElementIds); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	h.relayMessage(Message{
+		Type:      "operation",
+		Subtype:   msg.Subtype,
+		Data:      request,
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
+	return false
+}
+
+func (h *Hub) handleUngroup(msg Message) bool {
+	var request groupRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid ungroup operation")
+		return false
+	}
+	if err := h.workBoard.UngroupElement(request.CanvasId, request.GroupId); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	return true
+}
+
+// handleMoveToGroup moves elements into a group, or back to the canvas when no group is given
+func (h *Hub) handleMoveToGroup(msg Message) bool {
+	var request groupRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid move operation")
+		return false
+	}
+	if err := h.workBoard.MoveElementsToGroup(request.CanvasId, request.ElementIds, request.GroupId); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	return true
+}
+
+type transformRequest struct {
+	CanvasId   string           `json:"canvasId"`
+	ElementIds []string         `json:"elementIds"`
+	Matrix     *services.Matrix `json:"matrix"`
+	Mode       string           `json:"mode"`
+}
+
+// handleTransform composes a canvas space transform with the elements ("apply", the default),
+// or replaces their own transform ("set", a missing matrix resets them)
+func (h *Hub) handleTransform(msg Message) bool {
+	var request transformRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid transform operation")
+		return false
+	}
+	var err error
+	switch request.Mode {
+	case "", "apply":
+		if request.Matrix == nil {
+			h.sendError(msg.SessionID, "missing transform matrix")
+			return false
+		}
+		err = h.workBoard.TransformElements(request.CanvasId, request.ElementIds, *request.Matrix)
+	case "set":
+		err = h.workBoard.SetElementTransforms(request.CanvasId, request.ElementIds, request.Matrix)
+	default:
+		err = fmt.Errorf("unknown transform mode %q", request.Mode)
+	}
+	if err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	return true
+}
+
+type reorderRequest struct {
+	CanvasId  string `json:"canvasId"`
+	ElementId string `json:"elementId"`
+}
+
+// handleReorder moves an element in the z-order and relays its new key, which clients sort siblings by,
+// so that moves made at the same time by several users end the same everywhere
+func (h *Hub) handleReorder(msg Message) bool {
+	var request reorderRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid reorder operation")
+		return false
+	}
+	key, err := h.workBoard.ReorderElement(request.CanvasId, request.ElementId, msg.Subtype)
+	if err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	h.relayMessage(Message{
+		Type:    "operation",
+		Subtype: msg.Subtype,
+		Data: map[string]interface{}{
+			"canvasId":  request.CanvasId,
+			"elementId": request.ElementId,
+			"zIndex":    key,
+		},
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
+	return false
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		c.hub.unregister <- c
@@ -411,8 +942,23 @@ func (c *Client) readPump() {
 			break
 		}
 
-		c.hub.broadcast <- message
+		c.hub.broadcast <- c.stampMessage(message)
+	}
+}
+
+// stampMessage overwrites the sender identity of an incoming message with the one of the connection
+func (c *Client) stampMessage(message []byte) []byte {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return message
+	}
+	msg.UserID = c.userID
+	msg.SessionID = c.sessionID
+	stamped, err := json.Marshal(msg)
+	if err != nil {
+		return message
 	}
+	return stamped
 }
 
 func (c *Client) writePump() {
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"encoding/json"
+	"phaint/internal/services"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTestHub builds a hub without a project document nor configuration, its goroutine is not started
+func newTestHub() *Hub {
+	return &Hub{
+		broadcast:      make(chan []byte, 256),
+		register:       make(chan *Client),
+		unregister:     make(chan *Client),
+		clients:        make(map[*Client]bool),
+		sessions:       make(map[string]*UserPresence),
+		viewports:      make(map[string]*Viewport),
+		members:        make(map[string]string),
+		locks:          services.NewLockTable(services.DefaultLockLease),
+		strokes:        services.StrokeProcessing{Tolerance: 0.5},
+		drafts:         services.NewStrokeDrafts(),
+		projectID:      "project",
+		workBoard:      services.NewCanvasService(),
+		projectHandler: &ProjectHandler{},
+	}
+}
+
+// connect registers a client, then gives it an empty send buffer of the given size
+func connect(h *Hub, userID string, sessionID string, buffer int) *Client {
+	client := &Client{hub: h, send: make(chan []byte, 16), userID: userID, username: userID, sessionID: sessionID}
+	h.registerClient(client)
+	client.send = make(chan []byte, buffer)
+	return client
+}
+
+// drain empties the send buffer of a client
+func drain(client *Client) {
+	for {
+		select {
+		case _, open := <-client.send:
+			if !open {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func TestDeliverDropsSlowClientsOnce(t *testing.T) {
+	h := newTestHub()
+	client := connect(h, "u1", "s1", 1)
+	drain(client)
+
+	if !h.deliver(client, []byte("first")) {
+		t.Fatal("Expected a message to be queued")
+	}
+	if h.deliver(client, []byte("second")) {
+		t.Fatal("Expected a full client to be dropped")
+	}
+	if h.clients[client] {
+		t.Fatal("Expected the client to be removed")
+	}
+	// sending to or removing a dropped client again must neither panic nor close its channel twice
+	if h.deliver(client, []byte("third")) {
+		t.Error("Expected nothing to be sent to a dropped client")
+	}
+	h.removeClient(client)
+}
+
+func TestRelayToViewportStopsOnDroppedClient(t *testing.T) {
+	h := newTestHub()
+	h.workBoard.AddOrUpdateCanvas(services.Canvas{ID: "c1", VectorData: services.VectorData{Width: 100, Height: 100}})
+	client := connect(h, "u1", "s1", 1)
+	drain(client)
+	client.viewport = services.NewViewportSubscription("c1", services.Rect{MaxX: 100, MaxY: 100})
+	client.send <- []byte("backlog")
+
+	// the workboard outline does not fit, the area must not be sent after it
+	h.relayToViewport(client, []byte(`{"type":"operation","subtype":"add"}`), &operationScope{kind: scopeCanvases})
+	if h.clients[client] {
+		t.Error("Expected the slow client to be dropped")
+	}
+}
+
+func TestStateBroadcastsDoNotQueueOnTheHub(t *testing.T) {
+	h := newTestHub()
+	// nothing reads the queue of the hub: pushing onto it while holding the mutex would block forever
+	h.broadcast = make(chan []byte)
+	client := &Client{hub: h, send: make(chan []byte, 16), userID: "u1", username: "u1", sessionID: "s1"}
+	h.registerClient(client)
+	h.locks.Acquire("c1", "u1", "s1", []string{"e1"}, time.Now())
+	h.unregisterClient(client)
+
+	types := []string{}
+	for data := range client.send {
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, msg.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"session", "operation", "users_state", "lock"}) {
+		t.Errorf("Expected the session, the canvases, then the users and locks states on registration, got %v", types)
+	}
+}
+
+func TestUsersStateGroupsSessionsByUser(t *testing.T) {
+	h := newTestHub()
+	connect(h, "u1", "s2", 16)
+	connect(h, "u1", "s1", 16)
+	connect(h, "u2", "s3", 16)
+
+	users := h.usersState()
+	if len(users) != 2 {
+		t.Fatalf("Expected two users, got %d", len(users))
+	}
+	u1 := users["u1"]
+	if u1.SessionCount != 2 || len(u1.Sessions) != 2 || u1.Sessions[0].SessionID != "s1" || u1.Sessions[1].SessionID != "s2" {
+		t.Errorf("Expected both sessions of u1 in order, got %+v", u1)
+	}
+	if u1.Color != h.userColor("u1") || u1.Username != "u1" {
+		t.Errorf("Expected the user color and name, got %+v", u1)
+	}
+	if users["u2"].SessionCount != 1 || users["u2"].Sessions[0].SessionID != "s3" {
+		t.Errorf("Expected the single session of u2, got %+v", users["u2"])
+	}
+
+	h.unregisterClient(findClient(h, "s2"))
+	if users := h.usersState(); users["u1"].SessionCount != 1 || users["u1"].Sessions[0].SessionID != "s1" {
+		t.Errorf("Expected u1 to keep its other session, got %+v", users["u1"])
+	}
+	h.unregisterClient(findClient(h, "s3"))
+	if _, present := h.usersState()["u2"]; present {
+		t.Error("Expected a user without sessions to be left out")
+	}
+}
+
+// findClient returns the registered client of a session
+func findClient(h *Hub, sessionID string) *Client {
+	for client := range h.clients {
+		if client.sessionID == sessionID {
+			return client
+		}
+	}
+	return nil
+}
+
+func TestInvalidShapeIsRefused(t *testing.T) {
+	h := newTestHub()
+	h.workBoard.AddOrUpdateCanvas(services.Canvas{ID: "c1"})
+	client := connect(h, "u1", "s1", 4)
+
+	msg := Message{Type: "operation", Subtype: "shape", SessionID: "s1", Data: map[string]interface{}{"id": "c1"}}
+	if h.handleOperations(msg) {
+		t.Error("Expected a shape without a stroke not to be relayed")
+	}
+	if len(h.workBoard.GetCanvas("c1").VectorData.Elements) != 0 {
+		t.Error("Expected nothing to be stored")
+	}
+	var reply Message
+	if err := json.Unmarshal(<-client.send, &reply); err != nil || reply.Type != "error" {
+		t.Errorf("Expected an error to be sent back, got %+v", reply)
+	}
+}
+
+func TestCanvasesWithInvalidStylesAreRefused(t *testing.T) {
+	h := newTestHub()
+	client := connect(h, "u1", "s1", 4)
+
+	canvas := map[string]interface{}{"id": "c1", "vectorData": map[string]interface{}{"elements": []interface{}{
+		map[string]interface{}{"id": "r", "type": "rectangle", "fill": "#00ff00"},
+	}}}
+	invalid := map[string]interface{}{"id": "c2", "vectorData": map[string]interface{}{"elements": []interface{}{
+		map[string]interface{}{"id": "r", "type": "rectangle", "fill": "javascript:alert(1)"},
+	}}}
+	if h.handleOperations(Message{Type: "operation", Subtype: "add", SessionID: "s1", Data: []interface{}{canvas, invalid}}) {
+		t.Error("Expected the operation not to be relayed")
+	}
+	if h.workBoard.GetCanvas("c1") != nil || h.workBoard.GetCanvas("c2") != nil {
+		t.Error("Expected none of the canvases to be stored")
+	}
+	var reply Message
+	if err := json.Unmarshal(<-client.send, &reply); err != nil || reply.Type != "error" {
+		t.Errorf("Expected an error to be sent back, got %+v", reply)
+	}
+
+	if !h.handleOperations(Message{Type: "operation", Subtype: "load", SessionID: "s1", Data: canvas}) || h.workBoard.GetCanvas("c1") == nil {
+		t.Error("Expected a valid canvas to be stored and relayed")
+	}
+}
+
+func TestOnlyMembersChatAndAreMentioned(t *testing.T) {
+	h := newTestHub()
+	h.members["u1"] = "alice"
+	stranger := connect(h, "u2", "s2", 4)
+
+	if _, known := h.members["u2"]; known {
+		t.Fatal("Expected a connection not to make its user a member")
+	}
+	if uids := h.resolveMentions([]string{"u2"}); len(uids) != 0 {
+		t.Errorf("Expected a stranger not to be mentioned, got %v", uids)
+	}
+
+	h.handleChat(Message{Type: "chat", Subtype: "message", SessionID: "s2", Data: map[string]interface{}{"text": "hello"}})
+	var reply Message
+	if err := json.Unmarshal(<-stranger.send, &reply); err != nil || reply.Type != "error" {
+		t.Errorf("Expected a stranger's message to be refused, got %+v", reply)
+	}
+	if len(stranger.send) != 0 {
+		t.Error("Expected nothing to be relayed")
+	}
+}
+
+func TestLocksCoverGroupsAndTheirElements(t *testing.T) {
+	h := newTestHub()
+	h.workBoard.AddOrUpdateCanvas(services.Canvas{ID: "c1", VectorData: services.VectorData{Elements: []services.VectorElement{
+		services.VectorGroup{VectorShape: services.VectorShape{ID: "g"}, Type: "group", Children: []services.VectorElement{
+			services.VectorRectangle{VectorShape: services.VectorShape{ID: "r"}, Type: "rectangle", Width: 10, Height: 10},
+		}},
+	}}})
+	connect(h, "u1", "s1", 16)
+	connect(h, "u2", "s2", 16)
+
+	lock := func(sessionID string, ids ...string) bool {
+		h.handleLock(Message{Type: "lock", Subtype: "acquire", SessionID: sessionID, Data: map[string]interface{}{"canvasId": "c1", "elementIds": ids}})
+		return h.locks.Check("c1", "other", ids, time.Now()) != nil
+	}
+	if lock("s1", "missing") {
+		t.Error("Expected a missing element not to be locked")
+	}
+	if !lock("s1", "r") {
+		t.Fatal("Expected the rectangle to be locked")
+	}
+	if lock("s2", "g") {
+		t.Error("Expected a group not to be locked while one of its elements is")
+	}
+	transform := Message{Type: "operation", Subtype: "transform", SessionID: "s2", Data: map[string]interface{}{"canvasId": "c1", "elementIds": []string{"g"}}}
+	if h.checkElementLocks(transform) == nil {
+		t.Error("Expected the group of a locked element not to be transformed")
+	}
+
+	h.locks.ReleaseSession("s1")
+	if !lock("s2", "g") {
+		t.Fatal("Expected the group to be locked")
+	}
+	action := Message{Type: "operation", Subtype: "action", SessionID: "s1", Data: map[string]interface{}{"canvasId": "c1", "vectorElementId": "r"}}
+	if h.checkElementLocks(action) == nil {
+		t.Error("Expected an element of a locked group to be protected")
+	}
+}
+
+func TestResentCanvasesKeepStoredStyles(t *testing.T) {
+	h := newTestHub()
+	stored := map[string]interface{}{"id": "c1", "vectorData": map[string]interface{}{"elements": []interface{}{
+		map[string]interface{}{"id": "old", "type": "rectangle", "fill": "hsl(120, 100%, 50%)"},
+	}}}
+	canvas, _ := parseCanvas(stored)
+	h.workBoard.AddOrUpdateCanvas(canvas)
+	client := connect(h, "u1", "s1", 4)
+
+	resent := map[string]interface{}{"id": "c1", "vectorData": map[string]interface{}{"elements": []interface{}{
+		map[string]interface{}{"id": "old", "type": "rectangle", "fill": "hsl(120, 100%, 50%)"},
+		map[string]interface{}{"id": "new", "type": "rectangle", "fill": "#00ff00"},
+	}}}
+	if !h.handleOperations(Message{Type: "operation", Subtype: "load", SessionID: "s1", Data: resent}) {
+		t.Fatal("Expected a canvas to be stored with its unchanged elements")
+	}
+	if len(h.workBoard.GetCanvas("c1").VectorData.Elements) != 2 {
+		t.Error("Expected the new element to be stored")
+	}
+
+	changed := map[string]interface{}{"id": "c1", "vectorData": map[string]interface{}{"elements": []interface{}{
+		map[string]interface{}{"id": "old", "type": "rectangle", "fill": "hsl(120, 100%, 40%)"},
+	}}}
+	if h.handleOperations(Message{Type: "operation", Subtype: "load", SessionID: "s1", Data: changed}) {
+		t.Error("Expected a changed element to be validated")
+	}
+	var reply Message
+	if err := json.Unmarshal(<-client.send, &reply); err != nil || reply.Type != "error" {
+		t.Errorf("Expected an error to be sent back, got %+v", reply)
+	}
+}
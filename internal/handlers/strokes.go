@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"phaint/internal/services"
+)
+
+type strokeRequest struct {
+	CanvasId  string           `json:"canvasId"`
+	ElementId string           `json:"elementId"`
+	Points    []services.Point `json:"points"`
+}
+
+// handleStrokeStream relays a freehand stroke while it is drawn. "stroke_begin" carries the path like a shape
+// operation, "stroke_points" the samples drawn since, and "stroke_end" stores the whole path and relays it
+// as a shape operation. Nothing is stored before the end, "stroke_cancel" drops the stroke
+func (h *Hub) handleStrokeStream(msg Message) bool {
+	if msg.Subtype == "stroke_begin" {
+		return h.handleStrokeBegin(msg)
+	}
+
+	var request strokeRequest
+	if err := decodeMessageData(msg, &request); err != nil {
+		h.sendError(msg.SessionID, "invalid stroke operation")
+		return false
+	}
+	switch msg.Subtype {
+	case "stroke_points":
+		if _, err := h.drafts.Append(msg.SessionID, request.ElementId, request.Points); err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
+		}
+	case "stroke_end":
+		// the last samples may come with the end
+		if _, err := h.drafts.Append(msg.SessionID, request.ElementId, request.Points); err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
+		}
+		draft, err := h.drafts.Finish(msg.SessionID, request.ElementId)
+		if err != nil {
+			h.sendError(msg.SessionID, err.Error())
+			return false
+		}
+		if h.workBoard.LayerLocked(draft.CanvasID, draft.Path.Layer) {
+			h.sendError(msg.SessionID, fmt.Sprintf("layer %s is locked", draft.Path.Layer))
+			h.relayStrokeCancel(msg, draft)
+			return false
+		}
+		h.commitPath(msg, draft.CanvasID, draft.Path)
+	case "stroke_cancel":
+		draft, err := h.drafts.Finish(msg.SessionID, request.ElementId)
+		if err != nil {
+			return false
+		}
+		h.relayStrokeCancel(msg, draft)
+		return false
+	}
+	// peers drop their preview on the end, once the shape operation is relayed
+	return true
+}
+
+func (h *Hub) handleStrokeBegin(msg Message) bool {
+	var canvasId string
+	var stroke services.VectorElement
+	if dataMap, ok := msg.Data.(map[string]interface{}); ok {
+		canvasId, _ = dataMap["id"].(string)
+		if strokeData, ok := dataMap["stroke"].(map[string]interface{}); ok {
+			stroke = services.ParseSingleStrokeFromRaw(strokeData)
+		}
+	}
+	path, isPath := stroke.(services.VectorPath)
+	if !isPath {
+		h.sendError(msg.SessionID, "only paths can be streamed")
+		return false
+	}
+	if h.workBoard.GetCanvas(canvasId) == nil {
+		h.sendError(msg.SessionID, "canvas not found: "+canvasId)
+		return false
+	}
+	if err := services.ValidateStyle(path); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	if err := h.drafts.Begin(canvasId, msg.SessionID, path); err != nil {
+		h.sendError(msg.SessionID, err.Error())
+		return false
+	}
+	return true
+}
+
+// relayStrokeCancel tells peers to drop the preview of a stroke which will not be stored
+func (h *Hub) relayStrokeCancel(msg Message, draft services.StrokeDraft) {
+	h.relayMessage(Message{
+		Type:      "operation",
+		Subtype:   "stroke_cancel",
+		Data:      map[string]string{"canvasId": draft.CanvasID, "elementId": draft.Path.ID},
+		UserID:    msg.UserID,
+		SessionID: msg.SessionID,
+	})
+}
+
+// discardStrokes drops the strokes a disconnected client left unfinished; the caller must hold the hub mutex
+func (h *Hub) discardStrokes(client *Client) {
+	for _, draft := range h.drafts.DiscardSession(client.sessionID) {
+		h.relayStrokeCancel(Message{UserID: client.userID, SessionID: client.sessionID}, draft)
+	}
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"phaint/internal/services"
+	"phaint/internal/utils"
+
+	"cloud.google.com/go/firestore"
+)
+
+// styleLibraryField is the project document field holding the palette and the style presets
+const styleLibraryField = "StyleLibrary"
+
+type StyleHandler struct{}
+
+type swatchRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type presetRequest struct {
+	Name  *string                `json:"name"`
+	Style *services.ElementStyle `json:"style"`
+}
+
+// loadStyleLibrary reads the style library of a raw project document, empty for projects without one
+func loadStyleLibrary(rawData map[string]interface{}) services.StyleLibrary {
+	library := services.StyleLibrary{Swatches: []services.Swatch{}, Presets: []services.StylePreset{}}
+	raw, ok := rawData[styleLibraryField]
+	if !ok {
+		return library
+	}
+	// the firestore and JSON names of the library fields are the same
+	jsonData, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(jsonData, &library)
+	}
+	if err != nil {
+		log.Println("Error decoding style library:", err)
+	}
+	return library
+}
+
+// updateStyleLibrary applies a change to the style library of a project inside a transaction
+func updateStyleLibrary(projectID string, change func(library *services.StyleLibrary) error) (services.StyleLibrary, error) {
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		return services.StyleLibrary{}, newHTTPError(http.StatusNotFound, "Project not found")
+	}
+
+	var library services.StyleLibrary
+	err = services.FirebaseDb().GetClient().RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if err != nil {
+			return err
+		}
+		library = loadStyleLibrary(docSnap.Data())
+		if err := change(&library); err != nil {
+			return err
+		}
+		return tx.Update(docRef, []firestore.Update{{Path: styleLibraryField, Value: library}})
+	})
+	return library, err
+}
+
+func (s *StyleHandler) getLibrary(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("pid")
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+	docRef, err := GetProjectById(projectID)
+	if err != nil {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project not found"))
+		return
+	}
+	docSnap, err := docRef.Get(context.Background())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, loadStyleLibrary(docSnap.Data()))
+}
+
+func (s *StyleHandler) createSwatch(w http.ResponseWriter, r *http.Request, uid string) {
+	var request swatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == nil || request.Color == nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "A name and a color are required"))
+		return
+	}
+	swatch := services.Swatch{ID: utils.GenerateRandomString(20), Name: *request.Name, Color: *request.Color}
+	if err := swatch.Validate(); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	s.changeLibrary(w, r, uid, "swatch_created", swatch, http.StatusCreated, func(library *services.StyleLibrary) error {
+		library.Swatches = append(library.Swatches, swatch)
+		return nil
+	})
+}
+
+func (s *StyleHandler) updateSwatch(w http.ResponseWriter, r *http.Request, uid string) {
+	var request swatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "Invalid request body"))
+		return
+	}
+	var swatch services.Swatch
+	s.changeLibrary(w, r, uid, "swatch_updated", &swatch, http.StatusOK, func(library *services.StyleLibrary) error {
+		i := library.FindSwatch(r.PathValue("sid"))
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Swatch not found")
+		}
+		swatch = library.Swatches[i]
+		if request.Name != nil {
+			swatch.Name = *request.Name
+		}
+		if request.Color != nil {
+			swatch.Color = *request.Color
+		}
+		if err := swatch.Validate(); err != nil {
+			return newHTTPError(http.StatusBadRequest, err.Error())
+		}
+		library.Swatches[i] = swatch
+		return nil
+	})
+}
+
+func (s *StyleHandler) deleteSwatch(w http.ResponseWriter, r *http.Request, uid string) {
+	swatchID := r.PathValue("sid")
+	s.changeLibrary(w, r, uid, "swatch_deleted", map[string]string{"id": swatchID}, http.StatusNoContent, func(library *services.StyleLibrary) error {
+		i := library.FindSwatch(swatchID)
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Swatch not found")
+		}
+		library.Swatches = append(library.Swatches[:i], library.Swatches[i+1:]...)
+		return nil
+	})
+}
+
+func (s *StyleHandler) createPreset(w http.ResponseWriter, r *http.Request, uid string) {
+	var request presetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Name == nil || request.Style == nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "A name and a style are required"))
+		return
+	}
+	preset := services.StylePreset{ID: utils.GenerateRandomString(20), Name: *request.Name, Style: *request.Style}
+	if err := preset.Validate(); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	s.changeLibrary(w, r, uid, "preset_created", preset, http.StatusCreated, func(library *services.StyleLibrary) error {
+		library.Presets = append(library.Presets, preset)
+		return nil
+	})
+}
+
+// updatePreset changes a preset and restyles the live elements using it
+func (s *StyleHandler) updatePreset(w http.ResponseWriter, r *http.Request, uid string) {
+	var request presetRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, newHTTPError(http.StatusBadRequest, "Invalid request body"))
+		return
+	}
+	projectID := r.PathValue("pid")
+	var preset services.StylePreset
+	s.changeLibrary(w, r, uid, "preset_updated", &preset, http.StatusOK, func(library *services.StyleLibrary) error {
+		i := library.FindPreset(r.PathValue("sid"))
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Preset not found")
+		}
+		preset = library.Presets[i]
+		if request.Name != nil {
+			preset.Name = *request.Name
+		}
+		if request.Style != nil {
+			preset.Style = *request.Style
+		}
+		if err := preset.Validate(); err != nil {
+			return newHTTPError(http.StatusBadRequest, err.Error())
+		}
+		library.Presets[i] = preset
+		return nil
+	}, func() {
+		// canvases that are not live pick the new style up when they are loaded
+		if hub, live := liveHub(projectID); live {
+			hub.workBoard.ApplyPreset(preset)
+		}
+	})
+}
+
+func (s *StyleHandler) deletePreset(w http.ResponseWriter, r *http.Request, uid string) {
+	projectID := r.PathValue("pid")
+	presetID := r.PathValue("sid")
+	s.changeLibrary(w, r, uid, "preset_deleted", map[string]string{"id": presetID}, http.StatusNoContent, func(library *services.StyleLibrary) error {
+		i := library.FindPreset(presetID)
+		if i < 0 {
+			return newHTTPError(http.StatusNotFound, "Preset not found")
+		}
+		library.Presets = append(library.Presets[:i], library.Presets[i+1:]...)
+		return nil
+	}, func() {
+		if hub, live := liveHub(projectID); live {
+			hub.workBoard.DetachPreset(presetID)
+		}
+	})
+}
+
+// changeLibrary runs a library update, then the live side effects, and reports the change to the caller
+// and to the live project. The result is read once the update is done
+func (s *StyleHandler) changeLibrary(w http.ResponseWriter, r *http.Request, uid string, subtype string, result interface{}, status int, change func(library *services.StyleLibrary) error, afterwards ...func()) {
+	projectID := r.PathValue("pid")
+	if _, err := updateStyleLibrary(projectID, change); err != nil {
+		writeError(w, err)
+		return
+	}
+	for _, effect := range afterwards {
+		effect()
+	}
+
+	publishToProject(projectID, Message{
+		Type:      "style",
+		Subtype:   subtype,
+		Data:      result,
+		UserID:    uid,
+		ProjectID: projectID,
+	})
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, result)
+}
+
+func (s *StyleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	kind := r.PathValue("kind")
+	styleID := r.PathValue("sid")
+
+	if kind == "" {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		s.getLibrary(w, r)
+		return
+	}
+	if kind != "swatches" && kind != "presets" {
+		http.NotFound(w, r)
+		return
+	}
+
+	uid, err := requireProjectMember(r, r.PathValue("pid"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch {
+	case styleID == "" && r.Method == http.MethodPost && kind == "swatches":
+		s.createSwatch(w, r, uid)
+	case styleID == "" && r.Method == http.MethodPost:
+		s.createPreset(w, r, uid)
+	case styleID != "" && r.Method == http.MethodPatch && kind == "swatches":
+		s.updateSwatch(w, r, uid)
+	case styleID != "" && r.Method == http.MethodPatch:
+		s.updatePreset(w, r, uid)
+	case styleID != "" && r.Method == http.MethodDelete && kind == "swatches":
+		s.deleteSwatch(w, r, uid)
+	case styleID != "" && r.Method == http.MethodDelete:
+		s.deletePreset(w, r, uid)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"phaint/internal/services"
+)
+
+type subscribeRequest struct {
+	CanvasId string `json:"canvasId"`
+	services.Rect
+}
+
+const (
+	// scopeAll messages reach every client
+	scopeAll = iota
+	// scopeCanvases messages replace whole canvases
+	scopeCanvases
+	// scopeElements messages change some elements of a canvas
+	scopeElements
+)
+
+// operationScope tells which part of the workboard a relayed message concerns
+type operationScope struct {
+	kind       int
+	canvasId   string
+	elementIds []string
+}
+
+func newOperationScope(message []byte) *operationScope {
+	var msg Message
+	if err := json.Unmarshal(message, &msg); err != nil || msg.Type != "operation" {
+		return &operationScope{kind: scopeAll}
+	}
+	switch msg.Subtype {
+	case "load", "add":
+		return &operationScope{kind: scopeCanvases}
+	case "stroke_begin", "stroke_points", "stroke_end", "stroke_cancel":
+		// strokes being drawn are not elements yet, their previews reach everyone
+		return &operationScope{kind: scopeAll}
+	}
+	target, ok := decodeOperationTarget(msg)
+	if !ok {
+		return &operationScope{kind: scopeAll}
+	}
+	if msg.Subtype == "shape" {
+		id, _ := target.Stroke["id"].(string)
+		return &operationScope{kind: scopeElements, canvasId: target.Id, elementIds: []string{id}}
+	}
+	return &operationScope{kind: scopeElements, canvasId: target.CanvasId, elementIds: target.elementIds()}
+}
+
+// relayToViewport forwards a message to a viewport synchronized client when it concerns its area, sending
+// whole the elements it misses to follow; the caller must hold the hub mutex
+func (h *Hub) relayToViewport(client *Client, message []byte, scope *operationScope) {
+	switch scope.kind {
+	case scopeCanvases:
+		// the canvases were replaced, the client gets their outline then its area again
+		client.viewport.Reset()
+		if h.deliverJSON(client, h.getCurrentWorkboard(false)) {
+			h.syncViewport(client)
+		}
+	case scopeElements:
+		forward, elements := h.workBoard.ViewportUpdate(client.viewport, scope.canvasId, scope.elementIds)
+		if forward && !h.deliver(client, message) {
+			return
+		}
+		if len(elements) > 0 {
+			h.sendElements(client, elements)
+		}
+	default:
+		h.deliver(client, message)
+	}
+}
+
+// syncViewport sends a client the elements of its area it did not receive yet
+func (h *Hub) syncViewport(client *Client) {
+	h.sendElements(client, h.workBoard.FetchViewport(client.viewport))
+}
+
+// sendElements sends top level elements of the subscribed canvas, replacing the client copies
+func (h *Hub) sendElements(client *Client, elements []services.VectorElement) {
+	h.deliverJSON(client, Message{
+		Type: "sync",
+		Data: map[string]interface{}{
+			"canvasId": client.viewport.CanvasId,
+			"elements": elements,
+		},
+		SessionID: client.sessionID,
+	})
+}
+
+func (h *Hub) deliverJSON(client *Client, v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error marshaling message:", err)
+		return false
+	}
+	return h.deliver(client, data)
+}
+
+// handleSubscribe limits the synchronization of a session to an area of a canvas ("viewport"), the elements
+// of the area it misses are sent right away so that moving the area fetches only what came into view.
+// "all" goes back to receiving the whole workboard
+func (h *Hub) handleSubscribe(msg Message) bool {
+	var client *Client
+	for c := range h.clients {
+		if c.sessionID == msg.SessionID {
+			client = c
+		}
+	}
+	if client == nil {
+		return false
+	}
+
+	switch msg.Subtype {
+	case "", "viewport":
+		var request subscribeRequest
+		if err := decodeMessageData(msg, &request); err != nil {
+			h.sendError(msg.SessionID, "invalid subscription")
+			return false
+		}
+		if !validQueryRect(request.Rect) {
+			h.sendError(msg.SessionID, "invalid viewport rectangle")
+			return false
+		}
+		if h.workBoard.GetCanvas(request.CanvasId) == nil {
+			h.sendError(msg.SessionID, "canvas not found: "+request.CanvasId)
+			return false
+		}
+		if client.viewport == nil {
+			client.viewport = services.NewViewportSubscription(request.CanvasId, request.Rect)
+		}
+		client.viewport.Move(request.CanvasId, request.Rect)
+		h.syncViewport(client)
+	case "all":
+		if client.viewport != nil {
+			client.viewport = nil
+			h.deliverJSON(client, h.getCurrentWorkboard(true))
+		}
+	default:
+		h.sendError(msg.SessionID, "unknown subscription: "+msg.Subtype)
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"phaint/internal/services"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// projectSummaryFields are the project document fields read by listings, leaving the canvases out
+var projectSummaryFields = []string{"UID", "PID", "ProjectName", "CreationDate", "Collaborators", "CanvasCount", "ThumbnailUpdatedAt"}
+
+// projectThumbnails remembers the canvases the thumbnails were drawn from since the server started
+var projectThumbnails = services.NewThumbnailCache()
+
+// projectSummary is a project as listed, with a preview instead of its canvases
+type projectSummary struct {
+	UID           string   `firestore:"UID" json:"UID"`
+	PID           string   `firestore:"PID" json:"PID"`
+	ProjectName   string   `firestore:"ProjectName" json:"ProjectName"`
+	CreationDate  string   `firestore:"CreationDate" json:"CreationDate"`
+	Collaborators []string `firestore:"Collaborators" json:"Collaborators"`
+	CanvasCount   int      `firestore:"CanvasCount" json:"CanvasCount"`
+	// ThumbnailURL changes with the thumbnail so that browsers can cache it, empty without thumbnail
+	ThumbnailURL       string    `firestore:"-" json:"ThumbnailURL,omitempty"`
+	ThumbnailUpdatedAt time.Time `firestore:"ThumbnailUpdatedAt" json:"-"`
+}
+
+// summarizeProject reads the listed fields of a project document
+func summarizeProject(doc *firestore.DocumentSnapshot) (projectSummary, error) {
+	var summary projectSummary
+	if err := doc.DataTo(&summary); err != nil {
+		return summary, err
+	}
+	if summary.Collaborators == nil {
+		summary.Collaborators = []string{}
+	}
+	if !summary.ThumbnailUpdatedAt.IsZero() {
+		summary.ThumbnailURL = fmt.Sprintf("/projects/%s/thumbnail.png?v=%d", summary.PID, summary.ThumbnailUpdatedAt.UnixMilli())
+	}
+	return summary, nil
+}
+
+// projectSummaryUpdates refreshes the thumbnail of a project and returns the listed fields to store along with
+// its canvases
+func projectSummaryUpdates(projectID string, workBoard *services.CanvasService) []firestore.Update {
+	updates := []firestore.Update{{Path: "CanvasCount", Value: len(workBoard.ListCanvasIDs())}}
+	changed, exists, err := projectThumbnails.Refresh(context.Background(), services.Blobs(), projectID, workBoard, assetImages(projectID))
+	if err != nil {
+		log.Printf("Error refreshing the thumbnail of project %s: %v", projectID, err)
+		return updates
+	}
+	if changed {
+		var updatedAt interface{} = firestore.Delete
+		if exists {
+			updatedAt = time.Now().UTC()
+		}
+		updates = append(updates, firestore.Update{Path: "ThumbnailUpdatedAt", Value: updatedAt})
+	}
+	return updates
+}
+
+type ThumbnailHandler struct{}
+
+// getThumbnail serves the thumbnail of a project to its members
+func (t *ThumbnailHandler) getThumbnail(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("pid")
+	if _, err := requireProjectMember(r, projectID); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	data, err := services.Blobs().Get(context.Background(), services.ProjectThumbnailKey(projectID))
+	if errors.Is(err, services.ErrBlobNotFound) {
+		writeError(w, newHTTPError(http.StatusNotFound, "Project has no thumbnail"))
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// listed URLs carry the version of the thumbnail
+	if r.URL.Query().Get("v") != "" {
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (t *ThumbnailHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	t.getThumbnail(w, r)
+}
@@ -57,17 +57,17 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request, userR
 		log.Fatalf("Error during user craetion : %v\n", err)
 	}
 
-	_, err = utils.SignInWithPassword(userReq.Mail, userReq.Password)
+	token, err := utils.SignInWithPassword(userReq.Mail, userReq.Password)
 	if err != nil {
 		fmt.Println(err)
 	}
 
-	writeResponse(w, map[string]string{"userId": userId, "username": userReq.Username})
+	writeResponse(w, map[string]string{"userId": userId, "username": userReq.Username, "token": token})
 }
 
 // LoginUser Authenticate a user passed in the http request body
 func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request, user models.User) {
-	_, err := utils.SignInWithPassword(user.Mail, user.Password)
+	token, err := utils.SignInWithPassword(user.Mail, user.Password)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -91,7 +91,7 @@ func (h *UserHandler) LoginUser(w http.ResponseWriter, r *http.Request, user mod
 		}
 	}
 
-	writeResponse(w, map[string]string{"userId": arr[0]["UID"].(string), "username": arr[0]["username"].(string)})
+	writeResponse(w, map[string]string{"userId": arr[0]["UID"].(string), "username": arr[0]["username"].(string), "token": token})
 }
 
 func writeResponse(w http.ResponseWriter, toWrite map[string]string) {
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// AssetThumbnailSize is the maximum width and height of asset thumbnails
+const AssetThumbnailSize = 256
+
+// MaxAssetPixels bounds the size of the images decoded from assets, a few compressed bytes can describe far
+// more pixels than memory holds
+const MaxAssetPixels = 40 << 20
+
+var ErrImageTooLarge = errors.New("the image has too many pixels")
+
+// allowedAssetTypes lists the content types accepted for uploaded assets
+var allowedAssetTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// SniffAssetType detects the content type of an upload from its bytes, the client provided type is never trusted
+func SniffAssetType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !allowedAssetTypes[contentType] {
+		return "", fmt.Errorf("unsupported asset type: %s", contentType)
+	}
+	return contentType, nil
+}
+
+func AssetKey(projectID string, assetID string) string {
+	return "projects/" + projectID + "/assets/" + assetID
+}
+
+func AssetThumbnailKey(projectID string, assetID string) string {
+	return AssetKey(projectID, assetID) + "_thumb.png"
+}
+
+// Thumbnail scales an image down to fit in a maxSize square, averaging the covered source pixels
+func Thumbnail(src image.Image, maxSize int) *image.RGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			width, height = maxSize, max(1, height*maxSize/width)
+		} else {
+			width, height = max(1, width*maxSize/height), maxSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	scaleX := float64(bounds.Dx()) / float64(width)
+	scaleY := float64(bounds.Dy()) / float64(height)
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + int(float64(y)*scaleY)
+		y1 := max(y0+1, bounds.Min.Y+int(float64(y+1)*scaleY))
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + int(float64(x)*scaleX)
+			x1 := max(x0+1, bounds.Min.X+int(float64(x+1)*scaleX))
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					count++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i+0] = uint8(r / count >> 8)
+			dst.Pix[i+1] = uint8(g / count >> 8)
+			dst.Pix[i+2] = uint8(b / count >> 8)
+			dst.Pix[i+3] = uint8(a / count >> 8)
+		}
+	}
+	return dst
+}
+
+// DecodeAssetImage decodes an image once its header shows it fits in MaxAssetPixels
+func DecodeAssetImage(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxAssetPixels/config.Height {
+		return nil, ErrImageTooLarge
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	return src, err
+}
+
+// ImageThumbnail decodes an uploaded image and returns a PNG thumbnail of it along with the original size
+func ImageThumbnail(data []byte, maxSize int) ([]byte, int, int, error) {
+	src, err := DecodeAssetImage(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, Thumbnail(src, maxSize)); err != nil {
+		return nil, 0, 0, err
+	}
+	return buf.Bytes(), src.Bounds().Dx(), src.Bounds().Dy(), nil
+}
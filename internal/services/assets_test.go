@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSniffAssetType(t *testing.T) {
+	data := encodePNG(t, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	contentType, err := SniffAssetType(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("Expected 'image/png', got '%s'", contentType)
+	}
+
+	if _, err := SniffAssetType([]byte("<html><body>not an image</body></html>")); err == nil {
+		t.Error("Expected error for HTML upload")
+	}
+}
+
+func TestImageThumbnail(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 512, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 512; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+
+	thumbnail, width, height, err := ImageThumbnail(encodePNG(t, src), AssetThumbnailSize)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if width != 512 || height != 256 {
+		t.Errorf("Expected original size 512x256, got %dx%d", width, height)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(thumbnail))
+	if err != nil {
+		t.Fatalf("Thumbnail is not a PNG: %v", err)
+	}
+	if decoded.Bounds().Dx() != 256 || decoded.Bounds().Dy() != 128 {
+		t.Errorf("Expected thumbnail 256x128, got %dx%d", decoded.Bounds().Dx(), decoded.Bounds().Dy())
+	}
+	if r, g, b, a := decoded.At(10, 10).RGBA(); r>>8 != 255 || g != 0 || b != 0 || a>>8 != 255 {
+		t.Errorf("Expected red pixel, got %d %d %d %d", r>>8, g>>8, b>>8, a>>8)
+	}
+}
+
+// pngHeader is the start of a PNG claiming a size, enough for its configuration to be read
+func pngHeader(width, height uint32) []byte {
+	chunk := []byte("IHDR")
+	chunk = binary.BigEndian.AppendUint32(chunk, width)
+	chunk = binary.BigEndian.AppendUint32(chunk, height)
+	chunk = append(chunk, 8, 6, 0, 0, 0)
+	data := []byte("\x89PNG\r\n\x1a\n")
+	data = binary.BigEndian.AppendUint32(data, uint32(len(chunk)-4))
+	data = append(data, chunk...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(chunk))
+}
+
+func TestDecodeAssetImageRejectsHugeImages(t *testing.T) {
+	for _, size := range [][2]uint32{{100000, 100000}, {1 << 30, 1}} {
+		if _, err := DecodeAssetImage(pngHeader(size[0], size[1])); !errors.Is(err, ErrImageTooLarge) {
+			t.Errorf("Expected a %dx%d image to be refused, got %v", size[0], size[1], err)
+		}
+	}
+	if _, _, _, err := ImageThumbnail(pngHeader(100000, 100000), AssetThumbnailSize); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("Expected no thumbnail of a huge image, got %v", err)
+	}
+	if _, err := DecodeAssetImage(encodePNG(t, image.NewRGBA(image.Rect(0, 0, 4, 4)))); err != nil {
+		t.Errorf("Expected a small image to be decoded, got %v", err)
+	}
+}
+
+func TestThumbnailKeepsSmallImages(t *testing.T) {
+	thumbnail := Thumbnail(image.NewRGBA(image.Rect(0, 0, 40, 30)), AssetThumbnailSize)
+	if thumbnail.Bounds().Dx() != 40 || thumbnail.Bounds().Dy() != 30 {
+		t.Errorf("Expected 40x30, got %dx%d", thumbnail.Bounds().Dx(), thumbnail.Bounds().Dy())
+	}
+}
+
+func TestParseImageElement(t *testing.T) {
+	element := ParseSingleStrokeFromRaw(map[string]interface{}{
+		"type": "image", "id": "image-1", "x": 5.0, "y": 6.0, "width": 100.0, "height": 50.0, "assetId": "asset-1",
+	})
+	if img, ok := element.(VectorImage); !ok || img.AssetID != "asset-1" || img.Width != 100 {
+		t.Errorf("Expected image referencing asset-1, got %#v", element)
+	}
+	if ParseSingleStrokeFromRaw(map[string]interface{}{"type": "image", "id": "image-2"}) != nil {
+		t.Error("Expected nil for image without asset")
+	}
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"math"
+)
+
+// Rect is an axis aligned box
+type Rect struct {
+	MinX float64 `json:"minX"`
+	MinY float64 `json:"minY"`
+	MaxX float64 `json:"maxX"`
+	MaxY float64 `json:"maxY"`
+}
+
+func (r Rect) Width() float64 {
+	return r.MaxX - r.MinX
+}
+
+func (r Rect) Height() float64 {
+	return r.MaxY - r.MinY
+}
+
+// Union returns the smallest box containing both boxes
+func (r Rect) Union(o Rect) Rect {
+	return Rect{
+		MinX: math.Min(r.MinX, o.MinX),
+		MinY: math.Min(r.MinY, o.MinY),
+		MaxX: math.Max(r.MaxX, o.MaxX),
+		MaxY: math.Max(r.MaxY, o.MaxY),
+	}
+}
+
+// Intersects reports whether both boxes overlap, touching edges included
+func (r Rect) Intersects(o Rect) bool {
+	return r.MinX <= o.MaxX && r.MaxX >= o.MinX && r.MinY <= o.MaxY && r.MaxY >= o.MinY
+}
+
+// Inflate grows the box by d on every side
+func (r Rect) Inflate(d float64) Rect {
+	return Rect{MinX: r.MinX - d, MinY: r.MinY - d, MaxX: r.MaxX + d, MaxY: r.MaxY + d}
+}
+
+// pointsBounds returns the box of points once transformed by m
+func pointsBounds(m Matrix, points []Point) (Rect, bool) {
+	if len(points) == 0 {
+		return Rect{}, false
+	}
+	first := m.Apply(points[0])
+	r := Rect{MinX: first.X, MinY: first.Y, MaxX: first.X, MaxY: first.Y}
+	for _, p := range points[1:] {
+		p = m.Apply(p)
+		r = r.Union(Rect{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y})
+	}
+	return r, true
+}
+
+func boxCorners(x, y, width, height float64) []Point {
+	return []Point{{X: x, Y: y}, {X: x + width, Y: y}, {X: x + width, Y: y + height}, {X: x, Y: y + height}}
+}
+
+// ellipseBounds returns the exact box of an axis aligned ellipse once transformed by m
+func ellipseBounds(m Matrix, cx, cy, rx, ry float64) Rect {
+	center := m.Apply(Point{X: cx, Y: cy})
+	halfWidth := math.Hypot(m.A*rx, m.C*ry)
+	halfHeight := math.Hypot(m.B*rx, m.D*ry)
+	return Rect{MinX: center.X - halfWidth, MinY: center.Y - halfHeight, MaxX: center.X + halfWidth, MaxY: center.Y + halfHeight}
+}
+
+// ElementBounds returns the box of an element in the coordinates of its container, strokes included;
+// false when the element has no extent, like an empty group
+func ElementBounds(element VectorElement) (Rect, bool) {
+	return elementBounds(element, Identity())
+}
+
+// elementBounds returns the box of an element once transformed by its own transform then by m
+func elementBounds(element VectorElement, m Matrix) (Rect, bool) {
+	m = m.Multiply(elementTransform(element))
+	shape, _ := ElementShape(element)
+	stroke := shape.StrokeWidth / 2 * m.maxScale()
+	inflate := func(r Rect, ok bool) (Rect, bool) {
+		return r.Inflate(stroke), ok
+	}
+	switch e := element.(type) {
+	case VectorPath:
+		return inflate(pointsBounds(m, pathOutline(e)))
+	case VectorPolyline:
+		return inflate(pointsBounds(m, e.Points))
+	case VectorPolygon:
+		return inflate(pointsBounds(m, e.Points))
+	case VectorLine:
+		return inflate(pointsBounds(m, []Point{{X: e.X1, Y: e.Y1}, {X: e.X2, Y: e.Y2}}))
+	case VectorArrow:
+		r, ok := pointsBounds(m, []Point{{X: e.X1, Y: e.Y1}, {X: e.X2, Y: e.Y2}})
+		return r.Inflate(stroke + e.HeadSize/2*m.maxScale()), ok
+	case VectorRectangle:
+		return inflate(pointsBounds(m, boxCorners(e.X, e.Y, e.Width, e.Height)))
+	case VectorImage:
+		return pointsBounds(m, boxCorners(e.X, e.Y, e.Width, e.Height))
+	case VectorText:
+		width, height := textBox(e)
+		return pointsBounds(m, boxCorners(e.X, e.Y, width, height))
+	case VectorCircle:
+		return ellipseBounds(m, e.CX, e.CY, e.Radius, e.Radius).Inflate(stroke), true
+	case VectorEllipse:
+		return ellipseBounds(m, e.CX, e.CY, e.RX, e.RY).Inflate(stroke), true
+	case VectorGroup:
+		var bounds Rect
+		found := false
+		for _, child := range e.Children {
+			r, ok := elementBounds(child, m)
+			if !ok {
+				continue
+			}
+			if found {
+				bounds = bounds.Union(r)
+			} else {
+				bounds, found = r, true
+			}
+		}
+		return bounds, found
+	}
+	return Rect{}, false
+}
+
+// ElementBounds returns the box of an element of a canvas in canvas coordinates
+func (c *CanvasService) ElementBounds(canvasId string, elementId string) (Rect, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return Rect{}, false
+	}
+	element, world, _, found := findElement(canvas.VectorData.Elements, elementId, Identity(), nil)
+	if !found {
+		return Rect{}, false
+	}
+	return elementBounds(element, world)
+}
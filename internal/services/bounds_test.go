@@ -0,0 +1,55 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func nearlyRect(a, b Rect) bool {
+	return math.Abs(a.MinX-b.MinX) < 1e-6 && math.Abs(a.MinY-b.MinY) < 1e-6 &&
+		math.Abs(a.MaxX-b.MaxX) < 1e-6 && math.Abs(a.MaxY-b.MaxY) < 1e-6
+}
+
+func TestElementBounds(t *testing.T) {
+	rotated := rotation(math.Pi / 4)
+	scaled := Matrix{A: 2, D: 1}
+	tests := []struct {
+		name    string
+		element VectorElement
+		expect  Rect
+	}{
+		{"rectangle with stroke", VectorRectangle{VectorShape: VectorShape{StrokeWidth: 2}, X: 0, Y: 0, Width: 10, Height: 20},
+			Rect{MinX: -1, MinY: -1, MaxX: 11, MaxY: 21}},
+		{"rotated square", VectorRectangle{VectorShape: VectorShape{Transform: &rotated}, X: 0, Y: 0, Width: 10, Height: 10},
+			Rect{MinX: -10 / math.Sqrt2, MinY: 0, MaxX: 10 / math.Sqrt2, MaxY: 20 / math.Sqrt2}},
+		{"scaled circle", VectorCircle{VectorShape: VectorShape{Transform: &scaled}, CX: 0, CY: 0, Radius: 5},
+			Rect{MinX: -10, MinY: -5, MaxX: 10, MaxY: 5}},
+		{"path", VectorPath{Points: []Point{{X: 1, Y: 5}, {X: 4, Y: -2}}},
+			Rect{MinX: 1, MinY: -2, MaxX: 4, MaxY: 5}},
+		{"group", VectorGroup{VectorShape: VectorShape{Transform: &scaled}, Children: []VectorElement{
+			VectorLine{X1: 0, Y1: 0, X2: 1, Y2: 1},
+			VectorImage{X: 5, Y: 5, Width: 2, Height: 2},
+		}}, Rect{MinX: 0, MinY: 0, MaxX: 14, MaxY: 7}},
+	}
+	for _, tt := range tests {
+		bounds, ok := ElementBounds(tt.element)
+		if !ok || !nearlyRect(bounds, tt.expect) {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.expect, bounds)
+		}
+	}
+
+	if _, ok := ElementBounds(VectorGroup{}); ok {
+		t.Error("Expected an empty group to have no bounds")
+	}
+}
+
+func TestCanvasElementBounds(t *testing.T) {
+	moved := Translate(100, 0)
+	cs := newGroupCanvas(VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &moved}, Type: "group",
+		Children: []VectorElement{rect("a", 0, 0)}})
+
+	bounds, ok := cs.ElementBounds("c1", "a")
+	if !ok || !nearlyRect(bounds, Rect{MinX: 100, MinY: 0, MaxX: 110, MaxY: 10}) {
+		t.Errorf("Expected a in canvas coordinates, got %+v", bounds)
+	}
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"phaint/models"
+	"time"
+)
+
+const (
+	// BundleFormat identifies the manifest of a project bundle
+	BundleFormat = "phaint"
+	// BundleVersion is the version of the bundles written by this server, older ones are migrated when read
+	BundleVersion = 2
+	// BundleExtension names bundle files
+	BundleExtension = ".phaint"
+)
+
+const (
+	bundleManifest = "manifest.json"
+	bundleComments = "comments.json"
+)
+
+var (
+	ErrInvalidBundle  = errors.New("the file is not a Phaint bundle")
+	ErrBundleVersion  = errors.New("the bundle was made by a newer version of Phaint")
+	ErrBundleTooLarge = errors.New("the bundle content is too large")
+)
+
+// BundleProject describes the exported project
+type BundleProject struct {
+	Name         string `json:"name"`
+	CreationDate string `json:"creationDate"`
+}
+
+// BundleMember is a member of the exported project. Importing a bundle gives no access to its members, their
+// usernames are only shown along with their content
+type BundleMember struct {
+	UID      string `json:"uid"`
+	Username string `json:"username"`
+	Owner    bool   `json:"owner"`
+}
+
+// BundleManifest is the manifest.json entry of a bundle
+type BundleManifest struct {
+	Format     string        `json:"format"`
+	Version    int           `json:"version"`
+	ExportedAt time.Time     `json:"exportedAt"`
+	Project    BundleProject `json:"project"`
+	// Canvases lists the canvas IDs in project order, the canvas at index i is in canvases/<i+1>.json
+	Canvases     []string       `json:"canvases"`
+	Assets       []models.Asset `json:"assets"`
+	Members      []BundleMember `json:"members"`
+	StyleLibrary StyleLibrary   `json:"styleLibrary"`
+}
+
+// Bundle is the content of a .phaint archive: a project with its canvases, assets and comments
+type Bundle struct {
+	Manifest BundleManifest
+	Canvases []Canvas
+	Comments []models.Comment
+	// AssetData holds the content of the assets by ID, stored in assets/<id>
+	AssetData map[string][]byte
+}
+
+func bundleCanvasEntry(index int) string {
+	return fmt.Sprintf("canvases/%d.json", index+1)
+}
+
+func bundleAssetEntry(assetId string) string {
+	return "assets/" + assetId
+}
+
+// WriteBundle archives a bundle at the current version
+func WriteBundle(b Bundle) ([]byte, error) {
+	manifest := b.Manifest
+	manifest.Format, manifest.Version = BundleFormat, BundleVersion
+	manifest.Canvases = make([]string, len(b.Canvases))
+	for i, canvas := range b.Canvases {
+		manifest.Canvases[i] = canvas.ID
+	}
+	if manifest.Assets == nil {
+		manifest.Assets = []models.Asset{}
+	}
+	if manifest.Members == nil {
+		manifest.Members = []BundleMember{}
+	}
+	comments := b.Comments
+	if comments == nil {
+		comments = []models.Comment{}
+	}
+
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	writeJSON := func(name string, value interface{}) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		entry, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = entry.Write(data)
+		return err
+	}
+
+	if err := writeJSON(bundleManifest, manifest); err != nil {
+		return nil, err
+	}
+	for i, canvas := range b.Canvases {
+		if err := writeJSON(bundleCanvasEntry(i), canvas); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeJSON(bundleComments, comments); err != nil {
+		return nil, err
+	}
+	for _, asset := range manifest.Assets {
+		data, found := b.AssetData[asset.ID]
+		if !found {
+			continue
+		}
+		// assets are compressed images already
+		entry, err := writer.CreateHeader(&zip.FileHeader{Name: bundleAssetEntry(asset.ID), Method: zip.Store})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// bundleMigrations upgrade the entries of a bundle from the version of their index to the next one
+var bundleMigrations = map[int]func(entries map[string][]byte, manifest map[string]interface{}) error{
+	1: migrateBundleV1,
+}
+
+// migrateBundleV1 splits the canvases.json array of version 1 bundles into an entry per canvas, their order
+// moving to the manifest
+func migrateBundleV1(entries map[string][]byte, manifest map[string]interface{}) error {
+	var canvases []map[string]interface{}
+	if data, found := entries["canvases.json"]; found {
+		if err := json.Unmarshal(data, &canvases); err != nil {
+			return err
+		}
+	}
+	ids := make([]interface{}, len(canvases))
+	for i, canvas := range canvases {
+		ids[i], _ = canvas["id"].(string)
+		data, err := json.Marshal(canvas)
+		if err != nil {
+			return err
+		}
+		entries[bundleCanvasEntry(i)] = data
+	}
+	delete(entries, "canvases.json")
+	manifest["canvases"] = ids
+	return nil
+}
+
+// ReadBundle reads a bundle archive, migrating older versions. maxSize bounds the uncompressed content
+func ReadBundle(data []byte, maxSize int64) (Bundle, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return Bundle{}, ErrInvalidBundle
+	}
+	entries := make(map[string][]byte)
+	remaining := maxSize
+	for _, file := range reader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entry, err := file.Open()
+		if err != nil {
+			return Bundle{}, ErrInvalidBundle
+		}
+		// the sizes of the headers cannot be trusted, the content is read up to what is left of the limit
+		content, err := io.ReadAll(io.LimitReader(entry, remaining+1))
+		entry.Close()
+		if err != nil {
+			return Bundle{}, ErrInvalidBundle
+		}
+		if int64(len(content)) > remaining {
+			return Bundle{}, ErrBundleTooLarge
+		}
+		remaining -= int64(len(content))
+		entries[file.Name] = content
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(entries[bundleManifest], &raw); err != nil || raw["format"] != BundleFormat {
+		return Bundle{}, ErrInvalidBundle
+	}
+	version, _ := raw["version"].(float64)
+	if version < 1 || version != float64(int(version)) {
+		return Bundle{}, ErrInvalidBundle
+	}
+	if version > BundleVersion {
+		return Bundle{}, ErrBundleVersion
+	}
+	for v := int(version); v < BundleVersion; v++ {
+		if err := bundleMigrations[v](entries, raw); err != nil {
+			return Bundle{}, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+		}
+	}
+	raw["version"] = BundleVersion
+
+	b := Bundle{AssetData: make(map[string][]byte)}
+	manifest, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(manifest, &b.Manifest)
+	}
+	if err != nil {
+		return Bundle{}, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, id := range b.Manifest.Canvases {
+		if id == "" || seen[id] {
+			return Bundle{}, fmt.Errorf("%w: duplicate or empty canvas ID %q", ErrInvalidBundle, id)
+		}
+		seen[id] = true
+		canvas, err := decodeCanvas(entries[bundleCanvasEntry(i)])
+		if err != nil {
+			return Bundle{}, fmt.Errorf("%w: canvas %s: %v", ErrInvalidBundle, id, err)
+		}
+		canvas.ID = id
+		b.Canvases = append(b.Canvases, canvas)
+	}
+	if comments, found := entries[bundleComments]; found {
+		if err := json.Unmarshal(comments, &b.Comments); err != nil {
+			return Bundle{}, fmt.Errorf("%w: comments: %v", ErrInvalidBundle, err)
+		}
+	}
+	for _, asset := range b.Manifest.Assets {
+		if content, found := entries[bundleAssetEntry(asset.ID)]; found {
+			b.AssetData[asset.ID] = content
+		}
+	}
+	return b, nil
+}
+
+// decodeCanvas parses a canvas entry, its elements as when they are loaded from the database
+func decodeCanvas(data []byte) (Canvas, error) {
+	var canvas Canvas
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return canvas, err
+	}
+	if err := json.Unmarshal(data, &canvas); err != nil {
+		return canvas, err
+	}
+	canvas.VectorData.Elements = ParseVectorElementsFromRaw(raw)
+	if canvas.VectorData.Elements == nil {
+		canvas.VectorData.Elements = []VectorElement{}
+	}
+	if err := ValidateElementsStyle(canvas.VectorData.Elements); err != nil {
+		return canvas, err
+	}
+	repairZIndexes(canvas.VectorData.Elements)
+	return canvas, nil
+}
+
+// importedAuthor is the username shown for content of uid in an imported bundle, the one given by an earlier
+// import first
+func (b *Bundle) importedAuthor(uid string, previous string) string {
+	if previous != "" {
+		return previous
+	}
+	for _, member := range b.Manifest.Members {
+		if member.UID == uid {
+			return member.Username
+		}
+	}
+	return ""
+}
+
+// Remap gives new IDs to the assets, comments and replies of a bundle imported as projectID, as their IDs
+// name documents and files. Bundles come from anywhere, so their users are never matched with accounts of
+// this server: the content is attributed to the importer, with the username of its author for display only.
+// IDs scoped to the project, as the ones of canvases and elements, are kept
+func (b *Bundle) Remap(projectID string, newID func() string, importer string) {
+	assets := make(map[string]string)
+	data := make(map[string][]byte)
+	for i, asset := range b.Manifest.Assets {
+		id := newID()
+		assets[asset.ID] = id
+		if content, found := b.AssetData[asset.ID]; found {
+			data[id] = content
+		}
+		b.Manifest.Assets[i].ID = id
+		b.Manifest.Assets[i].ProjectID = projectID
+		b.Manifest.Assets[i].UserID = importer
+		b.Manifest.Assets[i].ImportedAuthor = b.importedAuthor(asset.UserID, asset.ImportedAuthor)
+	}
+	b.AssetData = data
+	for i := range b.Canvases {
+		remapAssets(b.Canvases[i].VectorData.Elements, assets)
+	}
+
+	for i := range b.Comments {
+		comment := &b.Comments[i]
+		comment.ID = newID()
+		comment.ProjectID = projectID
+		comment.ImportedAuthor = b.importedAuthor(comment.UserID, comment.ImportedAuthor)
+		comment.UserID = importer
+		if comment.ResolvedBy != "" {
+			comment.ResolvedBy = importer
+		}
+		for j := range comment.Replies {
+			reply := &comment.Replies[j]
+			reply.ID = newID()
+			reply.ImportedAuthor = b.importedAuthor(reply.UserID, reply.ImportedAuthor)
+			reply.UserID = importer
+		}
+	}
+}
+
+// remapAssets points the images of a tree of elements to the new IDs of their assets
+func remapAssets(elements []VectorElement, assets map[string]string) {
+	for i, element := range elements {
+		switch e := element.(type) {
+		case VectorImage:
+			if id, found := assets[e.AssetID]; found {
+				e.AssetID = id
+				elements[i] = e
+			}
+		case VectorGroup:
+			remapAssets(e.Children, assets)
+		}
+	}
+}
+
+// ExportBundle archives the canvases of the service in order with the rest of a project bundle
+func (c *CanvasService) ExportBundle(b Bundle) ([]byte, error) {
+	b.Canvases = []Canvas{}
+	for _, id := range c.ListCanvasIDs() {
+		if canvas, exists := c.canvasSnapshot(id); exists {
+			b.Canvases = append(b.Canvases, canvas)
+		}
+	}
+	return WriteBundle(b)
+}
@@ -0,0 +1,203 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"phaint/models"
+	"strings"
+	"testing"
+)
+
+func testBundle() Bundle {
+	return Bundle{
+		Manifest: BundleManifest{
+			Project: BundleProject{Name: "Poster", CreationDate: "2026-01-02"},
+			Assets:  []models.Asset{{ID: "a1", ProjectID: "old", UserID: "u1", Name: "logo.png", ContentType: "image/png"}},
+			Members: []BundleMember{{UID: "u1", Username: "alice", Owner: true}, {UID: "u2", Username: "bob"}},
+			StyleLibrary: StyleLibrary{
+				Swatches: []Swatch{{ID: "s1", Name: "Brand", Color: "#ff0000"}},
+				Presets:  []StylePreset{},
+			},
+		},
+		Canvases: []Canvas{
+			{ID: "second", VectorData: VectorData{Width: 100, Height: 50, Elements: []VectorElement{
+				VectorRectangle{VectorShape: VectorShape{ID: "r", Fill: "#00ff00"}, Type: "rectangle", Width: 10, Height: 10},
+				VectorGroup{VectorShape: VectorShape{ID: "g"}, Type: "group", Children: []VectorElement{
+					VectorImage{VectorShape: VectorShape{ID: "img"}, Type: "image", Width: 5, Height: 5, AssetID: "a1"},
+				}},
+			}}},
+			{ID: "first", VectorData: VectorData{Width: 20, Height: 20}},
+		},
+		Comments: []models.Comment{{
+			ID: "c1", ProjectID: "old", UserID: "u2", Text: "Bigger?", ResolvedBy: "u3",
+			Anchor:  models.CommentAnchor{CanvasID: "second", ElementID: "r"},
+			Replies: []models.CommentReply{{ID: "r1", UserID: "u1", Text: "Sure"}},
+		}},
+		AssetData: map[string][]byte{"a1": []byte("png bytes")},
+	}
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	data, err := WriteBundle(testBundle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ReadBundle(data, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b.Manifest.Format != BundleFormat || b.Manifest.Version != BundleVersion || b.Manifest.Project.Name != "Poster" {
+		t.Errorf("Unexpected manifest %#v", b.Manifest)
+	}
+	if len(b.Canvases) != 2 || b.Canvases[0].ID != "second" || b.Canvases[1].ID != "first" {
+		t.Fatalf("Expected the canvases in project order, got %#v", b.Canvases)
+	}
+	elements := b.Canvases[0].VectorData.Elements
+	if len(elements) != 2 {
+		t.Fatalf("Expected the elements to be read back, got %#v", elements)
+	}
+	if rect, ok := elements[0].(VectorRectangle); !ok || rect.Fill != "#00ff00" || rect.ZIndex == "" {
+		t.Errorf("Expected a rectangle with a z-index key, got %#v", elements[0])
+	}
+	if group, ok := elements[1].(VectorGroup); !ok || group.Children[0].(VectorImage).AssetID != "a1" {
+		t.Errorf("Expected the group and its image, got %#v", elements[1])
+	}
+	if string(b.AssetData["a1"]) != "png bytes" || len(b.Comments) != 1 || b.Comments[0].Replies[0].Text != "Sure" {
+		t.Errorf("Expected the assets and comments, got %v %#v", b.AssetData, b.Comments)
+	}
+	if len(b.Manifest.Members) != 2 || !b.Manifest.Members[0].Owner || b.Manifest.StyleLibrary.Swatches[0].Color != "#ff0000" {
+		t.Errorf("Expected the members and the style library, got %#v", b.Manifest)
+	}
+}
+
+func TestBundleRemap(t *testing.T) {
+	b := testBundle()
+	b.Comments[0].Replies = append(b.Comments[0].Replies, models.CommentReply{ID: "r2", UserID: "u1", ImportedAuthor: "carol"})
+	next := 0
+	b.Remap("new", func() string {
+		next++
+		return fmt.Sprintf("id%d", next)
+	}, "importer")
+
+	asset := b.Manifest.Assets[0]
+	if asset.ID != "id1" || asset.ProjectID != "new" || string(b.AssetData["id1"]) != "png bytes" || len(b.AssetData) != 1 {
+		t.Errorf("Expected the asset to be renamed, got %#v %v", asset, b.AssetData)
+	}
+	if asset.UserID != "importer" || asset.ImportedAuthor != "alice" {
+		t.Errorf("Expected the asset to be attributed to the importer, got %#v", asset)
+	}
+	image := b.Canvases[0].VectorData.Elements[1].(VectorGroup).Children[0].(VectorImage)
+	if image.AssetID != "id1" {
+		t.Errorf("Expected images to follow their asset, got %q", image.AssetID)
+	}
+	comment := b.Comments[0]
+	if comment.ID != "id2" || comment.ProjectID != "new" {
+		t.Errorf("Expected the comment to be renamed, got %#v", comment)
+	}
+	// the users of the bundle are never taken for accounts of this server
+	if comment.UserID != "importer" || comment.ResolvedBy != "importer" || comment.ImportedAuthor != "bob" {
+		t.Errorf("Expected the comment to be attributed to the importer, got %#v", comment)
+	}
+	if reply := comment.Replies[0]; reply.ID != "id3" || reply.UserID != "importer" || reply.ImportedAuthor != "alice" {
+		t.Errorf("Expected the reply to be renamed and attributed to the importer, got %#v", reply)
+	}
+	if reply := comment.Replies[1]; reply.ImportedAuthor != "carol" {
+		t.Errorf("Expected the author of an earlier import to be kept, got %#v", reply)
+	}
+	if comment.Anchor.CanvasID != "second" || comment.Anchor.ElementID != "r" {
+		t.Errorf("Expected the IDs scoped to the project to be kept, got %#v", comment.Anchor)
+	}
+}
+
+// zipEntries builds an archive out of named entries
+func zipEntries(t *testing.T, entries map[string]string) []byte {
+	t.Helper()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	for name, content := range entries {
+		entry, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = entry.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archive.Bytes()
+}
+
+func TestReadBundleMigratesVersion1(t *testing.T) {
+	canvases, _ := json.Marshal([]map[string]interface{}{
+		{"id": "b", "vectorData": map[string]interface{}{"width": 10, "height": 10, "elements": []interface{}{
+			map[string]interface{}{"id": "c", "type": "circle", "cx": 1, "cy": 1, "radius": 1},
+		}}},
+		{"id": "a", "vectorData": map[string]interface{}{"width": 5, "height": 5}},
+	})
+	data := zipEntries(t, map[string]string{
+		"manifest.json":  `{"format":"phaint","version":1,"project":{"name":"Old"}}`,
+		"canvases.json":  string(canvases),
+		"comments.json":  `[]`,
+		"unrelated.txt":  "ignored",
+		"assets/missing": "ignored",
+	})
+	b, err := ReadBundle(data, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Manifest.Version != BundleVersion || len(b.Canvases) != 2 || b.Canvases[0].ID != "b" || b.Canvases[1].ID != "a" {
+		t.Fatalf("Expected the canvases of a version 1 bundle in order, got %#v", b)
+	}
+	if len(b.Canvases[0].VectorData.Elements) != 1 || len(b.Canvases[1].VectorData.Elements) != 0 {
+		t.Errorf("Expected the elements to be migrated, got %#v", b.Canvases)
+	}
+}
+
+func TestReadBundleErrors(t *testing.T) {
+	if _, err := ReadBundle([]byte("not a zip"), 1<<20); err != ErrInvalidBundle {
+		t.Errorf("Expected other files to be refused, got %v", err)
+	}
+	if _, err := ReadBundle(zipEntries(t, map[string]string{"manifest.json": `{"format":"other","version":2}`}), 1<<20); err != ErrInvalidBundle {
+		t.Errorf("Expected other archives to be refused, got %v", err)
+	}
+	if _, err := ReadBundle(zipEntries(t, map[string]string{"manifest.json": `{"format":"phaint","version":99}`}), 1<<20); err != ErrBundleVersion {
+		t.Errorf("Expected newer bundles to be refused, got %v", err)
+	}
+	duplicate := zipEntries(t, map[string]string{
+		"manifest.json":   `{"format":"phaint","version":2,"canvases":["a","a"]}`,
+		"canvases/1.json": `{"id":"a"}`,
+		"canvases/2.json": `{"id":"a"}`,
+	})
+	if _, err := ReadBundle(duplicate, 1<<20); err == nil || !strings.Contains(err.Error(), "duplicate") {
+		t.Errorf("Expected duplicate canvases to be refused, got %v", err)
+	}
+	badStyle := zipEntries(t, map[string]string{
+		"manifest.json":   `{"format":"phaint","version":2,"canvases":["a"]}`,
+		"canvases/1.json": `{"id":"a","vectorData":{"elements":[{"id":"r","type":"rectangle","fill":"url(#x)"}]}}`,
+	})
+	if _, err := ReadBundle(badStyle, 1<<20); !errors.Is(err, ErrInvalidBundle) || !strings.Contains(err.Error(), "fill") {
+		t.Errorf("Expected invalid styles to be refused, got %v", err)
+	}
+	missing := zipEntries(t, map[string]string{"manifest.json": `{"format":"phaint","version":2,"canvases":["a"]}`})
+	if _, err := ReadBundle(missing, 1<<20); err == nil {
+		t.Error("Expected missing canvases to be refused")
+	}
+
+	data, _ := WriteBundle(Bundle{AssetData: map[string][]byte{}, Manifest: BundleManifest{
+		Assets: []models.Asset{{ID: "big"}},
+	}, Canvases: []Canvas{}})
+	large, _ := WriteBundle(Bundle{
+		Manifest:  BundleManifest{Assets: []models.Asset{{ID: "big"}}},
+		AssetData: map[string][]byte{"big": bytes.Repeat([]byte{0}, 4096)},
+	})
+	if _, err := ReadBundle(data, 4096); err != nil {
+		t.Errorf("Expected small bundles to be read, got %v", err)
+	}
+	if _, err := ReadBundle(large, 4096); err != ErrBundleTooLarge {
+		t.Errorf("Expected the uncompressed size to be bounded, got %v", err)
+	}
+}
@@ -2,7 +2,10 @@ package services
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"slices"
 	"sync"
 	"time"
 )
@@ -25,6 +28,20 @@ type VectorShape struct {
 	StrokeWidth float64 `firestore:"strokeWidth" json:"strokeWidth"`
 	Fill        string  `firestore:"fill" json:"fill"`
 	Action      Action  `firestore:"action" json:"action"`
+	Transform   *Matrix `firestore:"transform,omitempty" json:"transform,omitempty"`
+	Layer       string  `firestore:"layer,omitempty" json:"layer,omitempty"`
+	ZIndex      string  `firestore:"zIndex,omitempty" json:"zIndex,omitempty"`
+	// styling added later, missing values keep the look of older documents
+	StrokeOpacity   *float64  `firestore:"strokeOpacity,omitempty" json:"strokeOpacity,omitempty"`
+	FillOpacity     *float64  `firestore:"fillOpacity,omitempty" json:"fillOpacity,omitempty"`
+	StrokeDasharray []float64 `firestore:"strokeDasharray,omitempty" json:"strokeDasharray,omitempty"`
+	LineCap         string    `firestore:"lineCap,omitempty" json:"lineCap,omitempty"`
+	LineJoin        string    `firestore:"lineJoin,omitempty" json:"lineJoin,omitempty"`
+	FillGradient    *Gradient `firestore:"fillGradient,omitempty" json:"fillGradient,omitempty"`
+	Shadow          *Shadow   `firestore:"shadow,omitempty" json:"shadow,omitempty"`
+	BlendMode       string    `firestore:"blendMode,omitempty" json:"blendMode,omitempty"`
+	// PresetID links the element to a style preset of the project, which then owns its styling
+	PresetID string `firestore:"presetId,omitempty" json:"presetId,omitempty"`
 }
 
 // VectorPath struct
@@ -32,6 +49,9 @@ type VectorPath struct {
 	VectorShape
 	Type   string  `firestore:"type" json:"type"`
 	Points []Point `firestore:"points" json:"points"`
+	// Segments curves the path between consecutive points, it is drawn as straight lines without them
+	Segments []BezierSegment `firestore:"segments,omitempty" json:"segments,omitempty"`
+	Closed   bool            `firestore:"closed,omitempty" json:"closed,omitempty"`
 }
 
 // VectorRectangle struct
@@ -53,6 +73,119 @@ type VectorCircle struct {
 	Radius float64 `firestore:"radius" json:"radius"`
 }
 
+// VectorEllipse struct
+type VectorEllipse struct {
+	VectorShape
+	Type string  `firestore:"type" json:"type"`
+	CX   float64 `firestore:"cx" json:"cx"`
+	CY   float64 `firestore:"cy" json:"cy"`
+	RX   float64 `firestore:"rx" json:"rx"`
+	RY   float64 `firestore:"ry" json:"ry"`
+}
+
+// VectorLine struct for straight segments
+type VectorLine struct {
+	VectorShape
+	Type string  `firestore:"type" json:"type"`
+	X1   float64 `firestore:"x1" json:"x1"`
+	Y1   float64 `firestore:"y1" json:"y1"`
+	X2   float64 `firestore:"x2" json:"x2"`
+	Y2   float64 `firestore:"y2" json:"y2"`
+}
+
+// VectorPolyline struct for open chains of straight segments
+type VectorPolyline struct {
+	VectorShape
+	Type   string  `firestore:"type" json:"type"`
+	Points []Point `firestore:"points" json:"points"`
+}
+
+// VectorPolygon struct for closed chains of straight segments
+type VectorPolygon struct {
+	VectorShape
+	Type   string  `firestore:"type" json:"type"`
+	Points []Point `firestore:"points" json:"points"`
+}
+
+// Arrow head styles
+const (
+	ArrowHeadNone     = "none"
+	ArrowHeadTriangle = "triangle"
+	ArrowHeadOpen     = "open"
+	ArrowHeadDiamond  = "diamond"
+	ArrowHeadCircle   = "circle"
+	ArrowHeadBar      = "bar"
+)
+
+// VectorArrow struct, a line with a head style on each end
+type VectorArrow struct {
+	VectorShape
+	Type      string  `firestore:"type" json:"type"`
+	X1        float64 `firestore:"x1" json:"x1"`
+	Y1        float64 `firestore:"y1" json:"y1"`
+	X2        float64 `firestore:"x2" json:"x2"`
+	Y2        float64 `firestore:"y2" json:"y2"`
+	StartHead string  `firestore:"startHead" json:"startHead"`
+	EndHead   string  `firestore:"endHead" json:"endHead"`
+	HeadSize  float64 `firestore:"headSize" json:"headSize"`
+}
+
+// Text alignments
+const (
+	TextAlignLeft    = "left"
+	TextAlignCenter  = "center"
+	TextAlignRight   = "right"
+	TextAlignJustify = "justify"
+)
+
+// TextRun is a span of a text element sharing the same style, empty fields inherit the element style
+type TextRun struct {
+	Text          string  `firestore:"text" json:"text"`
+	FontFamily    string  `firestore:"fontFamily" json:"fontFamily,omitempty"`
+	FontSize      float64 `firestore:"fontSize" json:"fontSize,omitempty"`
+	FontWeight    string  `firestore:"fontWeight" json:"fontWeight,omitempty"`
+	Italic        bool    `firestore:"italic" json:"italic,omitempty"`
+	Underline     bool    `firestore:"underline" json:"underline,omitempty"`
+	Strikethrough bool    `firestore:"strikethrough" json:"strikethrough,omitempty"`
+	Color         string  `firestore:"color" json:"color,omitempty"`
+}
+
+// VectorText struct, Text is always the concatenation of the runs when there are any
+type VectorText struct {
+	VectorShape
+	Type       string    `firestore:"type" json:"type"`
+	X          float64   `firestore:"x" json:"x"`
+	Y          float64   `firestore:"y" json:"y"`
+	Width      float64   `firestore:"width" json:"width"`
+	Text       string    `firestore:"text" json:"text"`
+	FontFamily string    `firestore:"fontFamily" json:"fontFamily"`
+	FontSize   float64   `firestore:"fontSize" json:"fontSize"`
+	FontWeight string    `firestore:"fontWeight" json:"fontWeight"`
+	Align      string    `firestore:"align" json:"align"`
+	LineHeight float64   `firestore:"lineHeight" json:"lineHeight"`
+	Color      string    `firestore:"color" json:"color"`
+	Runs       []TextRun `firestore:"runs" json:"runs"`
+	Revision   int       `firestore:"revision" json:"revision"`
+}
+
+// VectorImage struct, an uploaded asset placed on the canvas
+type VectorImage struct {
+	VectorShape
+	Type    string  `firestore:"type" json:"type"`
+	X       float64 `firestore:"x" json:"x"`
+	Y       float64 `firestore:"y" json:"y"`
+	Width   float64 `firestore:"width" json:"width"`
+	Height  float64 `firestore:"height" json:"height"`
+	AssetID string  `firestore:"assetId" json:"assetId"`
+}
+
+// VectorGroup struct, children coordinates are expressed in the group space set by its transform
+type VectorGroup struct {
+	VectorShape
+	Type     string          `firestore:"type" json:"type"`
+	Children []VectorElement `firestore:"children" json:"children"`
+}
+
 // VectorElement interface{} to cover the above types
 type VectorElement interface{}
 
@@ -61,6 +194,7 @@ type VectorData struct {
 	Width          float64         `firestore:"width" json:"width"`
 	Height         float64         `firestore:"height" json:"height"`
 	BackgroundFill string          `firestore:"backgroundFill" json:"backgroundFill"`
+	Layers         []Layer         `firestore:"layers" json:"layers"`
 	Elements       []VectorElement `firestore:"elements" json:"elements"`
 	Timestamp      string          `firestore:"timestamp" json:"timestamp"`
 	Version        string          `firestore:"version" json:"version"`
@@ -75,15 +209,27 @@ type Canvas struct {
 // CanvasService manages multiple canvases safely
 type CanvasService struct {
 	canvases map[string]*Canvas
-	mutex    sync.RWMutex
+	// order lists the canvas IDs as they were added, which is the order of the pages of a project
+	order       []string
+	textHistory map[string][]TextOperation
+	mutex       sync.RWMutex
+	// spatial indexes are built lazily by queries, under their own mutex as queries only read canvases
+	indexes    map[string]*spatialIndex
+	indexMutex sync.Mutex
+	// changed and removed list the canvases modified or deleted since they were last saved, orderChanged
+	// tells whether canvases were added or removed since then
+	changed      map[string]bool
+	removed      map[string]bool
+	orderChanged bool
 }
 
+// GetAllCanvases returns the canvases in the order they were added
 func (c *CanvasService) GetAllCanvases() []*Canvas {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	canvases := make([]*Canvas, 0, len(c.canvases))
-	for _, canvas := range c.canvases {
-		canvases = append(canvases, canvas)
+	canvases := make([]*Canvas, 0, len(c.order))
+	for _, id := range c.order {
+		canvases = append(canvases, c.canvases[id])
 	}
 	return canvases
 }
@@ -91,7 +237,11 @@ func (c *CanvasService) GetAllCanvases() []*Canvas {
 // Constructor
 func NewCanvasService() *CanvasService {
 	return &CanvasService{
-		canvases: make(map[string]*Canvas),
+		canvases:    make(map[string]*Canvas),
+		textHistory: make(map[string][]TextOperation),
+		indexes:     make(map[string]*spatialIndex),
+		changed:     make(map[string]bool),
+		removed:     make(map[string]bool),
 	}
 }
 
@@ -106,14 +256,30 @@ func (c *CanvasService) GetCanvas(id string) *Canvas {
 func (c *CanvasService) AddOrUpdateCanvas(canvas Canvas) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	repairZIndexes(canvas.VectorData.Elements)
+	if _, exists := c.canvases[canvas.ID]; !exists {
+		c.order = append(c.order, canvas.ID)
+		c.orderChanged = true
+	}
 	c.canvases[canvas.ID] = &canvas
+	c.invalidateIndex(canvas.ID)
+	c.markChanged(canvas.ID)
 }
 
 // RemoveCanvas deletes a canvas from the map
 func (c *CanvasService) RemoveCanvas(id string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if _, exists := c.canvases[id]; exists {
+		c.order = slices.DeleteFunc(c.order, func(other string) bool {
+			return other == id
+		})
+		c.orderChanged = true
+		delete(c.changed, id)
+		c.removed[id] = true
+	}
 	delete(c.canvases, id)
+	c.invalidateIndex(id)
 }
 
 // UpdateCanvasElement updates elements and metadata of a canvas
@@ -124,7 +290,14 @@ func (c *CanvasService) UpdateCanvasElement(id string, element VectorElement) bo
 	if !exists {
 		return false
 	}
-	canvas.VectorData.Elements = append(canvas.VectorData.Elements, element)
+	count := len(canvas.VectorData.Elements)
+	canvas.VectorData.Elements = insertByZIndex(canvas.VectorData.Elements, element)
+	if ElementID(canvas.VectorData.Elements[count]) == ElementID(element) {
+		c.appendToIndex(canvas)
+	} else {
+		c.invalidateIndex(id)
+	}
+	c.markChanged(id)
 	return true
 }
 
@@ -137,18 +310,15 @@ func (c *CanvasService) UpdateCanvasBackground(id string, backgroundFill string)
 		return false
 	}
 	canvas.VectorData.BackgroundFill = backgroundFill
+	c.markChanged(id)
 	return true
 }
 
-// ListCanvasIDs returns all canvas IDs currently present
+// ListCanvasIDs returns all canvas IDs currently present, in the order they were added
 func (c *CanvasService) ListCanvasIDs() []string {
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
-	ids := make([]string, 0, len(c.canvases))
-	for id := range c.canvases {
-		ids = append(ids, id)
-	}
-	return ids
+	return append([]string{}, c.order...)
 }
 
 func (c *CanvasService) UpdateCanvasWithAction(canvasId string, vectorElementId string, action Action) bool {
@@ -158,37 +328,126 @@ func (c *CanvasService) UpdateCanvasWithAction(canvasId string, vectorElementId
 	if !exists {
 		return false
 	}
-	for i := 0; i < len(canvas.VectorData.Elements); i++ {
-		switch canvas.VectorData.Elements[i].(type) {
-		case VectorCircle:
-			if c, ok := canvas.VectorData.Elements[i].(VectorCircle); ok {
-				if c.ID == vectorElementId {
-					c.Action = action
-					canvas.VectorData.Elements[i] = c
-				}
-			}
-			break
-		case VectorRectangle:
-			if c, ok := canvas.VectorData.Elements[i].(VectorRectangle); ok {
-				if c.ID == vectorElementId {
-					c.Action = action
-					canvas.VectorData.Elements[i] = c
-				}
-			}
-			break
-		case VectorPath:
-			if c, ok := canvas.VectorData.Elements[i].(VectorPath); ok {
-				if c.ID == vectorElementId {
-					c.Action = action
-					canvas.VectorData.Elements[i] = c
-				}
-			}
-			break
-		}
-	}
+	updateElement(canvas.VectorData.Elements, vectorElementId, func(element VectorElement) VectorElement {
+		return updateShape(element, func(shape *VectorShape) {
+			shape.Action = action
+		})
+	})
+	c.markChanged(canvasId)
 	return true
 }
 
+// Shape returns the shared fields of an element, it is promoted to every element type
+func (s VectorShape) Shape() VectorShape {
+	return s
+}
+
+// ElementShape returns the shared fields of any vector element
+func ElementShape(element VectorElement) (VectorShape, bool) {
+	if shaped, ok := element.(interface{ Shape() VectorShape }); ok {
+		return shaped.Shape(), true
+	}
+	return VectorShape{}, false
+}
+
+// ElementID returns the ID of any vector element
+func ElementID(element VectorElement) string {
+	shape, _ := ElementShape(element)
+	return shape.ID
+}
+
+// updateShape applies a change to the shared fields of an element and returns the updated element
+func updateShape(element VectorElement, change func(shape *VectorShape)) VectorElement {
+	switch e := element.(type) {
+	case VectorPath:
+		change(&e.VectorShape)
+		return e
+	case VectorRectangle:
+		change(&e.VectorShape)
+		return e
+	case VectorCircle:
+		change(&e.VectorShape)
+		return e
+	case VectorEllipse:
+		change(&e.VectorShape)
+		return e
+	case VectorLine:
+		change(&e.VectorShape)
+		return e
+	case VectorPolyline:
+		change(&e.VectorShape)
+		return e
+	case VectorPolygon:
+		change(&e.VectorShape)
+		return e
+	case VectorArrow:
+		change(&e.VectorShape)
+		return e
+	case VectorText:
+		change(&e.VectorShape)
+		return e
+	case VectorImage:
+		change(&e.VectorShape)
+		return e
+	case VectorGroup:
+		change(&e.VectorShape)
+		return e
+	}
+	return element
+}
+
+// ElementOrigin returns the reference point of an element before its own transform, used to pin things to it
+func ElementOrigin(element VectorElement) (Point, bool) {
+	switch e := element.(type) {
+	case VectorPath:
+		return firstPoint(e.Points)
+	case VectorRectangle:
+		return Point{X: e.X, Y: e.Y}, true
+	case VectorCircle:
+		return Point{X: e.CX, Y: e.CY}, true
+	case VectorEllipse:
+		return Point{X: e.CX, Y: e.CY}, true
+	case VectorLine:
+		return Point{X: e.X1, Y: e.Y1}, true
+	case VectorArrow:
+		return Point{X: e.X1, Y: e.Y1}, true
+	case VectorText:
+		return Point{X: e.X, Y: e.Y}, true
+	case VectorImage:
+		return Point{X: e.X, Y: e.Y}, true
+	case VectorGroup:
+		return Point{}, true
+	case VectorPolyline:
+		return firstPoint(e.Points)
+	case VectorPolygon:
+		return firstPoint(e.Points)
+	}
+	return Point{}, false
+}
+
+func firstPoint(points []Point) (Point, bool) {
+	if len(points) == 0 {
+		return Point{}, false
+	}
+	return points[0], true
+}
+
+// FindElementOrigin returns the reference point of an element of a canvas in canvas coordinates; false when the element does not exist
+func (c *CanvasService) FindElementOrigin(canvasId string, vectorElementId string) (Point, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return Point{}, false
+	}
+	element, world, _, found := findElement(canvas.VectorData.Elements, vectorElementId, Identity(), nil)
+	if !found {
+		return Point{}, false
+	}
+	origin, ok := ElementOrigin(element)
+	return world.Multiply(elementTransform(element)).Apply(origin), ok
+}
+
 // Helper for current timestamp string
 func GetCurrentTimestamp() string {
 	return time.Now().Format(time.RFC3339)
@@ -222,31 +481,8 @@ func ParseVectorElementsFromRaw(dataMap map[string]interface{}) []VectorElement
 			continue
 		}
 
-		t := getString(elemMap, "type")
-		jsonData, err := json.Marshal(elemMap)
-		if err != nil {
-			log.Println(err)
-			continue
-		}
-
-		switch t {
-		case "path":
-			var path VectorPath
-			if err := json.Unmarshal(jsonData, &path); err == nil {
-				elements = append(elements, path)
-			}
-		case "rectangle":
-			var rect VectorRectangle
-			if err := json.Unmarshal(jsonData, &rect); err == nil {
-				elements = append(elements, rect)
-			}
-		case "circle":
-			var circle VectorCircle
-			if err := json.Unmarshal(jsonData, &circle); err == nil {
-				elements = append(elements, circle)
-			}
-		default:
-			log.Printf("Unknown vector element type: %s", t)
+		if element := ParseSingleStrokeFromRaw(elemMap); element != nil {
+			elements = append(elements, element)
 		}
 	}
 	return elements
@@ -256,29 +492,121 @@ func ParseSingleStrokeFromRaw(dataMap map[string]interface{}) VectorElement {
 	t := getString(dataMap, "type")
 	jsonData, err := json.Marshal(dataMap)
 	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	element, err := parseElement(t, jsonData)
+	if err == nil && !validTransform(elementTransformPtr(element)) {
+		err = errors.New("transform is not invertible")
+	}
+	if err != nil {
+		log.Printf("Invalid vector element of type %s: %v", t, err)
 		return nil
 	}
+	return element
+}
+
+// parseElement decodes the JSON of a single element according to its type
+func parseElement(t string, jsonData []byte) (VectorElement, error) {
 	switch t {
 	case "path":
 		var path VectorPath
-		if err := json.Unmarshal(jsonData, &path); err == nil {
-			return path
+		err := json.Unmarshal(jsonData, &path)
+		if len(path.Segments) != segmentCount(path) {
+			// curves which do not match the points are dropped, the path stays readable as straight lines
+			path.Segments = nil
 		}
+		return path, err
 	case "rectangle":
 		var rect VectorRectangle
-		if err := json.Unmarshal(jsonData, &rect); err == nil {
-			return rect
-		}
+		err := json.Unmarshal(jsonData, &rect)
+		return rect, err
 	case "circle":
 		var circle VectorCircle
-		if err := json.Unmarshal(jsonData, &circle); err == nil {
-			return circle
+		err := json.Unmarshal(jsonData, &circle)
+		return circle, err
+	case "ellipse":
+		var ellipse VectorEllipse
+		err := json.Unmarshal(jsonData, &ellipse)
+		return ellipse, err
+	case "line":
+		var line VectorLine
+		err := json.Unmarshal(jsonData, &line)
+		return line, err
+	case "polyline":
+		var polyline VectorPolyline
+		err := json.Unmarshal(jsonData, &polyline)
+		return polyline, err
+	case "polygon":
+		var polygon VectorPolygon
+		err := json.Unmarshal(jsonData, &polygon)
+		return polygon, err
+	case "arrow":
+		// arrows point forward unless told otherwise
+		arrow := VectorArrow{StartHead: ArrowHeadNone, EndHead: ArrowHeadTriangle}
+		if err := json.Unmarshal(jsonData, &arrow); err != nil {
+			return nil, err
+		}
+		if !validArrowHead(arrow.StartHead) || !validArrowHead(arrow.EndHead) {
+			return nil, fmt.Errorf("unknown arrow head style %q/%q", arrow.StartHead, arrow.EndHead)
+		}
+		return arrow, nil
+	case "text":
+		text := VectorText{
+			FontFamily: "sans-serif",
+			FontSize:   16,
+			FontWeight: "normal",
+			Align:      TextAlignLeft,
+			LineHeight: 1.2,
+			Color:      "#000000",
+		}
+		if err := json.Unmarshal(jsonData, &text); err != nil {
+			return nil, err
 		}
-	default:
-		log.Printf("Unknown vector element type: %s", t)
-		// Optional: handle unknown types here or skip
+		if !validTextAlign(text.Align) {
+			return nil, fmt.Errorf("unknown text alignment %q", text.Align)
+		}
+		if len(text.Runs) > 0 {
+			text.Text = runsText(text.Runs)
+		}
+		return text, nil
+	case "image":
+		var img VectorImage
+		if err := json.Unmarshal(jsonData, &img); err != nil {
+			return nil, err
+		}
+		if img.AssetID == "" {
+			return nil, errors.New("image without asset")
+		}
+		return img, nil
+	case "group":
+		var group VectorGroup
+		if err := json.Unmarshal(jsonData, &group); err != nil {
+			return nil, err
+		}
+		// children are decoded as generic maps and parsed like top level elements
+		children := []VectorElement{}
+		for _, child := range group.Children {
+			childMap, ok := child.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if element := ParseSingleStrokeFromRaw(childMap); element != nil {
+				children = append(children, element)
+			}
+		}
+		group.Children = children
+		return group, nil
+	}
+	return nil, fmt.Errorf("unknown vector element type: %s", t)
+}
+
+func validArrowHead(style string) bool {
+	switch style {
+	case ArrowHeadNone, ArrowHeadTriangle, ArrowHeadOpen, ArrowHeadDiamond, ArrowHeadCircle, ArrowHeadBar:
+		return true
 	}
-	return nil
+	return false
 }
 
 func getString(m map[string]interface{}, key string) string {
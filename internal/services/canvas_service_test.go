@@ -1,6 +1,8 @@
 package services
 
 import (
+	"encoding/json"
+	"reflect"
 	"testing"
 )
 
@@ -173,6 +175,15 @@ func TestGetAllCanvases(t *testing.T) {
 	if len(canvases) != 2 {
 		t.Errorf("Expected 2 canvases, got %d", len(canvases))
 	}
+
+	// canvases keep the order they were added in, updates included
+	cs.AddOrUpdateCanvas(Canvas{ID: "canvas-0"})
+	cs.AddOrUpdateCanvas(Canvas{ID: "canvas-1", VectorData: VectorData{Width: 300}})
+	cs.RemoveCanvas("canvas-2")
+	canvases = cs.GetAllCanvases()
+	if len(canvases) != 2 || canvases[0].ID != "canvas-1" || canvases[0].VectorData.Width != 300 || canvases[1].ID != "canvas-0" {
+		t.Errorf("Expected canvas-1 then canvas-0, got %v", canvases)
+	}
 }
 
 func TestUpdateCanvasWithAction(t *testing.T) {
@@ -332,3 +343,147 @@ func TestVectorDataMarshalElements(t *testing.T) {
 		t.Error("First marshaled element is not a VectorPath")
 	}
 }
+
+func TestFindElementOrigin(t *testing.T) {
+	cs := NewCanvasService()
+	cs.AddOrUpdateCanvas(Canvas{
+		ID: "test-canvas-7",
+		VectorData: VectorData{
+			Elements: []VectorElement{
+				VectorPath{VectorShape: VectorShape{ID: "path-1"}, Type: "path", Points: []Point{{X: 5, Y: 6}, {X: 7, Y: 8}}},
+				VectorCircle{VectorShape: VectorShape{ID: "circle-1"}, Type: "circle", CX: 40, CY: 50, Radius: 10},
+			},
+		},
+	})
+
+	origin, ok := cs.FindElementOrigin("test-canvas-7", "circle-1")
+	if !ok {
+		t.Fatal("Expected origin for existing circle")
+	}
+	if origin.X != 40 || origin.Y != 50 {
+		t.Errorf("Expected origin (40, 50), got (%f, %f)", origin.X, origin.Y)
+	}
+
+	origin, ok = cs.FindElementOrigin("test-canvas-7", "path-1")
+	if !ok || origin.X != 5 || origin.Y != 6 {
+		t.Errorf("Expected path origin (5, 6), got (%f, %f)", origin.X, origin.Y)
+	}
+
+	if _, ok := cs.FindElementOrigin("test-canvas-7", "missing"); ok {
+		t.Error("Expected no origin for missing element")
+	}
+	if _, ok := cs.FindElementOrigin("missing", "circle-1"); ok {
+		t.Error("Expected no origin for missing canvas")
+	}
+}
+
+func TestParseNewShapeTypes(t *testing.T) {
+	rawData := map[string]interface{}{
+		"vectorData": map[string]interface{}{
+			"elements": []interface{}{
+				map[string]interface{}{"type": "ellipse", "id": "ellipse-1", "cx": 10.0, "cy": 20.0, "rx": 30.0, "ry": 15.0},
+				map[string]interface{}{"type": "line", "id": "line-1", "x1": 0.0, "y1": 0.0, "x2": 100.0, "y2": 50.0},
+				map[string]interface{}{"type": "polyline", "id": "polyline-1", "points": []interface{}{
+					map[string]interface{}{"x": 1.0, "y": 2.0},
+					map[string]interface{}{"x": 3.0, "y": 4.0},
+				}},
+				map[string]interface{}{"type": "polygon", "id": "polygon-1", "points": []interface{}{
+					map[string]interface{}{"x": 0.0, "y": 0.0},
+					map[string]interface{}{"x": 10.0, "y": 0.0},
+					map[string]interface{}{"x": 5.0, "y": 10.0},
+				}},
+				map[string]interface{}{"type": "arrow", "id": "arrow-1", "x1": 0.0, "y1": 0.0, "x2": 40.0, "y2": 0.0, "startHead": "circle", "headSize": 12.0},
+				map[string]interface{}{"type": "hexagon", "id": "unknown-1"},
+			},
+		},
+	}
+
+	elements := ParseVectorElementsFromRaw(rawData)
+	if len(elements) != 5 {
+		t.Fatalf("Expected 5 elements, got %d", len(elements))
+	}
+
+	if ellipse, ok := elements[0].(VectorEllipse); !ok || ellipse.RX != 30 || ellipse.RY != 15 {
+		t.Errorf("Expected ellipse with radii (30, 15), got %#v", elements[0])
+	}
+	if line, ok := elements[1].(VectorLine); !ok || line.X2 != 100 || line.Y2 != 50 {
+		t.Errorf("Expected line ending at (100, 50), got %#v", elements[1])
+	}
+	if polyline, ok := elements[2].(VectorPolyline); !ok || len(polyline.Points) != 2 {
+		t.Errorf("Expected polyline with 2 points, got %#v", elements[2])
+	}
+	if polygon, ok := elements[3].(VectorPolygon); !ok || len(polygon.Points) != 3 {
+		t.Errorf("Expected polygon with 3 points, got %#v", elements[3])
+	}
+	arrow, ok := elements[4].(VectorArrow)
+	if !ok {
+		t.Fatalf("Expected arrow, got %#v", elements[4])
+	}
+	if arrow.StartHead != ArrowHeadCircle {
+		t.Errorf("Expected start head '%s', got '%s'", ArrowHeadCircle, arrow.StartHead)
+	}
+	if arrow.EndHead != ArrowHeadTriangle {
+		t.Errorf("Expected default end head '%s', got '%s'", ArrowHeadTriangle, arrow.EndHead)
+	}
+}
+
+func TestParseArrowInvalidHead(t *testing.T) {
+	element := ParseSingleStrokeFromRaw(map[string]interface{}{
+		"type":    "arrow",
+		"id":      "arrow-2",
+		"endHead": "banana",
+	})
+	if element != nil {
+		t.Errorf("Expected nil for unknown arrow head, got %#v", element)
+	}
+}
+
+// Elements are persisted as structs and read back from Firestore as generic maps
+func TestNewShapeTypesRoundTrip(t *testing.T) {
+	shapes := []VectorElement{
+		VectorEllipse{VectorShape: VectorShape{ID: "ellipse-1", Stroke: "#000000", StrokeWidth: 2}, Type: "ellipse", CX: 1, CY: 2, RX: 3, RY: 4},
+		VectorLine{VectorShape: VectorShape{ID: "line-1"}, Type: "line", X1: 1, Y1: 2, X2: 3, Y2: 4},
+		VectorPolyline{VectorShape: VectorShape{ID: "polyline-1"}, Type: "polyline", Points: []Point{{X: 1, Y: 1}, {X: 2, Y: 2}}},
+		VectorPolygon{VectorShape: VectorShape{ID: "polygon-1", Fill: "#ff0000"}, Type: "polygon", Points: []Point{{X: 0, Y: 0}, {X: 1, Y: 0}, {X: 0, Y: 1}}},
+		VectorArrow{VectorShape: VectorShape{ID: "arrow-1"}, Type: "arrow", X2: 10, StartHead: ArrowHeadDiamond, EndHead: ArrowHeadOpen, HeadSize: 8},
+	}
+
+	for _, shape := range shapes {
+		jsonData, err := json.Marshal(shape)
+		if err != nil {
+			t.Fatalf("Error marshaling %T: %v", shape, err)
+		}
+		var raw map[string]interface{}
+		if err := json.Unmarshal(jsonData, &raw); err != nil {
+			t.Fatalf("Error unmarshaling %T: %v", shape, err)
+		}
+		parsed := ParseSingleStrokeFromRaw(raw)
+		if !reflect.DeepEqual(parsed, shape) {
+			t.Errorf("Round trip mismatch for %T: got %#v, want %#v", shape, parsed, shape)
+		}
+	}
+}
+
+func TestUpdateCanvasWithActionNewShapes(t *testing.T) {
+	cs := NewCanvasService()
+	cs.AddOrUpdateCanvas(Canvas{
+		ID: "test-canvas-8",
+		VectorData: VectorData{
+			Elements: []VectorElement{
+				VectorEllipse{VectorShape: VectorShape{ID: "ellipse-1"}, Type: "ellipse"},
+				VectorArrow{VectorShape: VectorShape{ID: "arrow-1"}, Type: "arrow"},
+			},
+		},
+	})
+
+	action := Action{Type: "link", Link: "https://example.com"}
+	cs.UpdateCanvasWithAction("test-canvas-8", "arrow-1", action)
+
+	elements := cs.GetCanvas("test-canvas-8").VectorData.Elements
+	if arrow := elements[1].(VectorArrow); arrow.Action != action {
+		t.Errorf("Expected arrow action %v, got %v", action, arrow.Action)
+	}
+	if ellipse := elements[0].(VectorEllipse); ellipse.Action != (Action{}) {
+		t.Errorf("Expected ellipse action to be untouched, got %v", ellipse.Action)
+	}
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// CanvasChunkSize bounds the encoded size of the elements stored in a document, far enough from the 1 MiB
+// limit of Firestore documents for the fields it counts and JSON does not
+const CanvasChunkSize = 256 << 10
+
+// CanvasChanges are the canvases to save since the last ones were, as taken by TakeChanges
+type CanvasChanges struct {
+	// Canvases are copies of the added or modified canvases
+	Canvases []Canvas
+	Removed  []string
+	// Order lists every canvas ID when canvases were added or removed, nil otherwise
+	Order []string
+}
+
+func (changes CanvasChanges) Empty() bool {
+	return len(changes.Canvases) == 0 && len(changes.Removed) == 0 && changes.Order == nil
+}
+
+// snapshot copies a canvas so that it can be read once the service is unlocked. The children of groups are
+// copied as well, as they are updated in place
+func (canvas *Canvas) snapshot() Canvas {
+	snapshot := *canvas
+	snapshot.VectorData.Elements = copyElements(canvas.VectorData.Elements)
+	snapshot.VectorData.Layers = append([]Layer{}, canvas.VectorData.Layers...)
+	return snapshot
+}
+
+// copyElements copies a tree of elements down to the children of its groups
+func copyElements(elements []VectorElement) []VectorElement {
+	copied := make([]VectorElement, len(elements))
+	for i, element := range elements {
+		if group, ok := element.(VectorGroup); ok {
+			group.Children = copyElements(group.Children)
+			element = group
+		}
+		copied[i] = element
+	}
+	return copied
+}
+
+// markChanged records a modified canvas to save, the caller holds the write lock
+func (c *CanvasService) markChanged(canvasId string) {
+	c.changed[canvasId] = true
+	delete(c.removed, canvasId)
+}
+
+// TakeChanges returns the canvases modified or removed since the last call and forgets about them, the
+// caller saves them or hands them back with RequeueChanges
+func (c *CanvasService) TakeChanges() CanvasChanges {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	changes := CanvasChanges{}
+	// canvases are saved in project order
+	for _, id := range c.order {
+		if c.changed[id] {
+			changes.Canvases = append(changes.Canvases, c.canvases[id].snapshot())
+		}
+	}
+	for id := range c.removed {
+		changes.Removed = append(changes.Removed, id)
+	}
+	if c.orderChanged {
+		changes.Order = append([]string{}, c.order...)
+	}
+	c.changed = make(map[string]bool)
+	c.removed = make(map[string]bool)
+	c.orderChanged = false
+	return changes
+}
+
+// RequeueChanges marks changes which could not be saved as pending again, unless newer changes replaced them
+func (c *CanvasService) RequeueChanges(changes CanvasChanges) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, canvas := range changes.Canvases {
+		if _, exists := c.canvases[canvas.ID]; exists {
+			c.changed[canvas.ID] = true
+		}
+	}
+	for _, id := range changes.Removed {
+		if _, exists := c.canvases[id]; !exists {
+			c.removed[id] = true
+		}
+	}
+	if changes.Order != nil {
+		c.orderChanged = true
+	}
+}
+
+// MarkSaved forgets every pending change, as when the canvases were just loaded
+func (c *CanvasService) MarkSaved() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.changed = make(map[string]bool)
+	c.removed = make(map[string]bool)
+	c.orderChanged = false
+}
+
+// SplitElements packs elements in order into chunks whose JSON encoding stays under maxBytes, an element
+// larger than that getting a chunk of its own
+func SplitElements(elements []VectorElement, maxBytes int) ([][]VectorElement, error) {
+	chunks := [][]VectorElement{}
+	var chunk []VectorElement
+	size := 0
+	for _, element := range elements {
+		data, err := json.Marshal(element)
+		if err != nil {
+			return nil, err
+		}
+		if len(chunk) > 0 && size+len(data) > maxBytes {
+			chunks = append(chunks, chunk)
+			chunk, size = nil, 0
+		}
+		chunk = append(chunk, element)
+		size += len(data)
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks, nil
+}
+
+// CanvasDocumentID names the document of a canvas. Canvas IDs come from clients and are kept when Firestore
+// accepts them as document IDs, others are replaced by their hash behind a "~" which kept IDs never start with
+func CanvasDocumentID(canvasId string) string {
+	valid := canvasId != "" && canvasId != "." && canvasId != ".." && len(canvasId) <= 512 &&
+		utf8.ValidString(canvasId) && !strings.ContainsRune(canvasId, '/') && !strings.HasPrefix(canvasId, "~") &&
+		!(strings.HasPrefix(canvasId, "__") && strings.HasSuffix(canvasId, "__"))
+	if valid {
+		return canvasId
+	}
+	sum := sha256.Sum256([]byte(canvasId))
+	return "~" + hex.EncodeToString(sum[:])
+}
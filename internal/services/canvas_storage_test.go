@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testStorageService() *CanvasService {
+	cs := NewCanvasService()
+	cs.AddOrUpdateCanvas(Canvas{ID: "a", VectorData: VectorData{Width: 10, Height: 10}})
+	cs.AddOrUpdateCanvas(Canvas{ID: "b", VectorData: VectorData{Width: 20, Height: 20}})
+	cs.MarkSaved()
+	return cs
+}
+
+func TestTakeChanges(t *testing.T) {
+	cs := testStorageService()
+	if changes := cs.TakeChanges(); !changes.Empty() {
+		t.Fatalf("Expected no changes after saving, got %#v", changes)
+	}
+
+	cs.UpdateCanvasBackground("b", "#ff0000")
+	changes := cs.TakeChanges()
+	if len(changes.Canvases) != 1 || changes.Canvases[0].VectorData.BackgroundFill != "#ff0000" || changes.Order != nil {
+		t.Fatalf("Expected only the modified canvas, got %#v", changes)
+	}
+	if !cs.TakeChanges().Empty() {
+		t.Error("Expected taken changes to be forgotten")
+	}
+
+	cs.UpdateCanvasElement("a", VectorRectangle{VectorShape: VectorShape{ID: "r"}, Type: "rectangle"})
+	changes = cs.TakeChanges()
+	changes.Canvases[0].VectorData.Elements[0] = nil
+	if ElementID(cs.GetCanvas("a").VectorData.Elements[0]) != "r" {
+		t.Error("Expected the changes to hold copies of the canvases")
+	}
+
+	cs.AddOrUpdateCanvas(Canvas{ID: "c"})
+	cs.RemoveCanvas("a")
+	changes = cs.TakeChanges()
+	if len(changes.Canvases) != 1 || changes.Canvases[0].ID != "c" || !reflect.DeepEqual(changes.Removed, []string{"a"}) {
+		t.Errorf("Expected the added and removed canvases, got %#v", changes)
+	}
+	if !reflect.DeepEqual(changes.Order, []string{"b", "c"}) {
+		t.Errorf("Expected the new order, got %v", changes.Order)
+	}
+}
+
+func TestTakeChangesTracksMutations(t *testing.T) {
+	cs := testStorageService()
+	cs.UpdateCanvasElement("a", VectorRectangle{VectorShape: VectorShape{ID: "r"}, Type: "rectangle", Width: 1, Height: 1})
+	cs.TakeChanges()
+
+	// mutations run in order, ungrouping the group made before
+	mutations := []struct {
+		name   string
+		mutate func() error
+	}{
+		{"transform", func() error { return cs.TransformElements("a", []string{"r"}, Translate(1, 1)) }},
+		{"layer", func() error { _, err := cs.CreateLayer("a", "top", LayerPatch{}); return err }},
+		{"group", func() error { return cs.GroupElements("a", "g", []string{"r"}) }},
+		{"ungroup", func() error { return cs.UngroupElement("a", "g") }},
+		{"z-order", func() error { _, err := cs.ReorderElement("a", "r", ZOrderBack); return err }},
+	}
+	for _, tt := range mutations {
+		if err := tt.mutate(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if changes := cs.TakeChanges(); len(changes.Canvases) != 1 || changes.Canvases[0].ID != "a" {
+			t.Errorf("Expected %s to mark the canvas as changed, got %#v", tt.name, changes)
+		}
+	}
+
+	if err := cs.TransformElements("a", []string{"missing"}, Translate(1, 1)); err == nil {
+		t.Fatal("Expected a missing element to be refused")
+	}
+	if !cs.TakeChanges().Empty() {
+		t.Error("Expected failed operations to change nothing")
+	}
+}
+
+func TestTakeChangesCopiesGroups(t *testing.T) {
+	cs := testStorageService()
+	cs.UpdateCanvasElement("a", VectorGroup{VectorShape: VectorShape{ID: "g"}, Type: "group", Children: []VectorElement{
+		VectorRectangle{VectorShape: VectorShape{ID: "r"}, Type: "rectangle", Width: 1, Height: 1},
+	}})
+	changes := cs.TakeChanges()
+
+	// the saved copy is encoded while the canvas keeps changing
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := json.Marshal(changes.Canvases[0]); err != nil {
+			t.Error(err)
+		}
+	}()
+	if err := cs.TransformElements("a", []string{"r"}, Translate(5, 5)); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+
+	child := changes.Canvases[0].VectorData.Elements[0].(VectorGroup).Children[0].(VectorRectangle)
+	if child.X != 0 {
+		t.Errorf("Expected the taken canvas to keep its nested elements, got x=%v", child.X)
+	}
+}
+
+func TestRequeueChanges(t *testing.T) {
+	cs := testStorageService()
+	cs.UpdateCanvasBackground("a", "#000000")
+	cs.UpdateCanvasBackground("b", "#000000")
+	cs.RemoveCanvas("b")
+	cs.AddOrUpdateCanvas(Canvas{ID: "c"})
+	changes := cs.TakeChanges()
+
+	// canvases removed or added back since the failed save keep their newer state
+	cs.RemoveCanvas("c")
+	cs.AddOrUpdateCanvas(Canvas{ID: "b"})
+	cs.TakeChanges()
+	cs.RequeueChanges(changes)
+
+	requeued := cs.TakeChanges()
+	if len(requeued.Canvases) != 1 || requeued.Canvases[0].ID != "a" || len(requeued.Removed) != 0 {
+		t.Errorf("Expected only the canvas still present to be requeued, got %#v", requeued)
+	}
+	if !reflect.DeepEqual(requeued.Order, []string{"a", "b"}) {
+		t.Errorf("Expected the current order to be saved again, got %v", requeued.Order)
+	}
+}
+
+func TestSplitElements(t *testing.T) {
+	elements := []VectorElement{}
+	for i := 0; i < 10; i++ {
+		elements = append(elements, VectorRectangle{VectorShape: VectorShape{ID: fmt.Sprintf("r%d", i)}, Type: "rectangle"})
+	}
+	data, _ := json.Marshal(elements[0])
+	size := len(data)
+
+	chunks, err := SplitElements(elements, 3*size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 4 || len(chunks[0]) != 3 || len(chunks[3]) != 1 {
+		t.Fatalf("Expected chunks of 3 elements, got %d chunks", len(chunks))
+	}
+	if ElementID(chunks[1][0]) != "r3" || ElementID(chunks[3][0]) != "r9" {
+		t.Error("Expected the elements to keep their order")
+	}
+
+	if chunks, _ := SplitElements(elements, size/2); len(chunks) != len(elements) {
+		t.Errorf("Expected large elements to get a chunk each, got %d chunks", len(chunks))
+	}
+	if chunks, _ := SplitElements(nil, size); len(chunks) != 0 {
+		t.Errorf("Expected no chunks without elements, got %d", len(chunks))
+	}
+}
+
+func TestCanvasDocumentID(t *testing.T) {
+	for _, id := range []string{"canvas-1", "Page 2", "été"} {
+		if got := CanvasDocumentID(id); got != id {
+			t.Errorf("Expected %q to be kept, got %q", id, got)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, id := range []string{"", ".", "..", "a/b", "__name__", "~kept", strings.Repeat("x", 600), "\xff"} {
+		got := CanvasDocumentID(id)
+		if !strings.HasPrefix(got, "~") || strings.Contains(got, "/") || len(got) > 100 || seen[got] {
+			t.Errorf("Expected %q to be replaced by a distinct valid ID, got %q", id, got)
+		}
+		seen[got] = true
+	}
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		value  string
+		expect color.NRGBA
+	}{
+		{"#f00", color.NRGBA{R: 255, A: 255}},
+		{"#0f08", color.NRGBA{G: 255, A: 0x88}},
+		{"#336699", color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 255}},
+		{"#33669980", color.NRGBA{R: 0x33, G: 0x66, B: 0x99, A: 0x80}},
+		{"rgb(10, 20, 30)", color.NRGBA{R: 10, G: 20, B: 30, A: 255}},
+		{"rgba(10,20,30,0.5)", color.NRGBA{R: 10, G: 20, B: 30, A: 128}},
+		{"RebeccaPurple", color.NRGBA{R: 0x66, G: 0x33, B: 0x99, A: 255}},
+		{"transparent", color.NRGBA{}},
+	}
+	for _, tt := range tests {
+		got, ok := ParseColor(tt.value)
+		if !ok || got != tt.expect {
+			t.Errorf("ParseColor(%q) = %v, %v; expected %v", tt.value, got, ok, tt.expect)
+		}
+	}
+
+	for _, invalid := range []string{"#12", "#gggggg", "rgb(1,2)", "rgb(300,0,0)", "rgba(0,0,0,2)", "blurple"} {
+		if _, ok := ParseColor(invalid); ok {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+	if !ValidColor("") {
+		t.Error("Expected an empty color to be valid")
+	}
+}
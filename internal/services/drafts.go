@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MaxDraftPoints bounds the points a stroke can stream before it is finished
+const MaxDraftPoints = 100000
+
+// MaxSessionDrafts bounds the strokes a session draws at once, two fingers or a pen and a finger
+const MaxSessionDrafts = 2
+
+// StrokeDraft is a freehand path still being drawn, shared live with the other users but not stored
+type StrokeDraft struct {
+	CanvasID  string
+	SessionID string
+	Path      VectorPath
+}
+
+// StrokeDrafts keeps the strokes being drawn in a project, by path ID
+type StrokeDrafts struct {
+	mutex  sync.Mutex
+	drafts map[string]*StrokeDraft
+}
+
+func NewStrokeDrafts() *StrokeDrafts {
+	return &StrokeDrafts{drafts: make(map[string]*StrokeDraft)}
+}
+
+// Begin starts a stroke of a session, a session restarting one of its own strokes drops the points it had
+func (d *StrokeDrafts) Begin(canvasId, sessionId string, path VectorPath) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if path.ID == "" {
+		return errors.New("a stroke requires an id")
+	}
+	if len(path.Points) > MaxDraftPoints {
+		return fmt.Errorf("stroke %s has too many points", path.ID)
+	}
+	draft, exists := d.drafts[path.ID]
+	if exists && draft.SessionID != sessionId {
+		return fmt.Errorf("stroke %s is already being drawn", path.ID)
+	}
+	if !exists && d.sessionDrafts(sessionId) >= MaxSessionDrafts {
+		return errors.New("too many strokes are being drawn at once, finish one first")
+	}
+	path.Points = append([]Point{}, path.Points...)
+	d.drafts[path.ID] = &StrokeDraft{CanvasID: canvasId, SessionID: sessionId, Path: path}
+	return nil
+}
+
+// sessionDrafts counts the strokes a session is drawing; the caller must hold the mutex
+func (d *StrokeDrafts) sessionDrafts(sessionId string) int {
+	count := 0
+	for _, draft := range d.drafts {
+		if draft.SessionID == sessionId {
+			count++
+		}
+	}
+	return count
+}
+
+// draft returns a stroke of a session; the caller must hold the mutex
+func (d *StrokeDrafts) draft(sessionId, pathId string) (*StrokeDraft, error) {
+	draft, exists := d.drafts[pathId]
+	if !exists || draft.SessionID != sessionId {
+		return nil, fmt.Errorf("stroke %s was not started", pathId)
+	}
+	return draft, nil
+}
+
+// Append adds points at the end of a stroke of a session
+func (d *StrokeDrafts) Append(sessionId, pathId string, points []Point) (StrokeDraft, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	draft, err := d.draft(sessionId, pathId)
+	if err != nil {
+		return StrokeDraft{}, err
+	}
+	if len(draft.Path.Points)+len(points) > MaxDraftPoints {
+		return StrokeDraft{}, fmt.Errorf("stroke %s has too many points", pathId)
+	}
+	draft.Path.Points = append(draft.Path.Points, points...)
+	return *draft, nil
+}
+
+// Finish removes a stroke of a session, returning it with every point it received
+func (d *StrokeDrafts) Finish(sessionId, pathId string) (StrokeDraft, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	draft, err := d.draft(sessionId, pathId)
+	if err != nil {
+		return StrokeDraft{}, err
+	}
+	delete(d.drafts, pathId)
+	return *draft, nil
+}
+
+// DiscardSession drops the strokes a session left unfinished and returns them
+func (d *StrokeDrafts) DiscardSession(sessionId string) []StrokeDraft {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	discarded := []StrokeDraft{}
+	for id, draft := range d.drafts {
+		if draft.SessionID == sessionId {
+			discarded = append(discarded, *draft)
+			delete(d.drafts, id)
+		}
+	}
+	return discarded
+}
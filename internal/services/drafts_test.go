@@ -0,0 +1,84 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestStrokeDrafts(t *testing.T) {
+	drafts := NewStrokeDrafts()
+	path := VectorPath{VectorShape: VectorShape{ID: "p"}, Type: "path", Points: []Point{{0, 0}}}
+
+	if err := drafts.Begin("c1", "s1", path); err != nil {
+		t.Fatal(err)
+	}
+	if err := drafts.Begin("c1", "s2", path); err == nil {
+		t.Error("Expected another session to be refused the same stroke")
+	}
+	if _, err := drafts.Append("s2", "p", []Point{{1, 1}}); err == nil {
+		t.Error("Expected another session to be refused points")
+	}
+	draft, err := drafts.Append("s1", "p", []Point{{1, 1}, {2, 2}})
+	if err != nil || len(draft.Path.Points) != 3 {
+		t.Fatalf("Expected 3 points, got %+v %v", draft, err)
+	}
+
+	finished, err := drafts.Finish("s1", "p")
+	if err != nil || finished.CanvasID != "c1" || len(finished.Path.Points) != 3 {
+		t.Fatalf("Unexpected finished stroke %+v %v", finished, err)
+	}
+	if _, err := drafts.Finish("s1", "p"); err == nil {
+		t.Error("Expected a stroke to finish once")
+	}
+	if path.Points[0] != (Point{0, 0}) || len(path.Points) != 1 {
+		t.Error("Expected the original path to be left alone")
+	}
+}
+
+func TestStrokeDraftsDiscardSession(t *testing.T) {
+	drafts := NewStrokeDrafts()
+	_ = drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "a"}})
+	_ = drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "b"}})
+	_ = drafts.Begin("c1", "s2", VectorPath{VectorShape: VectorShape{ID: "c"}})
+
+	if discarded := drafts.DiscardSession("s1"); len(discarded) != 2 {
+		t.Errorf("Expected the 2 strokes of the session, got %+v", discarded)
+	}
+	if _, err := drafts.Append("s2", "c", []Point{{1, 1}}); err != nil {
+		t.Error("Expected the strokes of other sessions to remain")
+	}
+	if _, err := drafts.Append("s1", "a", []Point{{1, 1}}); err == nil {
+		t.Error("Expected the discarded stroke to be gone")
+	}
+}
+
+func TestStrokeDraftsLimit(t *testing.T) {
+	drafts := NewStrokeDrafts()
+	_ = drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "p"}})
+	if _, err := drafts.Append("s1", "p", make([]Point, MaxDraftPoints+1)); err == nil {
+		t.Error("Expected the points to be bounded")
+	}
+}
+
+func TestStrokeDraftsPerSession(t *testing.T) {
+	drafts := NewStrokeDrafts()
+	for _, id := range []string{"p1", "p2"} {
+		if err := drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: id}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "p3"}}); err == nil {
+		t.Error("Expected the strokes of a session to be bounded")
+	}
+	if err := drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "p1"}}); err != nil {
+		t.Errorf("Expected a session to restart its own stroke, got %v", err)
+	}
+	if err := drafts.Begin("c1", "s2", VectorPath{VectorShape: VectorShape{ID: "p3"}}); err != nil {
+		t.Errorf("Expected other sessions to draw, got %v", err)
+	}
+	if _, err := drafts.Finish("s1", "p2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := drafts.Begin("c1", "s1", VectorPath{VectorShape: VectorShape{ID: "p4"}}); err != nil {
+		t.Errorf("Expected a finished stroke to make room, got %v", err)
+	}
+}
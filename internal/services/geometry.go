@@ -0,0 +1,189 @@
+package services
+
+import (
+	"math"
+)
+
+// Matrix is a 2D affine transform mapping (x, y) to (A*x + C*y + E, B*x + D*y + F), as in SVG and canvas APIs
+type Matrix struct {
+	A float64 `firestore:"a" json:"a"`
+	B float64 `firestore:"b" json:"b"`
+	C float64 `firestore:"c" json:"c"`
+	D float64 `firestore:"d" json:"d"`
+	E float64 `firestore:"e" json:"e"`
+	F float64 `firestore:"f" json:"f"`
+}
+
+func Identity() Matrix {
+	return Matrix{A: 1, D: 1}
+}
+
+func Translate(x, y float64) Matrix {
+	return Matrix{A: 1, D: 1, E: x, F: y}
+}
+
+// Multiply returns the transform applying n first, then m
+func (m Matrix) Multiply(n Matrix) Matrix {
+	return Matrix{
+		A: m.A*n.A + m.C*n.B,
+		B: m.B*n.A + m.D*n.B,
+		C: m.A*n.C + m.C*n.D,
+		D: m.B*n.C + m.D*n.D,
+		E: m.A*n.E + m.C*n.F + m.E,
+		F: m.B*n.E + m.D*n.F + m.F,
+	}
+}
+
+// Invert returns the inverse transform, false when the matrix is not invertible
+func (m Matrix) Invert() (Matrix, bool) {
+	det := m.A*m.D - m.B*m.C
+	if math.Abs(det) < 1e-12 {
+		return Matrix{}, false
+	}
+	return Matrix{
+		A: m.D / det,
+		B: -m.B / det,
+		C: -m.C / det,
+		D: m.A / det,
+		E: (m.C*m.F - m.D*m.E) / det,
+		F: (m.B*m.E - m.A*m.F) / det,
+	}, true
+}
+
+func (m Matrix) Apply(p Point) Point {
+	return Point{X: m.A*p.X + m.C*p.Y + m.E, Y: m.B*p.X + m.D*p.Y + m.F}
+}
+
+// IsTranslation reports whether the transform only moves things
+func (m Matrix) IsTranslation() bool {
+	return nearlyEqual(m.A, 1) && nearlyEqual(m.B, 0) && nearlyEqual(m.C, 0) && nearlyEqual(m.D, 1)
+}
+
+// transformOrIdentity treats a missing transform as the identity
+func transformOrIdentity(m *Matrix) Matrix {
+	if m == nil {
+		return Identity()
+	}
+	return *m
+}
+
+// validTransform accepts a missing transform or a finite invertible one
+func validTransform(m *Matrix) bool {
+	if m == nil {
+		return true
+	}
+	for _, v := range []float64{m.A, m.B, m.C, m.D, m.E, m.F} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	_, ok := m.Invert()
+	return ok
+}
+
+// maxScale returns the largest length a unit vector can get through the transform, along either axis
+func (m Matrix) maxScale() float64 {
+	return math.Max(math.Hypot(m.A, m.B), math.Hypot(m.C, m.D))
+}
+
+// elementTransformPtr returns the transform of an element, nil when it has none
+func elementTransformPtr(element VectorElement) *Matrix {
+	shape, _ := ElementShape(element)
+	return shape.Transform
+}
+
+// elementTransform maps the coordinates of an element geometry to the ones of its container
+func elementTransform(element VectorElement) Matrix {
+	return transformOrIdentity(elementTransformPtr(element))
+}
+
+func nearlyEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func distance(a, b Point) float64 {
+	return math.Hypot(a.X-b.X, a.Y-b.Y)
+}
+
+// distanceToSegment returns the distance between p and the segment [a, b]
+func distanceToSegment(p, a, b Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return distance(p, a)
+	}
+	t := ((p.X-a.X)*dx + (p.Y-a.Y)*dy) / lengthSquared
+	t = math.Max(0, math.Min(1, t))
+	return distance(p, Point{X: a.X + t*dx, Y: a.Y + t*dy})
+}
+
+// distanceToPolyline returns the distance between p and a chain of segments, closing it when asked
+func distanceToPolyline(p Point, points []Point, closed bool) float64 {
+	if len(points) == 0 {
+		return math.Inf(1)
+	}
+	best := distance(p, points[0])
+	for i := 1; i < len(points); i++ {
+		best = math.Min(best, distanceToSegment(p, points[i-1], points[i]))
+	}
+	if closed && len(points) > 2 {
+		best = math.Min(best, distanceToSegment(p, points[len(points)-1], points[0]))
+	}
+	return best
+}
+
+// pointInPolygon uses the even-odd rule
+func pointInPolygon(p Point, points []Point) bool {
+	inside := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, b := points[i], points[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// arrowHead is the outline of an arrow head: a polygon when closed, a polyline otherwise, or a circle
+type arrowHead struct {
+	Points []Point
+	Closed bool
+	Circle bool
+	Center Point
+	Radius float64
+}
+
+// arrowHeadSize returns the length of the heads of an arrow, scaled on its stroke when it sets none
+func arrowHeadSize(a VectorArrow) float64 {
+	if a.HeadSize > 0 {
+		return a.HeadSize
+	}
+	return math.Max(10, 4*a.StrokeWidth)
+}
+
+// arrowHeadShape returns the head of an arrow pointing at tip, coming from the other end of the arrow
+func arrowHeadShape(style string, tip, from Point, size float64) (arrowHead, bool) {
+	length := distance(tip, from)
+	if style == ArrowHeadNone || style == "" || length == 0 {
+		return arrowHead{}, false
+	}
+	// unit vector along the arrow and its normal
+	dx, dy := (tip.X-from.X)/length, (tip.Y-from.Y)/length
+	nx, ny := -dy, dx
+	at := func(along, across float64) Point {
+		return Point{X: tip.X - dx*along + nx*across, Y: tip.Y - dy*along + ny*across}
+	}
+	switch style {
+	case ArrowHeadTriangle:
+		return arrowHead{Points: []Point{tip, at(size, size/2), at(size, -size/2)}, Closed: true}, true
+	case ArrowHeadOpen:
+		return arrowHead{Points: []Point{at(size, size/2), tip, at(size, -size/2)}}, true
+	case ArrowHeadDiamond:
+		return arrowHead{Points: []Point{tip, at(size/2, size/3), at(size, 0), at(size/2, -size/3)}, Closed: true}, true
+	case ArrowHeadCircle:
+		return arrowHead{Circle: true, Center: at(size/2, 0), Radius: size / 2}, true
+	case ArrowHeadBar:
+		return arrowHead{Points: []Point{at(0, size/2), at(0, -size/2)}}, true
+	}
+	return arrowHead{}, false
+}
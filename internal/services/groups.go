@@ -0,0 +1,381 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// findElement looks for an element in a tree of groups, returning it with the transform from its
+// coordinates to the canvas and the IDs of the groups containing it, outermost first
+func findElement(elements []VectorElement, id string, world Matrix, ancestors []string) (VectorElement, Matrix, []string, bool) {
+	for _, element := range elements {
+		if ElementID(element) == id {
+			return element, world, ancestors, true
+		}
+		if group, ok := element.(VectorGroup); ok {
+			inner := world.Multiply(elementTransform(group))
+			path := append(append([]string{}, ancestors...), group.ID)
+			if found, foundWorld, foundPath, ok := findElement(group.Children, id, inner, path); ok {
+				return found, foundWorld, foundPath, true
+			}
+		}
+	}
+	return nil, Matrix{}, nil, false
+}
+
+// updateElement replaces an element, wherever it is in the tree of groups, by its changed version
+func updateElement(elements []VectorElement, id string, change func(element VectorElement) VectorElement) bool {
+	for i, element := range elements {
+		if ElementID(element) == id {
+			elements[i] = change(element)
+			return true
+		}
+		if group, ok := element.(VectorGroup); ok && updateElement(group.Children, id, change) {
+			return true
+		}
+	}
+	return false
+}
+
+// withContainer rebuilds the tree with the children of a group (the top level elements for "") replaced by the
+// result of change, which must not modify the slice it receives
+func withContainer(elements []VectorElement, groupID string, change func(children []VectorElement) ([]VectorElement, error)) ([]VectorElement, bool, error) {
+	if groupID == "" {
+		children, err := change(elements)
+		return children, true, err
+	}
+	for i, element := range elements {
+		group, ok := element.(VectorGroup)
+		if !ok {
+			continue
+		}
+		if group.ID == groupID {
+			children, err := change(group.Children)
+			if err != nil {
+				return nil, true, err
+			}
+			group.Children = children
+		} else {
+			children, found, err := withContainer(group.Children, groupID, change)
+			if !found {
+				continue
+			}
+			if err != nil {
+				return nil, true, err
+			}
+			group.Children = children
+		}
+		updated := append([]VectorElement{}, elements...)
+		updated[i] = group
+		return updated, true, nil
+	}
+	return elements, false, nil
+}
+
+type detachedElement struct {
+	element VectorElement
+	world   Matrix
+}
+
+// detachElements removes the given elements from the tree, returning them in tree order along with the
+// transform of the container they were in
+func detachElements(elements []VectorElement, ids map[string]bool, world Matrix) ([]VectorElement, []detachedElement) {
+	remaining := make([]VectorElement, 0, len(elements))
+	detached := []detachedElement{}
+	for _, element := range elements {
+		if ids[ElementID(element)] {
+			detached = append(detached, detachedElement{element: element, world: world})
+			continue
+		}
+		if group, ok := element.(VectorGroup); ok {
+			children, found := detachElements(group.Children, ids, world.Multiply(elementTransform(group)))
+			if len(found) > 0 {
+				group.Children = children
+				element = group
+				detached = append(detached, found...)
+			}
+		}
+		remaining = append(remaining, element)
+	}
+	return remaining, detached
+}
+
+// translateElement moves an element by (dx, dy) in the coordinates of its container
+func translateElement(element VectorElement, dx, dy float64) VectorElement {
+	if _, isGroup := element.(VectorGroup); isGroup || elementTransformPtr(element) != nil {
+		return setTransform(element, Translate(dx, dy).Multiply(elementTransform(element)))
+	}
+	movePoints := func(points []Point) []Point {
+		moved := make([]Point, len(points))
+		for i, p := range points {
+			moved[i] = Point{X: p.X + dx, Y: p.Y + dy}
+		}
+		return moved
+	}
+	switch e := element.(type) {
+	case VectorPath:
+		e.Points = movePoints(e.Points)
+		if e.Segments != nil {
+			segments := make([]BezierSegment, len(e.Segments))
+			for i, segment := range e.Segments {
+				moved := movePoints([]Point{segment.C1, segment.C2})
+				segments[i] = BezierSegment{C1: moved[0], C2: moved[1]}
+			}
+			e.Segments = segments
+		}
+		return e
+	case VectorRectangle:
+		e.X, e.Y = e.X+dx, e.Y+dy
+		return e
+	case VectorCircle:
+		e.CX, e.CY = e.CX+dx, e.CY+dy
+		return e
+	case VectorEllipse:
+		e.CX, e.CY = e.CX+dx, e.CY+dy
+		return e
+	case VectorLine:
+		e.X1, e.Y1, e.X2, e.Y2 = e.X1+dx, e.Y1+dy, e.X2+dx, e.Y2+dy
+		return e
+	case VectorArrow:
+		e.X1, e.Y1, e.X2, e.Y2 = e.X1+dx, e.Y1+dy, e.X2+dx, e.Y2+dy
+		return e
+	case VectorPolyline:
+		e.Points = movePoints(e.Points)
+		return e
+	case VectorPolygon:
+		e.Points = movePoints(e.Points)
+		return e
+	case VectorText:
+		e.X, e.Y = e.X+dx, e.Y+dy
+		return e
+	case VectorImage:
+		e.X, e.Y = e.X+dx, e.Y+dy
+		return e
+	}
+	return element
+}
+
+// reparentElement re-expresses an element moving from a container with transform from to one with transform to,
+// so that it keeps its place on the canvas
+func reparentElement(element VectorElement, from Matrix, to Matrix) (VectorElement, error) {
+	inverse, ok := to.Invert()
+	if !ok {
+		return nil, errors.New("target group transform is not invertible")
+	}
+	return transformElement(element, inverse.Multiply(from)), nil
+}
+
+// elementIDSet checks that a list of IDs is not empty and has no duplicates
+func elementIDSet(elementIDs []string) (map[string]bool, error) {
+	if len(elementIDs) == 0 {
+		return nil, errors.New("no element given")
+	}
+	ids := make(map[string]bool, len(elementIDs))
+	for _, id := range elementIDs {
+		if ids[id] {
+			return nil, fmt.Errorf("element %s given twice", id)
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// GroupElements wraps sibling elements in a new group placed where the topmost of them was
+func (c *CanvasService) GroupElements(canvasId string, groupId string, elementIds []string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	ids, err := elementIDSet(elementIds)
+	if err != nil {
+		return err
+	}
+	if groupId == "" || ids[groupId] {
+		return errors.New("invalid group id")
+	}
+	if _, _, _, taken := findElement(canvas.VectorData.Elements, groupId, Identity(), nil); taken {
+		return fmt.Errorf("element %s already exists", groupId)
+	}
+
+	parent := ""
+	layer := -1
+	for i, id := range elementIds {
+		_, _, ancestors, found := findElement(canvas.VectorData.Elements, id, Identity(), nil)
+		if !found {
+			return fmt.Errorf("element %s not found", id)
+		}
+		container := ""
+		if len(ancestors) > 0 {
+			container = ancestors[len(ancestors)-1]
+		}
+		if i > 0 && container != parent {
+			return errors.New("grouped elements must share the same parent")
+		}
+		parent = container
+		index, _ := canvas.VectorData.elementLayerIndex(id)
+		if i > 0 && index != layer {
+			return errors.New("grouped elements must be on the same layer")
+		}
+		layer = index
+	}
+	layerId := ""
+	if parent == "" && len(canvas.VectorData.Layers) > 0 {
+		layerId = canvas.VectorData.Layers[layer].ID
+	}
+
+	elements, _, err := withContainer(canvas.VectorData.Elements, parent, func(children []VectorElement) ([]VectorElement, error) {
+		group := VectorGroup{VectorShape: VectorShape{ID: groupId, Layer: layerId}, Type: "group", Children: []VectorElement{}}
+		position := 0
+		remaining := make([]VectorElement, 0, len(children))
+		for _, child := range children {
+			if ids[ElementID(child)] {
+				group.Children = append(group.Children, child)
+				position = len(remaining)
+				continue
+			}
+			remaining = append(remaining, child)
+		}
+		updated := append([]VectorElement{}, remaining[:position]...)
+		updated = append(updated, group)
+		return append(updated, remaining[position:]...), nil
+	})
+	if err != nil {
+		return err
+	}
+	repairZIndexes(elements)
+	canvas.VectorData.Elements = elements
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
+
+// UngroupElement replaces a group by its children, which keep their place on the canvas
+func (c *CanvasService) UngroupElement(canvasId string, groupId string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	element, _, ancestors, found := findElement(canvas.VectorData.Elements, groupId, Identity(), nil)
+	if !found {
+		return fmt.Errorf("group %s not found", groupId)
+	}
+	group, ok := element.(VectorGroup)
+	if !ok {
+		return fmt.Errorf("element %s is not a group", groupId)
+	}
+	parent := ""
+	if len(ancestors) > 0 {
+		parent = ancestors[len(ancestors)-1]
+	}
+
+	transform := transformOrIdentity(group.Transform)
+	released := make([]VectorElement, 0, len(group.Children))
+	for _, child := range group.Children {
+		moved, err := reparentElement(child, transform, Identity())
+		if err != nil {
+			return err
+		}
+		if parent == "" {
+			moved = updateShape(moved, func(shape *VectorShape) {
+				shape.Layer = group.Layer
+			})
+		}
+		released = append(released, moved)
+	}
+
+	elements, _, err := withContainer(canvas.VectorData.Elements, parent, func(children []VectorElement) ([]VectorElement, error) {
+		updated := make([]VectorElement, 0, len(children)+len(released))
+		for _, child := range children {
+			if ElementID(child) == groupId {
+				updated = append(updated, released...)
+				continue
+			}
+			updated = append(updated, child)
+		}
+		return updated, nil
+	})
+	if err != nil {
+		return err
+	}
+	repairZIndexes(elements)
+	canvas.VectorData.Elements = elements
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
+
+// MoveElementsToGroup moves elements on top of the children of a group, or of the canvas when groupId is empty,
+// keeping their place on the canvas
+func (c *CanvasService) MoveElementsToGroup(canvasId string, elementIds []string, groupId string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	ids, err := elementIDSet(elementIds)
+	if err != nil {
+		return err
+	}
+	// elements moved back to the canvas stay on the layer they were on
+	layers := make(map[string]string, len(elementIds))
+	for _, id := range elementIds {
+		index, found := canvas.VectorData.elementLayerIndex(id)
+		if !found {
+			return fmt.Errorf("element %s not found", id)
+		}
+		if len(canvas.VectorData.Layers) > 0 {
+			layers[id] = canvas.VectorData.Layers[index].ID
+		}
+	}
+
+	target := Identity()
+	if groupId != "" {
+		element, world, ancestors, found := findElement(canvas.VectorData.Elements, groupId, Identity(), nil)
+		if !found {
+			return fmt.Errorf("group %s not found", groupId)
+		}
+		group, ok := element.(VectorGroup)
+		if !ok {
+			return fmt.Errorf("element %s is not a group", groupId)
+		}
+		// a group cannot be moved inside itself
+		for _, id := range append(ancestors, groupId) {
+			if ids[id] {
+				return fmt.Errorf("group %s cannot be moved inside itself", id)
+			}
+		}
+		target = world.Multiply(elementTransform(group))
+	}
+
+	remaining, detached := detachElements(canvas.VectorData.Elements, ids, Identity())
+	moved := make([]VectorElement, 0, len(detached))
+	for _, d := range detached {
+		element, err := reparentElement(d.element, d.world, target)
+		if err != nil {
+			return err
+		}
+		if groupId == "" {
+			element = updateShape(element, func(shape *VectorShape) {
+				shape.Layer = layers[ElementID(element)]
+			})
+		}
+		moved = append(moved, element)
+	}
+
+	elements, _, err := withContainer(remaining, groupId, func(children []VectorElement) ([]VectorElement, error) {
+		return append(append([]VectorElement{}, children...), moved...), nil
+	})
+	if err != nil {
+		return err
+	}
+	repairZIndexes(elements)
+	canvas.VectorData.Elements = elements
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func newGroupCanvas(elements ...VectorElement) *CanvasService {
+	cs := NewCanvasService()
+	cs.AddOrUpdateCanvas(Canvas{ID: "c1", VectorData: VectorData{Elements: elements}})
+	return cs
+}
+
+func elementIDs(elements []VectorElement) []string {
+	ids := []string{}
+	for _, element := range elements {
+		ids = append(ids, ElementID(element))
+	}
+	return ids
+}
+
+func sameIDs(got []string, want ...string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func rect(id string, x, y float64) VectorRectangle {
+	return VectorRectangle{VectorShape: VectorShape{ID: id, Fill: "#ff0000"}, Type: "rectangle", X: x, Y: y, Width: 10, Height: 10}
+}
+
+func TestParseGroupElement(t *testing.T) {
+	raw := map[string]interface{}{}
+	data := `{"id":"g1","type":"group","transform":{"a":1,"b":0,"c":0,"d":1,"e":5,"f":6},"children":[
+		{"id":"r1","type":"rectangle","x":1,"y":2,"width":3,"height":4},
+		{"id":"g2","type":"group","children":[{"id":"c1","type":"circle","cx":1,"cy":1,"radius":2}]}]}`
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatal(err)
+	}
+	group, ok := ParseSingleStrokeFromRaw(raw).(VectorGroup)
+	if !ok {
+		t.Fatal("Expected a VectorGroup")
+	}
+	if group.Transform == nil || group.Transform.E != 5 || group.Transform.F != 6 {
+		t.Errorf("Unexpected transform %+v", group.Transform)
+	}
+	if _, ok := group.Children[0].(VectorRectangle); !ok {
+		t.Errorf("Expected a rectangle child, got %T", group.Children[0])
+	}
+	nested, ok := group.Children[1].(VectorGroup)
+	if !ok {
+		t.Fatalf("Expected a nested group, got %T", group.Children[1])
+	}
+	if _, ok := nested.Children[0].(VectorCircle); !ok {
+		t.Errorf("Expected a circle grandchild, got %T", nested.Children[0])
+	}
+}
+
+func TestGroupAndUngroupElements(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 20, 0), rect("c", 40, 0), rect("d", 60, 0))
+
+	if err := cs.GroupElements("c1", "g", []string{"c", "a"}); err != nil {
+		t.Fatalf("GroupElements failed: %v", err)
+	}
+	elements := cs.GetCanvas("c1").VectorData.Elements
+	if !sameIDs(elementIDs(elements), "b", "g", "d") {
+		t.Fatalf("Unexpected top level order %v", elementIDs(elements))
+	}
+	if !sameIDs(elementIDs(elements[1].(VectorGroup).Children), "a", "c") {
+		t.Errorf("Unexpected children %v", elementIDs(elements[1].(VectorGroup).Children))
+	}
+
+	if err := cs.GroupElements("c1", "g2", []string{"a", "b"}); err == nil {
+		t.Error("Expected an error when grouping elements with different parents")
+	}
+	if err := cs.GroupElements("c1", "b", []string{"d"}); err == nil {
+		t.Error("Expected an error when reusing an existing ID")
+	}
+
+	// a translated group gives its offset back to its children
+	updateElement(cs.GetCanvas("c1").VectorData.Elements, "g", func(element VectorElement) VectorElement {
+		return translateElement(element, 5, 7)
+	})
+	if err := cs.UngroupElement("c1", "g"); err != nil {
+		t.Fatalf("UngroupElement failed: %v", err)
+	}
+	elements = cs.GetCanvas("c1").VectorData.Elements
+	if !sameIDs(elementIDs(elements), "b", "a", "c", "d") {
+		t.Fatalf("Unexpected order after ungroup %v", elementIDs(elements))
+	}
+	if a := elements[1].(VectorRectangle); a.X != 5 || a.Y != 7 {
+		t.Errorf("Expected a at (5, 7), got (%f, %f)", a.X, a.Y)
+	}
+	if err := cs.UngroupElement("c1", "b"); err == nil {
+		t.Error("Expected an error when ungrouping a non group element")
+	}
+}
+
+func TestMoveElementsToGroup(t *testing.T) {
+	moved := Translate(100, 50)
+	cs := newGroupCanvas(
+		rect("a", 110, 60),
+		VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &moved}, Type: "group", Children: []VectorElement{
+			VectorGroup{VectorShape: VectorShape{ID: "inner"}, Type: "group", Children: []VectorElement{rect("b", 0, 0)}},
+		}},
+	)
+
+	if err := cs.MoveElementsToGroup("c1", []string{"a"}, "inner"); err != nil {
+		t.Fatalf("MoveElementsToGroup failed: %v", err)
+	}
+	element, world, ancestors, found := findElement(cs.GetCanvas("c1").VectorData.Elements, "a", Identity(), nil)
+	if !found || !sameIDs(ancestors, "g", "inner") {
+		t.Fatalf("Expected a inside g/inner, got %v", ancestors)
+	}
+	if a := element.(VectorRectangle); a.X != 10 || a.Y != 10 {
+		t.Errorf("Expected a at (10, 10) in group space, got (%f, %f)", a.X, a.Y)
+	}
+	if p := world.Apply(Point{X: 10, Y: 10}); p.X != 110 || p.Y != 60 {
+		t.Errorf("Expected a to keep its place on the canvas, got %+v", p)
+	}
+
+	if err := cs.MoveElementsToGroup("c1", []string{"g"}, "inner"); err == nil {
+		t.Error("Expected an error when moving a group inside itself")
+	}
+
+	if err := cs.MoveElementsToGroup("c1", []string{"b"}, ""); err != nil {
+		t.Fatalf("MoveElementsToGroup to the canvas failed: %v", err)
+	}
+	elements := cs.GetCanvas("c1").VectorData.Elements
+	if !sameIDs(elementIDs(elements), "g", "b") {
+		t.Fatalf("Unexpected top level order %v", elementIDs(elements))
+	}
+	if b := elements[1].(VectorRectangle); b.X != 100 || b.Y != 50 {
+		t.Errorf("Expected b at (100, 50), got (%f, %f)", b.X, b.Y)
+	}
+}
+
+func TestNestedElementActionAndOrigin(t *testing.T) {
+	moved := Translate(10, 20)
+	cs := newGroupCanvas(VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &moved}, Type: "group",
+		Children: []VectorElement{rect("a", 1, 2)}})
+
+	if !cs.UpdateCanvasWithAction("c1", "a", Action{Type: "link", Link: "https://example.com"}) {
+		t.Fatal("UpdateCanvasWithAction failed")
+	}
+	element, _, _, _ := findElement(cs.GetCanvas("c1").VectorData.Elements, "a", Identity(), nil)
+	if element.(VectorRectangle).Action.Link != "https://example.com" {
+		t.Error("Expected the action to be set on the nested element")
+	}
+
+	origin, ok := cs.FindElementOrigin("c1", "a")
+	if !ok || origin.X != 11 || origin.Y != 22 {
+		t.Errorf("Expected origin (11, 22), got %+v", origin)
+	}
+}
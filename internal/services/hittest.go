@@ -0,0 +1,145 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// Hit is an element found under a point, with the groups containing it, outermost first
+type Hit struct {
+	ElementID string   `json:"elementId"`
+	Groups    []string `json:"groups"`
+}
+
+// HitTest returns the elements of visible layers under a point in canvas coordinates, topmost first.
+// Strokes and unfilled shapes are hit within tolerance of their outline
+func (c *CanvasService) HitTest(canvasId string, p Point, tolerance float64) []Hit {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return nil
+	}
+	// the spatial index narrows the search to the elements whose box is around the point
+	index := c.canvasIndex(canvas)
+	area := Rect{MinX: p.X, MinY: p.Y, MaxX: p.X, MaxY: p.Y}.Inflate(tolerance)
+	candidates := zOrdered(&canvas.VectorData, index, index.query(area, false))
+
+	hits := []Hit{}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if canvas.VectorData.ElementLayer(candidates[i]).Visible {
+			hitTestElements(candidates[i:i+1], p, tolerance, nil, &hits)
+		}
+	}
+	return hits
+}
+
+func hitTestElements(elements []VectorElement, p Point, tolerance float64, groups []string, hits *[]Hit) {
+	for i := len(elements) - 1; i >= 0; i-- {
+		element := elements[i]
+		transform := elementTransform(element)
+		inverse, ok := transform.Invert()
+		if !ok {
+			continue
+		}
+		// the tolerance follows the average scale of the element
+		local := inverse.Apply(p)
+		localTolerance := tolerance / math.Sqrt(math.Abs(transform.A*transform.D-transform.B*transform.C))
+		if group, ok := element.(VectorGroup); ok {
+			path := append(append([]string{}, groups...), group.ID)
+			hitTestElements(group.Children, local, localTolerance, path, hits)
+			continue
+		}
+		if elementContains(element, local, localTolerance) {
+			*hits = append(*hits, Hit{ElementID: ElementID(element), Groups: groups})
+		}
+	}
+}
+
+// isFilled reports whether the fill of an element paints anything
+func isFilled(shape VectorShape) bool {
+	if shape.FillGradient != nil {
+		return true
+	}
+	return shape.Fill != "" && shape.Fill != "none" && shape.Fill != "transparent"
+}
+
+// elementContains tests a point expressed in the element coordinates
+func elementContains(element VectorElement, p Point, tolerance float64) bool {
+	switch e := element.(type) {
+	case VectorPath:
+		outline := pathOutline(e)
+		if e.Closed && isFilled(e.VectorShape) && pointInPolygon(p, outline) {
+			return true
+		}
+		return distanceToPolyline(p, outline, false) <= tolerance+e.StrokeWidth/2
+	case VectorPolyline:
+		return distanceToPolyline(p, e.Points, false) <= tolerance+e.StrokeWidth/2
+	case VectorPolygon:
+		if isFilled(e.VectorShape) && pointInPolygon(p, e.Points) {
+			return true
+		}
+		return distanceToPolyline(p, e.Points, true) <= tolerance+e.StrokeWidth/2
+	case VectorLine:
+		return distanceToSegment(p, Point{X: e.X1, Y: e.Y1}, Point{X: e.X2, Y: e.Y2}) <= tolerance+e.StrokeWidth/2
+	case VectorArrow:
+		return distanceToSegment(p, Point{X: e.X1, Y: e.Y1}, Point{X: e.X2, Y: e.Y2}) <= tolerance+e.StrokeWidth/2+e.HeadSize/2
+	case VectorRectangle:
+		return boxContains(p, e.X, e.Y, e.Width, e.Height, isFilled(e.VectorShape), tolerance+e.StrokeWidth/2)
+	case VectorImage:
+		return boxContains(p, e.X, e.Y, e.Width, e.Height, true, tolerance)
+	case VectorText:
+		width, height := textBox(e)
+		return boxContains(p, e.X, e.Y, width, height, true, tolerance)
+	case VectorCircle:
+		d := distance(p, Point{X: e.CX, Y: e.CY})
+		if isFilled(e.VectorShape) && d <= e.Radius {
+			return true
+		}
+		return math.Abs(d-e.Radius) <= tolerance+e.StrokeWidth/2
+	case VectorEllipse:
+		return ellipseContains(p, e, tolerance+e.StrokeWidth/2)
+	}
+	return false
+}
+
+// boxContains tests the inside of a box when filled, its border otherwise
+func boxContains(p Point, x, y, width, height float64, filled bool, tolerance float64) bool {
+	inside := p.X >= x-tolerance && p.X <= x+width+tolerance && p.Y >= y-tolerance && p.Y <= y+height+tolerance
+	if filled || !inside {
+		return inside
+	}
+	corners := []Point{{X: x, Y: y}, {X: x + width, Y: y}, {X: x + width, Y: y + height}, {X: x, Y: y + height}}
+	return distanceToPolyline(p, corners, true) <= tolerance
+}
+
+// ellipseContains approximates the distance to the outline by scaling the radial distance
+func ellipseContains(p Point, e VectorEllipse, tolerance float64) bool {
+	if e.RX <= 0 || e.RY <= 0 {
+		return distance(p, Point{X: e.CX, Y: e.CY}) <= tolerance
+	}
+	dx, dy := p.X-e.CX, p.Y-e.CY
+	r := math.Hypot(dx/e.RX, dy/e.RY)
+	if isFilled(e.VectorShape) && r <= 1 {
+		return true
+	}
+	if r == 0 {
+		return math.Min(e.RX, e.RY) <= tolerance
+	}
+	return math.Abs(math.Hypot(dx, dy)*(1-1/r)) <= tolerance
+}
+
+// textBox estimates the size of a text element from its lines, using an average glyph width
+func textBox(t VectorText) (float64, float64) {
+	lines := strings.Split(t.Text, "\n")
+	height := float64(len(lines)) * t.FontSize * t.LineHeight
+	if t.Width > 0 {
+		return t.Width, height
+	}
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, utf8.RuneCountInString(line))
+	}
+	return float64(longest) * t.FontSize * 0.6, height
+}
@@ -0,0 +1,43 @@
+package services
+
+import "testing"
+
+func TestHitTest(t *testing.T) {
+	scaled := Matrix{A: 2, D: 2, E: 100, F: 100}
+	cs := newGroupCanvas(
+		rect("bottom", 0, 0),
+		VectorRectangle{VectorShape: VectorShape{ID: "outline", StrokeWidth: 2}, Type: "rectangle", X: 0, Y: 0, Width: 20, Height: 20},
+		VectorPath{VectorShape: VectorShape{ID: "path", StrokeWidth: 2}, Type: "path", Points: []Point{{X: 0, Y: 50}, {X: 50, Y: 50}}},
+		VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &scaled}, Type: "group", Children: []VectorElement{
+			VectorCircle{VectorShape: VectorShape{ID: "circle", Fill: "#00ff00"}, Type: "circle", CX: 5, CY: 5, Radius: 5},
+		}},
+	)
+
+	tests := []struct {
+		name   string
+		point  Point
+		expect []string
+	}{
+		{"filled rectangle under outline", Point{X: 5, Y: 5}, []string{"bottom"}},
+		{"outline and filled rectangle", Point{X: 0.5, Y: 5}, []string{"outline", "bottom"}},
+		{"inside unfilled outline", Point{X: 15, Y: 15}, []string{}},
+		{"path within tolerance", Point{X: 25, Y: 52}, []string{"path"}},
+		{"circle in scaled group", Point{X: 115, Y: 115}, []string{"circle"}},
+		{"outside circle in scaled group", Point{X: 121, Y: 121}, []string{}},
+	}
+	for _, tt := range tests {
+		hits := cs.HitTest("c1", tt.point, 1)
+		ids := []string{}
+		for _, hit := range hits {
+			ids = append(ids, hit.ElementID)
+		}
+		if !sameIDs(ids, tt.expect...) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expect, ids)
+		}
+	}
+
+	hits := cs.HitTest("c1", Point{X: 110, Y: 110}, 1)
+	if len(hits) != 1 || !sameIDs(hits[0].Groups, "g") {
+		t.Errorf("Expected the circle hit to report its group, got %+v", hits)
+	}
+}
@@ -0,0 +1,361 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// DefaultLayerID is the layer of canvases created before layers existed
+const DefaultLayerID = "default"
+
+// Layer of a canvas, top level elements belong to one through their layer field
+type Layer struct {
+	ID      string  `firestore:"id" json:"id"`
+	Name    string  `firestore:"name" json:"name"`
+	Visible bool    `firestore:"visible" json:"visible"`
+	Locked  bool    `firestore:"locked" json:"locked"`
+	Opacity float64 `firestore:"opacity" json:"opacity"`
+}
+
+// LayerPatch lists the layer properties to change, nil fields are left as they are
+type LayerPatch struct {
+	Name    *string  `json:"name"`
+	Visible *bool    `json:"visible"`
+	Locked  *bool    `json:"locked"`
+	Opacity *float64 `json:"opacity"`
+}
+
+func defaultLayer() Layer {
+	return Layer{ID: DefaultLayerID, Name: "Layer 1", Visible: true, Opacity: 1}
+}
+
+func (l *Layer) apply(patch LayerPatch) error {
+	if patch.Name != nil {
+		if *patch.Name == "" {
+			return errors.New("layer name cannot be empty")
+		}
+		l.Name = *patch.Name
+	}
+	if patch.Visible != nil {
+		l.Visible = *patch.Visible
+	}
+	if patch.Locked != nil {
+		l.Locked = *patch.Locked
+	}
+	if patch.Opacity != nil {
+		if math.IsNaN(*patch.Opacity) || *patch.Opacity < 0 || *patch.Opacity > 1 {
+			return errors.New("layer opacity must be between 0 and 1")
+		}
+		l.Opacity = *patch.Opacity
+	}
+	return nil
+}
+
+// EffectiveLayers returns the layers bottom to top, a canvas without layers has a single implicit one
+func (v *VectorData) EffectiveLayers() []Layer {
+	if len(v.Layers) == 0 {
+		return []Layer{defaultLayer()}
+	}
+	return v.Layers
+}
+
+// layerIndex returns the position of a layer, elements without a known layer belong to the bottom one
+func (v *VectorData) layerIndex(layerId string) int {
+	for i, layer := range v.Layers {
+		if layer.ID == layerId {
+			return i
+		}
+	}
+	return 0
+}
+
+// ElementLayer returns the layer of a top level element
+func (v *VectorData) ElementLayer(element VectorElement) Layer {
+	shape, _ := ElementShape(element)
+	return v.EffectiveLayers()[v.layerIndex(shape.Layer)]
+}
+
+// LayerElements splits the top level elements by layer, bottom to top, keeping their order within each layer
+func (v *VectorData) LayerElements() [][]VectorElement {
+	layers := make([][]VectorElement, len(v.EffectiveLayers()))
+	for _, element := range v.Elements {
+		shape, _ := ElementShape(element)
+		index := v.layerIndex(shape.Layer)
+		layers[index] = append(layers[index], element)
+	}
+	return layers
+}
+
+// elementLayerIndex returns the layer of an element, nested elements share the one of their top level group
+func (v *VectorData) elementLayerIndex(elementId string) (int, bool) {
+	_, _, ancestors, found := findElement(v.Elements, elementId, Identity(), nil)
+	if !found {
+		return 0, false
+	}
+	if len(ancestors) > 0 {
+		elementId = ancestors[0]
+	}
+	for _, element := range v.Elements {
+		if ElementID(element) == elementId {
+			shape, _ := ElementShape(element)
+			return v.layerIndex(shape.Layer), true
+		}
+	}
+	return 0, false
+}
+
+// ensureLayers turns the implicit layer of an older canvas into a real one before layers are edited
+func (v *VectorData) ensureLayers() {
+	if len(v.Layers) == 0 {
+		v.Layers = []Layer{defaultLayer()}
+	}
+}
+
+func (v *VectorData) findLayer(layerId string) (int, error) {
+	for i, layer := range v.Layers {
+		if layer.ID == layerId {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("layer %s not found", layerId)
+}
+
+// CreateLayer adds a layer on top of the others, visible and opaque unless the patch says otherwise
+func (c *CanvasService) CreateLayer(canvasId string, layerId string, patch LayerPatch) (Layer, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return Layer{}, fmt.Errorf("canvas %s not found", canvasId)
+	}
+	v := &canvas.VectorData
+	v.ensureLayers()
+	if layerId == "" {
+		return Layer{}, errors.New("invalid layer id")
+	}
+	if _, err := v.findLayer(layerId); err == nil {
+		return Layer{}, fmt.Errorf("layer %s already exists", layerId)
+	}
+	layer := Layer{ID: layerId, Name: fmt.Sprintf("Layer %d", len(v.Layers)+1), Visible: true, Opacity: 1}
+	if err := layer.apply(patch); err != nil {
+		return Layer{}, err
+	}
+	v.Layers = append(v.Layers, layer)
+	c.markChanged(canvasId)
+	return layer, nil
+}
+
+// UpdateLayer renames, hides, locks or fades a layer
+func (c *CanvasService) UpdateLayer(canvasId string, layerId string, patch LayerPatch) (Layer, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return Layer{}, fmt.Errorf("canvas %s not found", canvasId)
+	}
+	v := &canvas.VectorData
+	v.ensureLayers()
+	index, err := v.findLayer(layerId)
+	if err != nil {
+		return Layer{}, err
+	}
+	layer := v.Layers[index]
+	if err := layer.apply(patch); err != nil {
+		return Layer{}, err
+	}
+	v.Layers[index] = layer
+	c.markChanged(canvasId)
+	return layer, nil
+}
+
+// ReorderLayer moves a layer to a position counted from the bottom
+func (c *CanvasService) ReorderLayer(canvasId string, layerId string, position int) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	v := &canvas.VectorData
+	v.ensureLayers()
+	index, err := v.findLayer(layerId)
+	if err != nil {
+		return err
+	}
+	if position < 0 || position >= len(v.Layers) {
+		return fmt.Errorf("layer position %d out of range", position)
+	}
+	layer := v.Layers[index]
+	layers := append(append([]Layer{}, v.Layers[:index]...), v.Layers[index+1:]...)
+	layers = append(layers[:position], append([]Layer{layer}, layers[position:]...)...)
+	v.Layers = layers
+	c.markChanged(canvasId)
+	return nil
+}
+
+// DeleteLayer removes a layer, its elements go to the layer below it, or above it for the bottom one
+func (c *CanvasService) DeleteLayer(canvasId string, layerId string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	v := &canvas.VectorData
+	v.ensureLayers()
+	index, err := v.findLayer(layerId)
+	if err != nil {
+		return err
+	}
+	if len(v.Layers) == 1 {
+		return errors.New("cannot delete the last layer")
+	}
+	if v.Layers[index].Locked {
+		return fmt.Errorf("layer %s is locked", layerId)
+	}
+	heir := v.Layers[1]
+	if index > 0 {
+		heir = v.Layers[index-1]
+	}
+	for i, element := range v.Elements {
+		shape, _ := ElementShape(element)
+		if v.layerIndex(shape.Layer) == index {
+			v.Elements[i] = updateShape(element, func(shape *VectorShape) {
+				shape.Layer = heir.ID
+			})
+		}
+	}
+	v.Layers = append(append([]Layer{}, v.Layers[:index]...), v.Layers[index+1:]...)
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
+
+// MoveElementsToLayer moves top level elements to another layer, on top of the elements already there
+func (c *CanvasService) MoveElementsToLayer(canvasId string, elementIds []string, layerId string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	v := &canvas.VectorData
+	ids, err := elementIDSet(elementIds)
+	if err != nil {
+		return err
+	}
+	v.ensureLayers()
+	target, err := v.findLayer(layerId)
+	if err != nil {
+		return err
+	}
+	if v.Layers[target].Locked {
+		return fmt.Errorf("layer %s is locked", layerId)
+	}
+
+	found := 0
+	for _, element := range v.Elements {
+		if !ids[ElementID(element)] {
+			continue
+		}
+		found++
+		if layer := v.ElementLayer(element); layer.Locked {
+			return fmt.Errorf("layer %s is locked", layer.ID)
+		}
+	}
+	if found != len(ids) {
+		return errors.New("only existing top level elements can change layer")
+	}
+
+	// moved elements go to the end of the list so that they end on top of their new layer
+	remaining := make([]VectorElement, 0, len(v.Elements))
+	moved := make([]VectorElement, 0, len(ids))
+	for _, element := range v.Elements {
+		if ids[ElementID(element)] {
+			moved = append(moved, updateShape(element, func(shape *VectorShape) {
+				shape.Layer = layerId
+			}))
+			continue
+		}
+		remaining = append(remaining, element)
+	}
+	v.Elements = append(remaining, moved...)
+	repairZIndexes(v.Elements)
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
+
+// LockedElement returns the first of the elements that sits on a locked layer
+func (c *CanvasService) LockedElement(canvasId string, elementIds []string) (string, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return "", false
+	}
+	v := &canvas.VectorData
+	layers := v.EffectiveLayers()
+	for _, id := range elementIds {
+		if index, found := v.elementLayerIndex(id); found && layers[index].Locked {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+// LayerLocked reports whether elements cannot be added to a layer
+func (c *CanvasService) LayerLocked(canvasId string, layerId string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return false
+	}
+	v := &canvas.VectorData
+	return v.EffectiveLayers()[v.layerIndex(layerId)].Locked
+}
+
+// LockedReplacement tells why replacing a canvas with another version of it would change its locked layers:
+// their properties or the elements on them. A new canvas has nothing locked
+func (c *CanvasService) LockedReplacement(canvas Canvas) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	existing, exists := c.canvases[canvas.ID]
+	if !exists {
+		return nil
+	}
+	v := &existing.VectorData
+	for _, layer := range v.EffectiveLayers() {
+		if layer.Locked && !slices.Contains(canvas.VectorData.Layers, layer) {
+			return fmt.Errorf("layer %s is locked", layer.ID)
+		}
+	}
+	before, after := elementsByID(v.Elements), elementsByID(canvas.VectorData.Elements)
+	for id, element := range before {
+		if other, kept := after[id]; v.ElementLayer(element).Locked && (!kept || !sameElement(element, other)) {
+			return fmt.Errorf("element %s is on a locked layer", id)
+		}
+	}
+	for id, element := range after {
+		if previous, existed := before[id]; v.ElementLayer(element).Locked && (!existed || !sameElement(previous, element)) {
+			return fmt.Errorf("element %s is on a locked layer", id)
+		}
+	}
+	return nil
+}
+
+// HasLockedLayer tells whether a canvas has a locked layer
+func (c *CanvasService) HasLockedLayer(canvasId string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return false
+	}
+	return slices.ContainsFunc(canvas.VectorData.Layers, func(layer Layer) bool {
+		return layer.Locked
+	})
+}
@@ -0,0 +1,170 @@
+package services
+
+import "testing"
+
+func onLayer(element VectorElement, layerId string) VectorElement {
+	return updateShape(element, func(shape *VectorShape) {
+		shape.Layer = layerId
+	})
+}
+
+func TestEffectiveLayers(t *testing.T) {
+	v := VectorData{Elements: []VectorElement{rect("a", 0, 0)}}
+	layers := v.EffectiveLayers()
+	if len(layers) != 1 || layers[0].ID != DefaultLayerID || !layers[0].Visible || layers[0].Opacity != 1 {
+		t.Errorf("Expected an implicit default layer, got %+v", layers)
+	}
+	if v.ElementLayer(v.Elements[0]).ID != DefaultLayerID {
+		t.Error("Expected elements without layer on the default layer")
+	}
+}
+
+func TestLayerOperations(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 0, 0))
+
+	hidden := false
+	top, err := cs.CreateLayer("c1", "top", LayerPatch{Visible: &hidden})
+	if err != nil {
+		t.Fatalf("CreateLayer failed: %v", err)
+	}
+	if top.Visible || top.Opacity != 1 || top.Name != "Layer 2" {
+		t.Errorf("Unexpected layer %+v", top)
+	}
+	if _, err := cs.CreateLayer("c1", "top", LayerPatch{}); err == nil {
+		t.Error("Expected an error for a duplicate layer")
+	}
+	invalid := 2.0
+	if _, err := cs.UpdateLayer("c1", "top", LayerPatch{Opacity: &invalid}); err == nil {
+		t.Error("Expected an error for an opacity above 1")
+	}
+
+	if err := cs.MoveElementsToLayer("c1", []string{"a"}, "top"); err != nil {
+		t.Fatalf("MoveElementsToLayer failed: %v", err)
+	}
+	v := cs.GetCanvas("c1").VectorData
+	layered := v.LayerElements()
+	if !sameIDs(elementIDs(layered[0]), "b") || !sameIDs(elementIDs(layered[1]), "a") {
+		t.Errorf("Unexpected layer split %v %v", elementIDs(layered[0]), elementIDs(layered[1]))
+	}
+
+	if err := cs.ReorderLayer("c1", "top", 0); err != nil {
+		t.Fatalf("ReorderLayer failed: %v", err)
+	}
+	if layers := cs.GetCanvas("c1").VectorData.Layers; layers[0].ID != "top" || layers[1].ID != DefaultLayerID {
+		t.Errorf("Unexpected layer order %+v", layers)
+	}
+
+	if err := cs.DeleteLayer("c1", "top"); err != nil {
+		t.Fatalf("DeleteLayer failed: %v", err)
+	}
+	v = cs.GetCanvas("c1").VectorData
+	if len(v.Layers) != 1 || v.ElementLayer(v.Elements[1]).ID != DefaultLayerID {
+		t.Errorf("Expected a to move to the remaining layer, got %+v", v.Elements[1])
+	}
+	if err := cs.DeleteLayer("c1", DefaultLayerID); err == nil {
+		t.Error("Expected an error when deleting the last layer")
+	}
+}
+
+func TestLockedLayers(t *testing.T) {
+	cs := newGroupCanvas(onLayer(rect("a", 0, 0), "locked"), VectorGroup{
+		VectorShape: VectorShape{ID: "g", Layer: "locked"}, Type: "group", Children: []VectorElement{rect("b", 0, 0)},
+	}, rect("c", 0, 0))
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{defaultLayer(), {ID: "locked", Name: "Locked", Visible: true, Locked: true, Opacity: 1}}
+
+	if id, locked := cs.LockedElement("c1", []string{"c", "b"}); !locked || id != "b" {
+		t.Errorf("Expected the nested element b to be locked, got %q %v", id, locked)
+	}
+	if _, locked := cs.LockedElement("c1", []string{"c"}); locked {
+		t.Error("Expected c not to be locked")
+	}
+	if !cs.LayerLocked("c1", "locked") || cs.LayerLocked("c1", "") {
+		t.Error("Unexpected layer lock state")
+	}
+	if err := cs.MoveElementsToLayer("c1", []string{"c"}, "locked"); err == nil {
+		t.Error("Expected an error when moving to a locked layer")
+	}
+	if err := cs.MoveElementsToLayer("c1", []string{"a"}, DefaultLayerID); err == nil {
+		t.Error("Expected an error when moving from a locked layer")
+	}
+}
+
+func TestLockedReplacement(t *testing.T) {
+	cs := newGroupCanvas(onLayer(rect("a", 0, 0), "locked"), rect("c", 0, 0))
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{defaultLayer(), {ID: "locked", Name: "Locked", Visible: true, Locked: true, Opacity: 1}}
+	current := *cs.GetCanvas("c1")
+
+	unchanged := sentCanvas(t, current.snapshot())
+	unchanged.VectorData.Elements = append(unchanged.VectorData.Elements, rect("d", 0, 0))
+	unchanged.VectorData.Elements[1] = rect("c", 5, 5)
+	if err := cs.LockedReplacement(unchanged); err != nil {
+		t.Errorf("Expected changes outside locked layers to be allowed, got %v", err)
+	}
+
+	replacements := map[string]func(*VectorData){
+		"changed":  func(v *VectorData) { v.Elements[0] = onLayer(rect("a", 5, 5), "locked") },
+		"removed":  func(v *VectorData) { v.Elements = v.Elements[1:] },
+		"added":    func(v *VectorData) { v.Elements = append(v.Elements, onLayer(rect("d", 0, 0), "locked")) },
+		"moved in": func(v *VectorData) { v.Elements[1] = onLayer(rect("c", 0, 0), "locked") },
+		"unlocked": func(v *VectorData) { v.Layers[1].Locked = false },
+		"no layer": func(v *VectorData) { v.Layers = nil },
+	}
+	for name, replace := range replacements {
+		canvas := sentCanvas(t, current.snapshot())
+		replace(&canvas.VectorData)
+		if err := cs.LockedReplacement(canvas); err == nil {
+			t.Errorf("Expected a %s replacement to be refused", name)
+		}
+	}
+
+	if err := cs.LockedReplacement(Canvas{ID: "new"}); err != nil {
+		t.Errorf("Expected a new canvas to be allowed, got %v", err)
+	}
+	if !cs.HasLockedLayer("c1") || cs.HasLockedLayer("new") {
+		t.Error("Unexpected locked layers")
+	}
+}
+
+func TestGroupKeepsLayer(t *testing.T) {
+	cs := newGroupCanvas(onLayer(rect("a", 0, 0), "l2"), onLayer(rect("b", 0, 0), "l2"), rect("c", 0, 0))
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{defaultLayer(), {ID: "l2", Name: "Layer 2", Visible: true, Opacity: 1}}
+
+	if err := cs.GroupElements("c1", "g", []string{"a", "c"}); err == nil {
+		t.Error("Expected an error when grouping elements of different layers")
+	}
+	if err := cs.GroupElements("c1", "g", []string{"a", "b"}); err != nil {
+		t.Fatalf("GroupElements failed: %v", err)
+	}
+	v := cs.GetCanvas("c1").VectorData
+	if v.ElementLayer(v.Elements[0]).ID != "l2" {
+		t.Error("Expected the group on the layer of its children")
+	}
+	if err := cs.MoveElementsToGroup("c1", []string{"a"}, ""); err != nil {
+		t.Fatalf("MoveElementsToGroup failed: %v", err)
+	}
+	v = cs.GetCanvas("c1").VectorData
+	if layer := v.ElementLayer(v.Elements[len(v.Elements)-1]); layer.ID != "l2" {
+		t.Errorf("Expected a back on layer l2, got %s", layer.ID)
+	}
+}
+
+func TestHitTestSkipsHiddenLayers(t *testing.T) {
+	cs := newGroupCanvas(onLayer(rect("a", 0, 0), "top"), rect("b", 0, 0))
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{defaultLayer(), {ID: "top", Name: "Top", Visible: true, Opacity: 1}}
+
+	ids := []string{}
+	for _, hit := range cs.HitTest("c1", Point{X: 5, Y: 5}, 0) {
+		ids = append(ids, hit.ElementID)
+	}
+	if !sameIDs(ids, "a", "b") {
+		t.Errorf("Expected the top layer first, got %v", ids)
+	}
+
+	hidden := false
+	if _, err := cs.UpdateLayer("c1", "top", LayerPatch{Visible: &hidden}); err != nil {
+		t.Fatal(err)
+	}
+	if hits := cs.HitTest("c1", Point{X: 5, Y: 5}, 0); len(hits) != 1 || hits[0].ElementID != "b" {
+		t.Errorf("Expected only b, got %+v", hits)
+	}
+}
@@ -0,0 +1,291 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLockLease is how long an element lock lasts unless its holder renews it
+const DefaultLockLease = 10 * time.Second
+
+// MaxLockElements is the number of elements a session can lock at once
+const MaxLockElements = 500
+
+// ElementLock is a lease taken by a session on an element while it edits it
+type ElementLock struct {
+	CanvasID  string    `json:"canvasId"`
+	ElementID string    `json:"elementId"`
+	UserID    string    `json:"userId"`
+	SessionID string    `json:"sessionId"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// ErrElementLocked reports the lock that prevents an operation
+type ErrElementLocked struct {
+	Lock ElementLock
+}
+
+func (e *ErrElementLocked) Error() string {
+	return fmt.Sprintf("element %s is locked by %s", e.Lock.ElementID, e.Lock.UserID)
+}
+
+// LockTable keeps the element locks of a project
+type LockTable struct {
+	mutex sync.Mutex
+	lease time.Duration
+	locks map[string]ElementLock
+}
+
+func NewLockTable(lease time.Duration) *LockTable {
+	return &LockTable{lease: lease, locks: make(map[string]ElementLock)}
+}
+
+func lockKey(canvasId, elementId string) string {
+	return canvasId + "/" + elementId
+}
+
+// heldByOther returns a live lock on the element taken by another session; the caller must hold the mutex
+func (t *LockTable) heldByOther(canvasId, sessionId, elementId string, now time.Time) (ElementLock, bool) {
+	lock, exists := t.locks[lockKey(canvasId, elementId)]
+	if !exists || lock.SessionID == sessionId || !now.Before(lock.ExpiresAt) {
+		return ElementLock{}, false
+	}
+	return lock, true
+}
+
+// Acquire takes or renews the locks of a session on several elements; none is taken when one of them is held
+// by another session
+func (t *LockTable) Acquire(canvasId, userId, sessionId string, elementIds []string, now time.Time) ([]ElementLock, error) {
+	if len(elementIds) > MaxLockElements {
+		return nil, fmt.Errorf("at most %d elements can be locked at once", MaxLockElements)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, id := range elementIds {
+		if lock, held := t.heldByOther(canvasId, sessionId, id, now); held {
+			return nil, &ErrElementLocked{Lock: lock}
+		}
+	}
+	acquired := make([]ElementLock, 0, len(elementIds))
+	for _, id := range elementIds {
+		lock := ElementLock{CanvasID: canvasId, ElementID: id, UserID: userId, SessionID: sessionId, ExpiresAt: now.Add(t.lease)}
+		t.locks[lockKey(canvasId, id)] = lock
+		acquired = append(acquired, lock)
+	}
+	return acquired, nil
+}
+
+// Release drops the locks a session holds on elements, locks of other sessions are left untouched
+func (t *LockTable) Release(canvasId, sessionId string, elementIds []string) []ElementLock {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	released := []ElementLock{}
+	for _, id := range elementIds {
+		key := lockKey(canvasId, id)
+		if lock, exists := t.locks[key]; exists && lock.SessionID == sessionId {
+			delete(t.locks, key)
+			released = append(released, lock)
+		}
+	}
+	return released
+}
+
+// ReleaseSession drops every lock of a session, when it disconnects
+func (t *LockTable) ReleaseSession(sessionId string) []ElementLock {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	released := []ElementLock{}
+	for key, lock := range t.locks {
+		if lock.SessionID == sessionId {
+			delete(t.locks, key)
+			released = append(released, lock)
+		}
+	}
+	return released
+}
+
+// Expire drops the locks whose lease is over
+func (t *LockTable) Expire(now time.Time) []ElementLock {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	expired := []ElementLock{}
+	for key, lock := range t.locks {
+		if !now.Before(lock.ExpiresAt) {
+			delete(t.locks, key)
+			expired = append(expired, lock)
+		}
+	}
+	return expired
+}
+
+// Check returns the first live lock held by another session on the elements
+func (t *LockTable) Check(canvasId, sessionId string, elementIds []string, now time.Time) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, id := range elementIds {
+		if lock, held := t.heldByOther(canvasId, sessionId, id, now); held {
+			return &ErrElementLocked{Lock: lock}
+		}
+	}
+	return nil
+}
+
+// Locks returns the live locks sorted by canvas and element
+func (t *LockTable) Locks(now time.Time) []ElementLock {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	locks := make([]ElementLock, 0, len(t.locks))
+	for _, lock := range t.locks {
+		if now.Before(lock.ExpiresAt) {
+			locks = append(locks, lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool {
+		return lockKey(locks[i].CanvasID, locks[i].ElementID) < lockKey(locks[j].CanvasID, locks[j].ElementID)
+	})
+	return locks
+}
+
+// elementsByID indexes top level elements by ID
+func elementsByID(elements []VectorElement) map[string]VectorElement {
+	byID := make(map[string]VectorElement, len(elements))
+	for _, element := range elements {
+		byID[ElementID(element)] = element
+	}
+	return byID
+}
+
+// canonicalElement encodes an element for comparisons. Z-index keys, which are given again when canvases
+// are stored, and empty fields, whose encoding depends on how the element was built, are left out
+func canonicalElement(element VectorElement) string {
+	data, err := json.Marshal(element)
+	if err != nil {
+		return ""
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return ""
+	}
+	data, _ = json.Marshal(canonicalValue(value))
+	return string(data)
+}
+
+func canonicalValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		delete(v, "zIndex")
+		for key, field := range v {
+			if field = canonicalValue(field); field == nil {
+				delete(v, key)
+			} else {
+				v[key] = field
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i := range v {
+			v[i] = canonicalValue(v[i])
+		}
+	}
+	return value
+}
+
+func sameElement(a, b VectorElement) bool {
+	return canonicalElement(a) == canonicalElement(b)
+}
+
+// appendElementIDs adds the ID of an element and of the elements nested in it
+func appendElementIDs(ids []string, element VectorElement) []string {
+	ids = append(ids, ElementID(element))
+	if group, ok := element.(VectorGroup); ok {
+		for _, child := range group.Children {
+			ids = appendElementIDs(ids, child)
+		}
+	}
+	return ids
+}
+
+// ChangedElements compares a canvas replacing the one with its ID, returning the sorted IDs of the elements
+// it adds, changes or removes along with the ones nested in them
+func (c *CanvasService) ChangedElements(canvas Canvas) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var current []VectorElement
+	if existing, exists := c.canvases[canvas.ID]; exists {
+		current = existing.VectorData.Elements
+	}
+	before, after := elementsByID(current), elementsByID(canvas.VectorData.Elements)
+	ids := []string{}
+	for id, element := range before {
+		other, kept := after[id]
+		if !kept || !sameElement(element, other) {
+			ids = appendElementIDs(ids, element)
+		}
+	}
+	for id, element := range after {
+		if previous, existed := before[id]; !existed || !sameElement(previous, element) {
+			ids = appendElementIDs(ids, element)
+		}
+	}
+	sort.Strings(ids)
+	return slices.Compact(ids)
+}
+
+// SentElements returns the top level elements of a canvas replacing the one with its ID that it adds or
+// changes, in order; the elements it sends again unchanged are left out
+func (c *CanvasService) SentElements(canvas Canvas) []VectorElement {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var current []VectorElement
+	if existing, exists := c.canvases[canvas.ID]; exists {
+		current = existing.VectorData.Elements
+	}
+	before := elementsByID(current)
+	sent := []VectorElement{}
+	for _, element := range canvas.VectorData.Elements {
+		if previous, existed := before[ElementID(element)]; !existed || !sameElement(previous, element) {
+			sent = append(sent, element)
+		}
+	}
+	return sent
+}
+
+// LockableElements checks that the elements exist in the canvas before they are locked
+func (c *CanvasService) LockableElements(canvasId string, elementIds []string) error {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	for _, id := range elementIds {
+		if _, _, _, found := findElement(canvas.VectorData.Elements, id, Identity(), nil); !found {
+			return fmt.Errorf("element %s not found", id)
+		}
+	}
+	return nil
+}
+
+// ElementFamily returns the sorted IDs of elements along with the groups containing them and the elements
+// nested in them, since a lock on any of those covers the others. Elements missing from the canvas, such as
+// the ones an operation adds, are returned alone
+func (c *CanvasService) ElementFamily(canvasId string, elementIds []string) []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ids := append([]string{}, elementIds...)
+	if canvas, exists := c.canvases[canvasId]; exists {
+		for _, id := range elementIds {
+			if element, _, ancestors, found := findElement(canvas.VectorData.Elements, id, Identity(), nil); found {
+				ids = append(appendElementIDs(ids, element), ancestors...)
+			}
+		}
+	}
+	sort.Strings(ids)
+	return slices.Compact(ids)
+}
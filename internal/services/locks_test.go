@@ -0,0 +1,168 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLockTableAcquire(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	locks := NewLockTable(10 * time.Second)
+
+	acquired, err := locks.Acquire("c1", "alice", "s1", []string{"a", "b"}, now)
+	if err != nil || len(acquired) != 2 {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	// another session cannot take any of them, and gets nothing
+	_, err = locks.Acquire("c1", "bob", "s2", []string{"c", "b"}, now.Add(time.Second))
+	var locked *ErrElementLocked
+	if !errors.As(err, &locked) || locked.Lock.ElementID != "b" || locked.Lock.UserID != "alice" {
+		t.Fatalf("Expected b to be locked by alice, got %v", err)
+	}
+	if err := locks.Check("c1", "s2", []string{"c"}, now); err != nil {
+		t.Error("Expected c to stay free after a refused acquire")
+	}
+
+	// the same element on another canvas is another lock
+	if _, err := locks.Acquire("c2", "bob", "s2", []string{"a"}, now); err != nil {
+		t.Errorf("Expected a on another canvas to be free, got %v", err)
+	}
+
+	// the holder renews its lease
+	renewed, err := locks.Acquire("c1", "alice", "s1", []string{"a"}, now.Add(8*time.Second))
+	if err != nil || !renewed[0].ExpiresAt.Equal(now.Add(18*time.Second)) {
+		t.Errorf("Expected a renewed lease, got %+v %v", renewed, err)
+	}
+	if err := locks.Check("c1", "s1", []string{"a", "b"}, now); err != nil {
+		t.Errorf("Expected the holder to pass the check, got %v", err)
+	}
+	if err := locks.Check("c1", "s2", []string{"a"}, now); err == nil {
+		t.Error("Expected other sessions to fail the check")
+	}
+}
+
+func TestLockTableRelease(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	locks := NewLockTable(10 * time.Second)
+	_, _ = locks.Acquire("c1", "alice", "s1", []string{"a", "b"}, now)
+	_, _ = locks.Acquire("c1", "bob", "s2", []string{"c"}, now)
+
+	if released := locks.Release("c1", "s2", []string{"a"}); len(released) != 0 {
+		t.Error("Expected a session not to release the locks of another one")
+	}
+	if released := locks.Release("c1", "s1", []string{"a"}); len(released) != 1 {
+		t.Errorf("Expected a to be released, got %+v", released)
+	}
+	if released := locks.ReleaseSession("s1"); len(released) != 1 || released[0].ElementID != "b" {
+		t.Errorf("Expected b to be released with its session, got %+v", released)
+	}
+	if live := locks.Locks(now); len(live) != 1 || live[0].ElementID != "c" {
+		t.Errorf("Expected only c to stay locked, got %+v", live)
+	}
+}
+
+func TestLockTableExpire(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	locks := NewLockTable(10 * time.Second)
+	_, _ = locks.Acquire("c1", "alice", "s1", []string{"a"}, now)
+	_, _ = locks.Acquire("c1", "alice", "s1", []string{"b"}, now.Add(5*time.Second))
+
+	later := now.Add(10 * time.Second)
+	if err := locks.Check("c1", "s2", []string{"a"}, later); err != nil {
+		t.Error("Expected an expired lock not to block other sessions")
+	}
+	if live := locks.Locks(later); len(live) != 1 || live[0].ElementID != "b" {
+		t.Errorf("Expected only b to be live, got %+v", live)
+	}
+	if expired := locks.Expire(later); len(expired) != 1 || expired[0].ElementID != "a" {
+		t.Errorf("Expected a to expire, got %+v", expired)
+	}
+	if _, err := locks.Acquire("c1", "bob", "s2", []string{"a"}, later); err != nil {
+		t.Errorf("Expected an expired element to be free, got %v", err)
+	}
+}
+
+// sentCanvas is a canvas as sent back by a client, encoded and parsed again
+func sentCanvas(t *testing.T, canvas Canvas) Canvas {
+	data, err := json.Marshal(canvas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var sent Canvas
+	if err := json.Unmarshal(data, &sent); err != nil {
+		t.Fatal(err)
+	}
+	sent.VectorData.Elements = ParseVectorElementsFromRaw(raw)
+	return sent
+}
+
+func TestChangedElements(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), VectorGroup{
+		VectorShape: VectorShape{ID: "g"}, Type: "group", Children: []VectorElement{rect("b", 0, 0)},
+	}, rect("c", 0, 0))
+	current := *cs.GetCanvas("c1")
+
+	if ids := cs.ChangedElements(sentCanvas(t, current)); len(ids) != 0 {
+		t.Errorf("Expected the same canvas to change nothing, got %v", ids)
+	}
+
+	canvas := sentCanvas(t, current)
+	canvas.VectorData.Elements = []VectorElement{rect("a", 5, 5), canvas.VectorData.Elements[2], rect("d", 0, 0)}
+	if ids := cs.ChangedElements(canvas); !reflect.DeepEqual(ids, []string{"a", "b", "d", "g"}) {
+		t.Errorf("Expected the changed, removed and added elements, got %v", ids)
+	}
+
+	if ids := cs.ChangedElements(Canvas{ID: "c1"}); !reflect.DeepEqual(ids, []string{"a", "b", "c", "g"}) {
+		t.Errorf("Expected every element of a removed canvas, got %v", ids)
+	}
+}
+
+func TestElementFamily(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), VectorGroup{
+		VectorShape: VectorShape{ID: "g"}, Type: "group", Children: []VectorElement{
+			rect("b", 0, 0), VectorGroup{VectorShape: VectorShape{ID: "h"}, Type: "group", Children: []VectorElement{rect("c", 0, 0)}},
+		},
+	})
+
+	if ids := cs.ElementFamily("c1", []string{"h"}); !reflect.DeepEqual(ids, []string{"c", "g", "h"}) {
+		t.Errorf("Expected a group with its elements and parents, got %v", ids)
+	}
+	if ids := cs.ElementFamily("c1", []string{"b", "new"}); !reflect.DeepEqual(ids, []string{"b", "g", "new"}) {
+		t.Errorf("Expected an element with its group and a missing one alone, got %v", ids)
+	}
+
+	if err := cs.LockableElements("c1", []string{"a", "c"}); err != nil {
+		t.Errorf("Expected nested elements to be lockable, got %v", err)
+	}
+	if err := cs.LockableElements("c1", []string{"a", "missing"}); err == nil {
+		t.Error("Expected a missing element not to be lockable")
+	}
+	if err := cs.LockableElements("c2", []string{"a"}); err == nil {
+		t.Error("Expected the elements of a missing canvas not to be lockable")
+	}
+	if _, err := NewLockTable(DefaultLockLease).Acquire("c1", "alice", "s1", make([]string, MaxLockElements+1), time.Now()); err == nil {
+		t.Error("Expected too many elements not to be locked")
+	}
+}
+
+func TestSentElements(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 0, 0))
+	canvas := sentCanvas(t, *cs.GetCanvas("c1"))
+	canvas.VectorData.Elements = []VectorElement{rect("c", 0, 0), canvas.VectorData.Elements[0], rect("b", 5, 5)}
+
+	sent := cs.SentElements(canvas)
+	if len(sent) != 2 || ElementID(sent[0]) != "c" || ElementID(sent[1]) != "b" {
+		t.Errorf("Expected the added and changed elements, got %v", sent)
+	}
+	if sent := cs.SentElements(Canvas{ID: "c2", VectorData: VectorData{Elements: []VectorElement{rect("a", 0, 0)}}}); len(sent) != 1 {
+		t.Errorf("Expected every element of a new canvas, got %v", sent)
+	}
+}
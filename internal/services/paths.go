@@ -0,0 +1,136 @@
+package services
+
+// curveSteps is the number of straight lines a curve segment is flattened into for hit-testing and bounds
+const curveSteps = 16
+
+// BezierSegment holds the control points of the cubic curve going from a point of a path to the next one
+type BezierSegment struct {
+	C1 Point `firestore:"c1" json:"c1"`
+	C2 Point `firestore:"c2" json:"c2"`
+}
+
+// StrokeProcessing configures what happens to freehand paths accepted from clients
+type StrokeProcessing struct {
+	// Tolerance of the simplification, which is skipped when not positive
+	Tolerance float64
+	// Smooth turns the simplified points into curves
+	Smooth bool
+}
+
+// segmentCount returns the number of segments of a path, closed paths have one more back to their start
+func segmentCount(path VectorPath) int {
+	if len(path.Points) < 2 {
+		return 0
+	}
+	if path.Closed {
+		return len(path.Points)
+	}
+	return len(path.Points) - 1
+}
+
+// SimplifyPoints drops the points of a polyline which it does not need to stay within tolerance of every
+// original point, using the Ramer-Douglas-Peucker algorithm. The first and last points are always kept
+func SimplifyPoints(points []Point, tolerance float64) []Point {
+	if len(points) < 3 || tolerance <= 0 {
+		return points
+	}
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	// an explicit stack avoids deep recursion on long strokes
+	stack := [][2]int{{0, len(points) - 1}}
+	for len(stack) > 0 {
+		span := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		first, last := span[0], span[1]
+		farthest, maxDistance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := distanceToSegment(points[i], points[first], points[last]); d > maxDistance {
+				farthest, maxDistance = i, d
+			}
+		}
+		if farthest < 0 {
+			continue
+		}
+		keep[farthest] = true
+		stack = append(stack, [2]int{first, farthest}, [2]int{farthest, last})
+	}
+
+	simplified := []Point{}
+	for i, p := range points {
+		if keep[i] {
+			simplified = append(simplified, p)
+		}
+	}
+	return simplified
+}
+
+// smoothSegments returns the curves of the Catmull-Rom spline going through points, as cubic Bezier segments.
+// Open paths repeat their end points as neighbours, closed ones wrap around
+func smoothSegments(points []Point, closed bool) []BezierSegment {
+	n := len(points)
+	at := func(i int) Point {
+		if closed {
+			return points[(i%n+n)%n]
+		}
+		return points[max(0, min(n-1, i))]
+	}
+	segments := make([]BezierSegment, segmentCount(VectorPath{Points: points, Closed: closed}))
+	for i := range segments {
+		p0, p1, p2, p3 := at(i-1), at(i), at(i+1), at(i+2)
+		segments[i] = BezierSegment{
+			C1: Point{X: p1.X + (p2.X-p0.X)/6, Y: p1.Y + (p2.Y-p0.Y)/6},
+			C2: Point{X: p2.X - (p3.X-p1.X)/6, Y: p2.Y - (p3.Y-p1.Y)/6},
+		}
+	}
+	return segments
+}
+
+// ProcessStroke simplifies and smooths a freehand path as configured. Paths already made of curves are
+// left alone, so that sending back a processed path does not alter it
+func ProcessStroke(path VectorPath, settings StrokeProcessing) VectorPath {
+	if len(path.Segments) > 0 {
+		return path
+	}
+	points := path.Points
+	if path.Closed && len(points) > 2 && points[0] == points[len(points)-1] {
+		// the closing segment joins the ends of closed paths
+		points = points[:len(points)-1]
+	}
+	path.Points = SimplifyPoints(points, settings.Tolerance)
+	if settings.Smooth && len(path.Points) > 2 {
+		path.Segments = smoothSegments(path.Points, path.Closed)
+	}
+	return path
+}
+
+// bezierPoint evaluates a cubic curve at t between 0 and 1
+func bezierPoint(p0, c1, c2, p3 Point, t float64) Point {
+	u := 1 - t
+	a, b, c, d := u*u*u, 3*u*u*t, 3*u*t*t, t*t*t
+	return Point{
+		X: a*p0.X + b*c1.X + c*c2.X + d*p3.X,
+		Y: a*p0.Y + b*c1.Y + c*c2.Y + d*p3.Y,
+	}
+}
+
+// pathOutline returns the polyline a path is drawn along, its curves flattened; closed paths end on their start
+func pathOutline(path VectorPath) []Point {
+	count := segmentCount(path)
+	if len(path.Segments) != count {
+		if path.Closed && count > 1 {
+			return append(append([]Point{}, path.Points...), path.Points[0])
+		}
+		return path.Points
+	}
+	outline := make([]Point, 0, count*curveSteps+1)
+	if count > 0 {
+		outline = append(outline, path.Points[0])
+	}
+	for i, segment := range path.Segments {
+		from, to := path.Points[i], path.Points[(i+1)%len(path.Points)]
+		for step := 1; step <= curveSteps; step++ {
+			outline = append(outline, bezierPoint(from, segment.C1, segment.C2, to, float64(step)/curveSteps))
+		}
+	}
+	return outline
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestSimplifyPoints(t *testing.T) {
+	points := []Point{}
+	for i := 0; i <= 100; i++ {
+		// a nearly straight line with a corner at x = 50
+		y := math.Sin(float64(i)) * 0.1
+		if i > 50 {
+			y += float64(i-50) * 2
+		}
+		points = append(points, Point{X: float64(i), Y: y})
+	}
+
+	simplified := SimplifyPoints(points, 0.5)
+	if len(simplified) > 5 {
+		t.Errorf("Expected a handful of points, got %d", len(simplified))
+	}
+	if simplified[0] != points[0] || simplified[len(simplified)-1] != points[100] {
+		t.Error("Expected the ends to be kept")
+	}
+	for _, p := range points {
+		if d := distanceToPolyline(p, simplified, false); d > 0.5 {
+			t.Fatalf("Expected every sample within tolerance, %+v is %v away", p, d)
+		}
+	}
+
+	if got := SimplifyPoints(points, 0); len(got) != len(points) {
+		t.Error("Expected no simplification without tolerance")
+	}
+}
+
+func TestProcessStroke(t *testing.T) {
+	raw := VectorPath{Type: "path", Points: []Point{{0, 0}, {5, 0.01}, {10, 0}, {10, 10}, {0, 10}}}
+
+	plain := ProcessStroke(raw, StrokeProcessing{Tolerance: 0.5})
+	if len(plain.Points) != 4 || plain.Segments != nil {
+		t.Errorf("Expected 4 points and no curves, got %+v", plain)
+	}
+
+	smooth := ProcessStroke(raw, StrokeProcessing{Tolerance: 0.5, Smooth: true})
+	if len(smooth.Segments) != 3 {
+		t.Fatalf("Expected 3 curves, got %d", len(smooth.Segments))
+	}
+	// the curve leaving a corner follows the direction from the previous point to the next one
+	if !nearlyPoint(smooth.Segments[1].C1, Point{X: 10 + 10.0/6, Y: 10.0 / 6}) {
+		t.Errorf("Unexpected control point %+v", smooth.Segments[1].C1)
+	}
+	if again := ProcessStroke(smooth, StrokeProcessing{Tolerance: 5, Smooth: true}); len(again.Points) != 4 {
+		t.Error("Expected processed paths to be left alone")
+	}
+
+	closed := ProcessStroke(VectorPath{Points: []Point{{0, 0}, {10, 0}, {10, 10}, {0, 0}}, Closed: true}, StrokeProcessing{Smooth: true})
+	if len(closed.Points) != 3 || len(closed.Segments) != 3 {
+		t.Errorf("Expected the closing segment to replace the repeated start, got %+v", closed)
+	}
+}
+
+func TestCurvedPathGeometry(t *testing.T) {
+	path := VectorPath{
+		VectorShape: VectorShape{ID: "p", StrokeWidth: 2},
+		Type:        "path",
+		Points:      []Point{{0, 0}, {100, 0}},
+		Segments:    []BezierSegment{{C1: Point{X: 0, Y: 100}, C2: Point{X: 100, Y: 100}}},
+	}
+	bounds, _ := ElementBounds(path)
+	if !nearlyEqual(bounds.MaxY, 76) {
+		t.Errorf("Expected the bounds to follow the curve, got %+v", bounds)
+	}
+	if !elementContains(path, Point{X: 50, Y: 75}, 0) || elementContains(path, Point{X: 50, Y: 1}, 0) {
+		t.Error("Expected hit-testing along the curve rather than the chord")
+	}
+
+	moved := translateElement(path, 10, 0).(VectorPath)
+	if moved.Segments[0].C1.X != 10 || path.Segments[0].C1.X != 0 {
+		t.Error("Expected the control points to move with the path, without changing the original")
+	}
+}
+
+func TestParsePathSegments(t *testing.T) {
+	parse := func(data string) VectorPath {
+		raw := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			t.Fatal(err)
+		}
+		return ParseSingleStrokeFromRaw(raw).(VectorPath)
+	}
+	path := parse(`{"id":"p","type":"path","points":[{"x":0,"y":0},{"x":1,"y":1}],"segments":[{"c1":{"x":0,"y":1},"c2":{"x":1,"y":0}}]}`)
+	if len(path.Segments) != 1 {
+		t.Errorf("Expected the curve to be read, got %+v", path)
+	}
+	path = parse(`{"id":"p","type":"path","points":[{"x":0,"y":0},{"x":1,"y":1}],"segments":[]}`)
+	if path.Segments != nil || len(path.Points) != 2 {
+		t.Errorf("Expected a raw points path, got %+v", path)
+	}
+	path = parse(`{"id":"p","type":"path","points":[{"x":0,"y":0},{"x":1,"y":1},{"x":2,"y":0}],"segments":[{"c1":{"x":0,"y":1},"c2":{"x":1,"y":0}}]}`)
+	if path.Segments != nil {
+		t.Error("Expected mismatched curves to be dropped")
+	}
+}
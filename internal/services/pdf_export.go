@@ -0,0 +1,708 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// pdfPointsPerUnit prints canvas units, CSS pixels, at their size on screen
+	pdfPointsPerUnit = 0.75
+	// pdfMargin surrounds canvases, the project name and the page number are written in it
+	pdfMargin = 36
+	// pdfMinPageWidth keeps room for the header of small canvases
+	pdfMinPageWidth = 216
+	// ellipseKappa places the control points of the four Bezier curves drawing an ellipse
+	ellipseKappa = 0.5522847498
+)
+
+// PDFOptions tunes the export of projects to PDF documents
+type PDFOptions struct {
+	// Title is written at the top of every page and in the document properties
+	Title string
+	// Image returns the decoded content of an asset, images without one are left out
+	Image func(assetId string) (image.Image, bool)
+}
+
+// pdfDocument collects numbered objects, an object being referenced as "<n> 0 R"
+type pdfDocument struct {
+	objects [][]byte
+	options PDFOptions
+	// fonts and images are shared by the pages, missing images are kept as 0
+	fonts  map[string]int
+	images map[string]int
+}
+
+func (d *pdfDocument) reserve() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects)
+}
+
+func (d *pdfDocument) set(id int, body string) {
+	d.objects[id-1] = []byte(body)
+}
+
+func (d *pdfDocument) add(body string) int {
+	id := d.reserve()
+	d.set(id, body)
+	return id
+}
+
+// setStream stores a compressed stream, dict holding the entries besides its length and filter
+func (d *pdfDocument) setStream(id int, dict string, data []byte) {
+	var compressed bytes.Buffer
+	writer := zlib.NewWriter(&compressed)
+	_, _ = writer.Write(data)
+	_ = writer.Close()
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<< %s /Length %d /Filter /FlateDecode >>\nstream\n", dict, compressed.Len())
+	body.Write(compressed.Bytes())
+	body.WriteString("\nendstream")
+	d.objects[id-1] = body.Bytes()
+}
+
+func (d *pdfDocument) addStream(dict string, data []byte) int {
+	id := d.reserve()
+	d.setStream(id, dict, data)
+	return id
+}
+
+// bytes writes the objects, then the cross-reference table locating them
+func (d *pdfDocument) bytes(root, info int) []byte {
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n", i+1)
+		out.Write(body)
+		out.WriteString("\nendobj\n")
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, root, info, xref)
+	return out.Bytes()
+}
+
+// font returns the object of one of the standard fonts, which readers provide without embedding
+func (d *pdfDocument) font(base string) int {
+	if id, exists := d.fonts[base]; exists {
+		return id
+	}
+	d.fonts[base] = d.add(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", base))
+	return d.fonts[base]
+}
+
+// image returns the object of an asset, with its transparency as a soft mask, false when it cannot be loaded
+func (d *pdfDocument) image(assetId string) (int, bool) {
+	if id, loaded := d.images[assetId]; loaded {
+		return id, id != 0
+	}
+	d.images[assetId] = 0
+	if d.options.Image == nil {
+		return 0, false
+	}
+	src, found := d.options.Image(assetId)
+	if !found || src.Bounds().Empty() {
+		return 0, false
+	}
+
+	bounds := src.Bounds()
+	rgb := make([]byte, 0, bounds.Dx()*bounds.Dy()*3)
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+			rgb = append(rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			opaque = opaque && c.A == 255
+		}
+	}
+	dict := fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8", bounds.Dx(), bounds.Dy())
+	if !opaque {
+		mask := d.addStream(fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8", bounds.Dx(), bounds.Dy()), alpha)
+		dict += fmt.Sprintf(" /SMask %d 0 R", mask)
+	}
+	d.images[assetId] = d.addStream(dict, rgb)
+	return d.images[assetId], true
+}
+
+// pdfResources names the resources used by the content of a page, by category then by value
+type pdfResources struct {
+	names map[string]map[string]string
+	count int
+}
+
+// name returns the name of a resource, the same value always getting the same name
+func (r *pdfResources) name(category, value string) string {
+	if r.names[category] == nil {
+		r.names[category] = make(map[string]string)
+	}
+	if name, exists := r.names[category][value]; exists {
+		return name
+	}
+	r.count++
+	name := fmt.Sprintf("R%d", r.count)
+	r.names[category][value] = name
+	return name
+}
+
+func (r *pdfResources) dict() string {
+	categories := make([]string, 0, len(r.names))
+	for category := range r.names {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	var dict strings.Builder
+	dict.WriteString("<<")
+	for _, category := range categories {
+		entries := make([]string, 0, len(r.names[category]))
+		for value, name := range r.names[category] {
+			entries = append(entries, fmt.Sprintf(" /%s %s", name, value))
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(&dict, " /%s <<%s >>", category, strings.Join(entries, ""))
+	}
+	dict.WriteString(" >>")
+	return dict.String()
+}
+
+// pdfLink is a link annotation, its box in page coordinates
+type pdfLink struct {
+	box  Rect
+	href string
+}
+
+// pdfPage draws a canvas in the content stream of a page. The content is drawn in canvas coordinates,
+// device mapping them to the page for the annotations
+type pdfPage struct {
+	doc         *pdfDocument
+	resources   *pdfResources
+	resourcesID int
+	out         *strings.Builder
+	links       []pdfLink
+}
+
+func pdfNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+func pdfColor(c color.NRGBA) string {
+	return pdfNumber(float64(c.R)/255) + " " + pdfNumber(float64(c.G)/255) + " " + pdfNumber(float64(c.B)/255)
+}
+
+func pdfMatrix(m Matrix) string {
+	return strings.Join([]string{pdfNumber(m.A), pdfNumber(m.B), pdfNumber(m.C), pdfNumber(m.D), pdfNumber(m.E), pdfNumber(m.F)}, " ")
+}
+
+// winAnsi are the characters of the Windows-1252 encoding of the standard fonts which differ from Latin-1
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88, '‰': 0x89,
+	'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95,
+	'–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// pdfString writes text shown with the standard fonts, characters they lack become question marks
+func pdfString(text string) string {
+	var s strings.Builder
+	s.WriteByte('(')
+	for _, r := range text {
+		var b byte
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			s.WriteByte('\\')
+			b = byte(r)
+		case r >= 32 && r < 127 || r >= 160 && r <= 255:
+			b = byte(r)
+		case winAnsi[r] != 0:
+			b = winAnsi[r]
+		default:
+			b = '?'
+		}
+		if b >= 128 {
+			fmt.Fprintf(&s, "\\%03o", b)
+		} else {
+			s.WriteByte(b)
+		}
+	}
+	s.WriteByte(')')
+	return s.String()
+}
+
+// pdfTextString writes text of the document properties, as UTF-16 when it is not plain ASCII
+func pdfTextString(text string) string {
+	ascii := true
+	for _, r := range text {
+		ascii = ascii && r >= 32 && r < 127
+	}
+	if ascii {
+		return pdfString(text)
+	}
+	var s strings.Builder
+	s.WriteString("<FEFF")
+	for _, unit := range utf16.Encode([]rune(text)) {
+		fmt.Fprintf(&s, "%04X", unit)
+	}
+	s.WriteByte('>')
+	return s.String()
+}
+
+// pdfFontName picks the standard font closest to a CSS font family
+func pdfFontName(family string, bold, italic bool) string {
+	family = strings.ToLower(family)
+	styles := [4]string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"}
+	switch {
+	case strings.Contains(family, "mono") || strings.Contains(family, "courier"):
+		styles = [4]string{"Courier", "Courier-Bold", "Courier-Oblique", "Courier-BoldOblique"}
+	case strings.Contains(family, "times") || strings.Contains(family, "georgia") ||
+		strings.Contains(family, "serif") && !strings.Contains(family, "sans"):
+		styles = [4]string{"Times-Roman", "Times-Bold", "Times-Italic", "Times-BoldItalic"}
+	}
+	i := 0
+	if bold {
+		i++
+	}
+	if italic {
+		i += 2
+	}
+	return styles[i]
+}
+
+// pdfBlendMode converts a CSS blend mode to its PDF name, multiply to Multiply and color-dodge to ColorDodge
+func pdfBlendMode(mode string) string {
+	parts := strings.Split(mode, "-")
+	for i, part := range parts {
+		if part != "" {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// pdfPolyline returns the operators of a chain of points, closed or not
+func pdfPolyline(points []Point, closed bool) string {
+	if len(points) == 0 {
+		return ""
+	}
+	var ops strings.Builder
+	for i, p := range points {
+		op := "l"
+		if i == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(&ops, "%s %s %s\n", pdfNumber(p.X), pdfNumber(p.Y), op)
+	}
+	if closed {
+		ops.WriteString("h\n")
+	}
+	return ops.String()
+}
+
+// pdfPath returns the operators of a path, its curves included
+func pdfPath(path VectorPath) string {
+	if len(path.Points) == 0 {
+		return ""
+	}
+	if len(path.Segments) != segmentCount(path) {
+		return pdfPolyline(path.Points, path.Closed)
+	}
+	var ops strings.Builder
+	fmt.Fprintf(&ops, "%s %s m\n", pdfNumber(path.Points[0].X), pdfNumber(path.Points[0].Y))
+	for i, s := range path.Segments {
+		to := path.Points[(i+1)%len(path.Points)]
+		fmt.Fprintf(&ops, "%s %s %s %s %s %s c\n",
+			pdfNumber(s.C1.X), pdfNumber(s.C1.Y), pdfNumber(s.C2.X), pdfNumber(s.C2.Y), pdfNumber(to.X), pdfNumber(to.Y))
+	}
+	if path.Closed {
+		ops.WriteString("h\n")
+	}
+	return ops.String()
+}
+
+// pdfEllipse returns the operators of an axis aligned ellipse, as four Bezier curves
+func pdfEllipse(cx, cy, rx, ry float64) string {
+	kx, ky := rx*ellipseKappa, ry*ellipseKappa
+	n := pdfNumber
+	return fmt.Sprintf("%s %s m\n%s %s %s %s %s %s c\n%s %s %s %s %s %s c\n%s %s %s %s %s %s c\n%s %s %s %s %s %s c\nh\n",
+		n(cx+rx), n(cy),
+		n(cx+rx), n(cy+ky), n(cx+kx), n(cy+ry), n(cx), n(cy+ry),
+		n(cx-kx), n(cy+ry), n(cx-rx), n(cy+ky), n(cx-rx), n(cy),
+		n(cx-rx), n(cy-ky), n(cx-kx), n(cy-ry), n(cx), n(cy-ry),
+		n(cx+kx), n(cy-ry), n(cx+rx), n(cy-ky), n(cx+rx), n(cy))
+}
+
+func pdfRectangle(x, y, width, height float64) string {
+	return fmt.Sprintf("%s %s %s %s re\n", pdfNumber(x), pdfNumber(y), pdfNumber(width), pdfNumber(height))
+}
+
+// state sets a graphics state, made of PDF dictionary entries
+func (p *pdfPage) state(entries string) {
+	fmt.Fprintf(p.out, "/%s gs\n", p.resources.name("ExtGState", "<< "+entries+" >>"))
+}
+
+// shading defines a gradient over the unit square, the box of the element it fills once mapped.
+// Stop colors are opaque, the fill opacity applies to the whole gradient
+func (p *pdfPage) shading(g *Gradient) (string, bool) {
+	if len(g.Stops) == 0 {
+		return "", false
+	}
+	stops := append([]GradientStop{}, g.Stops...)
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].Offset < stops[j].Offset
+	})
+	for i := range stops {
+		stops[i].Offset = math.Max(0, math.Min(1, stops[i].Offset))
+	}
+	if stops[0].Offset > 0 {
+		stops = append([]GradientStop{{Offset: 0, Color: stops[0].Color}}, stops...)
+	}
+	if last := stops[len(stops)-1]; last.Offset < 1 || len(stops) == 1 {
+		stops = append(stops, GradientStop{Offset: 1, Color: last.Color})
+	}
+
+	colors := make([]string, len(stops))
+	for i, stop := range stops {
+		c, _ := ParseColor(stop.Color)
+		colors[i] = pdfColor(c)
+	}
+	functions, bounds, encode := []string{}, []string{}, []string{}
+	for i := 1; i < len(stops); i++ {
+		functions = append(functions, fmt.Sprintf("<< /FunctionType 2 /Domain [0 1] /C0 [%s] /C1 [%s] /N 1 >>", colors[i-1], colors[i]))
+		encode = append(encode, "0 1")
+		if i < len(stops)-1 {
+			bounds = append(bounds, pdfNumber(stops[i].Offset))
+		}
+	}
+	function := functions[0]
+	if len(functions) > 1 {
+		function = fmt.Sprintf("<< /FunctionType 3 /Domain [0 1] /Functions [%s] /Bounds [%s] /Encode [%s] >>",
+			strings.Join(functions, " "), strings.Join(bounds, " "), strings.Join(encode, " "))
+	}
+
+	shading := fmt.Sprintf("<< /ShadingType 2 /ColorSpace /DeviceRGB /Coords [%s %s %s %s] /Function %s /Extend [true true] >>",
+		pdfNumber(g.X1), pdfNumber(g.Y1), pdfNumber(g.X2), pdfNumber(g.Y2), function)
+	if g.Type == GradientRadial {
+		shading = fmt.Sprintf("<< /ShadingType 3 /ColorSpace /DeviceRGB /Coords [%s %s 0 %s %s %s] /Function %s /Extend [true true] >>",
+			pdfNumber(g.CX), pdfNumber(g.CY), pdfNumber(g.CX), pdfNumber(g.CY), pdfNumber(g.R), function)
+	}
+	return p.resources.name("Shading", shading), true
+}
+
+// paint fills then strokes a path given by its operators. Filled tells whether the fill paints anything, box is
+// the element box gradients spread over. A tint replaces every color, to draw shadows
+func (p *pdfPage) paint(shape VectorShape, path string, filled bool, box Rect, tint *color.NRGBA) {
+	if path == "" {
+		return
+	}
+	fillAlpha, strokeAlpha := 1.0, 1.0
+	fill, fillOk := ParseColor(shape.Fill)
+	filled = filled && isFilled(shape) && (fillOk || shape.FillGradient != nil)
+	stroke, strokeOk := ParseColor(shape.Stroke)
+	stroked := shape.Stroke != "" && shape.StrokeWidth > 0 && strokeOk
+	if tint != nil {
+		fill, stroke = *tint, *tint
+	}
+	gradient := filled && shape.FillGradient != nil && tint == nil
+	if filled {
+		if !gradient {
+			fillAlpha = float64(fill.A) / 255
+			fmt.Fprintf(p.out, "%s rg\n", pdfColor(fill))
+		}
+		fillAlpha *= shape.EffectiveFillOpacity()
+	}
+	if stroked {
+		strokeAlpha = float64(stroke.A) / 255 * shape.EffectiveStrokeOpacity()
+		fmt.Fprintf(p.out, "%s RG\n%s w\n", pdfColor(stroke), pdfNumber(shape.StrokeWidth))
+		caps := map[string]int{LineCapButt: 0, LineCapRound: 1, LineCapSquare: 2}
+		joins := map[string]int{LineJoinMiter: 0, LineJoinRound: 1, LineJoinBevel: 2}
+		fmt.Fprintf(p.out, "%d J\n%d j\n%d M\n", caps[shape.EffectiveLineCap()], joins[shape.EffectiveLineJoin()], miterLimit)
+		dashes := make([]string, len(shape.StrokeDasharray))
+		for i, dash := range shape.StrokeDasharray {
+			dashes[i] = pdfNumber(dash)
+		}
+		fmt.Fprintf(p.out, "[%s] 0 d\n", strings.Join(dashes, " "))
+	}
+	if !filled && !stroked {
+		return
+	}
+	p.state(fmt.Sprintf("/ca %s /CA %s", pdfNumber(fillAlpha), pdfNumber(strokeAlpha)))
+
+	if gradient {
+		if name, ok := p.shading(shape.FillGradient); ok && box.Width() > 0 && box.Height() > 0 {
+			fmt.Fprintf(p.out, "q\n%sW n\n%s cm\n/%s sh\nQ\n", path, pdfMatrix(Matrix{A: box.Width(), D: box.Height(), E: box.MinX, F: box.MinY}), name)
+		}
+		filled = false
+	}
+	switch {
+	case filled && stroked:
+		p.out.WriteString(path + "B\n")
+	case filled:
+		p.out.WriteString(path + "f\n")
+	case stroked:
+		p.out.WriteString(path + "S\n")
+	}
+}
+
+// element draws an element and its shadow, m mapping its container coordinates to the page
+func (p *pdfPage) element(element VectorElement, m Matrix, tint *color.NRGBA) {
+	shape, ok := ElementShape(element)
+	if !ok {
+		return
+	}
+	if href, linked := actionHref(shape.Action); linked && tint == nil {
+		if bounds, ok := elementBounds(element, m); ok {
+			p.links = append(p.links, pdfLink{box: bounds, href: href})
+		}
+	}
+
+	p.out.WriteString("q\n")
+	if shape.Transform != nil {
+		fmt.Fprintf(p.out, "%s cm\n", pdfMatrix(*shape.Transform))
+	}
+	m = m.Multiply(elementTransform(element))
+	if mode := shape.EffectiveBlendMode(); mode != "normal" && tint == nil {
+		p.state("/BM /" + pdfBlendMode(mode))
+	}
+	if shape.Shadow != nil && tint == nil {
+		// PDF has no blur, shadows are drawn as flat silhouettes
+		if c, ok := ParseColor(shape.Shadow.Color); ok && c.A > 0 {
+			fmt.Fprintf(p.out, "q\n1 0 0 1 %s %s cm\n", pdfNumber(shape.Shadow.OffsetX), pdfNumber(shape.Shadow.OffsetY))
+			p.draw(element, m, &c)
+			p.out.WriteString("Q\n")
+		}
+	}
+	p.draw(element, m, tint)
+	p.out.WriteString("Q\n")
+}
+
+// draw draws an element in its own coordinates, its transform being applied
+func (p *pdfPage) draw(element VectorElement, m Matrix, tint *color.NRGBA) {
+	switch e := element.(type) {
+	case VectorPath:
+		box, _ := pointsBounds(Identity(), pathOutline(e))
+		p.paint(e.VectorShape, pdfPath(e), e.Closed, box, tint)
+	case VectorRectangle:
+		box, _ := pointsBounds(Identity(), boxCorners(e.X, e.Y, e.Width, e.Height))
+		p.paint(e.VectorShape, pdfRectangle(e.X, e.Y, e.Width, e.Height), true, box, tint)
+	case VectorCircle:
+		p.paint(e.VectorShape, pdfEllipse(e.CX, e.CY, e.Radius, e.Radius), true, ellipseBounds(Identity(), e.CX, e.CY, e.Radius, e.Radius), tint)
+	case VectorEllipse:
+		p.paint(e.VectorShape, pdfEllipse(e.CX, e.CY, e.RX, e.RY), true, ellipseBounds(Identity(), e.CX, e.CY, e.RX, e.RY), tint)
+	case VectorLine:
+		p.paint(e.VectorShape, pdfPolyline([]Point{{X: e.X1, Y: e.Y1}, {X: e.X2, Y: e.Y2}}, false), false, Rect{}, tint)
+	case VectorPolyline:
+		p.paint(e.VectorShape, pdfPolyline(e.Points, false), false, Rect{}, tint)
+	case VectorPolygon:
+		box, _ := pointsBounds(Identity(), e.Points)
+		p.paint(e.VectorShape, pdfPolyline(e.Points, true), true, box, tint)
+	case VectorArrow:
+		p.arrow(e, tint)
+	case VectorText:
+		p.text(e, tint)
+	case VectorImage:
+		p.image(e, tint)
+	case VectorGroup:
+		for _, child := range e.Children {
+			p.element(child, m, tint)
+		}
+	}
+}
+
+// arrow draws the line of an arrow then its heads, filled with the stroke color and without dashes
+func (p *pdfPage) arrow(a VectorArrow, tint *color.NRGBA) {
+	start, end := Point{X: a.X1, Y: a.Y1}, Point{X: a.X2, Y: a.Y2}
+	p.paint(a.VectorShape, pdfPolyline([]Point{start, end}, false), false, Rect{}, tint)
+
+	head := a.VectorShape
+	head.Fill, head.FillGradient, head.FillOpacity, head.StrokeDasharray = a.Stroke, nil, a.StrokeOpacity, nil
+	size := arrowHeadSize(a)
+	for _, h := range []struct {
+		style    string
+		tip, end Point
+	}{{a.StartHead, start, end}, {a.EndHead, end, start}} {
+		outline, ok := arrowHeadShape(h.style, h.tip, h.end, size)
+		switch {
+		case !ok:
+		case outline.Circle:
+			p.paint(head, pdfEllipse(outline.Center.X, outline.Center.Y, outline.Radius, outline.Radius), true, Rect{}, tint)
+		default:
+			p.paint(head, pdfPolyline(outline.Points, outline.Closed), outline.Closed, Rect{}, tint)
+		}
+	}
+}
+
+// text writes the lines of a text element with the standard fonts. Alignment and decorations rely on the
+// estimated width of the characters, as the boxes of text elements do
+func (p *pdfPage) text(t VectorText, tint *color.NRGBA) {
+	anchor, x := textAnchor(t)
+	for i, line := range textLines(t) {
+		width := 0.0
+		for _, run := range line {
+			width += float64(len([]rune(run.Text))) * run.FontSize * glyphAdvance
+		}
+		left := x
+		switch anchor {
+		case "middle":
+			left -= width / 2
+		case "end":
+			left -= width
+		}
+		baseline := textBaseline(t, i)
+
+		// glyphs are flipped back upright in the canvas coordinates, whose y axis goes down
+		fmt.Fprintf(p.out, "BT\n1 0 0 -1 %s %s Tm\n", pdfNumber(left), pdfNumber(baseline))
+		decorations := ""
+		for _, run := range line {
+			c, ok := ParseColor(run.Color)
+			if tint != nil {
+				c, ok = *tint, true
+			}
+			if !ok {
+				c = color.NRGBA{A: 255}
+			}
+			font := p.resources.name("Font", fmt.Sprintf("%d 0 R", p.doc.font(pdfFontName(run.FontFamily, isBold(run.FontWeight), run.Italic))))
+			p.state(fmt.Sprintf("/ca %s", pdfNumber(float64(c.A)/255)))
+			fmt.Fprintf(p.out, "/%s %s Tf\n%s rg\n%s Tj\n", font, pdfNumber(run.FontSize), pdfColor(c), pdfString(run.Text))
+
+			runWidth := float64(len([]rune(run.Text))) * run.FontSize * glyphAdvance
+			thickness := run.FontSize / 15
+			if run.Underline {
+				decorations += fmt.Sprintf("%s rg\n%sf\n", pdfColor(c), pdfRectangle(left, baseline+thickness, runWidth, thickness))
+			}
+			if run.Strikethrough {
+				decorations += fmt.Sprintf("%s rg\n%sf\n", pdfColor(c), pdfRectangle(left, baseline-run.FontSize*0.3, runWidth, thickness))
+			}
+			left += runWidth
+		}
+		p.out.WriteString("ET\n" + decorations)
+	}
+}
+
+// image draws an asset stretched over the box of an image element
+func (p *pdfPage) image(e VectorImage, tint *color.NRGBA) {
+	if tint != nil {
+		p.paint(VectorShape{Fill: "#000"}, pdfRectangle(e.X, e.Y, e.Width, e.Height), true, Rect{}, tint)
+		return
+	}
+	id, found := p.doc.image(e.AssetID)
+	if !found {
+		return
+	}
+	name := p.resources.name("XObject", fmt.Sprintf("%d 0 R", id))
+	// images fill the unit square upwards, the top row at y = 1
+	fmt.Fprintf(p.out, "q\n%s cm\n/%s Do\nQ\n", pdfMatrix(Matrix{A: e.Width, D: -e.Height, E: e.X, F: e.Y + e.Height}), name)
+}
+
+// page adds the page of a canvas, with the title above it and its number below it
+func (d *pdfDocument) page(parent int, v *VectorData, number, total int) int {
+	p := &pdfPage{doc: d, resources: &pdfResources{names: make(map[string]map[string]string)}, resourcesID: d.reserve(), out: &strings.Builder{}}
+
+	area, scale := Rect{MaxX: 1, MaxY: 1}, 0.0
+	if v != nil {
+		area, scale = canvasArea(*v), pdfPointsPerUnit
+	}
+	width, height := area.Width()*scale, area.Height()*scale
+	pageWidth, pageHeight := math.Max(width+2*pdfMargin, pdfMinPageWidth), height+2*pdfMargin
+	left := (pageWidth - width) / 2
+	device := Matrix{A: scale, D: -scale, E: left - area.MinX*scale, F: pdfMargin + height + area.MinY*scale}
+
+	if v != nil {
+		fmt.Fprintf(p.out, "q\n%s cm\n%sW n\n", pdfMatrix(device), pdfRectangle(area.MinX, area.MinY, area.Width(), area.Height()))
+		if background, ok := ParseColor(v.BackgroundFill); ok && v.BackgroundFill != "none" {
+			fmt.Fprintf(p.out, "%s rg\n%sf\n", pdfColor(background), pdfRectangle(area.MinX, area.MinY, area.Width(), area.Height()))
+		}
+		layers := v.EffectiveLayers()
+		for i, elements := range v.LayerElements() {
+			if !layers[i].Visible || len(elements) == 0 {
+				continue
+			}
+			if layers[i].Opacity >= 1 {
+				for _, element := range elements {
+					p.element(element, device, nil)
+				}
+				continue
+			}
+			// a faded layer is drawn as a transparency group so that its elements do not show through each other
+			page := p.out
+			p.out = &strings.Builder{}
+			for _, element := range elements {
+				p.element(element, device, nil)
+			}
+			group := d.addStream(fmt.Sprintf("/Type /XObject /Subtype /Form /BBox [%s %s %s %s] /Group << /S /Transparency >> /Resources %d 0 R",
+				pdfNumber(area.MinX), pdfNumber(area.MinY), pdfNumber(area.MaxX), pdfNumber(area.MaxY), p.resourcesID), []byte(p.out.String()))
+			p.out = page
+			p.out.WriteString("q\n")
+			p.state(fmt.Sprintf("/ca %s /CA %s", pdfNumber(layers[i].Opacity), pdfNumber(layers[i].Opacity)))
+			fmt.Fprintf(p.out, "/%s Do\nQ\n", p.resources.name("XObject", fmt.Sprintf("%d 0 R", group)))
+		}
+		p.out.WriteString("Q\n")
+		fmt.Fprintf(p.out, "0.8 G\n0.5 w\n%sS\n", pdfRectangle(left, pdfMargin, width, height))
+	}
+
+	// the header and the footer, their widths estimated like texts
+	title := p.resources.name("Font", fmt.Sprintf("%d 0 R", d.font("Helvetica-Bold")))
+	regular := p.resources.name("Font", fmt.Sprintf("%d 0 R", d.font("Helvetica")))
+	footer := fmt.Sprintf("Page %d of %d", number, total)
+	fmt.Fprintf(p.out, "BT\n0.2 g\n/%s 12 Tf\n%s %s Td\n%s Tj\nET\n",
+		title, pdfNumber(left), pdfNumber(pageHeight-pdfMargin/2-4), pdfString(d.options.Title))
+	fmt.Fprintf(p.out, "BT\n0.4 g\n/%s 9 Tf\n%s %s Td\n%s Tj\nET\n",
+		regular, pdfNumber((pageWidth-float64(len(footer))*9*0.5)/2), pdfNumber(pdfMargin/2-3), pdfString(footer))
+
+	d.set(p.resourcesID, p.resources.dict())
+	contents := d.addStream("", []byte(p.out.String()))
+	annotations := ""
+	if len(p.links) > 0 {
+		refs := make([]string, len(p.links))
+		for i, link := range p.links {
+			refs[i] = fmt.Sprintf("%d 0 R", d.add(fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%s %s %s %s] /Border [0 0 0] /A << /S /URI /URI %s >> >>",
+				pdfNumber(link.box.MinX), pdfNumber(link.box.MinY), pdfNumber(link.box.MaxX), pdfNumber(link.box.MaxY), pdfString(link.href))))
+		}
+		annotations = fmt.Sprintf(" /Annots [%s]", strings.Join(refs, " "))
+	}
+	return d.add(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources %d 0 R /Contents %d 0 R%s >>",
+		parent, pdfNumber(pageWidth), pdfNumber(pageHeight), p.resourcesID, contents, annotations))
+}
+
+// RenderPDF renders canvases as the pages of a PDF document, in order, each page showing the title and its
+// number. Canvases are drawn as vectors with the standard PDF fonts, shadows without blur
+func RenderPDF(canvases []Canvas, options PDFOptions) []byte {
+	d := &pdfDocument{options: options, fonts: make(map[string]int), images: make(map[string]int)}
+	catalog := d.reserve()
+	pages := d.reserve()
+
+	kids := []string{}
+	if len(canvases) == 0 {
+		// a document needs a page, which only shows the title
+		kids = append(kids, fmt.Sprintf("%d 0 R", d.page(pages, nil, 1, 1)))
+	}
+	for i := range canvases {
+		kids = append(kids, fmt.Sprintf("%d 0 R", d.page(pages, &canvases[i].VectorData, i+1, len(canvases))))
+	}
+	d.set(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	d.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+	info := d.add(fmt.Sprintf("<< /Title %s /Producer (Phaint) >>", pdfTextString(options.Title)))
+	return d.bytes(catalog, info)
+}
+
+// ExportPDF renders every canvas of the service as the pages of a PDF document, in the order of the project
+func (c *CanvasService) ExportPDF(options PDFOptions) []byte {
+	canvases := []Canvas{}
+	for _, canvas := range c.GetAllCanvases() {
+		if snapshot, exists := c.canvasSnapshot(canvas.ID); exists {
+			canvases = append(canvases, snapshot)
+		}
+	}
+	return RenderPDF(canvases, options)
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pdfObjects reads the objects of a document through its cross-reference table, streams inflated
+func pdfObjects(t *testing.T, data []byte) map[int]string {
+	t.Helper()
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("Invalid PDF envelope:\n%s", data)
+	}
+	start := bytes.LastIndex(data, []byte("startxref\n"))
+	xref, err := strconv.Atoi(strings.Fields(string(data[start+len("startxref\n"):]))[0])
+	if err != nil || !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("Invalid cross-reference offset %d", xref)
+	}
+
+	lines := strings.Split(string(data[xref:]), "\n")
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	objects := make(map[int]string)
+	for id := 1; id < count; id++ {
+		offset, _ := strconv.Atoi(strings.Fields(lines[2+id])[0])
+		header := fmt.Sprintf("%d 0 obj\n", id)
+		if !bytes.HasPrefix(data[offset:], []byte(header)) {
+			t.Fatalf("Object %d is not at offset %d", id, offset)
+		}
+		body := string(data[offset+len(header):])
+		body = body[:strings.Index(body, "\nendobj\n")]
+		if i := strings.Index(body, "\nstream\n"); i >= 0 {
+			reader, err := zlib.NewReader(strings.NewReader(body[i+len("\nstream\n") : len(body)-len("\nendstream")]))
+			if err != nil {
+				t.Fatalf("Invalid stream in object %d: %v", id, err)
+			}
+			content, _ := io.ReadAll(reader)
+			body = body[:i] + "\n" + string(content)
+		}
+		objects[id] = body
+	}
+	return objects
+}
+
+// pdfPages returns the content of the pages, in order
+func pdfPages(t *testing.T, objects map[int]string) []string {
+	t.Helper()
+	var kids string
+	for _, body := range objects {
+		if strings.Contains(body, "/Type /Pages") {
+			kids = regexp.MustCompile(`/Kids \[([^\]]*)\]`).FindStringSubmatch(body)[1]
+		}
+	}
+	pages := []string{}
+	for _, ref := range regexp.MustCompile(`(\d+) 0 R`).FindAllStringSubmatch(kids, -1) {
+		id, _ := strconv.Atoi(ref[1])
+		contents := regexp.MustCompile(`/Contents (\d+) 0 R`).FindStringSubmatch(objects[id])
+		content, _ := strconv.Atoi(contents[1])
+		pages = append(pages, objects[id]+"\n"+objects[content])
+	}
+	return pages
+}
+
+func TestRenderPDF(t *testing.T) {
+	half := 0.5
+	canvases := []Canvas{
+		{ID: "first", VectorData: VectorData{
+			Width:          200,
+			Height:         100,
+			BackgroundFill: "#ff0000",
+			Elements: []VectorElement{
+				VectorRectangle{VectorShape: VectorShape{ID: "r", Stroke: "#0000ff", StrokeWidth: 2, StrokeDasharray: []float64{4, 2}, Fill: "#00ff00", FillOpacity: &half, Action: Action{Link: "https://example.com/a(b)"}}, Type: "rectangle", X: 10, Y: 10, Width: 30, Height: 20},
+				VectorCircle{VectorShape: VectorShape{ID: "c", FillGradient: &Gradient{Type: GradientLinear, X2: 1, Stops: []GradientStop{{0, "red"}, {0.5, "white"}, {1, "blue"}}}, BlendMode: "color-dodge"}, Type: "circle", CX: 100, CY: 50, Radius: 20},
+				VectorText{VectorShape: VectorShape{ID: "t"}, Type: "text", Text: "Café (1)", FontFamily: "serif", FontSize: 12, FontWeight: "bold", LineHeight: 1, Color: "#000"},
+			},
+		}},
+		{ID: "second", VectorData: VectorData{Width: 50, Height: 50}},
+	}
+
+	data := RenderPDF(canvases, PDFOptions{Title: "Handouts ✓"})
+	objects := pdfObjects(t, data)
+	pages := pdfPages(t, objects)
+	if len(pages) != 2 {
+		t.Fatalf("Expected a page per canvas, got %d", len(pages))
+	}
+
+	first := pages[0]
+	for _, want := range []string{
+		"/MediaBox [0 0 222 147]",
+		"0.75 0 0 -0.75 36 111 cm",
+		"1 0 0 rg\n0 0 200 100 re\nf",
+		"[4 2] 0 d",
+		"10 10 30 20 re\nB",
+		" sh\n",
+		"(Caf\\351 \\(1\\)) Tj",
+		"(Page 1 of 2) Tj",
+		"(Handouts ?) Tj",
+		"/Annots [",
+	} {
+		if !strings.Contains(first, want) {
+			t.Errorf("Expected %q in the first page\n%s", want, first)
+		}
+	}
+	if !strings.Contains(pages[1], "(Page 2 of 2) Tj") || !strings.Contains(pages[1], "/MediaBox [0 0 216 109.5]") {
+		t.Errorf("Unexpected second page\n%s", pages[1])
+	}
+
+	all := strings.Join(func() []string {
+		bodies := []string{}
+		for _, body := range objects {
+			bodies = append(bodies, body)
+		}
+		return bodies
+	}(), "\n")
+	for _, want := range []string{"/BaseFont /Times-Bold", "/BM /ColorDodge", "/ca 0.5 /CA 1", "/FunctionType 3", "/Title <FEFF00480061006E0064006F00750074007300202713>",
+		"/URI (https://example.com/a\\(b\\))",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("Expected %q in the document", want)
+		}
+	}
+}
+
+func TestRenderPDFLayersAndImages(t *testing.T) {
+	asset := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	asset.Set(0, 0, color.NRGBA{R: 255, A: 128})
+	v := VectorData{
+		Width:  100,
+		Height: 100,
+		Layers: []Layer{
+			{ID: "hidden", Name: "Hidden", Visible: false, Opacity: 1},
+			{ID: "faded", Name: "Faded", Visible: true, Opacity: 0.25},
+		},
+		Elements: []VectorElement{
+			onLayer(rect("secret", 0, 0), "hidden"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "img", Shadow: &Shadow{OffsetX: 2, OffsetY: 3, Color: "#000"}}, Type: "image", X: 10, Y: 10, Width: 20, Height: 20, AssetID: "a1"}, "faded"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "again"}, Type: "image", X: 50, Y: 50, Width: 20, Height: 20, AssetID: "a1"}, "faded"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "missing"}, Type: "image", Width: 5, Height: 5, AssetID: "a2"}, "faded"),
+		},
+	}
+	loads := 0
+	data := RenderPDF([]Canvas{{ID: "c", VectorData: v}}, PDFOptions{Title: "Images", Image: func(assetId string) (image.Image, bool) {
+		loads++
+		return asset, assetId == "a1"
+	}})
+	objects := pdfObjects(t, data)
+
+	forms, images, masks := 0, 0, 0
+	for _, body := range objects {
+		switch {
+		case strings.Contains(body, "/Subtype /Form"):
+			forms++
+			if !strings.Contains(body, "/Group << /S /Transparency >>") || !strings.Contains(body, "1 0 0 1 2 3 cm") ||
+				!strings.Contains(body, "20 0 0 -20 10 30 cm") {
+				t.Errorf("Unexpected layer content\n%s", body)
+			}
+			if strings.Contains(body, "secret") || strings.Count(body, " Do\n") != 2 {
+				t.Errorf("Expected the two loaded images only\n%s", body)
+			}
+		case strings.Contains(body, "/DeviceRGB /BitsPerComponent 8 /SMask"):
+			images++
+		case strings.Contains(body, "/DeviceGray"):
+			masks++
+		}
+	}
+	if forms != 1 || images != 1 || masks != 1 {
+		t.Errorf("Expected a layer group and a masked image, got %d, %d and %d", forms, images, masks)
+	}
+	if loads != 2 {
+		t.Errorf("Expected each asset to be loaded once, got %d loads", loads)
+	}
+	// the resources of the first page follow the catalog and the page tree
+	if resources := objects[3]; !strings.Contains(resources, "<< /ca 0.25 /CA 0.25 >>") {
+		t.Errorf("Expected the layer opacity on its group\n%s", resources)
+	}
+}
+
+func TestExportPDF(t *testing.T) {
+	cs := NewCanvasService()
+	for _, id := range []string{"z", "a", "m"} {
+		cs.AddOrUpdateCanvas(Canvas{ID: id, VectorData: VectorData{Width: float64(len(cs.ListCanvasIDs())+3) * 100, Height: 100}})
+	}
+	pages := pdfPages(t, pdfObjects(t, cs.ExportPDF(PDFOptions{Title: "Project"})))
+	for i, width := range []string{"297", "372", "447"} {
+		if !strings.Contains(pages[i], "/MediaBox [0 0 "+width+" ") {
+			t.Errorf("Expected page %d to be %s wide, in the order of the canvases\n%s", i+1, width, pages[i])
+		}
+	}
+
+	empty := pdfPages(t, pdfObjects(t, NewCanvasService().ExportPDF(PDFOptions{Title: "Empty"})))
+	if len(empty) != 1 || !strings.Contains(empty[0], "(Empty) Tj") {
+		t.Errorf("Expected a title page for projects without canvases, got %v", empty)
+	}
+}
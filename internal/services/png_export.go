@@ -0,0 +1,452 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+)
+
+// MaxRasterPixels bounds the size of rasterized exports
+const MaxRasterPixels = 16 << 20
+
+var ErrRasterTooLarge = errors.New("the export is too large, lower its scale")
+
+// RasterOptions tunes the export of canvases to bitmaps
+type RasterOptions struct {
+	// Scale is the number of pixels per canvas unit, 1 when not set
+	Scale float64
+	// Transparent leaves the canvas background out
+	Transparent bool
+	// Image returns the decoded content of an asset, images without one are left out
+	Image func(assetId string) (image.Image, bool)
+}
+
+type rasterRenderer struct {
+	options RasterOptions
+}
+
+// RenderRaster draws the visible layers of a canvas into a bitmap, with the pure Go rasterizer of this package.
+// Text is drawn with a built-in bitmap font and blend modes are drawn as normal
+func RenderRaster(v VectorData, options RasterOptions) (*image.RGBA, error) {
+	if options.Scale == 0 {
+		options.Scale = 1
+	}
+	if options.Scale < 0 || math.IsNaN(options.Scale) || math.IsInf(options.Scale, 0) {
+		return nil, errors.New("the scale must be positive")
+	}
+	area := canvasArea(v)
+	width := math.Ceil(area.Width() * options.Scale)
+	height := math.Ceil(area.Height() * options.Scale)
+	if width*height > MaxRasterPixels {
+		return nil, ErrRasterTooLarge
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, max(1, int(width)), max(1, int(height))))
+	if !options.Transparent {
+		background, ok := ParseColor(v.BackgroundFill)
+		if v.BackgroundFill == "" || !ok {
+			background = color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+		}
+		c := premultiplied(background, 1)
+		bounds := dst.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				blendPixel(dst, x, y, c, 1)
+			}
+		}
+	}
+
+	r := &rasterRenderer{options: options}
+	device := Matrix{A: options.Scale, D: options.Scale, E: -area.MinX * options.Scale, F: -area.MinY * options.Scale}
+	layers := v.EffectiveLayers()
+	for i, elements := range v.LayerElements() {
+		if !layers[i].Visible || len(elements) == 0 {
+			continue
+		}
+		target := dst
+		if layers[i].Opacity < 1 {
+			// a faded layer is drawn apart so that its elements do not show through each other
+			target = image.NewRGBA(dst.Bounds())
+		}
+		for _, element := range elements {
+			r.element(target, element, device)
+		}
+		if target != dst {
+			composite(dst, target, layers[i].Opacity)
+		}
+	}
+	return dst, nil
+}
+
+// RenderPNG draws a canvas as a PNG image
+func RenderPNG(v VectorData, options RasterOptions) ([]byte, error) {
+	img, err := RenderRaster(v, options)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ExportPNG draws a canvas as a PNG image, false when the canvas does not exist
+func (c *CanvasService) ExportPNG(canvasId string, options RasterOptions) ([]byte, bool, error) {
+	canvas, exists := c.canvasSnapshot(canvasId)
+	if !exists {
+		return nil, false, nil
+	}
+	data, err := RenderPNG(canvas.VectorData, options)
+	return data, true, err
+}
+
+// fillPaint returns the paint of the fill of a shape covering polygons given in its coordinates
+func fillPaint(shape VectorShape, polygons [][]Point, m Matrix) (paint, bool) {
+	if !isFilled(shape) {
+		return nil, false
+	}
+	if shape.FillGradient != nil {
+		return gradientPaint(shape.FillGradient, polygons, m, shape.EffectiveFillOpacity())
+	}
+	fill, ok := ParseColor(shape.Fill)
+	if !ok {
+		return nil, false
+	}
+	return solidPaint(premultiplied(fill, shape.EffectiveFillOpacity())), true
+}
+
+// gradientPaint spreads a gradient over the box of polygons, mapping device points back to the shape
+func gradientPaint(g *Gradient, polygons [][]Point, m Matrix, opacity float64) (paint, bool) {
+	inverse, ok := m.Invert()
+	if !ok || len(g.Stops) == 0 {
+		return nil, false
+	}
+	box, found := Rect{}, false
+	for _, polygon := range polygons {
+		if b, ok := pointsBounds(Identity(), polygon); ok {
+			if found {
+				box = box.Union(b)
+			} else {
+				box, found = b, true
+			}
+		}
+	}
+	if !found || box.Width() == 0 || box.Height() == 0 {
+		return nil, false
+	}
+
+	stops := append([]GradientStop{}, g.Stops...)
+	sort.SliceStable(stops, func(i, j int) bool {
+		return stops[i].Offset < stops[j].Offset
+	})
+	colors := make([]rgba, len(stops))
+	for i, stop := range stops {
+		c, _ := ParseColor(stop.Color)
+		colors[i] = premultiplied(c, opacity)
+	}
+	at := func(t float64) rgba {
+		if t <= stops[0].Offset {
+			return colors[0]
+		}
+		for i := 1; i < len(stops); i++ {
+			if t <= stops[i].Offset {
+				span := stops[i].Offset - stops[i-1].Offset
+				if span <= 0 {
+					return colors[i]
+				}
+				f := (t - stops[i-1].Offset) / span
+				a, b := colors[i-1], colors[i]
+				return rgba{R: a.R + (b.R-a.R)*f, G: a.G + (b.G-a.G)*f, B: a.B + (b.B-a.B)*f, A: a.A + (b.A-a.A)*f}
+			}
+		}
+		return colors[len(colors)-1]
+	}
+
+	return func(x, y float64) rgba {
+		local := inverse.Apply(Point{X: x, Y: y})
+		fx, fy := (local.X-box.MinX)/box.Width(), (local.Y-box.MinY)/box.Height()
+		if g.Type == GradientRadial {
+			if g.R <= 0 {
+				return colors[len(colors)-1]
+			}
+			return at(math.Hypot(fx-g.CX, fy-g.CY) / g.R)
+		}
+		dx, dy := g.X2-g.X1, g.Y2-g.Y1
+		lengthSquared := dx*dx + dy*dy
+		if lengthSquared == 0 {
+			return colors[len(colors)-1]
+		}
+		return at(((fx-g.X1)*dx + (fy-g.Y1)*dy) / lengthSquared)
+	}, true
+}
+
+// strokePaint returns the paint of the stroke of a shape
+func strokePaint(shape VectorShape) (paint, bool) {
+	if shape.Stroke == "" || shape.StrokeWidth <= 0 {
+		return nil, false
+	}
+	stroke, ok := ParseColor(shape.Stroke)
+	if !ok || stroke.A == 0 {
+		return nil, false
+	}
+	return solidPaint(premultiplied(stroke, shape.EffectiveStrokeOpacity())), true
+}
+
+// shape draws the fill then the stroke of an outline given in the coordinates of an element
+func (r *rasterRenderer) shape(dst *image.RGBA, shape VectorShape, outline []Point, closed bool, filled bool, m Matrix) {
+	if filled && closed {
+		polygons := [][]Point{outline}
+		if p, ok := fillPaint(shape, polygons, m); ok {
+			fillPolygons(dst, transformPolygons(m, polygons), false, p)
+		}
+	}
+	if p, ok := strokePaint(shape); ok {
+		fillPolygons(dst, transformPolygons(m, strokePolygons(outline, closed, shapeStrokeStyle(shape), m.maxScale())), false, p)
+	}
+}
+
+// element draws an element, m mapping its container coordinates to the device
+func (r *rasterRenderer) element(dst *image.RGBA, element VectorElement, m Matrix) {
+	shape, ok := ElementShape(element)
+	if !ok {
+		return
+	}
+	if shape.Shadow != nil {
+		r.shadowed(dst, element, shape, m)
+		return
+	}
+	m = m.Multiply(elementTransform(element))
+	scale := m.maxScale()
+
+	switch e := element.(type) {
+	case VectorPath:
+		r.shape(dst, e.VectorShape, pathOutline(e), e.Closed, true, m)
+	case VectorRectangle:
+		r.shape(dst, e.VectorShape, boxCorners(e.X, e.Y, e.Width, e.Height), true, true, m)
+	case VectorCircle:
+		r.shape(dst, e.VectorShape, ellipsePoints(e.CX, e.CY, e.Radius, e.Radius, scale), true, true, m)
+	case VectorEllipse:
+		r.shape(dst, e.VectorShape, ellipsePoints(e.CX, e.CY, e.RX, e.RY, scale), true, true, m)
+	case VectorLine:
+		r.shape(dst, e.VectorShape, []Point{{X: e.X1, Y: e.Y1}, {X: e.X2, Y: e.Y2}}, false, false, m)
+	case VectorPolyline:
+		r.shape(dst, e.VectorShape, e.Points, false, false, m)
+	case VectorPolygon:
+		r.shape(dst, e.VectorShape, e.Points, true, true, m)
+	case VectorArrow:
+		r.arrow(dst, e, m)
+	case VectorText:
+		r.text(dst, e, m)
+	case VectorImage:
+		r.image(dst, e, m)
+	case VectorGroup:
+		for _, child := range e.Children {
+			r.element(dst, child, m)
+		}
+	}
+}
+
+// shadowed draws an element apart, then its blurred silhouette and the element itself
+func (r *rasterRenderer) shadowed(dst *image.RGBA, element VectorElement, shape VectorShape, m Matrix) {
+	shadow := *shape.Shadow
+	alone := setShadow(element, nil)
+	full := m.Multiply(elementTransform(element))
+	offsetX := full.A*shadow.OffsetX + full.C*shadow.OffsetY
+	offsetY := full.B*shadow.OffsetX + full.D*shadow.OffsetY
+	blur := shadow.Blur / 2 * full.maxScale()
+
+	bounds, ok := elementBounds(alone, m)
+	if !ok {
+		return
+	}
+	margin := 3*blur + shape.StrokeWidth*full.maxScale() + 1
+	area := image.Rect(int(math.Floor(bounds.MinX-margin)), int(math.Floor(bounds.MinY-margin)),
+		int(math.Ceil(bounds.MaxX+margin)), int(math.Ceil(bounds.MaxY+margin)))
+	// the silhouette may come from outside of the surface once offset
+	visible := dst.Bounds().Union(dst.Bounds().Add(image.Pt(-int(offsetX), -int(offsetY))))
+	area = area.Intersect(visible)
+	if area.Empty() {
+		return
+	}
+	layer := image.NewRGBA(area)
+	r.element(layer, alone, m)
+
+	if c, ok := ParseColor(shadow.Color); ok && c.A > 0 {
+		silhouette := blurAlpha(layer, blur)
+		tint := premultiplied(c, 1)
+		dx, dy := int(math.Round(offsetX)), int(math.Round(offsetY))
+		target := dst.Bounds()
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				a := silhouette[(y-area.Min.Y)*area.Dx()+x-area.Min.X]
+				if a > 0 && image.Pt(x+dx, y+dy).In(target) {
+					blendPixel(dst, x+dx, y+dy, tint, a)
+				}
+			}
+		}
+	}
+	composite(dst, layer, 1)
+}
+
+// setShadow returns an element with another shadow
+func setShadow(element VectorElement, shadow *Shadow) VectorElement {
+	return updateShape(element, func(shape *VectorShape) {
+		shape.Shadow = shadow
+	})
+}
+
+// blurAlpha returns the alpha of a surface blurred by three box blurs, close to a gaussian of deviation sigma
+func blurAlpha(src *image.RGBA, sigma float64) []float64 {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	alpha := make([]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			alpha[y*width+x] = float64(src.Pix[src.PixOffset(bounds.Min.X+x, bounds.Min.Y+y)+3]) / 255
+		}
+	}
+	// three passes of a box of width 2r+1 spread about as much as a gaussian of deviation r
+	radius := int(math.Round(sigma))
+	if radius < 1 {
+		return alpha
+	}
+	buffer := make([]float64, len(alpha))
+	boxBlur := func(from, to []float64, length, count, stride, step int) {
+		for line := 0; line < count; line++ {
+			sum := 0.0
+			base := line * stride
+			for i := -radius; i <= radius; i++ {
+				if i >= 0 && i < length {
+					sum += from[base+i*step]
+				}
+			}
+			for i := 0; i < length; i++ {
+				to[base+i*step] = sum / float64(2*radius+1)
+				if out := i - radius; out >= 0 {
+					sum -= from[base+out*step]
+				}
+				if in := i + radius + 1; in < length {
+					sum += from[base+in*step]
+				}
+			}
+		}
+	}
+	for pass := 0; pass < 3; pass++ {
+		boxBlur(alpha, buffer, width, height, width, 1)
+		boxBlur(buffer, alpha, height, width, 1, width)
+	}
+	return alpha
+}
+
+// arrow draws the line of an arrow then its heads, filled with the stroke color and without dashes
+func (r *rasterRenderer) arrow(dst *image.RGBA, a VectorArrow, m Matrix) {
+	start, end := Point{X: a.X1, Y: a.Y1}, Point{X: a.X2, Y: a.Y2}
+	r.shape(dst, a.VectorShape, []Point{start, end}, false, false, m)
+
+	head := a.VectorShape
+	head.Fill, head.FillGradient, head.FillOpacity, head.StrokeDasharray = a.Stroke, nil, a.StrokeOpacity, nil
+	size := arrowHeadSize(a)
+	for _, h := range []struct {
+		style    string
+		tip, end Point
+	}{{a.StartHead, start, end}, {a.EndHead, end, start}} {
+		outline, ok := arrowHeadShape(h.style, h.tip, h.end, size)
+		switch {
+		case !ok:
+		case outline.Circle:
+			r.shape(dst, head, ellipsePoints(outline.Center.X, outline.Center.Y, outline.Radius, outline.Radius, m.maxScale()), true, true, m)
+		default:
+			r.shape(dst, head, outline.Points, outline.Closed, true, m)
+		}
+	}
+}
+
+// text draws the lines of a text element with the built-in font
+func (r *rasterRenderer) text(dst *image.RGBA, t VectorText, m Matrix) {
+	anchor, x := textAnchor(t)
+	for i, line := range textLines(t) {
+		width := 0.0
+		for _, run := range line {
+			width += float64(len([]rune(run.Text))) * run.FontSize * glyphAdvance
+		}
+		left := x
+		switch anchor {
+		case "middle":
+			left -= width / 2
+		case "end":
+			left -= width
+		}
+		baseline := textBaseline(t, i)
+
+		for _, run := range line {
+			c, ok := ParseColor(run.Color)
+			if !ok {
+				left += float64(len([]rune(run.Text))) * run.FontSize * glyphAdvance
+				continue
+			}
+			dot := run.FontSize * glyphAdvance / 6
+			bold := isBold(run.FontWeight)
+			polygons := [][]Point{}
+			runLeft := left
+			for _, char := range run.Text {
+				polygons = append(polygons, glyphRects(char, left, baseline, dot, bold)...)
+				left += run.FontSize * glyphAdvance
+			}
+			if run.Underline {
+				polygons = append(polygons, boxCorners(runLeft, baseline+dot, left-runLeft, dot*0.8))
+			}
+			if run.Strikethrough {
+				polygons = append(polygons, boxCorners(runLeft, baseline-dot*3.9, left-runLeft, dot*0.8))
+			}
+			if run.Italic {
+				// slant the glyphs around their baseline
+				for _, polygon := range polygons {
+					for j := range polygon {
+						polygon[j].X += (baseline - polygon[j].Y) * 0.2
+					}
+				}
+			}
+			fillPolygons(dst, transformPolygons(m, polygons), false, solidPaint(premultiplied(c, 1)))
+		}
+	}
+}
+
+// isBold tells whether a font weight is drawn bold
+func isBold(weight string) bool {
+	switch weight {
+	case "bold", "bolder", "600", "700", "800", "900":
+		return true
+	}
+	return false
+}
+
+// image draws an asset stretched over the box of an image element, sampling its nearest pixels
+func (r *rasterRenderer) image(dst *image.RGBA, e VectorImage, m Matrix) {
+	if r.options.Image == nil || e.Width <= 0 || e.Height <= 0 {
+		return
+	}
+	src, found := r.options.Image(e.AssetID)
+	if !found {
+		return
+	}
+	inverse, ok := m.Invert()
+	if !ok {
+		return
+	}
+	bounds := src.Bounds()
+	sample := func(x, y float64) rgba {
+		local := inverse.Apply(Point{X: x, Y: y})
+		sx := bounds.Min.X + int((local.X-e.X)/e.Width*float64(bounds.Dx()))
+		sy := bounds.Min.Y + int((local.Y-e.Y)/e.Height*float64(bounds.Dy()))
+		sx = max(bounds.Min.X, min(bounds.Max.X-1, sx))
+		sy = max(bounds.Min.Y, min(bounds.Max.Y-1, sy))
+		cr, cg, cb, ca := src.At(sx, sy).RGBA()
+		return rgba{R: float64(cr) / 0xffff, G: float64(cg) / 0xffff, B: float64(cb) / 0xffff, A: float64(ca) / 0xffff}
+	}
+	fillPolygons(dst, transformPolygons(m, [][]Point{boxCorners(e.X, e.Y, e.Width, e.Height)}), false, sample)
+}
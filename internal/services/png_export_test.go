@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden images of the raster tests")
+
+// goldenScene is a canvas using most of what the rasterizer draws
+func goldenScene() VectorData {
+	half := 0.5
+	// a rotation of 0.3 radians around 120,30
+	cos, sin := math.Cos(0.3), math.Sin(0.3)
+	rotation := Translate(120, 30).Multiply(Matrix{A: cos, B: sin, C: -sin, D: cos}).Multiply(Translate(-120, -30))
+	return VectorData{
+		Width:          160,
+		Height:         120,
+		BackgroundFill: "#f0f0e0",
+		Layers: []Layer{
+			{ID: "base", Name: "Base", Visible: true, Opacity: 1},
+			{ID: "faded", Name: "Faded", Visible: true, Opacity: 0.5},
+		},
+		Elements: []VectorElement{
+			onLayer(VectorRectangle{VectorShape: VectorShape{ID: "r", Stroke: "#000080", StrokeWidth: 3, Fill: "#ffcc00", LineJoin: LineJoinRound}, Type: "rectangle", X: 10, Y: 10, Width: 50, Height: 30}, "base"),
+			onLayer(VectorCircle{VectorShape: VectorShape{ID: "c", FillGradient: &Gradient{Type: GradientLinear, X2: 1, Stops: []GradientStop{{0, "red"}, {1, "blue"}}}}, Type: "circle", CX: 100, CY: 30, Radius: 20}, "base"),
+			onLayer(VectorPolyline{VectorShape: VectorShape{ID: "dashed", Stroke: "#008000", StrokeWidth: 2, StrokeDasharray: []float64{6, 3}, LineCap: LineCapRound}, Type: "polyline", Points: []Point{{10, 60}, {60, 90}, {110, 60}}}, "base"),
+			onLayer(VectorArrow{VectorShape: VectorShape{ID: "a", Stroke: "#000", StrokeWidth: 2}, Type: "arrow", X1: 10, Y1: 110, X2: 70, Y2: 110, EndHead: ArrowHeadTriangle, StartHead: ArrowHeadCircle, HeadSize: 8}, "base"),
+			onLayer(VectorText{VectorShape: VectorShape{ID: "t"}, Type: "text", Text: "Phaint!", FontFamily: "sans-serif", FontSize: 10, FontWeight: "bold", LineHeight: 1.2, Color: "#202020", X: 90, Y: 90}, "base"),
+			onLayer(VectorEllipse{VectorShape: VectorShape{ID: "shadowed", Fill: "#ffffff", Shadow: &Shadow{OffsetX: 3, OffsetY: 3, Blur: 4, Color: "#00000080"}}, Type: "ellipse", CX: 135, CY: 70, RX: 15, RY: 8}, "base"),
+			onLayer(VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &rotation}, Type: "group", Children: []VectorElement{
+				VectorRectangle{VectorShape: VectorShape{ID: "inner", Fill: "#800080", FillOpacity: &half}, Type: "rectangle", X: 110, Y: 5, Width: 40, Height: 10},
+			}}, "faded"),
+			onLayer(VectorRectangle{VectorShape: VectorShape{ID: "over", Fill: "#00ffff"}, Type: "rectangle", X: 50, Y: 20, Width: 40, Height: 40}, "faded"),
+		},
+	}
+}
+
+// compareGolden compares an image with the one saved under testdata, with a small tolerance per channel
+func compareGolden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Missing golden image, run the tests with -update: %v", err)
+	}
+	defer file.Close()
+	golden, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if golden.Bounds() != img.Bounds() {
+		t.Fatalf("Expected an image of %v, got %v", golden.Bounds(), img.Bounds())
+	}
+	different := 0
+	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
+		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+			want := color.NRGBAModel.Convert(golden.At(x, y)).(color.NRGBA)
+			got := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if channelDistance(want, got) > 2 {
+				different++
+			}
+		}
+	}
+	if different > 0 {
+		t.Errorf("Expected the image to match %s, %d pixels differ", path, different)
+	}
+}
+
+func channelDistance(a, b color.NRGBA) int {
+	distance := 0
+	for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B), int(a.A) - int(b.A)} {
+		distance = max(distance, d, -d)
+	}
+	return distance
+}
+
+func TestRenderRasterGolden(t *testing.T) {
+	img, err := RenderRaster(goldenScene(), RasterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "scene.png", img)
+
+	doubled, err := RenderRaster(goldenScene(), RasterOptions{Scale: 2, Transparent: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compareGolden(t, "scene-2x-transparent.png", doubled)
+}
+
+func TestRenderRaster(t *testing.T) {
+	v := VectorData{
+		Width:  20,
+		Height: 10,
+		Layers: []Layer{
+			{ID: "hidden", Name: "Hidden", Visible: false, Opacity: 1},
+			{ID: "shown", Name: "Shown", Visible: true, Opacity: 1},
+		},
+		Elements: []VectorElement{
+			onLayer(VectorRectangle{VectorShape: VectorShape{ID: "r", Fill: "#ff0000"}, Type: "rectangle", X: 0, Y: 0, Width: 10, Height: 10}, "shown"),
+			onLayer(VectorRectangle{VectorShape: VectorShape{ID: "secret", Fill: "#00ff00"}, Type: "rectangle", X: 10, Y: 0, Width: 10, Height: 10}, "hidden"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "img"}, Type: "image", X: 10, Y: 0, Width: 10, Height: 10, AssetID: "a1"}, "shown"),
+		},
+	}
+
+	img, err := RenderRaster(v, RasterOptions{Scale: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 60, 30) {
+		t.Fatalf("Expected the scale to size the image, got %v", img.Bounds())
+	}
+	if got := img.RGBAAt(5, 5); got != (color.RGBA{R: 255, A: 255}) {
+		t.Errorf("Expected the rectangle to be drawn, got %v", got)
+	}
+	if got := img.RGBAAt(45, 15); got != (color.RGBA{R: 255, G: 255, B: 255, A: 255}) {
+		t.Errorf("Expected a white background without hidden layers nor missing images, got %v", got)
+	}
+
+	asset := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	asset.Set(0, 0, color.NRGBA{B: 255, A: 255})
+	asset.Set(1, 0, color.NRGBA{G: 255, A: 255})
+	img, err = RenderRaster(v, RasterOptions{Transparent: true, Image: func(assetId string) (image.Image, bool) {
+		return asset, assetId == "a1"
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := img.RGBAAt(12, 5); got != (color.RGBA{B: 255, A: 255}) {
+		t.Errorf("Expected the left of the image to be blue, got %v", got)
+	}
+	if got := img.RGBAAt(18, 5); got != (color.RGBA{G: 255, A: 255}) {
+		t.Errorf("Expected the right of the image to be green, got %v", got)
+	}
+
+	transparent := VectorData{Width: 4, Height: 4}
+	img, err = RenderRaster(transparent, RasterOptions{Transparent: true})
+	if err != nil || img.RGBAAt(1, 1).A != 0 {
+		t.Errorf("Expected a transparent background, got %v, %v", img.RGBAAt(1, 1), err)
+	}
+
+	if _, err := RenderRaster(VectorData{Width: 10000, Height: 10000}, RasterOptions{}); err != ErrRasterTooLarge {
+		t.Errorf("Expected huge exports to be refused, got %v", err)
+	}
+	if _, err := RenderRaster(transparent, RasterOptions{Scale: -1}); err == nil {
+		t.Error("Expected negative scales to be refused")
+	}
+}
+
+func TestExportPNG(t *testing.T) {
+	c := NewCanvasService()
+	c.AddOrUpdateCanvas(Canvas{ID: "c1", VectorData: VectorData{Width: 8, Height: 4}})
+
+	data, exists, err := c.ExportPNG("c1", RasterOptions{Scale: 2})
+	if !exists || err != nil {
+		t.Fatalf("Expected the canvas to be exported, got %v %v", exists, err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 8 {
+		t.Errorf("Expected a 16x8 image, got %v", img.Bounds())
+	}
+	if _, exists, _ := c.ExportPNG("missing", RasterOptions{}); exists {
+		t.Error("Expected missing canvases not to be exported")
+	}
+}
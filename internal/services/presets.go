@@ -0,0 +1,135 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StyleNameMaxLength is the maximum number of characters of a swatch or preset name
+const StyleNameMaxLength = 100
+
+// Swatch is a named color of the project palette
+type Swatch struct {
+	ID    string `firestore:"id" json:"id"`
+	Name  string `firestore:"name" json:"name"`
+	Color string `firestore:"color" json:"color"`
+}
+
+// StylePreset is a named style that elements can reference
+type StylePreset struct {
+	ID    string       `firestore:"id" json:"id"`
+	Name  string       `firestore:"name" json:"name"`
+	Style ElementStyle `firestore:"style" json:"style"`
+}
+
+// StyleLibrary is the palette and the style presets shared by the canvases of a project
+type StyleLibrary struct {
+	Swatches []Swatch      `firestore:"swatches" json:"swatches"`
+	Presets  []StylePreset `firestore:"presets" json:"presets"`
+}
+
+func validateStyleName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("name is empty")
+	}
+	if utf8.RuneCountInString(name) > StyleNameMaxLength {
+		return errors.New("name is too long")
+	}
+	return nil
+}
+
+func (s Swatch) Validate() error {
+	if err := validateStyleName(s.Name); err != nil {
+		return err
+	}
+	if s.Color == "" || !ValidColor(s.Color) {
+		return fmt.Errorf("invalid swatch color %q", s.Color)
+	}
+	return nil
+}
+
+func (p StylePreset) Validate() error {
+	if err := validateStyleName(p.Name); err != nil {
+		return err
+	}
+	return p.Style.Validate()
+}
+
+// FindSwatch returns the position of a swatch, -1 when it does not exist
+func (l *StyleLibrary) FindSwatch(id string) int {
+	for i, swatch := range l.Swatches {
+		if swatch.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindPreset returns the position of a preset, -1 when it does not exist
+func (l *StyleLibrary) FindPreset(id string) int {
+	for i, preset := range l.Presets {
+		if preset.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// restyleElements applies a change to the elements of a tree using a preset, returning how many changed
+func restyleElements(elements []VectorElement, presetId string, change func(shape *VectorShape)) int {
+	count := 0
+	for i, element := range elements {
+		if group, ok := element.(VectorGroup); ok {
+			count += restyleElements(group.Children, presetId, change)
+		}
+		if shape, _ := ElementShape(element); presetId != "" && shape.PresetID == presetId {
+			elements[i] = updateShape(elements[i], change)
+			count++
+		}
+	}
+	return count
+}
+
+// ApplyPreset restyles every element referencing a preset, on every canvas, and returns how many changed
+func (c *CanvasService) ApplyPreset(preset StylePreset) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	count := 0
+	for _, canvas := range c.canvases {
+		if restyled := restyleElements(canvas.VectorData.Elements, preset.ID, func(shape *VectorShape) {
+			shape.setStyle(preset.Style)
+		}); restyled > 0 {
+			// stroke widths change the bounding boxes
+			c.invalidateIndex(canvas.ID)
+			c.markChanged(canvas.ID)
+			count += restyled
+		}
+	}
+	return count
+}
+
+// ApplyStyleLibrary restyles the elements of every preset of a library, used when loading canvases
+// saved before their presets last changed
+func (c *CanvasService) ApplyStyleLibrary(library StyleLibrary) {
+	for _, preset := range library.Presets {
+		c.ApplyPreset(preset)
+	}
+}
+
+// DetachPreset unlinks the elements of a deleted preset, they keep their current style
+func (c *CanvasService) DetachPreset(presetId string) int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	count := 0
+	for _, canvas := range c.canvases {
+		if detached := restyleElements(canvas.VectorData.Elements, presetId, func(shape *VectorShape) {
+			shape.PresetID = ""
+		}); detached > 0 {
+			c.markChanged(canvas.ID)
+			count += detached
+		}
+	}
+	return count
+}
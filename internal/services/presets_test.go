@@ -0,0 +1,66 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStyleLibraryValidation(t *testing.T) {
+	if err := (Swatch{Name: "Brand", Color: "#ff6600"}).Validate(); err != nil {
+		t.Errorf("Expected a valid swatch, got %v", err)
+	}
+	invalid := []Swatch{
+		{Name: "", Color: "#fff"},
+		{Name: strings.Repeat("a", StyleNameMaxLength+1), Color: "#fff"},
+		{Name: "Empty", Color: ""},
+		{Name: "Bad", Color: "#ff"},
+	}
+	for _, swatch := range invalid {
+		if err := swatch.Validate(); err == nil {
+			t.Errorf("Expected swatch %+v to be rejected", swatch)
+		}
+	}
+	if err := (StylePreset{Name: "Dashed", Style: ElementStyle{LineCap: "pointy"}}).Validate(); err == nil {
+		t.Error("Expected a preset with an invalid style to be rejected")
+	}
+
+	library := StyleLibrary{Swatches: []Swatch{{ID: "s1"}}, Presets: []StylePreset{{ID: "p1"}, {ID: "p2"}}}
+	if library.FindSwatch("s1") != 0 || library.FindPreset("p2") != 1 || library.FindPreset("missing") != -1 {
+		t.Error("Unexpected library lookups")
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	linked := rect("a", 0, 0)
+	linked.PresetID = "p1"
+	nested := rect("b", 0, 0)
+	nested.PresetID = "p1"
+	cs := newGroupCanvas(linked, rect("c", 0, 0), VectorGroup{VectorShape: VectorShape{ID: "g"}, Type: "group",
+		Children: []VectorElement{nested}})
+
+	half := 0.5
+	preset := StylePreset{ID: "p1", Name: "Outline", Style: ElementStyle{Stroke: "#123456", StrokeWidth: 3, Fill: "none", FillOpacity: &half}}
+	if count := cs.ApplyPreset(preset); count != 2 {
+		t.Errorf("Expected 2 restyled elements, got %d", count)
+	}
+	elements := cs.GetCanvas("c1").VectorData.Elements
+	a := elements[0].(VectorRectangle)
+	if a.Stroke != "#123456" || a.StrokeWidth != 3 || a.Fill != "none" || a.EffectiveFillOpacity() != 0.5 {
+		t.Errorf("Unexpected style %+v", a.Style())
+	}
+	if c := elements[1].(VectorRectangle); c.Fill != "#ff0000" {
+		t.Error("Expected elements without preset to keep their style")
+	}
+	b := elements[2].(VectorGroup).Children[0].(VectorRectangle)
+	if b.Stroke != "#123456" {
+		t.Error("Expected nested elements to be restyled")
+	}
+
+	if count := cs.DetachPreset("p1"); count != 2 {
+		t.Errorf("Expected 2 detached elements, got %d", count)
+	}
+	a = cs.GetCanvas("c1").VectorData.Elements[0].(VectorRectangle)
+	if a.PresetID != "" || a.Stroke != "#123456" {
+		t.Errorf("Expected a detached element to keep its style, got %+v", a.VectorShape)
+	}
+}
@@ -0,0 +1,425 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// rasterSamples is the number of scanlines sampled per pixel row, horizontal coverage is computed exactly
+const rasterSamples = 4
+
+// miterLimit is the SVG default ratio between a miter length and the stroke width, longer miters are beveled
+const miterLimit = 4
+
+// rgba is a premultiplied color with components between 0 and 1
+type rgba struct {
+	R, G, B, A float64
+}
+
+func premultiplied(c color.NRGBA, opacity float64) rgba {
+	a := float64(c.A) / 255 * opacity
+	return rgba{R: float64(c.R) / 255 * a, G: float64(c.G) / 255 * a, B: float64(c.B) / 255 * a, A: a}
+}
+
+// paint returns the color of a point of the device, sampled at pixel centers
+type paint func(x, y float64) rgba
+
+func solidPaint(c rgba) paint {
+	return func(x, y float64) rgba {
+		return c
+	}
+}
+
+func clampByte(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v*255))))
+}
+
+// blendPixel composites a color over a pixel of a premultiplied surface, source over destination
+func blendPixel(dst *image.RGBA, x, y int, c rgba, coverage float64) {
+	a := c.A * coverage
+	if a <= 0 {
+		return
+	}
+	i := dst.PixOffset(x, y)
+	inverse := 1 - a
+	pix := dst.Pix[i : i+4 : i+4]
+	pix[0] = clampByte(c.R*coverage + float64(pix[0])/255*inverse)
+	pix[1] = clampByte(c.G*coverage + float64(pix[1])/255*inverse)
+	pix[2] = clampByte(c.B*coverage + float64(pix[2])/255*inverse)
+	pix[3] = clampByte(a + float64(pix[3])/255*inverse)
+}
+
+// composite draws a surface over another one with an opacity, both sharing the same coordinates
+func composite(dst *image.RGBA, src *image.RGBA, opacity float64) {
+	area := dst.Bounds().Intersect(src.Bounds())
+	for y := area.Min.Y; y < area.Max.Y; y++ {
+		for x := area.Min.X; x < area.Max.X; x++ {
+			i := src.PixOffset(x, y)
+			if src.Pix[i+3] == 0 {
+				continue
+			}
+			c := rgba{R: float64(src.Pix[i]) / 255, G: float64(src.Pix[i+1]) / 255, B: float64(src.Pix[i+2]) / 255, A: float64(src.Pix[i+3]) / 255}
+			blendPixel(dst, x, y, c, opacity)
+		}
+	}
+}
+
+type rasterEdge struct {
+	x0, y0, x1, y1 float64
+	winding        int
+}
+
+// fillPolygons paints the inside of closed polygons given in device coordinates, by the nonzero winding rule
+// or the even-odd one, antialiased
+func fillPolygons(dst *image.RGBA, polygons [][]Point, evenOdd bool, p paint) {
+	edges := []rasterEdge{}
+	bounds := Rect{MinX: math.Inf(1), MinY: math.Inf(1), MaxX: math.Inf(-1), MaxY: math.Inf(-1)}
+	for _, polygon := range polygons {
+		for i := range polygon {
+			a, b := polygon[i], polygon[(i+1)%len(polygon)]
+			bounds = bounds.Union(Rect{MinX: a.X, MinY: a.Y, MaxX: a.X, MaxY: a.Y})
+			switch {
+			case a.Y < b.Y:
+				edges = append(edges, rasterEdge{x0: a.X, y0: a.Y, x1: b.X, y1: b.Y, winding: 1})
+			case a.Y > b.Y:
+				edges = append(edges, rasterEdge{x0: b.X, y0: b.Y, x1: a.X, y1: a.Y, winding: -1})
+			}
+		}
+	}
+	clip := dst.Bounds()
+	minX, maxX := max(clip.Min.X, int(math.Floor(bounds.MinX))), min(clip.Max.X, int(math.Ceil(bounds.MaxX)))
+	minY, maxY := max(clip.Min.Y, int(math.Floor(bounds.MinY))), min(clip.Max.Y, int(math.Ceil(bounds.MaxY)))
+	if len(edges) == 0 || minX >= maxX || minY >= maxY {
+		return
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		return edges[i].y0 < edges[j].y0
+	})
+
+	type crossing struct {
+		x       float64
+		winding int
+	}
+	width := maxX - minX
+	coverage := make([]float64, width+1)
+	active := []rasterEdge{}
+	crossings := []crossing{}
+	next := 0
+	weight := 1.0 / rasterSamples
+	// addSpan covers [xa, xb) of the row, partially covered pixels get the covered fraction
+	addSpan := func(xa, xb float64) {
+		xa = math.Max(xa-float64(minX), 0)
+		xb = math.Min(xb-float64(minX), float64(width))
+		if xb <= xa {
+			return
+		}
+		ia, ib := int(xa), int(xb)
+		if ia == ib {
+			coverage[ia] += (xb - xa) * weight
+			return
+		}
+		coverage[ia] += (float64(ia+1) - xa) * weight
+		for i := ia + 1; i < ib; i++ {
+			coverage[i] += weight
+		}
+		coverage[ib] += (xb - float64(ib)) * weight
+	}
+
+	for py := minY; py < maxY; py++ {
+		for i := range coverage {
+			coverage[i] = 0
+		}
+		for s := 0; s < rasterSamples; s++ {
+			sy := float64(py) + (float64(s)+0.5)/rasterSamples
+			for next < len(edges) && edges[next].y0 <= sy {
+				active = append(active, edges[next])
+				next++
+			}
+			crossings = crossings[:0]
+			kept := active[:0]
+			for _, e := range active {
+				if e.y1 <= sy {
+					continue
+				}
+				kept = append(kept, e)
+				if e.y0 <= sy {
+					crossings = append(crossings, crossing{x: e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), winding: e.winding})
+				}
+			}
+			active = kept
+			sort.Slice(crossings, func(i, j int) bool {
+				return crossings[i].x < crossings[j].x
+			})
+			winding := 0
+			for i, c := range crossings {
+				winding += c.winding
+				inside := winding != 0
+				if evenOdd {
+					inside = winding%2 != 0
+				}
+				if inside && i+1 < len(crossings) {
+					addSpan(c.x, crossings[i+1].x)
+				}
+			}
+		}
+		for i := 0; i < width; i++ {
+			if coverage[i] <= 0 {
+				continue
+			}
+			x := minX + i
+			blendPixel(dst, x, py, p(float64(x)+0.5, float64(py)+0.5), math.Min(coverage[i], 1))
+		}
+	}
+}
+
+// transformPolygons maps polygons to the device
+func transformPolygons(m Matrix, polygons [][]Point) [][]Point {
+	transformed := make([][]Point, len(polygons))
+	for i, polygon := range polygons {
+		transformed[i] = make([]Point, len(polygon))
+		for j, p := range polygon {
+			transformed[i][j] = m.Apply(p)
+		}
+	}
+	return transformed
+}
+
+func signedArea(polygon []Point) float64 {
+	area := 0.0
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		area += a.X*b.Y - b.X*a.Y
+	}
+	return area / 2
+}
+
+// oriented returns a polygon wound in the positive direction, so that overlapping pieces of a stroke add up
+// rather than cancel out under the nonzero rule
+func oriented(polygon []Point) []Point {
+	if signedArea(polygon) >= 0 {
+		return polygon
+	}
+	reversed := make([]Point, len(polygon))
+	for i, p := range polygon {
+		reversed[len(polygon)-1-i] = p
+	}
+	return reversed
+}
+
+// ellipsePoints approximates an ellipse with a polygon, precise enough once scaled by scale
+func ellipsePoints(cx, cy, rx, ry float64, scale float64) []Point {
+	steps := int(math.Ceil(2 * math.Pi * math.Max(rx, ry) * scale / 3))
+	steps = max(16, min(256, steps))
+	points := make([]Point, steps)
+	for i := range points {
+		angle := 2 * math.Pi * float64(i) / float64(steps)
+		points[i] = Point{X: cx + rx*math.Cos(angle), Y: cy + ry*math.Sin(angle)}
+	}
+	return points
+}
+
+// strokeStyle is how the outline of a shape is drawn
+type strokeStyle struct {
+	width  float64
+	cap    string
+	join   string
+	dashes []float64
+}
+
+func shapeStrokeStyle(shape VectorShape) strokeStyle {
+	return strokeStyle{width: shape.StrokeWidth, cap: shape.EffectiveLineCap(), join: shape.EffectiveLineJoin(), dashes: shape.StrokeDasharray}
+}
+
+// dedupe drops repeated consecutive points, and the end of closed chains coming back to their start
+func dedupe(points []Point, closed bool) []Point {
+	unique := []Point{}
+	for _, p := range points {
+		if len(unique) == 0 || p != unique[len(unique)-1] {
+			unique = append(unique, p)
+		}
+	}
+	if closed && len(unique) > 1 && unique[0] == unique[len(unique)-1] {
+		unique = unique[:len(unique)-1]
+	}
+	return unique
+}
+
+// maxDashPieces bounds the dashes cut along a single stroke, longer dashed strokes are drawn solid
+const maxDashPieces = 10000
+
+// dashPattern returns a dash pattern with an even number of lengths, odd patterns repeating as in SVG,
+// along with the length of its period
+func dashPattern(dashes []float64) ([]float64, float64) {
+	pattern := append([]float64{}, dashes...)
+	if len(pattern)%2 == 1 {
+		pattern = append(pattern, pattern...)
+	}
+	total := 0.0
+	for _, dash := range pattern {
+		total += math.Max(dash, 0)
+	}
+	return pattern, total
+}
+
+// dashed tells whether a chain of points is drawn dashed: the period of its pattern must cover a device
+// pixel, at scale device pixels per unit, and the chain must not be cut into more than maxDashPieces
+func dashed(points []Point, closed bool, dashes []float64, scale float64) bool {
+	pattern, total := dashPattern(dashes)
+	if !(total*scale >= 1) {
+		return false
+	}
+	length := 0.0
+	for i := 1; i < len(points); i++ {
+		length += distance(points[i-1], points[i])
+	}
+	if closed && len(points) > 1 {
+		length += distance(points[len(points)-1], points[0])
+	}
+	return length/total*float64(len(pattern)/2) <= maxDashPieces
+}
+
+// dashPieces splits a chain of points into the open chains drawn by a dash pattern
+func dashPieces(points []Point, closed bool, dashes []float64) [][]Point {
+	if closed && len(points) > 1 {
+		points = append(append([]Point{}, points...), points[0])
+	}
+	pattern, total := dashPattern(dashes)
+	if total <= 0 {
+		return [][]Point{points}
+	}
+
+	pieces := [][]Point{}
+	index, left, on := 0, pattern[0], true
+	current := []Point{}
+	if on && len(points) > 0 {
+		current = append(current, points[0])
+	}
+	for i := 1; i < len(points); i++ {
+		a, b := points[i-1], points[i]
+		length := distance(a, b)
+		done := 0.0
+		for length-done > left {
+			done += left
+			t := done / length
+			p := Point{X: a.X + (b.X-a.X)*t, Y: a.Y + (b.Y-a.Y)*t}
+			if on {
+				pieces = append(pieces, append(current, p))
+				current = nil
+			} else {
+				current = []Point{p}
+			}
+			on = !on
+			index = (index + 1) % len(pattern)
+			left = math.Max(pattern[index], 0)
+		}
+		left -= length - done
+		if on {
+			current = append(current, b)
+		}
+	}
+	if on && len(current) > 1 {
+		pieces = append(pieces, current)
+	}
+	return pieces
+}
+
+// strokePolygons returns polygons which together cover the stroke of a chain of points, with its joins
+// and caps. Scale is the size of a unit on the device, used to approximate round parts
+func strokePolygons(points []Point, closed bool, style strokeStyle, scale float64) [][]Point {
+	points = dedupe(points, closed)
+	if style.width <= 0 || len(points) == 0 {
+		return nil
+	}
+	if len(style.dashes) > 0 && dashed(points, closed, style.dashes, scale) {
+		polygons := [][]Point{}
+		for _, piece := range dashPieces(points, closed, style.dashes) {
+			polygons = append(polygons, strokePolygons(piece, false, strokeStyle{width: style.width, cap: style.cap, join: style.join}, scale)...)
+		}
+		return polygons
+	}
+
+	half := style.width / 2
+	polygons := [][]Point{}
+	cap := func(p Point, dx, dy float64) {
+		switch style.cap {
+		case LineCapRound:
+			polygons = append(polygons, ellipsePoints(p.X, p.Y, half, half, scale))
+		case LineCapSquare:
+			nx, ny := -dy*half, dx*half
+			out := Point{X: p.X + dx*half, Y: p.Y + dy*half}
+			polygons = append(polygons, oriented([]Point{
+				{X: p.X + nx, Y: p.Y + ny}, {X: out.X + nx, Y: out.Y + ny}, {X: out.X - nx, Y: out.Y - ny}, {X: p.X - nx, Y: p.Y - ny},
+			}))
+		}
+	}
+	if len(points) == 1 {
+		// a dot only shows with round or square caps
+		cap(points[0], 1, 0)
+		return polygons
+	}
+
+	direction := func(a, b Point) (float64, float64) {
+		length := distance(a, b)
+		return (b.X - a.X) / length, (b.Y - a.Y) / length
+	}
+	count := len(points) - 1
+	if closed {
+		count = len(points)
+	}
+	for i := 0; i < count; i++ {
+		a, b := points[i], points[(i+1)%len(points)]
+		dx, dy := direction(a, b)
+		nx, ny := -dy*half, dx*half
+		polygons = append(polygons, oriented([]Point{
+			{X: a.X + nx, Y: a.Y + ny}, {X: b.X + nx, Y: b.Y + ny}, {X: b.X - nx, Y: b.Y - ny}, {X: a.X - nx, Y: a.Y - ny},
+		}))
+	}
+
+	join := func(previous, v, following Point) {
+		d0x, d0y := direction(previous, v)
+		d1x, d1y := direction(v, following)
+		cross := d0x*d1y - d0y*d1x
+		if style.join == LineJoinRound {
+			polygons = append(polygons, ellipsePoints(v.X, v.Y, half, half, scale))
+			return
+		}
+		if math.Abs(cross) < 1e-12 {
+			return
+		}
+		// the outer side of the turn is opposite to the direction it turns to
+		side := 1.0
+		if cross > 0 {
+			side = -1
+		}
+		n0 := Point{X: -d0y * half * side, Y: d0x * half * side}
+		n1 := Point{X: -d1y * half * side, Y: d1x * half * side}
+		a := Point{X: v.X + n0.X, Y: v.Y + n0.Y}
+		b := Point{X: v.X + n1.X, Y: v.Y + n1.Y}
+		m := Point{X: n0.X + n1.X, Y: n0.Y + n1.Y}
+		mLengthSquared := m.X*m.X + m.Y*m.Y
+		if style.join == LineJoinMiter && mLengthSquared > 0 && 2*half/math.Sqrt(mLengthSquared) <= miterLimit {
+			scaleMiter := 2 * half * half / mLengthSquared
+			miter := Point{X: v.X + m.X*scaleMiter, Y: v.Y + m.Y*scaleMiter}
+			polygons = append(polygons, oriented([]Point{v, a, miter, b}))
+			return
+		}
+		polygons = append(polygons, oriented([]Point{v, a, b}))
+	}
+	for i := 1; i < len(points)-1; i++ {
+		join(points[i-1], points[i], points[i+1])
+	}
+	if closed {
+		if len(points) > 2 {
+			join(points[len(points)-2], points[len(points)-1], points[0])
+			join(points[len(points)-1], points[0], points[1])
+		}
+		return polygons
+	}
+	dx, dy := direction(points[1], points[0])
+	cap(points[0], dx, dy)
+	dx, dy = direction(points[len(points)-2], points[len(points)-1])
+	cap(points[len(points)-1], dx, dy)
+	return polygons
+}
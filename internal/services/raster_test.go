@@ -0,0 +1,146 @@
+package services
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+// alphaAt returns the coverage of a pixel, between 0 and 1
+func alphaAt(img *image.RGBA, x, y int) float64 {
+	return float64(img.Pix[img.PixOffset(x, y)+3]) / 255
+}
+
+func TestFillPolygonsCoverage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	black := solidPaint(rgba{A: 1})
+	fillPolygons(img, [][]Point{boxCorners(0.5, 0.5, 2, 2)}, false, black)
+
+	for _, c := range []struct {
+		x, y int
+		want float64
+	}{
+		{0, 0, 0.25},
+		{1, 0, 0.5},
+		{1, 1, 1},
+		{2, 2, 0.25},
+		{3, 3, 0},
+	} {
+		if got := alphaAt(img, c.x, c.y); math.Abs(got-c.want) > 0.01 {
+			t.Errorf("Expected a coverage of %v at %d,%d, got %v", c.want, c.x, c.y, got)
+		}
+	}
+}
+
+func TestFillPolygonsRules(t *testing.T) {
+	outer, inner := boxCorners(0, 0, 6, 6), boxCorners(2, 2, 2, 2)
+	black := solidPaint(rgba{A: 1})
+
+	nonZero := image.NewRGBA(image.Rect(0, 0, 6, 6))
+	fillPolygons(nonZero, [][]Point{outer, inner}, false, black)
+	if alphaAt(nonZero, 3, 3) != 1 {
+		t.Error("Expected polygons wound the same way to add up under the nonzero rule")
+	}
+
+	evenOdd := image.NewRGBA(image.Rect(0, 0, 6, 6))
+	fillPolygons(evenOdd, [][]Point{outer, inner}, true, black)
+	if alphaAt(evenOdd, 3, 3) != 0 || alphaAt(evenOdd, 0, 0) != 1 {
+		t.Error("Expected a hole under the even-odd rule")
+	}
+
+	clipped := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	fillPolygons(clipped, [][]Point{boxCorners(-10, -10, 30, 30)}, false, black)
+	if alphaAt(clipped, 1, 1) != 1 {
+		t.Error("Expected polygons larger than the surface to be clipped")
+	}
+}
+
+func TestDashPieces(t *testing.T) {
+	pieces := dashPieces([]Point{{0, 0}, {10, 0}}, false, []float64{3, 2})
+	want := [][2]Point{{{0, 0}, {3, 0}}, {{5, 0}, {8, 0}}}
+	if len(pieces) != len(want) {
+		t.Fatalf("Expected 2 dashes, got %v", pieces)
+	}
+	for i := range pieces {
+		if pieces[i][0] != want[i][0] || pieces[i][len(pieces[i])-1] != want[i][1] {
+			t.Errorf("Expected dash %d to be %v, got %v", i, want[i], pieces[i])
+		}
+	}
+
+	// a dash running over a corner keeps the corner
+	pieces = dashPieces([]Point{{0, 0}, {2, 0}, {2, 2}}, false, []float64{3})
+	if len(pieces) != 1 || len(pieces[0]) != 3 || pieces[0][2] != (Point{X: 2, Y: 1}) {
+		t.Errorf("Expected a single dash turning the corner, got %v", pieces)
+	}
+}
+
+func TestTinyOrCountlessDashesAreDrawnSolid(t *testing.T) {
+	line := []Point{{0, 0}, {2000, 0}}
+	style := strokeStyle{width: 1, dashes: []float64{0.001}}
+	if polygons := strokePolygons(line, false, style, 1); len(polygons) != 1 {
+		t.Errorf("Expected dashes under a pixel to be drawn solid, got %d polygons", len(polygons))
+	}
+	style.dashes = []float64{0.05, 0.05}
+	if polygons := strokePolygons(line, false, style, 100); len(polygons) != 1 {
+		t.Errorf("Expected too many dashes to be drawn solid, got %d polygons", len(polygons))
+	}
+	style.dashes = []float64{4, 4}
+	if polygons := strokePolygons(line, false, style, 1); len(polygons) != 250 {
+		t.Errorf("Expected visible dashes to be kept, got %d polygons", len(polygons))
+	}
+}
+
+func TestStrokePolygons(t *testing.T) {
+	black := solidPaint(rgba{A: 1})
+	draw := func(points []Point, closed bool, style strokeStyle) *image.RGBA {
+		img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+		fillPolygons(img, strokePolygons(points, closed, style, 1), false, black)
+		return img
+	}
+
+	butt := draw([]Point{{5, 10}, {15, 10}}, false, strokeStyle{width: 4, cap: LineCapButt, join: LineJoinMiter})
+	if alphaAt(butt, 10, 9) != 1 || alphaAt(butt, 10, 12) != 0 || alphaAt(butt, 3, 10) != 0 {
+		t.Error("Expected a butt stroke to cover its width and stop at its ends")
+	}
+	square := draw([]Point{{5, 10}, {15, 10}}, false, strokeStyle{width: 4, cap: LineCapSquare, join: LineJoinMiter})
+	if alphaAt(square, 3, 10) != 1 {
+		t.Error("Expected square caps to extend the stroke")
+	}
+
+	// the outer corner of a right angle is filled by miter joins and cut by bevel ones
+	corner := []Point{{5, 15}, {5, 5}, {15, 5}}
+	miter := draw(corner, false, strokeStyle{width: 4, cap: LineCapButt, join: LineJoinMiter})
+	bevel := draw(corner, false, strokeStyle{width: 4, cap: LineCapButt, join: LineJoinBevel})
+	if alphaAt(miter, 3, 3) != 1 || alphaAt(bevel, 3, 3) != 0 {
+		t.Errorf("Expected the corner to be mitered then beveled, got %v and %v", alphaAt(miter, 3, 3), alphaAt(bevel, 3, 3))
+	}
+
+	if polygons := strokePolygons([]Point{{1, 1}}, false, strokeStyle{width: 2, cap: LineCapButt}, 1); len(polygons) != 0 {
+		t.Error("Expected a single point with butt caps to draw nothing")
+	}
+}
+
+func TestGlyphRects(t *testing.T) {
+	if rects := glyphRects(' ', 0, 7, 1, false); len(rects) != 0 {
+		t.Errorf("Expected a space to draw nothing, got %v", rects)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, 6, 8))
+	fillPolygons(img, glyphRects('l', 0, 7, 1, false), false, solidPaint(rgba{A: 1}))
+	covered := 0
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 6; x++ {
+			if alphaAt(img, x, y) > 0 {
+				covered++
+				if y == 7 {
+					t.Error("Expected glyphs to sit on their baseline")
+				}
+			}
+		}
+	}
+	if covered == 0 {
+		t.Error("Expected a letter to be drawn")
+	}
+	if unknown, question := glyphRects('é', 0, 7, 1, false), glyphRects('?', 0, 7, 1, false); len(unknown) != len(question) {
+		t.Error("Expected characters out of the font to be drawn as question marks")
+	}
+}
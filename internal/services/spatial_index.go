@@ -0,0 +1,186 @@
+package services
+
+import (
+	"math"
+	"sort"
+)
+
+// spatialCellSize is the side of the grid cells of the spatial index, in canvas units
+const spatialCellSize = 256
+
+// maxIndexedCells bounds the cells a single element is registered in, larger elements are always candidates
+const maxIndexedCells = 1024
+
+type cellKey struct {
+	x, y int
+}
+
+// spatialIndex is a uniform grid over the bounding boxes of the top level elements of a canvas. It also
+// remembers the position of each element in the canvas slice so that results can be put in z-order
+type spatialIndex struct {
+	cells     map[cellKey][]string
+	large     []string
+	bounds    map[string]Rect
+	positions map[string]int
+}
+
+func newSpatialIndex(elements []VectorElement) *spatialIndex {
+	index := &spatialIndex{
+		cells:     make(map[cellKey][]string),
+		bounds:    make(map[string]Rect),
+		positions: make(map[string]int),
+	}
+	for position, element := range elements {
+		index.insert(element, position)
+	}
+	return index
+}
+
+func cellRange(r Rect) (cellKey, cellKey) {
+	return cellKey{x: int(math.Floor(r.MinX / spatialCellSize)), y: int(math.Floor(r.MinY / spatialCellSize))},
+		cellKey{x: int(math.Floor(r.MaxX / spatialCellSize)), y: int(math.Floor(r.MaxY / spatialCellSize))}
+}
+
+// cellCount is the number of cells a rectangle covers, in floating point as huge rectangles overflow integers
+// and their cells. It is NaN for rectangles which are not numbers
+func cellCount(r Rect) float64 {
+	return (math.Floor(r.MaxX/spatialCellSize) - math.Floor(r.MinX/spatialCellSize) + 1) *
+		(math.Floor(r.MaxY/spatialCellSize) - math.Floor(r.MinY/spatialCellSize) + 1)
+}
+
+// coveredBy tells whether a rectangle overlaps a cell, without converting the rectangle to cells
+func (key cellKey) coveredBy(r Rect) bool {
+	x, y := float64(key.x)*spatialCellSize, float64(key.y)*spatialCellSize
+	return x+spatialCellSize > r.MinX && x <= r.MaxX && y+spatialCellSize > r.MinY && y <= r.MaxY
+}
+
+// insert registers an element found at position in the canvas slice; elements without extent are skipped
+func (s *spatialIndex) insert(element VectorElement, position int) {
+	id := ElementID(element)
+	bounds, ok := ElementBounds(element)
+	if !ok || math.IsNaN(bounds.MinX) || math.IsInf(bounds.Width(), 0) || math.IsInf(bounds.Height(), 0) {
+		return
+	}
+	s.bounds[id] = bounds
+	s.positions[id] = position
+
+	if !(cellCount(bounds) <= maxIndexedCells) {
+		s.large = append(s.large, id)
+		return
+	}
+	low, high := cellRange(bounds)
+	for x := low.x; x <= high.x; x++ {
+		for y := low.y; y <= high.y; y++ {
+			key := cellKey{x: x, y: y}
+			s.cells[key] = append(s.cells[key], id)
+		}
+	}
+}
+
+// query returns the elements whose bounding box intersects r, or lies inside it when contained is set
+func (s *spatialIndex) query(r Rect, contained bool) []string {
+	seen := make(map[string]bool)
+	matches := []string{}
+	check := func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+		b := s.bounds[id]
+		if contained {
+			if b.MinX >= r.MinX && b.MaxX <= r.MaxX && b.MinY >= r.MinY && b.MaxY <= r.MaxY {
+				matches = append(matches, id)
+			}
+			return
+		}
+		if b.Intersects(r) {
+			matches = append(matches, id)
+		}
+	}
+
+	for _, id := range s.large {
+		check(id)
+	}
+	if !(cellCount(r) <= float64(len(s.cells))) {
+		// a query larger than the populated grid is cheaper as a scan of the cells
+		for key, ids := range s.cells {
+			if key.coveredBy(r) {
+				for _, id := range ids {
+					check(id)
+				}
+			}
+		}
+		return matches
+	}
+	low, high := cellRange(r)
+	for x := low.x; x <= high.x; x++ {
+		for y := low.y; y <= high.y; y++ {
+			for _, id := range s.cells[cellKey{x: x, y: y}] {
+				check(id)
+			}
+		}
+	}
+	return matches
+}
+
+// canvasIndex returns the spatial index of a canvas, building it after a change; the caller must hold the
+// canvas service mutex, for reading at least
+func (c *CanvasService) canvasIndex(canvas *Canvas) *spatialIndex {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+	index, exists := c.indexes[canvas.ID]
+	if !exists {
+		index = newSpatialIndex(canvas.VectorData.Elements)
+		c.indexes[canvas.ID] = index
+	}
+	return index
+}
+
+// invalidateIndex drops the spatial index of a canvas whose elements changed, it is rebuilt on the next query
+func (c *CanvasService) invalidateIndex(canvasId string) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+	delete(c.indexes, canvasId)
+}
+
+// appendToIndex registers an element added on top of a canvas without rebuilding its index
+func (c *CanvasService) appendToIndex(canvas *Canvas) {
+	c.indexMutex.Lock()
+	defer c.indexMutex.Unlock()
+	if index, exists := c.indexes[canvas.ID]; exists {
+		last := len(canvas.VectorData.Elements) - 1
+		index.insert(canvas.VectorData.Elements[last], last)
+	}
+}
+
+// zOrdered sorts top level element IDs bottom to top: by layer, then by position within the canvas
+func zOrdered(v *VectorData, index *spatialIndex, ids []string) []VectorElement {
+	elements := make([]VectorElement, len(ids))
+	layers := make(map[string]int, len(ids))
+	for i, id := range ids {
+		elements[i] = v.Elements[index.positions[id]]
+		shape, _ := ElementShape(elements[i])
+		layers[id] = v.layerIndex(shape.Layer)
+	}
+	sort.SliceStable(elements, func(i, j int) bool {
+		a, b := ElementID(elements[i]), ElementID(elements[j])
+		if layers[a] != layers[b] {
+			return layers[a] < layers[b]
+		}
+		return index.positions[a] < index.positions[b]
+	})
+	return elements
+}
+
+// ElementsInRect returns the top level elements whose bounding box intersects a rectangle of a canvas, or lies
+// inside it when contained is set, bottom to top. Elements of hidden layers are included
+func (c *CanvasService) ElementsInRect(canvasId string, r Rect, contained bool) []VectorElement {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return nil
+	}
+	index := c.canvasIndex(canvas)
+	return zOrdered(&canvas.VectorData, index, index.query(r, contained))
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestElementsInRect(t *testing.T) {
+	cs := newGroupCanvas(
+		onLayer(rect("a", 0, 0), "top"),
+		onLayer(rect("far", 5000, 5000), "top"),
+		VectorRectangle{VectorShape: VectorShape{ID: "huge", Layer: "top"}, Type: "rectangle", X: -100000, Y: -100000, Width: 200000, Height: 200000},
+		onLayer(rect("below", 5, 5), "bottom"),
+	)
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{
+		{ID: "bottom", Name: "Bottom", Visible: false, Opacity: 1},
+		{ID: "top", Name: "Top", Visible: true, Opacity: 1},
+	}
+
+	ids := elementIDs(cs.ElementsInRect("c1", Rect{MinX: -1, MinY: -1, MaxX: 20, MaxY: 20}, false))
+	if !sameIDs(ids, "below", "a", "huge") {
+		t.Errorf("Expected intersecting elements bottom to top, got %v", ids)
+	}
+	ids = elementIDs(cs.ElementsInRect("c1", Rect{MinX: -1, MinY: -1, MaxX: 20, MaxY: 20}, true))
+	if !sameIDs(ids, "below", "a") {
+		t.Errorf("Expected contained elements only, got %v", ids)
+	}
+	ids = elementIDs(cs.ElementsInRect("c1", Rect{MinX: 4990, MinY: 4990, MaxX: 5001, MaxY: 5001}, false))
+	if !sameIDs(ids, "far", "huge") {
+		t.Errorf("Expected the far element, got %v", ids)
+	}
+	if elements := cs.ElementsInRect("missing", Rect{}, false); elements != nil {
+		t.Error("Expected nothing for a missing canvas")
+	}
+}
+
+func TestSpatialIndexFollowsChanges(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0))
+	area := Rect{MinX: 1000, MinY: 1000, MaxX: 1010, MaxY: 1010}
+	if len(cs.ElementsInRect("c1", area, false)) != 0 {
+		t.Fatal("Expected an empty area")
+	}
+
+	// elements drawn on top are added to the index in place
+	cs.UpdateCanvasElement("c1", rect("b", 1000, 1000))
+	if ids := elementIDs(cs.ElementsInRect("c1", area, false)); !sameIDs(ids, "b") {
+		t.Errorf("Expected the new element, got %v", ids)
+	}
+
+	if err := cs.TransformElements("c1", []string{"a"}, Translate(1000, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if ids := elementIDs(cs.ElementsInRect("c1", area, false)); !sameIDs(ids, "a", "b") {
+		t.Errorf("Expected the moved element, got %v", ids)
+	}
+
+	if _, err := cs.ReorderElement("c1", "a", ZOrderFront); err != nil {
+		t.Fatal(err)
+	}
+	if hits := cs.HitTest("c1", Point{X: 1005, Y: 1005}, 0); len(hits) != 2 || hits[0].ElementID != "a" {
+		t.Errorf("Expected a on top after reordering, got %+v", hits)
+	}
+
+	cs.RemoveCanvas("c1")
+	if elements := cs.ElementsInRect("c1", area, false); elements != nil {
+		t.Error("Expected the index to go with its canvas")
+	}
+}
+
+func BenchmarkHitTest(b *testing.B) {
+	elements := []VectorElement{}
+	for i := 0; i < 10000; i++ {
+		elements = append(elements, rect(fmt.Sprintf("r%d", i), float64(i%100)*50, float64(i/100)*50))
+	}
+	cs := newGroupCanvas(elements...)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cs.HitTest("c1", Point{X: float64(i%5000) + 1, Y: 2501}, 1)
+	}
+}
+
+func TestSpatialIndexHugeExtents(t *testing.T) {
+	cs := newGroupCanvas(
+		rect("a", 0, 0),
+		VectorRectangle{VectorShape: VectorShape{ID: "vast", Fill: "#000000"}, Type: "rectangle", X: -1e300, Y: -1e300, Width: 2e300, Height: 2e300},
+	)
+	// cell counts overflowing integers must neither loop over the cells nor miss the elements
+	if hits := cs.HitTest("c1", Point{X: 5, Y: 5}, 1e13); len(hits) != 2 {
+		t.Errorf("Expected both elements within a huge tolerance, got %v", hits)
+	}
+	ids := elementIDs(cs.ElementsInRect("c1", Rect{MinX: -1e300, MinY: -1e300, MaxX: 1e300, MaxY: 1e300}, false))
+	if !sameIDs(ids, "a", "vast") {
+		t.Errorf("Expected both elements in a huge rectangle, got %v", ids)
+	}
+	ids = elementIDs(cs.ElementsInRect("c1", Rect{MinX: 1e15, MinY: 1e15, MaxX: 1e16, MaxY: 1e16}, false))
+	if !sameIDs(ids, "vast") {
+		t.Errorf("Expected only the vast element far away, got %v", ids)
+	}
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// stroke line caps, the empty value is the SVG default butt cap
+const (
+	LineCapButt   = "butt"
+	LineCapRound  = "round"
+	LineCapSquare = "square"
+)
+
+// stroke line joins, the empty value is the SVG default miter join
+const (
+	LineJoinMiter = "miter"
+	LineJoinRound = "round"
+	LineJoinBevel = "bevel"
+)
+
+// MinDashPattern is the shortest total length of a dash pattern, shorter ones only make strokes look solid
+const MinDashPattern = 0.01
+
+// gradient kinds
+const (
+	GradientLinear = "linear"
+	GradientRadial = "radial"
+)
+
+// blendModes are the CSS mix-blend-mode values, the empty value is normal
+var blendModes = map[string]bool{
+	"normal": true, "multiply": true, "screen": true, "overlay": true, "darken": true, "lighten": true,
+	"color-dodge": true, "color-burn": true, "hard-light": true, "soft-light": true, "difference": true,
+	"exclusion": true, "hue": true, "saturation": true, "color": true, "luminosity": true,
+}
+
+// GradientStop is a color at a position of a gradient, from 0 to 1
+type GradientStop struct {
+	Offset float64 `firestore:"offset" json:"offset"`
+	Color  string  `firestore:"color" json:"color"`
+}
+
+// Gradient fill, its coordinates are fractions of the element bounding box.
+// Linear gradients go from (x1, y1) to (x2, y2); radial ones spread from (cx, cy) over radius r
+type Gradient struct {
+	Type  string         `firestore:"type" json:"type"`
+	X1    float64        `firestore:"x1" json:"x1"`
+	Y1    float64        `firestore:"y1" json:"y1"`
+	X2    float64        `firestore:"x2" json:"x2"`
+	Y2    float64        `firestore:"y2" json:"y2"`
+	CX    float64        `firestore:"cx" json:"cx"`
+	CY    float64        `firestore:"cy" json:"cy"`
+	R     float64        `firestore:"r" json:"r"`
+	Stops []GradientStop `firestore:"stops" json:"stops"`
+}
+
+// Shadow is a drop shadow cast by the element
+type Shadow struct {
+	OffsetX float64 `firestore:"offsetX" json:"offsetX"`
+	OffsetY float64 `firestore:"offsetY" json:"offsetY"`
+	Blur    float64 `firestore:"blur" json:"blur"`
+	Color   string  `firestore:"color" json:"color"`
+}
+
+// opacityOrDefault treats a missing opacity as fully opaque, as documents saved before opacities existed
+func opacityOrDefault(opacity *float64) float64 {
+	if opacity == nil {
+		return 1
+	}
+	return *opacity
+}
+
+func (s VectorShape) EffectiveStrokeOpacity() float64 {
+	return opacityOrDefault(s.StrokeOpacity)
+}
+
+func (s VectorShape) EffectiveFillOpacity() float64 {
+	return opacityOrDefault(s.FillOpacity)
+}
+
+func (s VectorShape) EffectiveLineCap() string {
+	if s.LineCap == "" {
+		return LineCapButt
+	}
+	return s.LineCap
+}
+
+func (s VectorShape) EffectiveLineJoin() string {
+	if s.LineJoin == "" {
+		return LineJoinMiter
+	}
+	return s.LineJoin
+}
+
+func (s VectorShape) EffectiveBlendMode() string {
+	if s.BlendMode == "" {
+		return "normal"
+	}
+	return s.BlendMode
+}
+
+func validOpacity(opacity *float64) bool {
+	return opacity == nil || (*opacity >= 0 && *opacity <= 1)
+}
+
+func validateGradient(g *Gradient) error {
+	switch g.Type {
+	case GradientLinear:
+	case GradientRadial:
+		if g.R <= 0 {
+			return errors.New("radial gradient radius must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown gradient type %q", g.Type)
+	}
+	if len(g.Stops) == 0 {
+		return errors.New("gradient without stops")
+	}
+	previous := 0.0
+	for _, stop := range g.Stops {
+		if stop.Offset < previous || stop.Offset > 1 {
+			return errors.New("gradient stop offsets must increase from 0 to 1")
+		}
+		if !ValidColor(stop.Color) {
+			return fmt.Errorf("invalid gradient stop color %q", stop.Color)
+		}
+		previous = stop.Offset
+	}
+	return nil
+}
+
+// ElementStyle is the styling part of the shared element fields, as kept by style presets
+type ElementStyle struct {
+	Stroke          string    `firestore:"stroke" json:"stroke"`
+	StrokeWidth     float64   `firestore:"strokeWidth" json:"strokeWidth"`
+	Fill            string    `firestore:"fill" json:"fill"`
+	StrokeOpacity   *float64  `firestore:"strokeOpacity,omitempty" json:"strokeOpacity,omitempty"`
+	FillOpacity     *float64  `firestore:"fillOpacity,omitempty" json:"fillOpacity,omitempty"`
+	StrokeDasharray []float64 `firestore:"strokeDasharray,omitempty" json:"strokeDasharray,omitempty"`
+	LineCap         string    `firestore:"lineCap,omitempty" json:"lineCap,omitempty"`
+	LineJoin        string    `firestore:"lineJoin,omitempty" json:"lineJoin,omitempty"`
+	FillGradient    *Gradient `firestore:"fillGradient,omitempty" json:"fillGradient,omitempty"`
+	Shadow          *Shadow   `firestore:"shadow,omitempty" json:"shadow,omitempty"`
+	BlendMode       string    `firestore:"blendMode,omitempty" json:"blendMode,omitempty"`
+}
+
+// Style returns the styling fields of an element
+func (s VectorShape) Style() ElementStyle {
+	return ElementStyle{
+		Stroke:          s.Stroke,
+		StrokeWidth:     s.StrokeWidth,
+		Fill:            s.Fill,
+		StrokeOpacity:   s.StrokeOpacity,
+		FillOpacity:     s.FillOpacity,
+		StrokeDasharray: s.StrokeDasharray,
+		LineCap:         s.LineCap,
+		LineJoin:        s.LineJoin,
+		FillGradient:    s.FillGradient,
+		Shadow:          s.Shadow,
+		BlendMode:       s.BlendMode,
+	}
+}
+
+// setStyle replaces every styling field of an element
+func (s *VectorShape) setStyle(style ElementStyle) {
+	s.Stroke = style.Stroke
+	s.StrokeWidth = style.StrokeWidth
+	s.Fill = style.Fill
+	s.StrokeOpacity = style.StrokeOpacity
+	s.FillOpacity = style.FillOpacity
+	s.StrokeDasharray = style.StrokeDasharray
+	s.LineCap = style.LineCap
+	s.LineJoin = style.LineJoin
+	s.FillGradient = style.FillGradient
+	s.Shadow = style.Shadow
+	s.BlendMode = style.BlendMode
+}
+
+// Validate checks the paint properties shared by every element
+func (s ElementStyle) Validate() error {
+	if !ValidColor(s.Stroke) {
+		return fmt.Errorf("invalid stroke color %q", s.Stroke)
+	}
+	if !ValidColor(s.Fill) {
+		return fmt.Errorf("invalid fill color %q", s.Fill)
+	}
+	if s.StrokeWidth < 0 || math.IsNaN(s.StrokeWidth) {
+		return errors.New("stroke width cannot be negative")
+	}
+	if !validOpacity(s.StrokeOpacity) || !validOpacity(s.FillOpacity) {
+		return errors.New("opacity must be between 0 and 1")
+	}
+	pattern := 0.0
+	for _, dash := range s.StrokeDasharray {
+		if dash < 0 || math.IsNaN(dash) || math.IsInf(dash, 0) {
+			return errors.New("dash lengths must be finite and not negative")
+		}
+		pattern += dash
+	}
+	if len(s.StrokeDasharray) > 0 && pattern < MinDashPattern {
+		return fmt.Errorf("dash patterns must be at least %g long", MinDashPattern)
+	}
+	switch s.LineCap {
+	case "", LineCapButt, LineCapRound, LineCapSquare:
+	default:
+		return fmt.Errorf("unknown line cap %q", s.LineCap)
+	}
+	switch s.LineJoin {
+	case "", LineJoinMiter, LineJoinRound, LineJoinBevel:
+	default:
+		return fmt.Errorf("unknown line join %q", s.LineJoin)
+	}
+	if s.BlendMode != "" && !blendModes[s.BlendMode] {
+		return fmt.Errorf("unknown blend mode %q", s.BlendMode)
+	}
+	if s.FillGradient != nil {
+		if err := validateGradient(s.FillGradient); err != nil {
+			return err
+		}
+	}
+	if s.Shadow != nil {
+		if s.Shadow.Blur < 0 {
+			return errors.New("shadow blur cannot be negative")
+		}
+		if !ValidColor(s.Shadow.Color) {
+			return fmt.Errorf("invalid shadow color %q", s.Shadow.Color)
+		}
+	}
+	return nil
+}
+
+// ValidateStyle checks the styling of an element and of its content: text colors and group children.
+// Stored documents are loaded without it so that older values never make elements disappear
+func ValidateStyle(element VectorElement) error {
+	shape, _ := ElementShape(element)
+	if err := shape.Style().Validate(); err != nil {
+		return err
+	}
+	switch e := element.(type) {
+	case VectorText:
+		if !ValidColor(e.Color) {
+			return fmt.Errorf("invalid text color %q", e.Color)
+		}
+		for _, run := range e.Runs {
+			if !ValidColor(run.Color) {
+				return fmt.Errorf("invalid text color %q", run.Color)
+			}
+		}
+	case VectorGroup:
+		for _, child := range e.Children {
+			if err := ValidateStyle(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateElementsStyle checks the styling of every element of a canvas sent or imported by a client
+func ValidateElementsStyle(elements []VectorElement) error {
+	for _, element := range elements {
+		if err := ValidateStyle(element); err != nil {
+			return fmt.Errorf("element %s: %w", ElementID(element), err)
+		}
+	}
+	return nil
+}
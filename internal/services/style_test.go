@@ -0,0 +1,92 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseStyledElement(t *testing.T) {
+	raw := map[string]interface{}{}
+	data := `{"id":"r1","type":"rectangle","x":0,"y":0,"width":10,"height":10,"stroke":"#000",
+		"strokeOpacity":0.5,"fillOpacity":0,"strokeDasharray":[4,2],"lineCap":"round","lineJoin":"bevel",
+		"fillGradient":{"type":"linear","x1":0,"y1":0,"x2":1,"y2":0,"stops":[{"offset":0,"color":"#fff"},{"offset":1,"color":"navy"}]},
+		"shadow":{"offsetX":2,"offsetY":3,"blur":4,"color":"rgba(0,0,0,0.3)"},"blendMode":"multiply"}`
+	if err := json.Unmarshal([]byte(data), &raw); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := ParseSingleStrokeFromRaw(raw).(VectorRectangle)
+	if !ok {
+		t.Fatal("Expected a VectorRectangle")
+	}
+	if r.EffectiveStrokeOpacity() != 0.5 || r.EffectiveFillOpacity() != 0 {
+		t.Errorf("Unexpected opacities %v %v", r.StrokeOpacity, r.FillOpacity)
+	}
+	if len(r.StrokeDasharray) != 2 || r.LineCap != LineCapRound || r.LineJoin != LineJoinBevel || r.BlendMode != "multiply" {
+		t.Errorf("Unexpected stroke style %+v", r.VectorShape)
+	}
+	if r.FillGradient == nil || len(r.FillGradient.Stops) != 2 || r.Shadow == nil || r.Shadow.Blur != 4 {
+		t.Errorf("Unexpected gradient or shadow %+v %+v", r.FillGradient, r.Shadow)
+	}
+	if err := ValidateStyle(r); err != nil {
+		t.Errorf("Expected a valid style, got %v", err)
+	}
+}
+
+func TestStyleDefaults(t *testing.T) {
+	raw := map[string]interface{}{"id": "p1", "type": "path", "stroke": "#000000", "strokeWidth": 2.0}
+	path, ok := ParseSingleStrokeFromRaw(raw).(VectorPath)
+	if !ok {
+		t.Fatal("Expected a VectorPath")
+	}
+	if path.EffectiveStrokeOpacity() != 1 || path.EffectiveFillOpacity() != 1 {
+		t.Error("Expected older documents to stay opaque")
+	}
+	if path.EffectiveLineCap() != LineCapButt || path.EffectiveLineJoin() != LineJoinMiter || path.EffectiveBlendMode() != "normal" {
+		t.Error("Unexpected stroke defaults")
+	}
+
+	// style fields are left out of documents that do not use them
+	encoded, _ := json.Marshal(path)
+	decoded := map[string]interface{}{}
+	_ = json.Unmarshal(encoded, &decoded)
+	for _, key := range []string{"strokeOpacity", "fillGradient", "shadow", "lineCap", "blendMode"} {
+		if _, present := decoded[key]; present {
+			t.Errorf("Expected %s to be omitted", key)
+		}
+	}
+}
+
+func TestValidateStyle(t *testing.T) {
+	half := 0.5
+	tooMuch := 1.5
+	tests := []struct {
+		name  string
+		shape VectorShape
+		valid bool
+	}{
+		{"plain", VectorShape{Stroke: "#000", Fill: "red", FillOpacity: &half}, true},
+		{"bad stroke", VectorShape{Stroke: "#00"}, false},
+		{"bad opacity", VectorShape{StrokeOpacity: &tooMuch}, false},
+		{"negative dash", VectorShape{StrokeDasharray: []float64{2, -1}}, false},
+		{"zero dashes", VectorShape{StrokeDasharray: []float64{0, 0}}, false},
+		{"tiny dashes", VectorShape{StrokeDasharray: []float64{0.001}}, false},
+		{"dots", VectorShape{StrokeDasharray: []float64{0, 2}}, true},
+		{"bad cap", VectorShape{LineCap: "pointy"}, false},
+		{"bad join", VectorShape{LineJoin: "glue"}, false},
+		{"bad blend mode", VectorShape{BlendMode: "add"}, false},
+		{"radial without radius", VectorShape{FillGradient: &Gradient{Type: GradientRadial, Stops: []GradientStop{{Offset: 0, Color: "#fff"}}}}, false},
+		{"unordered stops", VectorShape{FillGradient: &Gradient{Type: GradientLinear, Stops: []GradientStop{{Offset: 0.5, Color: "#fff"}, {Offset: 0.2, Color: "#000"}}}}, false},
+		{"bad shadow color", VectorShape{Shadow: &Shadow{Color: "shade"}}, false},
+	}
+	for _, tt := range tests {
+		err := ValidateStyle(VectorRectangle{VectorShape: tt.shape, Type: "rectangle"})
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid=%v, got %v", tt.name, tt.valid, err)
+		}
+	}
+
+	group := VectorGroup{Type: "group", Children: []VectorElement{VectorText{Type: "text", Color: "nope"}}}
+	if err := ValidateStyle(group); err == nil {
+		t.Error("Expected an invalid nested text color to be rejected")
+	}
+}
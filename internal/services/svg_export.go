@@ -0,0 +1,437 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// SVGOptions tunes the export of canvases to SVG
+type SVGOptions struct {
+	// ImageHref returns the address the content of an asset is loaded from, images without one are left out
+	ImageHref func(assetId string) (string, bool)
+}
+
+var svgEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+// svgNumber prints a coordinate without the noise of binary fractions
+func svgNumber(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1000)/1000, 'f', -1, 64)
+}
+
+func svgPoints(points []Point) string {
+	parts := make([]string, len(points))
+	for i, p := range points {
+		parts[i] = svgNumber(p.X) + "," + svgNumber(p.Y)
+	}
+	return strings.Join(parts, " ")
+}
+
+// actionHref returns the link of an action when it is a web or mail address, other schemes are not exported
+func actionHref(action Action) (string, bool) {
+	if action.Link == "" {
+		return "", false
+	}
+	link, err := url.Parse(action.Link)
+	if err != nil {
+		return "", false
+	}
+	switch link.Scheme {
+	case "http", "https", "mailto":
+		return link.String(), true
+	}
+	return "", false
+}
+
+// canvasArea returns the area of a canvas to export, the box of its elements when it has no size
+func canvasArea(v VectorData) Rect {
+	if v.Width > 0 && v.Height > 0 {
+		return Rect{MaxX: v.Width, MaxY: v.Height}
+	}
+	area, found := Rect{}, false
+	for _, element := range v.Elements {
+		if bounds, ok := ElementBounds(element); ok {
+			if found {
+				area = area.Union(bounds)
+			} else {
+				area, found = bounds, true
+			}
+		}
+	}
+	if !found || area.Width() <= 0 || area.Height() <= 0 {
+		return Rect{MaxX: 1, MaxY: 1}
+	}
+	return area
+}
+
+type svgWriter struct {
+	body    strings.Builder
+	defs    strings.Builder
+	options SVGOptions
+	ids     int
+}
+
+// nextID names the definitions of the document, element IDs are left to the elements
+func (w *svgWriter) nextID(kind string) string {
+	w.ids++
+	return fmt.Sprintf("phaint-%s-%d", kind, w.ids)
+}
+
+// RenderSVG renders the visible layers of a canvas as a standalone SVG document
+func RenderSVG(v VectorData, options SVGOptions) []byte {
+	w := &svgWriter{options: options}
+	area := canvasArea(v)
+	if v.BackgroundFill != "" && v.BackgroundFill != "none" {
+		fmt.Fprintf(&w.body, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+			svgNumber(area.MinX), svgNumber(area.MinY), svgNumber(area.Width()), svgNumber(area.Height()), svgEscaper.Replace(v.BackgroundFill))
+	}
+	layers := v.EffectiveLayers()
+	for i, elements := range v.LayerElements() {
+		if !layers[i].Visible || len(elements) == 0 {
+			continue
+		}
+		w.body.WriteString("<g")
+		if layers[i].Opacity < 1 {
+			fmt.Fprintf(&w.body, ` opacity="%s"`, svgNumber(layers[i].Opacity))
+		}
+		w.body.WriteString(">\n")
+		for _, element := range elements {
+			w.element(element)
+		}
+		w.body.WriteString("</g>\n")
+	}
+
+	var doc bytes.Buffer
+	doc.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&doc, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		svgNumber(area.Width()), svgNumber(area.Height()), svgNumber(area.MinX), svgNumber(area.MinY), svgNumber(area.Width()), svgNumber(area.Height()))
+	if w.defs.Len() > 0 {
+		doc.WriteString("<defs>\n" + w.defs.String() + "</defs>\n")
+	}
+	doc.WriteString(w.body.String())
+	doc.WriteString("</svg>\n")
+	return doc.Bytes()
+}
+
+// commonAttributes writes the identity, transform and effects of an element
+func (w *svgWriter) commonAttributes(shape VectorShape) string {
+	var attrs strings.Builder
+	if shape.ID != "" {
+		fmt.Fprintf(&attrs, ` id="%s"`, svgEscaper.Replace(shape.ID))
+	}
+	if m := shape.Transform; m != nil {
+		fmt.Fprintf(&attrs, ` transform="matrix(%s %s %s %s %s %s)"`,
+			svgNumber(m.A), svgNumber(m.B), svgNumber(m.C), svgNumber(m.D), svgNumber(m.E), svgNumber(m.F))
+	}
+	if shape.Shadow != nil {
+		id := w.nextID("shadow")
+		fmt.Fprintf(&w.defs, `<filter id="%s" x="-50%%" y="-50%%" width="200%%" height="200%%"><feDropShadow dx="%s" dy="%s" stdDeviation="%s" flood-color="%s"/></filter>`+"\n",
+			id, svgNumber(shape.Shadow.OffsetX), svgNumber(shape.Shadow.OffsetY), svgNumber(shape.Shadow.Blur/2), svgEscaper.Replace(shape.Shadow.Color))
+		fmt.Fprintf(&attrs, ` filter="url(#%s)"`, id)
+	}
+	if mode := shape.EffectiveBlendMode(); mode != "normal" {
+		fmt.Fprintf(&attrs, ` style="mix-blend-mode:%s"`, svgEscaper.Replace(mode))
+	}
+	return attrs.String()
+}
+
+// paintAttributes writes the stroke and fill of an element, filled tells whether its fill paints anything
+func (w *svgWriter) paintAttributes(shape VectorShape, filled bool) string {
+	var attrs strings.Builder
+	stroke := shape.Stroke
+	if stroke == "" {
+		stroke = "none"
+	}
+	fmt.Fprintf(&attrs, ` stroke="%s"`, svgEscaper.Replace(stroke))
+	if stroke != "none" {
+		fmt.Fprintf(&attrs, ` stroke-width="%s"`, svgNumber(shape.StrokeWidth))
+		if opacity := shape.EffectiveStrokeOpacity(); opacity < 1 {
+			fmt.Fprintf(&attrs, ` stroke-opacity="%s"`, svgNumber(opacity))
+		}
+		if len(shape.StrokeDasharray) > 0 {
+			dashes := make([]string, len(shape.StrokeDasharray))
+			for i, dash := range shape.StrokeDasharray {
+				dashes[i] = svgNumber(dash)
+			}
+			fmt.Fprintf(&attrs, ` stroke-dasharray="%s"`, strings.Join(dashes, " "))
+		}
+		if shape.LineCap != "" {
+			fmt.Fprintf(&attrs, ` stroke-linecap="%s"`, svgEscaper.Replace(shape.LineCap))
+		}
+		if shape.LineJoin != "" {
+			fmt.Fprintf(&attrs, ` stroke-linejoin="%s"`, svgEscaper.Replace(shape.LineJoin))
+		}
+	}
+
+	switch {
+	case !filled || !isFilled(shape):
+		attrs.WriteString(` fill="none"`)
+	case shape.FillGradient != nil:
+		fmt.Fprintf(&attrs, ` fill="url(#%s)"`, w.gradient(shape.FillGradient))
+	default:
+		fmt.Fprintf(&attrs, ` fill="%s"`, svgEscaper.Replace(shape.Fill))
+	}
+	if opacity := shape.EffectiveFillOpacity(); filled && opacity < 1 {
+		fmt.Fprintf(&attrs, ` fill-opacity="%s"`, svgNumber(opacity))
+	}
+	return attrs.String()
+}
+
+// gradient defines a gradient fill, in fractions of the element box like the stored ones
+func (w *svgWriter) gradient(g *Gradient) string {
+	id := w.nextID("gradient")
+	if g.Type == GradientRadial {
+		fmt.Fprintf(&w.defs, `<radialGradient id="%s" cx="%s" cy="%s" r="%s">`, id, svgNumber(g.CX), svgNumber(g.CY), svgNumber(g.R))
+	} else {
+		fmt.Fprintf(&w.defs, `<linearGradient id="%s" x1="%s" y1="%s" x2="%s" y2="%s">`, id, svgNumber(g.X1), svgNumber(g.Y1), svgNumber(g.X2), svgNumber(g.Y2))
+	}
+	for _, stop := range g.Stops {
+		fmt.Fprintf(&w.defs, `<stop offset="%s" stop-color="%s"/>`, svgNumber(stop.Offset), svgEscaper.Replace(stop.Color))
+	}
+	if g.Type == GradientRadial {
+		w.defs.WriteString("</radialGradient>\n")
+	} else {
+		w.defs.WriteString("</linearGradient>\n")
+	}
+	return id
+}
+
+// pathData returns the SVG path commands of a path, its curves included
+func pathData(path VectorPath) string {
+	if len(path.Points) == 0 {
+		return ""
+	}
+	var d strings.Builder
+	fmt.Fprintf(&d, "M%s %s", svgNumber(path.Points[0].X), svgNumber(path.Points[0].Y))
+	curved := len(path.Segments) == segmentCount(path)
+	for i := 0; i < segmentCount(path); i++ {
+		to := path.Points[(i+1)%len(path.Points)]
+		if curved {
+			s := path.Segments[i]
+			fmt.Fprintf(&d, " C%s %s %s %s %s %s", svgNumber(s.C1.X), svgNumber(s.C1.Y), svgNumber(s.C2.X), svgNumber(s.C2.Y), svgNumber(to.X), svgNumber(to.Y))
+		} else if !path.Closed || i < len(path.Points)-1 {
+			fmt.Fprintf(&d, " L%s %s", svgNumber(to.X), svgNumber(to.Y))
+		}
+	}
+	if path.Closed {
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+func (w *svgWriter) element(element VectorElement) {
+	shape, ok := ElementShape(element)
+	if !ok {
+		return
+	}
+	href, linked := actionHref(shape.Action)
+	if linked {
+		fmt.Fprintf(&w.body, `<a href="%s">`, svgEscaper.Replace(href))
+	}
+	common := w.commonAttributes(shape)
+
+	switch e := element.(type) {
+	case VectorPath:
+		if d := pathData(e); d != "" {
+			fmt.Fprintf(&w.body, `<path%s d="%s"%s/>`, common, d, w.paintAttributes(e.VectorShape, e.Closed))
+		}
+	case VectorRectangle:
+		fmt.Fprintf(&w.body, `<rect%s x="%s" y="%s" width="%s" height="%s"%s/>`, common,
+			svgNumber(e.X), svgNumber(e.Y), svgNumber(e.Width), svgNumber(e.Height), w.paintAttributes(e.VectorShape, true))
+	case VectorCircle:
+		fmt.Fprintf(&w.body, `<circle%s cx="%s" cy="%s" r="%s"%s/>`, common,
+			svgNumber(e.CX), svgNumber(e.CY), svgNumber(e.Radius), w.paintAttributes(e.VectorShape, true))
+	case VectorEllipse:
+		fmt.Fprintf(&w.body, `<ellipse%s cx="%s" cy="%s" rx="%s" ry="%s"%s/>`, common,
+			svgNumber(e.CX), svgNumber(e.CY), svgNumber(e.RX), svgNumber(e.RY), w.paintAttributes(e.VectorShape, true))
+	case VectorLine:
+		fmt.Fprintf(&w.body, `<line%s x1="%s" y1="%s" x2="%s" y2="%s"%s/>`, common,
+			svgNumber(e.X1), svgNumber(e.Y1), svgNumber(e.X2), svgNumber(e.Y2), w.paintAttributes(e.VectorShape, false))
+	case VectorPolyline:
+		fmt.Fprintf(&w.body, `<polyline%s points="%s"%s/>`, common, svgPoints(e.Points), w.paintAttributes(e.VectorShape, false))
+	case VectorPolygon:
+		fmt.Fprintf(&w.body, `<polygon%s points="%s"%s/>`, common, svgPoints(e.Points), w.paintAttributes(e.VectorShape, true))
+	case VectorArrow:
+		w.arrow(e, common)
+	case VectorText:
+		w.text(e, common)
+	case VectorImage:
+		if w.options.ImageHref != nil {
+			if source, found := w.options.ImageHref(e.AssetID); found {
+				fmt.Fprintf(&w.body, `<image%s x="%s" y="%s" width="%s" height="%s" preserveAspectRatio="none" href="%s" xlink:href="%s"/>`, common,
+					svgNumber(e.X), svgNumber(e.Y), svgNumber(e.Width), svgNumber(e.Height), svgEscaper.Replace(source), svgEscaper.Replace(source))
+			}
+		}
+	case VectorGroup:
+		fmt.Fprintf(&w.body, "<g%s>\n", common)
+		for _, child := range e.Children {
+			w.element(child)
+		}
+		w.body.WriteString("</g>")
+	}
+
+	if linked {
+		w.body.WriteString("</a>")
+	}
+	w.body.WriteString("\n")
+}
+
+// arrow draws the line of an arrow then its heads, in the stroke color
+func (w *svgWriter) arrow(a VectorArrow, common string) {
+	start, end := Point{X: a.X1, Y: a.Y1}, Point{X: a.X2, Y: a.Y2}
+	line := a.VectorShape
+	fmt.Fprintf(&w.body, `<g%s>`, common)
+	fmt.Fprintf(&w.body, `<line x1="%s" y1="%s" x2="%s" y2="%s"%s/>`,
+		svgNumber(a.X1), svgNumber(a.Y1), svgNumber(a.X2), svgNumber(a.Y2), w.paintAttributes(line, false))
+
+	// heads are filled with the stroke color and drawn without dashes
+	head := a.VectorShape
+	head.Fill, head.FillGradient, head.FillOpacity, head.StrokeDasharray = a.Stroke, nil, a.StrokeOpacity, nil
+	size := arrowHeadSize(a)
+	for _, h := range []struct {
+		style    string
+		tip, end Point
+	}{{a.StartHead, start, end}, {a.EndHead, end, start}} {
+		outline, ok := arrowHeadShape(h.style, h.tip, h.end, size)
+		switch {
+		case !ok:
+		case outline.Circle:
+			fmt.Fprintf(&w.body, `<circle cx="%s" cy="%s" r="%s"%s/>`,
+				svgNumber(outline.Center.X), svgNumber(outline.Center.Y), svgNumber(outline.Radius), w.paintAttributes(head, true))
+		case outline.Closed:
+			fmt.Fprintf(&w.body, `<polygon points="%s"%s/>`, svgPoints(outline.Points), w.paintAttributes(head, true))
+		default:
+			fmt.Fprintf(&w.body, `<polyline points="%s"%s/>`, svgPoints(outline.Points), w.paintAttributes(head, false))
+		}
+	}
+	w.body.WriteString("</g>")
+}
+
+// textAnchor returns the SVG anchor of an alignment and the x coordinate it applies to
+func textAnchor(t VectorText) (string, float64) {
+	width, _ := textBox(t)
+	switch t.Align {
+	case TextAlignCenter:
+		return "middle", t.X + width/2
+	case TextAlignRight:
+		return "end", t.X + width
+	}
+	return "start", t.X
+}
+
+// textBaseline returns the baseline of a line of a text element, whose position is the top of its box
+func textBaseline(t VectorText, line int) float64 {
+	lineHeight := t.FontSize * t.LineHeight
+	return t.Y + float64(line)*lineHeight + (lineHeight-t.FontSize)/2 + t.FontSize*0.8
+}
+
+func (w *svgWriter) text(t VectorText, common string) {
+	anchor, x := textAnchor(t)
+	fmt.Fprintf(&w.body, `<text%s text-anchor="%s" font-family="%s" font-size="%s" font-weight="%s" fill="%s">`, common,
+		anchor, svgEscaper.Replace(t.FontFamily), svgNumber(t.FontSize), svgEscaper.Replace(t.FontWeight), svgEscaper.Replace(t.Color))
+	for i, line := range textLines(t) {
+		if len(line) == 0 {
+			continue
+		}
+		fmt.Fprintf(&w.body, `<tspan x="%s" y="%s">`, svgNumber(x), svgNumber(textBaseline(t, i)))
+		for _, run := range line {
+			w.body.WriteString("<tspan")
+			if run.FontFamily != t.FontFamily {
+				fmt.Fprintf(&w.body, ` font-family="%s"`, svgEscaper.Replace(run.FontFamily))
+			}
+			if run.FontSize != t.FontSize {
+				fmt.Fprintf(&w.body, ` font-size="%s"`, svgNumber(run.FontSize))
+			}
+			if run.FontWeight != t.FontWeight {
+				fmt.Fprintf(&w.body, ` font-weight="%s"`, svgEscaper.Replace(run.FontWeight))
+			}
+			if run.Color != t.Color {
+				fmt.Fprintf(&w.body, ` fill="%s"`, svgEscaper.Replace(run.Color))
+			}
+			if run.Italic {
+				w.body.WriteString(` font-style="italic"`)
+			}
+			decorations := []string{}
+			if run.Underline {
+				decorations = append(decorations, "underline")
+			}
+			if run.Strikethrough {
+				decorations = append(decorations, "line-through")
+			}
+			if len(decorations) > 0 {
+				fmt.Fprintf(&w.body, ` text-decoration="%s"`, strings.Join(decorations, " "))
+			}
+			fmt.Fprintf(&w.body, ">%s</tspan>", svgEscaper.Replace(run.Text))
+		}
+		w.body.WriteString("</tspan>")
+	}
+	w.body.WriteString("</text>")
+}
+
+// canvasSnapshot copies a canvas so that it can be exported without holding the canvas service lock
+func (c *CanvasService) canvasSnapshot(canvasId string) (Canvas, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return Canvas{}, false
+	}
+	return canvas.snapshot(), true
+}
+
+// ExportSVG renders a canvas as a standalone SVG document, false when the canvas does not exist
+func (c *CanvasService) ExportSVG(canvasId string, options SVGOptions) ([]byte, bool) {
+	canvas, exists := c.canvasSnapshot(canvasId)
+	if !exists {
+		return nil, false
+	}
+	return RenderSVG(canvas.VectorData, options), true
+}
+
+// ExportArchive zips the export of every canvas in page order, named after their IDs with the given extension
+func (c *CanvasService) ExportArchive(extension string, export func(canvasId string) ([]byte, bool)) ([]byte, error) {
+	ids := c.ListCanvasIDs()
+	var archive bytes.Buffer
+	writer := zip.NewWriter(&archive)
+	names := make(map[string]bool)
+	for _, id := range ids {
+		data, exists := export(id)
+		if !exists {
+			continue
+		}
+		name := archiveName(id)
+		for i := 2; names[name]; i++ {
+			name = fmt.Sprintf("%s-%d", archiveName(id), i)
+		}
+		names[name] = true
+		file, err := writer.Create(name + "." + extension)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := file.Write(data); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return archive.Bytes(), nil
+}
+
+// archiveName keeps the characters of a canvas ID which are safe in a file name
+func archiveName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" {
+		return "canvas"
+	}
+	return name
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+// wellFormed decodes an XML document to the end
+func wellFormed(t *testing.T, data []byte) {
+	t.Helper()
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("Invalid SVG: %v\n%s", err, data)
+		}
+	}
+}
+
+func TestRenderSVG(t *testing.T) {
+	opacity := 0.5
+	m := Translate(5, 5)
+	v := VectorData{
+		Width:          200,
+		Height:         100,
+		BackgroundFill: "#ffffff",
+		Elements: []VectorElement{
+			VectorPath{VectorShape: VectorShape{ID: "p", Stroke: "#000", StrokeWidth: 2}, Type: "path", Points: []Point{{0, 0}, {10, 10}}},
+			VectorRectangle{VectorShape: VectorShape{ID: "r", Fill: "red", FillOpacity: &opacity, Action: Action{Type: "link", Link: "https://example.com/?a=1&b=2"}}, Type: "rectangle", X: 1, Y: 2, Width: 3, Height: 4},
+			VectorCircle{VectorShape: VectorShape{ID: "c", Fill: "blue", FillGradient: &Gradient{Type: GradientLinear, X2: 1, Stops: []GradientStop{{0, "red"}, {1, "blue"}}}}, Type: "circle", CX: 50, CY: 50, Radius: 10},
+			VectorArrow{VectorShape: VectorShape{ID: "a", Stroke: "green", StrokeWidth: 1}, Type: "arrow", X2: 100, EndHead: ArrowHeadTriangle, HeadSize: 10},
+			VectorText{VectorShape: VectorShape{ID: "t"}, Type: "text", Text: "a < b\nsecond", FontFamily: "serif", FontSize: 10, FontWeight: "normal", LineHeight: 1, Color: "#000"},
+			VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &m}, Type: "group", Children: []VectorElement{rect("inner", 0, 0)}},
+			VectorRectangle{VectorShape: VectorShape{ID: "js", Action: Action{Link: "javascript:alert(1)"}}, Type: "rectangle"},
+		},
+	}
+	svg := RenderSVG(v, SVGOptions{})
+	wellFormed(t, svg)
+	doc := string(svg)
+
+	for _, want := range []string{
+		`viewBox="0 0 200 100"`,
+		`<rect x="0" y="0" width="200" height="100" fill="#ffffff"/>`,
+		`<path id="p" d="M0 0 L10 10" stroke="#000" stroke-width="2" fill="none"/>`,
+		`<a href="https://example.com/?a=1&amp;b=2"><rect id="r"`,
+		`fill="red" fill-opacity="0.5"`,
+		`fill="url(#phaint-gradient-1)"`,
+		`<linearGradient id="phaint-gradient-1"`,
+		`<polygon points="100,0 90,5 90,-5"`,
+		`>a &lt; b</tspan>`,
+		`<g id="g" transform="matrix(1 0 0 1 5 5)">`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected %s in\n%s", want, doc)
+		}
+	}
+	if strings.Contains(doc, "javascript") {
+		t.Error("Expected script links to be left out")
+	}
+}
+
+func TestRenderSVGLayersAndImages(t *testing.T) {
+	v := VectorData{
+		Layers: []Layer{
+			{ID: "hidden", Name: "Hidden", Visible: false, Opacity: 1},
+			{ID: "faded", Name: "Faded", Visible: true, Opacity: 0.25},
+		},
+		Elements: []VectorElement{
+			onLayer(rect("secret", 0, 0), "hidden"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "img"}, Type: "image", X: 10, Y: 10, Width: 20, Height: 20, AssetID: "a1"}, "faded"),
+			onLayer(VectorImage{VectorShape: VectorShape{ID: "missing"}, Type: "image", Width: 5, Height: 5, AssetID: "a2"}, "faded"),
+		},
+	}
+	svg := RenderSVG(v, SVGOptions{ImageHref: func(assetId string) (string, bool) {
+		return "data:image/png;base64,AAAA", assetId == "a1"
+	}})
+	wellFormed(t, svg)
+	doc := string(svg)
+	if strings.Contains(doc, "secret") || strings.Contains(doc, "missing") {
+		t.Errorf("Expected hidden layers and unresolved images to be left out\n%s", doc)
+	}
+	if !strings.Contains(doc, `<g opacity="0.25">`) || !strings.Contains(doc, `href="data:image/png;base64,AAAA"`) {
+		t.Errorf("Expected the faded layer and its image\n%s", doc)
+	}
+	// without a size the canvas is cropped to its visible content
+	if !strings.Contains(doc, `viewBox="0 0 30 30"`) {
+		t.Errorf("Expected the content box as view box\n%s", doc)
+	}
+}
+
+func TestPathData(t *testing.T) {
+	closed := VectorPath{Points: []Point{{0, 0}, {10, 0}, {10, 10}}, Closed: true}
+	if d := pathData(closed); d != "M0 0 L10 0 L10 10 Z" {
+		t.Errorf("Unexpected closed path %q", d)
+	}
+	curved := VectorPath{Points: []Point{{0, 0}, {10, 0}}, Segments: []BezierSegment{{C1: Point{X: 0, Y: 5}, C2: Point{X: 10, Y: 5}}}}
+	if d := pathData(curved); d != "M0 0 C0 5 10 5 10 0" {
+		t.Errorf("Unexpected curved path %q", d)
+	}
+}
+
+func TestExportArchive(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0))
+	cs.AddOrUpdateCanvas(Canvas{ID: "c/2", VectorData: VectorData{Width: 10, Height: 10}})
+	data, err := cs.ExportArchive("svg", func(canvasId string) ([]byte, bool) {
+		return cs.ExportSVG(canvasId, SVGOptions{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+	}
+	if !sameIDs(names, "c1.svg", "c_2.svg") {
+		t.Errorf("Unexpected archive content %v", names)
+	}
+	if _, exists := cs.ExportSVG("missing", SVGOptions{}); exists {
+		t.Error("Expected no export of a missing canvas")
+	}
+}
@@ -0,0 +1,951 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxImportedElements bounds the elements created by an SVG import
+const MaxImportedElements = 10000
+
+// MaxSVGDepth bounds the nesting of groups and links, which are read recursively
+const MaxSVGDepth = 256
+
+const svgNamespace = "http://www.w3.org/2000/svg"
+
+var (
+	ErrNotSVG             = errors.New("the file is not an SVG document")
+	ErrTooManySVGElements = fmt.Errorf("the document has more than %d shapes", MaxImportedElements)
+	ErrSVGTooDeep         = fmt.Errorf("the document nests more than %d groups", MaxSVGDepth)
+)
+
+// SVGImport is the artwork read from an SVG document
+type SVGImport struct {
+	// Width and Height are the size of the document in canvas units, 0 when it has none
+	Width    float64
+	Height   float64
+	Elements []VectorElement
+	// Unsupported describes what was left out or approximated, with the number of occurrences
+	Unsupported []string
+}
+
+// svgState is what an element inherits from its ancestors
+type svgState struct {
+	matrix        Matrix
+	fill          string
+	stroke        string
+	color         string
+	strokeWidth   float64
+	fillOpacity   float64
+	strokeOpacity float64
+	// opacity gathers the opacity of the ancestors, applied to both the fill and the stroke
+	opacity  float64
+	dashes   []float64
+	lineCap  string
+	lineJoin string
+	hidden   bool
+	action   Action
+	// depth counts the groups and links the element is in
+	depth int
+}
+
+type svgImporter struct {
+	prefix      string
+	ids         int
+	elements    []VectorElement
+	unsupported map[string]int
+}
+
+// ImportSVG reads the shapes of an SVG document: paths, rectangles, circles, ellipses, lines, polylines and
+// polygons, with their transforms, their groups flattened and their basic styles. Other constructs are
+// reported. Elements get IDs made of idPrefix and a counter
+func ImportSVG(r io.Reader, idPrefix string) (SVGImport, error) {
+	decoder := xml.NewDecoder(r)
+	// only markup is imported, the encoding of text content does not matter
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	im := &svgImporter{prefix: idPrefix, unsupported: make(map[string]int)}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return SVGImport{}, ErrNotSVG
+		}
+		if err != nil {
+			return SVGImport{}, fmt.Errorf("invalid SVG document: %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "svg" || (start.Name.Space != "" && start.Name.Space != svgNamespace) {
+			return SVGImport{}, ErrNotSVG
+		}
+
+		result := SVGImport{}
+		state := svgState{matrix: Identity(), fill: "black", color: "black", strokeWidth: 1, fillOpacity: 1, strokeOpacity: 1, opacity: 1}
+		result.Width, result.Height, state.matrix = im.viewport(start)
+		state, visible := im.inherit(state, start, true)
+		if visible {
+			if err := im.children(decoder, state); err != nil {
+				return SVGImport{}, err
+			}
+		}
+		result.Elements = im.elements
+		result.Unsupported = im.report()
+		return result, nil
+	}
+}
+
+// report lists the unsupported constructs in a stable order
+func (im *svgImporter) report() []string {
+	report := make([]string, 0, len(im.unsupported))
+	for what, count := range im.unsupported {
+		if count > 1 {
+			what = fmt.Sprintf("%s (%d)", what, count)
+		}
+		report = append(report, what)
+	}
+	sort.Strings(report)
+	return report
+}
+
+func (im *svgImporter) unsupportedf(format string, args ...interface{}) {
+	im.unsupported[fmt.Sprintf(format, args...)]++
+}
+
+func (im *svgImporter) nextID() string {
+	im.ids++
+	return fmt.Sprintf("%s-%d", im.prefix, im.ids)
+}
+
+// viewport reads the size of the root element and the transform of its view box
+func (im *svgImporter) viewport(root xml.StartElement) (float64, float64, Matrix) {
+	width, widthOk := im.length(root, "width", 0)
+	height, heightOk := im.length(root, "height", 0)
+	box := svgNumbers(svgAttr(root, "viewBox"))
+	if len(box) != 4 || box[2] <= 0 || box[3] <= 0 {
+		if widthOk && heightOk {
+			return width, height, Identity()
+		}
+		return 0, 0, Identity()
+	}
+	if !widthOk || width <= 0 {
+		width = box[2]
+	}
+	if !heightOk || height <= 0 {
+		height = box[3]
+	}
+	if strings.HasPrefix(strings.TrimSpace(svgAttr(root, "preserveAspectRatio")), "none") {
+		return width, height, Matrix{A: width / box[2], D: height / box[3]}.Multiply(Translate(-box[0], -box[1]))
+	}
+	// other alignments are read as the default one, the view box centered and scaled uniformly
+	scale := math.Min(width/box[2], height/box[3])
+	return width, height, Translate((width-box[2]*scale)/2, (height-box[3]*scale)/2).Multiply(Matrix{A: scale, D: scale}).Multiply(Translate(-box[0], -box[1]))
+}
+
+// children reads the content of an element up to its end
+func (im *svgImporter) children(decoder *xml.Decoder, state svgState) error {
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid SVG document: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if err := im.element(decoder, t, state); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (im *svgImporter) element(decoder *xml.Decoder, start xml.StartElement, parent svgState) error {
+	// elements of editors' own namespaces only hold their metadata
+	if start.Name.Space != "" && start.Name.Space != svgNamespace {
+		return decoder.Skip()
+	}
+	name := start.Name.Local
+	switch name {
+	case "g", "a":
+		state, visible := im.inherit(parent, start, true)
+		if !visible {
+			return decoder.Skip()
+		}
+		if state.depth++; state.depth > MaxSVGDepth {
+			return ErrSVGTooDeep
+		}
+		if name == "a" {
+			if href, ok := actionHref(Action{Link: svgHref(start)}); ok {
+				state.action = Action{Type: "link", Link: href}
+			}
+		}
+		return im.children(decoder, state)
+	case "path", "rect", "circle", "ellipse", "line", "polyline", "polygon":
+		state, visible := im.inherit(parent, start, false)
+		if visible {
+			im.shape(start, state)
+		}
+		if len(im.elements) > MaxImportedElements {
+			return ErrTooManySVGElements
+		}
+		return decoder.Skip()
+	case "title", "desc", "metadata", "defs":
+		// definitions are only drawn where they are used, which is reported
+		return decoder.Skip()
+	case "linearGradient", "radialGradient", "pattern", "clipPath", "mask", "marker", "filter", "symbol", "style":
+		if name == "style" {
+			im.unsupportedf("<style> sheets")
+		}
+		return decoder.Skip()
+	}
+	im.unsupportedf("<%s> elements", name)
+	return decoder.Skip()
+}
+
+func svgAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name && (attr.Name.Space == "" || attr.Name.Space == svgNamespace) {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// svgHref reads a link, plain or in the xlink namespace
+func svgHref(start xml.StartElement) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == "href" {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// svgProperties returns the style of an element, its style attribute overriding its presentation attributes
+func svgProperties(start xml.StartElement) map[string]string {
+	properties := make(map[string]string)
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "" && attr.Name.Local != "style" {
+			properties[attr.Name.Local] = strings.TrimSpace(attr.Value)
+		}
+	}
+	for _, declaration := range strings.Split(svgAttr(start, "style"), ";") {
+		name, value, found := strings.Cut(declaration, ":")
+		if found {
+			value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+			properties[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return properties
+}
+
+// inherit applies the transform and the style of an element to the state of its parent, false when the
+// element is not displayed
+func (im *svgImporter) inherit(state svgState, start xml.StartElement, container bool) (svgState, bool) {
+	properties := svgProperties(start)
+	if properties["display"] == "none" {
+		return state, false
+	}
+	if transform, ok := properties["transform"]; ok && start.Name.Local != "svg" {
+		m, valid := parseSVGTransform(transform)
+		if !valid {
+			im.unsupportedf("transform %q", transform)
+		}
+		state.matrix = state.matrix.Multiply(m)
+	}
+	// the current color is known before the paints using it
+	if color := properties["color"]; color != "" && color != "inherit" && ValidColor(color) {
+		state.color = color
+	}
+
+	for property, value := range properties {
+		if value == "inherit" || value == "" {
+			continue
+		}
+		switch property {
+		case "fill", "stroke":
+			paint := im.paint(value, state.color)
+			if property == "fill" {
+				state.fill = paint
+			} else {
+				state.stroke = paint
+			}
+		case "stroke-width":
+			if width, ok := im.parseLength(value); ok && width >= 0 {
+				state.strokeWidth = width
+			}
+		case "fill-opacity", "stroke-opacity", "opacity":
+			opacity, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil {
+				continue
+			}
+			if strings.HasSuffix(value, "%") {
+				opacity /= 100
+			}
+			opacity = math.Max(0, math.Min(1, opacity))
+			switch property {
+			case "fill-opacity":
+				state.fillOpacity = opacity
+			case "stroke-opacity":
+				state.strokeOpacity = opacity
+			default:
+				state.opacity *= opacity
+			}
+		case "stroke-dasharray":
+			state.dashes = nil
+			if value != "none" {
+				dashes := svgNumbers(value)
+				// patterns too short to show are drawn solid, as SVG draws the ones summing to zero
+				if len(dashes) > 0 && !slicesContainNegative(dashes) && sum(dashes) >= MinDashPattern {
+					state.dashes = dashes
+				}
+			}
+		case "stroke-linecap":
+			state.lineCap = value
+		case "stroke-linejoin":
+			if value == "miter-clip" || value == "arcs" {
+				value = LineJoinMiter
+			}
+			state.lineJoin = value
+		case "visibility":
+			state.hidden = value == "hidden" || value == "collapse"
+		case "mix-blend-mode":
+			if container && value != "normal" {
+				im.unsupportedf("blend modes of groups")
+			}
+		case "filter", "clip-path", "mask", "marker-start", "marker-mid", "marker-end":
+			if value != "none" {
+				im.unsupportedf("%s", property)
+			}
+		case "fill-rule":
+			if value == "evenodd" {
+				im.unsupportedf("even-odd fill rule")
+			}
+		}
+	}
+	return state, true
+}
+
+func slicesContainNegative(values []float64) bool {
+	for _, v := range values {
+		if v < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+// paint reads a fill or a stroke, "" standing for none
+func (im *svgImporter) paint(value string, currentColor string) string {
+	switch {
+	case value == "none":
+		return ""
+	case value == "currentColor":
+		return currentColor
+	case strings.HasPrefix(value, "url("):
+		im.unsupportedf("gradient and pattern paints")
+		// a fallback color may follow the reference
+		if fallback := strings.TrimSpace(value[strings.Index(value, ")")+1:]); fallback != "" {
+			return im.paint(fallback, currentColor)
+		}
+		return ""
+	case ValidColor(value):
+		return value
+	}
+	im.unsupportedf("color %q", value)
+	return ""
+}
+
+// shapeOf returns the shared fields of an imported element, filled tells whether its fill can paint anything
+func (im *svgImporter) shapeOf(state svgState, filled bool) VectorShape {
+	shape := VectorShape{ID: im.nextID(), Action: state.action}
+	if state.matrix != Identity() {
+		m := state.matrix
+		shape.Transform = &m
+	}
+	if filled {
+		shape.Fill = state.fill
+		if opacity := state.fillOpacity * state.opacity; opacity < 1 && shape.Fill != "" {
+			shape.FillOpacity = &opacity
+		}
+	}
+	if state.stroke != "" && state.strokeWidth > 0 {
+		shape.Stroke = state.stroke
+		shape.StrokeWidth = state.strokeWidth
+		if opacity := state.strokeOpacity * state.opacity; opacity < 1 {
+			shape.StrokeOpacity = &opacity
+		}
+		shape.StrokeDasharray = state.dashes
+		if state.lineCap != LineCapButt {
+			shape.LineCap = state.lineCap
+		}
+		if state.lineJoin != LineJoinMiter {
+			shape.LineJoin = state.lineJoin
+		}
+	}
+	if err := shape.Style().Validate(); err != nil {
+		im.unsupportedf("style: %v", err)
+		shape.StrokeDasharray, shape.LineCap, shape.LineJoin = nil, "", ""
+	}
+	return shape
+}
+
+// shape converts a drawing element, leaving out the ones which draw nothing
+func (im *svgImporter) shape(start xml.StartElement, state svgState) {
+	if state.hidden {
+		return
+	}
+	length := func(name string) float64 {
+		v, _ := im.length(start, name, 0)
+		return v
+	}
+	blend := svgProperties(start)["mix-blend-mode"]
+	add := func(element VectorElement) {
+		if blend != "" && blend != "normal" && blendModes[blend] {
+			element = updateShape(element, func(shape *VectorShape) {
+				shape.BlendMode = blend
+			})
+		}
+		if err := ValidateStyle(element); err != nil {
+			im.unsupportedf("<%s> elements with invalid styles", start.Name.Local)
+			return
+		}
+		im.elements = append(im.elements, element)
+	}
+
+	switch start.Name.Local {
+	case "path":
+		paths, valid := parsePathData(svgAttr(start, "d"))
+		if !valid {
+			im.unsupportedf("malformed path data, drawn up to the error")
+		}
+		for _, path := range paths {
+			path.VectorShape = im.shapeOf(state, true)
+			add(path)
+		}
+	case "rect":
+		x, y, width, height := length("x"), length("y"), length("width"), length("height")
+		if width <= 0 || height <= 0 {
+			return
+		}
+		rx, rxOk := im.length(start, "rx", 0)
+		ry, ryOk := im.length(start, "ry", 0)
+		if !rxOk {
+			rx = ry
+		}
+		if !ryOk {
+			ry = rx
+		}
+		rx, ry = math.Min(math.Max(rx, 0), width/2), math.Min(math.Max(ry, 0), height/2)
+		if rx > 0 && ry > 0 {
+			path := roundedRectangle(x, y, width, height, rx, ry)
+			path.VectorShape = im.shapeOf(state, true)
+			add(path)
+			return
+		}
+		add(VectorRectangle{VectorShape: im.shapeOf(state, true), Type: "rectangle", X: x, Y: y, Width: width, Height: height})
+	case "circle":
+		if r := length("r"); r > 0 {
+			add(VectorCircle{VectorShape: im.shapeOf(state, true), Type: "circle", CX: length("cx"), CY: length("cy"), Radius: r})
+		}
+	case "ellipse":
+		rx, rxOk := im.length(start, "rx", 0)
+		ry, ryOk := im.length(start, "ry", 0)
+		if !rxOk {
+			rx = ry
+		}
+		if !ryOk {
+			ry = rx
+		}
+		if rx > 0 && ry > 0 {
+			add(VectorEllipse{VectorShape: im.shapeOf(state, true), Type: "ellipse", CX: length("cx"), CY: length("cy"), RX: rx, RY: ry})
+		}
+	case "line":
+		add(VectorLine{VectorShape: im.shapeOf(state, false), Type: "line", X1: length("x1"), Y1: length("y1"), X2: length("x2"), Y2: length("y2")})
+	case "polyline", "polygon":
+		numbers := svgNumbers(svgAttr(start, "points"))
+		points := make([]Point, 0, len(numbers)/2)
+		for i := 0; i+1 < len(numbers); i += 2 {
+			points = append(points, Point{X: numbers[i], Y: numbers[i+1]})
+		}
+		if len(points) < 2 {
+			return
+		}
+		if start.Name.Local == "polygon" {
+			add(VectorPolygon{VectorShape: im.shapeOf(state, true), Type: "polygon", Points: points})
+		} else {
+			add(VectorPolyline{VectorShape: im.shapeOf(state, false), Type: "polyline", Points: points})
+		}
+	}
+}
+
+// svgLengthUnits converts lengths to canvas units, which are CSS pixels
+var svgLengthUnits = map[string]float64{
+	"": 1, "px": 1, "pt": 96.0 / 72, "pc": 16, "mm": 96 / 25.4, "cm": 96 / 2.54, "in": 96,
+}
+
+// parseLength reads a length in canvas units, relative lengths are reported
+func (im *svgImporter) parseLength(value string) (float64, bool) {
+	value = strings.TrimSpace(value)
+	end := len(value)
+	for end > 0 && (value[end-1] >= 'a' && value[end-1] <= 'z' || value[end-1] == '%') {
+		end--
+	}
+	unit, known := svgLengthUnits[value[end:]]
+	number, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, false
+	}
+	if !known {
+		im.unsupportedf("%s lengths", value[end:])
+		return 0, false
+	}
+	return number * unit, true
+}
+
+// length reads a length attribute, false when it is missing or cannot be read
+func (im *svgImporter) length(start xml.StartElement, name string, fallback float64) (float64, bool) {
+	value := svgAttr(start, name)
+	if value == "" {
+		return fallback, false
+	}
+	if v, ok := im.parseLength(value); ok {
+		return v, true
+	}
+	return fallback, false
+}
+
+// roundedRectangle draws a rectangle with elliptic corners as a closed path
+func roundedRectangle(x, y, width, height, rx, ry float64) VectorPath {
+	b := &pathBuilder{}
+	b.moveTo(Point{X: x + rx, Y: y})
+	b.lineTo(Point{X: x + width - rx, Y: y})
+	b.arcTo(rx, ry, 0, false, true, Point{X: x + width, Y: y + ry})
+	b.lineTo(Point{X: x + width, Y: y + height - ry})
+	b.arcTo(rx, ry, 0, false, true, Point{X: x + width - rx, Y: y + height})
+	b.lineTo(Point{X: x + rx, Y: y + height})
+	b.arcTo(rx, ry, 0, false, true, Point{X: x, Y: y + height - ry})
+	b.lineTo(Point{X: x, Y: y + ry})
+	b.arcTo(rx, ry, 0, false, true, Point{X: x + rx, Y: y})
+	b.close()
+	return b.paths[0]
+}
+
+// svgScanner reads the numbers and commands of path data, points lists and transforms
+type svgScanner struct {
+	s string
+	i int
+}
+
+func (s *svgScanner) skipSeparators() {
+	for s.i < len(s.s) && strings.IndexByte(" \t\r\n,", s.s[s.i]) >= 0 {
+		s.i++
+	}
+}
+
+func (s *svgScanner) done() bool {
+	s.skipSeparators()
+	return s.i >= len(s.s)
+}
+
+// number reads a number, "1.5.5" being two numbers and "1-2" as well
+func (s *svgScanner) number() (float64, bool) {
+	s.skipSeparators()
+	start := s.i
+	if s.i < len(s.s) && (s.s[s.i] == '+' || s.s[s.i] == '-') {
+		s.i++
+	}
+	digits, dot := false, false
+	for s.i < len(s.s) {
+		c := s.s[s.i]
+		switch {
+		case c >= '0' && c <= '9':
+			digits = true
+		case c == '.' && !dot:
+			dot = true
+		default:
+			goto exponent
+		}
+		s.i++
+	}
+exponent:
+	if digits && s.i < len(s.s) && (s.s[s.i] == 'e' || s.s[s.i] == 'E') {
+		j := s.i + 1
+		if j < len(s.s) && (s.s[j] == '+' || s.s[j] == '-') {
+			j++
+		}
+		if j < len(s.s) && s.s[j] >= '0' && s.s[j] <= '9' {
+			for j < len(s.s) && s.s[j] >= '0' && s.s[j] <= '9' {
+				j++
+			}
+			s.i = j
+		}
+	}
+	if !digits {
+		s.i = start
+		return 0, false
+	}
+	v, err := strconv.ParseFloat(s.s[start:s.i], 64)
+	return v, err == nil
+}
+
+// flag reads an arc flag, which may be written without a separator
+func (s *svgScanner) flag() (bool, bool) {
+	s.skipSeparators()
+	if s.i < len(s.s) && (s.s[s.i] == '0' || s.s[s.i] == '1') {
+		s.i++
+		return s.s[s.i-1] == '1', true
+	}
+	return false, false
+}
+
+func (s *svgScanner) numbers(count int) ([]float64, bool) {
+	values := make([]float64, count)
+	for i := range values {
+		v, ok := s.number()
+		if !ok {
+			return nil, false
+		}
+		values[i] = v
+	}
+	return values, true
+}
+
+// svgNumbers reads a list of numbers, up to the first invalid one
+func svgNumbers(value string) []float64 {
+	s := &svgScanner{s: value}
+	numbers := []float64{}
+	for {
+		v, ok := s.number()
+		if !ok {
+			return numbers
+		}
+		numbers = append(numbers, v)
+	}
+}
+
+// parseSVGTransform reads a transform list, false when part of it cannot be read
+func parseSVGTransform(value string) (Matrix, bool) {
+	m := Identity()
+	rest := strings.TrimSpace(value)
+	for rest != "" {
+		open := strings.IndexByte(rest, '(')
+		end := strings.IndexByte(rest, ')')
+		if open < 0 || end < open {
+			return m, false
+		}
+		name := strings.TrimSpace(rest[:open])
+		args := svgNumbers(rest[open+1 : end])
+		rest = strings.TrimLeft(rest[end+1:], " \t\r\n,")
+
+		var t Matrix
+		switch {
+		case name == "matrix" && len(args) == 6:
+			t = Matrix{A: args[0], B: args[1], C: args[2], D: args[3], E: args[4], F: args[5]}
+		case name == "translate" && len(args) == 1:
+			t = Translate(args[0], 0)
+		case name == "translate" && len(args) == 2:
+			t = Translate(args[0], args[1])
+		case name == "scale" && len(args) == 1:
+			t = Matrix{A: args[0], D: args[0]}
+		case name == "scale" && len(args) == 2:
+			t = Matrix{A: args[0], D: args[1]}
+		case name == "rotate" && (len(args) == 1 || len(args) == 3):
+			angle := args[0] * math.Pi / 180
+			t = Matrix{A: math.Cos(angle), B: math.Sin(angle), C: -math.Sin(angle), D: math.Cos(angle)}
+			if len(args) == 3 {
+				t = Translate(args[1], args[2]).Multiply(t).Multiply(Translate(-args[1], -args[2]))
+			}
+		case name == "skewX" && len(args) == 1:
+			t = Matrix{A: 1, C: math.Tan(args[0] * math.Pi / 180), D: 1}
+		case name == "skewY" && len(args) == 1:
+			t = Matrix{A: 1, B: math.Tan(args[0] * math.Pi / 180), D: 1}
+		default:
+			return m, false
+		}
+		m = m.Multiply(t)
+	}
+	return m, true
+}
+
+// pathBuilder collects the subpaths of path data as paths, curved paths having a segment per pair of points
+type pathBuilder struct {
+	paths    []VectorPath
+	points   []Point
+	segments []BezierSegment
+	curved   bool
+	current  Point
+	start    Point
+}
+
+func (b *pathBuilder) flush(closed bool) {
+	if len(b.points) > 1 {
+		path := VectorPath{Type: "path", Points: b.points, Closed: closed}
+		if b.curved {
+			path.Segments = b.segments
+		}
+		b.paths = append(b.paths, path)
+	}
+	b.points, b.segments, b.curved = nil, nil, false
+}
+
+func (b *pathBuilder) moveTo(p Point) {
+	b.flush(false)
+	b.points = []Point{p}
+	b.start, b.current = p, p
+}
+
+// begin starts a subpath at the current point when drawing follows a close without a move
+func (b *pathBuilder) begin() {
+	if len(b.points) == 0 {
+		b.points = []Point{b.current}
+		b.start = b.current
+	}
+}
+
+func (b *pathBuilder) lineTo(p Point) {
+	b.begin()
+	from := b.current
+	// lines are kept as curves too, in case the path has any
+	b.segments = append(b.segments, BezierSegment{
+		C1: Point{X: from.X + (p.X-from.X)/3, Y: from.Y + (p.Y-from.Y)/3},
+		C2: Point{X: from.X + (p.X-from.X)*2/3, Y: from.Y + (p.Y-from.Y)*2/3},
+	})
+	b.points = append(b.points, p)
+	b.current = p
+}
+
+func (b *pathBuilder) curveTo(c1, c2, p Point) {
+	b.begin()
+	b.segments = append(b.segments, BezierSegment{C1: c1, C2: c2})
+	b.points = append(b.points, p)
+	b.current = p
+	b.curved = true
+}
+
+func (b *pathBuilder) close() {
+	if len(b.points) == 0 {
+		return
+	}
+	if len(b.points) > 1 && b.points[len(b.points)-1] == b.points[0] {
+		// the last segment already comes back to the start, it becomes the closing one
+		b.points = b.points[:len(b.points)-1]
+	} else {
+		b.lineTo(b.start)
+		b.points = b.points[:len(b.points)-1]
+	}
+	b.flush(true)
+	b.current = b.start
+}
+
+// arcTo converts an elliptical arc to cubic curves of at most a quarter turn each
+func (b *pathBuilder) arcTo(rx, ry, rotation float64, large, sweep bool, to Point) {
+	from := b.current
+	if from == to {
+		return
+	}
+	rx, ry = math.Abs(rx), math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		b.lineTo(to)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cos, sin := math.Cos(phi), math.Sin(phi)
+	dx, dy := (from.X-to.X)/2, (from.Y-to.Y)/2
+	x1, y1 := cos*dx+sin*dy, -sin*dx+cos*dy
+	// radii too small to join the ends are scaled up
+	if lambda := x1*x1/(rx*rx) + y1*y1/(ry*ry); lambda > 1 {
+		rx, ry = rx*math.Sqrt(lambda), ry*math.Sqrt(lambda)
+	}
+	numerator := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	denominator := rx*rx*y1*y1 + ry*ry*x1*x1
+	coefficient := math.Sqrt(math.Max(0, numerator/denominator))
+	if large == sweep {
+		coefficient = -coefficient
+	}
+	cx1, cy1 := coefficient*rx*y1/ry, -coefficient*ry*x1/rx
+	cx := cos*cx1 - sin*cy1 + (from.X+to.X)/2
+	cy := sin*cx1 + cos*cy1 + (from.Y+to.Y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	at := func(t float64) (Point, Point) {
+		p := Point{X: cx + rx*math.Cos(t)*cos - ry*math.Sin(t)*sin, Y: cy + rx*math.Cos(t)*sin + ry*math.Sin(t)*cos}
+		d := Point{X: -rx*math.Sin(t)*cos - ry*math.Cos(t)*sin, Y: -rx*math.Sin(t)*sin + ry*math.Cos(t)*cos}
+		return p, d
+	}
+	pieces := int(math.Ceil(math.Abs(delta) / (math.Pi / 2)))
+	step := delta / float64(pieces)
+	k := 4.0 / 3 * math.Tan(step/4)
+	for i := 0; i < pieces; i++ {
+		p1, d1 := at(theta + float64(i)*step)
+		p2, d2 := at(theta + float64(i+1)*step)
+		if i == pieces-1 {
+			p2 = to
+		}
+		b.curveTo(Point{X: p1.X + k*d1.X, Y: p1.Y + k*d1.Y}, Point{X: p2.X - k*d2.X, Y: p2.Y - k*d2.Y}, p2)
+	}
+}
+
+// parsePathData converts path data to paths, one per subpath. Data is read up to its first error as in
+// browsers, false telling that there was one
+func parsePathData(d string) ([]VectorPath, bool) {
+	b := &pathBuilder{}
+	s := &svgScanner{s: d}
+	var command byte
+	// control points reflected by the smooth curve commands
+	var lastCubic, lastQuadratic Point
+	var previous byte
+
+	for !s.done() {
+		c := s.s[s.i]
+		if strings.IndexByte("MmLlHhVvCcSsQqTtAaZz", c) >= 0 {
+			command = c
+			s.i++
+		} else if command == 0 || command == 'Z' || command == 'z' {
+			b.flush(false)
+			return b.paths, false
+		}
+		relative := command >= 'a'
+		origin := Point{}
+		if relative {
+			origin = b.current
+		}
+		point := func(values []float64) Point {
+			return Point{X: origin.X + values[0], Y: origin.Y + values[1]}
+		}
+
+		var values []float64
+		ok := true
+		upper := command &^ 0x20
+		switch upper {
+		case 'M':
+			if values, ok = s.numbers(2); ok {
+				b.moveTo(point(values))
+				// further pairs are lines
+				if relative {
+					command = 'l'
+				} else {
+					command = 'L'
+				}
+			}
+		case 'L':
+			if values, ok = s.numbers(2); ok {
+				b.lineTo(point(values))
+			}
+		case 'H':
+			if values, ok = s.numbers(1); ok {
+				b.lineTo(Point{X: origin.X + values[0], Y: b.current.Y})
+			}
+		case 'V':
+			if values, ok = s.numbers(1); ok {
+				b.lineTo(Point{X: b.current.X, Y: origin.Y + values[0]})
+			}
+		case 'C':
+			if values, ok = s.numbers(6); ok {
+				lastCubic = point(values[2:4])
+				b.curveTo(point(values[0:2]), lastCubic, point(values[4:6]))
+			}
+		case 'S':
+			if values, ok = s.numbers(4); ok {
+				c1 := b.current
+				if previous == 'C' || previous == 'S' {
+					c1 = Point{X: 2*b.current.X - lastCubic.X, Y: 2*b.current.Y - lastCubic.Y}
+				}
+				lastCubic = point(values[0:2])
+				b.curveTo(c1, lastCubic, point(values[2:4]))
+			}
+		case 'Q', 'T':
+			control := b.current
+			if upper == 'Q' {
+				if values, ok = s.numbers(4); ok {
+					control = point(values[0:2])
+					values = values[2:]
+				}
+			} else if values, ok = s.numbers(2); ok && (previous == 'Q' || previous == 'T') {
+				control = Point{X: 2*b.current.X - lastQuadratic.X, Y: 2*b.current.Y - lastQuadratic.Y}
+			}
+			if ok {
+				from, to := b.current, point(values)
+				lastQuadratic = control
+				// a quadratic curve is a cubic one with its control points two thirds of the way to its control
+				b.curveTo(
+					Point{X: from.X + (control.X-from.X)*2/3, Y: from.Y + (control.Y-from.Y)*2/3},
+					Point{X: to.X + (control.X-to.X)*2/3, Y: to.Y + (control.Y-to.Y)*2/3},
+					to,
+				)
+			}
+		case 'A':
+			var radii []float64
+			var large, sweep bool
+			if radii, ok = s.numbers(3); ok {
+				if large, ok = s.flag(); ok {
+					if sweep, ok = s.flag(); ok {
+						if values, ok = s.numbers(2); ok {
+							b.arcTo(radii[0], radii[1], radii[2], large, sweep, point(values))
+						}
+					}
+				}
+			}
+		case 'Z':
+			b.close()
+		}
+		if !ok {
+			b.flush(false)
+			return b.paths, false
+		}
+		previous = upper
+	}
+	b.flush(false)
+	return b.paths, true
+}
+
+// ImportCanvas puts imported elements on top of a canvas, creating it with the size of the document when it
+// does not exist. It returns a copy of the canvas afterwards and whether it was created
+func (c *CanvasService) ImportCanvas(canvasId string, imported SVGImport) (Canvas, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		canvas = &Canvas{ID: canvasId, VectorData: VectorData{Width: imported.Width, Height: imported.Height}}
+		c.canvases[canvasId] = canvas
+		c.order = append(c.order, canvasId)
+		c.orderChanged = true
+	}
+	for _, element := range imported.Elements {
+		canvas.VectorData.Elements = insertByZIndex(canvas.VectorData.Elements, element)
+	}
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return canvas.snapshot(), !exists
+}
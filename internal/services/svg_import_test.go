@@ -0,0 +1,214 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestImportSVG(t *testing.T) {
+	doc := `<?xml version="1.0" encoding="ISO-8859-1"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:inkscape="http://www.inkscape.org/namespaces/inkscape" width="200mm" height="100mm" viewBox="0 0 200 100">
+  <title>Artwork</title>
+  <inkscape:grid/>
+  <defs><linearGradient id="g"/></defs>
+  <g transform="translate(10,20)" fill="#ff0000" style="stroke: blue; stroke-width: 2">
+    <rect x="1" y="2" width="30" height="40" fill-opacity="0.5"/>
+    <circle cx="5" cy="6" r="7" style="fill:none"/>
+  </g>
+  <ellipse cx="50" cy="50" rx="10" ry="5" opacity=".5" stroke="black" stroke-dasharray="4 2" stroke-linecap="round"/>
+  <line x1="0" y1="0" x2="10" y2="10" stroke="currentColor" color="green"/>
+  <polygon points="0,0 10,0 10,10"/>
+  <polyline points="0 0 5 5 10 0 7"/>
+  <rect width="0" height="10"/>
+  <rect width="10" height="10" display="none"/>
+  <text x="1" y="2">Hello</text>
+  <text x="1" y="2">World</text>
+  <path d="M0 0L10 0" fill="url(#g)" filter="url(#f)"/>
+</svg>`
+	imported, err := ImportSVG(strings.NewReader(doc), "imp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mm := 96 / 25.4
+	if math.Abs(imported.Width-200*mm) > 1e-9 || math.Abs(imported.Height-100*mm) > 1e-9 {
+		t.Errorf("Expected the size in canvas units, got %vx%v", imported.Width, imported.Height)
+	}
+	if len(imported.Elements) != 7 {
+		t.Fatalf("Expected 7 elements, got %d: %#v", len(imported.Elements), imported.Elements)
+	}
+
+	rect, ok := imported.Elements[0].(VectorRectangle)
+	if !ok || rect.ID != "imp-1" || rect.X != 1 || rect.Width != 30 {
+		t.Fatalf("Expected the rectangle first, got %#v", imported.Elements[0])
+	}
+	if rect.Fill != "#ff0000" || rect.Stroke != "blue" || rect.StrokeWidth != 2 || rect.FillOpacity == nil || *rect.FillOpacity != 0.5 {
+		t.Errorf("Expected the style of the group to be inherited, got %#v", rect.VectorShape)
+	}
+	if rect.Transform == nil || !nearlyPoint(rect.Transform.Apply(Point{}), Point{X: 10 * mm, Y: 20 * mm}) {
+		t.Errorf("Expected the view box and the group transform to be composed, got %v", rect.Transform)
+	}
+	if circle := imported.Elements[1].(VectorCircle); circle.Fill != "" || circle.Radius != 7 {
+		t.Errorf("Expected the style attribute to override the inherited fill, got %#v", circle)
+	}
+
+	ellipse := imported.Elements[2].(VectorEllipse)
+	if ellipse.FillOpacity == nil || *ellipse.FillOpacity != 0.5 || ellipse.StrokeOpacity == nil || *ellipse.StrokeOpacity != 0.5 {
+		t.Errorf("Expected the opacity on both paints, got %#v", ellipse.VectorShape)
+	}
+	if len(ellipse.StrokeDasharray) != 2 || ellipse.LineCap != LineCapRound {
+		t.Errorf("Expected the stroke style, got %#v", ellipse.VectorShape)
+	}
+	if line := imported.Elements[3].(VectorLine); line.Stroke != "green" || line.Fill != "" {
+		t.Errorf("Expected the line to be stroked with the current color, got %#v", line.VectorShape)
+	}
+	if polygon := imported.Elements[4].(VectorPolygon); len(polygon.Points) != 3 || polygon.Fill != "black" {
+		t.Errorf("Expected a black polygon, got %#v", polygon)
+	}
+	if polyline := imported.Elements[5].(VectorPolyline); len(polyline.Points) != 3 {
+		t.Errorf("Expected an odd coordinate to be dropped, got %v", polyline.Points)
+	}
+	if path := imported.Elements[6].(VectorPath); path.Fill != "" {
+		t.Errorf("Expected gradient fills to be left out, got %q", path.Fill)
+	}
+
+	for _, element := range imported.Elements {
+		if err := ValidateStyle(element); err != nil {
+			t.Errorf("Expected valid elements, got %v", err)
+		}
+	}
+	want := []string{"<text> elements (2)", "filter", "gradient and pattern paints"}
+	if strings.Join(imported.Unsupported, "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %v to be reported, got %v", want, imported.Unsupported)
+	}
+}
+
+func TestImportSVGErrors(t *testing.T) {
+	if _, err := ImportSVG(strings.NewReader(`<html><body/></html>`), "x"); err != ErrNotSVG {
+		t.Errorf("Expected other documents to be refused, got %v", err)
+	}
+	if _, err := ImportSVG(strings.NewReader(""), "x"); err != ErrNotSVG {
+		t.Errorf("Expected empty files to be refused, got %v", err)
+	}
+	if _, err := ImportSVG(strings.NewReader(`<svg><rect width="1" height="1"`), "x"); err == nil || err == ErrNotSVG {
+		t.Errorf("Expected malformed documents to fail, got %v", err)
+	}
+	huge := "<svg>" + strings.Repeat(`<circle r="1"/>`, MaxImportedElements+1) + "</svg>"
+	if _, err := ImportSVG(strings.NewReader(huge), "x"); err != ErrTooManySVGElements {
+		t.Errorf("Expected huge documents to be refused, got %v", err)
+	}
+	nested := func(depth int) string {
+		return "<svg>" + strings.Repeat("<g>", depth) + `<circle r="1"/>` + strings.Repeat("</g>", depth) + "</svg>"
+	}
+	if _, err := ImportSVG(strings.NewReader(nested(MaxSVGDepth)), "x"); err != nil {
+		t.Errorf("Expected nested groups to be read, got %v", err)
+	}
+	if _, err := ImportSVG(strings.NewReader(nested(100000)), "x"); err != ErrSVGTooDeep {
+		t.Errorf("Expected deeply nested documents to be refused, got %v", err)
+	}
+}
+
+func TestImportSVGDrawsTinyDashesSolid(t *testing.T) {
+	doc := `<svg xmlns="http://www.w3.org/2000/svg"><line x2="10" stroke="black" stroke-dasharray="0.001"/><line x2="10" stroke="black" stroke-dasharray="0 0"/></svg>`
+	result, err := ImportSVG(strings.NewReader(doc), "s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Elements) != 2 {
+		t.Fatalf("Expected both lines, got %d elements and %v", len(result.Elements), result.Unsupported)
+	}
+	for _, element := range result.Elements {
+		if shape, _ := ElementShape(element); len(shape.StrokeDasharray) != 0 {
+			t.Errorf("Expected a solid line, got dashes %v", shape.StrokeDasharray)
+		}
+	}
+}
+
+func TestParsePathData(t *testing.T) {
+	paths, ok := parsePathData("M10,10 l10-0h10V20 z m0 10 1.5.5")
+	if !ok || len(paths) != 2 {
+		t.Fatalf("Expected two subpaths, got %v %v", paths, ok)
+	}
+	if !paths[0].Closed || len(paths[0].Points) != 4 || paths[0].Segments != nil {
+		t.Errorf("Expected a closed straight path, got %#v", paths[0])
+	}
+	if len(paths[1].Points) != 2 || paths[1].Points[0] != (Point{X: 10, Y: 20}) || paths[1].Points[1] != (Point{X: 11.5, Y: 20.5}) {
+		t.Errorf("Expected the second subpath to start where the first closed, got %v", paths[1].Points)
+	}
+
+	paths, _ = parsePathData("M0 0 C 0 10 10 10 10 0 S 20 -10 20 0 Q 25 10 30 0 T 40 0")
+	curve := paths[0]
+	if len(curve.Points) != 5 || len(curve.Segments) != 4 {
+		t.Fatalf("Expected a segment per curve, got %#v", curve)
+	}
+	if curve.Segments[1].C1 != (Point{X: 10, Y: -10}) {
+		t.Errorf("Expected S to reflect the previous control point, got %v", curve.Segments[1].C1)
+	}
+	if !nearlyPoint(curve.Segments[3].C1, Point{X: 30 + 5.0*2/3, Y: -10.0 * 2 / 3}) {
+		t.Errorf("Expected T to reflect the quadratic control point, got %v", curve.Segments[3].C1)
+	}
+
+	// a half circle of radius 10 is made of two quarters
+	paths, _ = parsePathData("M0 0 A10 10 0 0 1 20 0")
+	arc := paths[0]
+	if len(arc.Points) != 3 || !nearlyPoint(arc.Points[1], Point{X: 10, Y: -10}) || arc.Points[2] != (Point{X: 20, Y: 0}) {
+		t.Errorf("Expected the arc to go through its top, got %v", arc.Points)
+	}
+	if paths, _ := parsePathData("M0 0 a5 5 0 1020 0"); len(paths) != 1 || paths[0].Points[len(paths[0].Points)-1] != (Point{X: 20, Y: 0}) {
+		t.Errorf("Expected flags without separators and radii too small to be scaled up, got %v", paths)
+	}
+
+	paths, ok = parsePathData("M0 0 L10 10 L20 x 30 30")
+	if ok || len(paths) != 1 || len(paths[0].Points) != 2 {
+		t.Errorf("Expected paths to stop at the first error, got %v %v", paths, ok)
+	}
+	for _, path := range paths {
+		if segmentCount(path) != len(path.Segments) && path.Segments != nil {
+			t.Errorf("Expected a segment per pair of points, got %#v", path)
+		}
+	}
+}
+
+func TestParseSVGTransform(t *testing.T) {
+	m, ok := parseSVGTransform("translate(10) scale(2, 3) rotate(90 1 1)")
+	if !ok {
+		t.Fatal("Expected the transform list to be read")
+	}
+	// rotating 2,1 around 1,1 gives 1,2 then scaled to 2,6 and moved to 12,6
+	if got := m.Apply(Point{X: 2, Y: 1}); !nearlyPoint(got, Point{X: 12, Y: 6}) {
+		t.Errorf("Expected the transforms to apply right to left, got %v", got)
+	}
+	if _, ok := parseSVGTransform("perspective(3)"); ok {
+		t.Error("Expected unknown transforms to be reported")
+	}
+}
+
+func TestImportCanvas(t *testing.T) {
+	c := NewCanvasService()
+	imported, err := ImportSVG(strings.NewReader(`<svg width="40" height="30"><rect rx="2" width="10" height="10"/><circle r="3"/></svg>`), "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := imported.Elements[0].(VectorPath); !ok || !path.Closed || len(path.Segments) != len(path.Points) {
+		t.Errorf("Expected rounded rectangles to become closed curves, got %#v", imported.Elements[0])
+	}
+
+	canvas, created := c.ImportCanvas("c1", imported)
+	if !created || canvas.VectorData.Width != 40 || canvas.VectorData.Height != 30 || len(canvas.VectorData.Elements) != 2 {
+		t.Fatalf("Expected a canvas of the size of the document, got %v %#v", created, canvas)
+	}
+	again, _ := ImportSVG(strings.NewReader(`<svg width="400" height="300"><circle r="3"/></svg>`), "b")
+	canvas, created = c.ImportCanvas("c1", again)
+	if created || canvas.VectorData.Width != 40 || len(canvas.VectorData.Elements) != 3 || ElementID(canvas.VectorData.Elements[2]) != "b-1" {
+		t.Errorf("Expected the elements to be added on top of the canvas, got %v %#v", created, canvas)
+	}
+	keys := []string{}
+	for _, element := range c.GetCanvas("c1").VectorData.Elements {
+		keys = append(keys, elementZIndex(element))
+	}
+	for i := 1; i < len(keys); i++ {
+		if keys[i] <= keys[i-1] {
+			t.Errorf("Expected increasing z-index keys, got %v", keys)
+		}
+	}
+}
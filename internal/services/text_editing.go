@@ -0,0 +1,252 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Text operation kinds
+const (
+	TextInsert = "insert"
+	TextDelete = "delete"
+)
+
+// textHistoryLimit is the number of applied operations kept per text element to transform late operations
+const textHistoryLimit = 200
+
+// TextOperation inserts or deletes a range of a text element. Index and Length count runes and
+// Revision is the revision of the text the operation was made against
+type TextOperation struct {
+	Kind     string `json:"kind"`
+	Index    int    `json:"index"`
+	Text     string `json:"text,omitempty"`
+	Length   int    `json:"length,omitempty"`
+	Revision int    `json:"revision"`
+}
+
+var ErrStaleTextOperation = errors.New("text operation is based on a revision that is no longer available")
+
+func validTextAlign(align string) bool {
+	switch align {
+	case TextAlignLeft, TextAlignCenter, TextAlignRight, TextAlignJustify:
+		return true
+	}
+	return false
+}
+
+func runsText(runs []TextRun) string {
+	var builder strings.Builder
+	for _, run := range runs {
+		builder.WriteString(run.Text)
+	}
+	return builder.String()
+}
+
+// textLines splits a text element into lines of runs, the element style filling in what the runs leave empty
+func textLines(t VectorText) [][]TextRun {
+	runs := t.Runs
+	if len(runs) == 0 {
+		runs = []TextRun{{Text: t.Text}}
+	}
+	lines := [][]TextRun{{}}
+	for _, run := range runs {
+		if run.FontFamily == "" {
+			run.FontFamily = t.FontFamily
+		}
+		if run.FontSize <= 0 {
+			run.FontSize = t.FontSize
+		}
+		if run.FontWeight == "" {
+			run.FontWeight = t.FontWeight
+		}
+		if run.Color == "" {
+			run.Color = t.Color
+		}
+		for i, part := range strings.Split(run.Text, "\n") {
+			if i > 0 {
+				lines = append(lines, []TextRun{})
+			}
+			if part != "" {
+				piece := run
+				piece.Text = part
+				lines[len(lines)-1] = append(lines[len(lines)-1], piece)
+			}
+		}
+	}
+	return lines
+}
+
+// transformTextOperation rewrites op so that it applies after applied, both being made against the same text.
+// A deletion split by a concurrent insertion becomes two deletions, the rightmost first
+func transformTextOperation(op TextOperation, applied TextOperation) []TextOperation {
+	if applied.Kind == TextInsert {
+		inserted := len([]rune(applied.Text))
+		switch {
+		case op.Kind == TextInsert && op.Index >= applied.Index:
+			op.Index += inserted
+		case op.Kind == TextDelete && op.Index >= applied.Index:
+			op.Index += inserted
+		case op.Kind == TextDelete && op.Index+op.Length > applied.Index:
+			// keep the concurrently inserted text, delete around it
+			right := TextOperation{Kind: TextDelete, Index: applied.Index + inserted, Length: op.Index + op.Length - applied.Index}
+			left := TextOperation{Kind: TextDelete, Index: op.Index, Length: applied.Index - op.Index}
+			return []TextOperation{right, left}
+		}
+		return []TextOperation{op}
+	}
+
+	shift := func(index int) int {
+		switch {
+		case index <= applied.Index:
+			return index
+		case index < applied.Index+applied.Length:
+			return applied.Index
+		default:
+			return index - applied.Length
+		}
+	}
+	if op.Kind == TextInsert {
+		op.Index = shift(op.Index)
+		return []TextOperation{op}
+	}
+	start, end := shift(op.Index), shift(op.Index+op.Length)
+	if end <= start {
+		return nil
+	}
+	op.Index, op.Length = start, end-start
+	return []TextOperation{op}
+}
+
+// applyTextOperation changes the content and the runs of a text element
+func applyTextOperation(text *VectorText, op TextOperation) error {
+	content := []rune(text.Text)
+	switch op.Kind {
+	case TextInsert:
+		if op.Index < 0 || op.Index > len(content) {
+			return fmt.Errorf("insert index %d out of range [0, %d]", op.Index, len(content))
+		}
+		if op.Text == "" {
+			return errors.New("nothing to insert")
+		}
+		text.Runs = insertIntoRuns(text.Runs, op.Index, op.Text)
+		text.Text = string(content[:op.Index]) + op.Text + string(content[op.Index:])
+	case TextDelete:
+		if op.Length <= 0 || op.Index < 0 || op.Index+op.Length > len(content) {
+			return fmt.Errorf("delete range [%d, %d) out of range [0, %d]", op.Index, op.Index+op.Length, len(content))
+		}
+		text.Runs = deleteFromRuns(text.Runs, op.Index, op.Length)
+		text.Text = string(content[:op.Index]) + string(content[op.Index+op.Length:])
+	default:
+		return fmt.Errorf("unknown text operation: %s", op.Kind)
+	}
+	text.Revision++
+	return nil
+}
+
+// insertIntoRuns adds text at a rune index, it takes the style of the run it continues
+func insertIntoRuns(runs []TextRun, index int, inserted string) []TextRun {
+	if len(runs) == 0 {
+		return runs
+	}
+	updated := append([]TextRun{}, runs...)
+	start := 0
+	for i, run := range updated {
+		content := []rune(run.Text)
+		if index <= start+len(content) && (index > start || i == 0) {
+			offset := index - start
+			updated[i].Text = string(content[:offset]) + inserted + string(content[offset:])
+			return updated
+		}
+		start += len(content)
+	}
+	updated[len(updated)-1].Text += inserted
+	return updated
+}
+
+// deleteFromRuns removes a rune range from the runs, dropping runs left empty but always keeping the first one
+func deleteFromRuns(runs []TextRun, index int, length int) []TextRun {
+	if len(runs) == 0 {
+		return runs
+	}
+	updated := make([]TextRun, 0, len(runs))
+	start := 0
+	end := index + length
+	for _, run := range runs {
+		content := []rune(run.Text)
+		from := min(max(index-start, 0), len(content))
+		to := min(max(end-start, 0), len(content))
+		start += len(content)
+		run.Text = string(content[:from]) + string(content[to:])
+		if run.Text != "" {
+			updated = append(updated, run)
+		}
+	}
+	if len(updated) == 0 {
+		first := runs[0]
+		first.Text = ""
+		updated = append(updated, first)
+	}
+	return updated
+}
+
+// ApplyTextOperation applies an edit of a text element made by a collaborator. Edits made against an older
+// revision are transformed against the edits applied since then, the applied operations are returned with
+// the revision they produced
+func (c *CanvasService) ApplyTextOperation(canvasId string, textElementId string, op TextOperation) ([]TextOperation, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return nil, fmt.Errorf("canvas %s not found", canvasId)
+	}
+
+	element, _, _, found := findElement(canvas.VectorData.Elements, textElementId, Identity(), nil)
+	if !found {
+		return nil, fmt.Errorf("text element %s not found", textElementId)
+	}
+	text, ok := element.(VectorText)
+	if !ok {
+		return nil, fmt.Errorf("element %s is not a text", textElementId)
+	}
+
+	key := canvasId + "/" + textElementId
+	history := c.textHistory[key]
+	if op.Revision > text.Revision {
+		return nil, fmt.Errorf("text operation revision %d is ahead of %d", op.Revision, text.Revision)
+	}
+	missed := text.Revision - op.Revision
+	if missed > len(history) {
+		return nil, ErrStaleTextOperation
+	}
+
+	pending := []TextOperation{op}
+	for _, applied := range history[len(history)-missed:] {
+		transformed := []TextOperation{}
+		for _, p := range pending {
+			transformed = append(transformed, transformTextOperation(p, applied)...)
+		}
+		pending = transformed
+	}
+
+	result := []TextOperation{}
+	for _, p := range pending {
+		p.Revision = text.Revision
+		if err := applyTextOperation(&text, p); err != nil {
+			return nil, err
+		}
+		history = append(history, p)
+		p.Revision = text.Revision
+		result = append(result, p)
+	}
+	if len(history) > textHistoryLimit {
+		history = history[len(history)-textHistoryLimit:]
+	}
+	c.textHistory[key] = history
+	updateElement(canvas.VectorData.Elements, textElementId, func(VectorElement) VectorElement {
+		return text
+	})
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return result, nil
+}
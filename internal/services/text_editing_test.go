@@ -0,0 +1,149 @@
+package services
+
+import (
+	"testing"
+)
+
+func newTextCanvas(text VectorText) *CanvasService {
+	cs := NewCanvasService()
+	cs.AddOrUpdateCanvas(Canvas{
+		ID:         "text-canvas",
+		VectorData: VectorData{Elements: []VectorElement{text}},
+	})
+	return cs
+}
+
+func currentText(t *testing.T, cs *CanvasService) VectorText {
+	text, ok := cs.GetCanvas("text-canvas").VectorData.Elements[0].(VectorText)
+	if !ok {
+		t.Fatal("Element is not a VectorText")
+	}
+	return text
+}
+
+func TestParseTextElement(t *testing.T) {
+	element := ParseSingleStrokeFromRaw(map[string]interface{}{
+		"type": "text",
+		"id":   "text-1",
+		"x":    10.0,
+		"y":    20.0,
+		"runs": []interface{}{
+			map[string]interface{}{"text": "Hello "},
+			map[string]interface{}{"text": "world", "fontWeight": "bold"},
+		},
+	})
+	text, ok := element.(VectorText)
+	if !ok {
+		t.Fatalf("Expected VectorText, got %#v", element)
+	}
+	if text.Text != "Hello world" {
+		t.Errorf("Expected text 'Hello world', got '%s'", text.Text)
+	}
+	if text.FontSize != 16 || text.Align != TextAlignLeft || text.LineHeight != 1.2 {
+		t.Errorf("Expected default font size, alignment and line height, got %f %s %f", text.FontSize, text.Align, text.LineHeight)
+	}
+
+	if ParseSingleStrokeFromRaw(map[string]interface{}{"type": "text", "align": "diagonal"}) != nil {
+		t.Error("Expected nil for unknown alignment")
+	}
+}
+
+func TestApplyTextOperationInsertDelete(t *testing.T) {
+	cs := newTextCanvas(VectorText{
+		VectorShape: VectorShape{ID: "text-1"},
+		Type:        "text",
+		Text:        "Hello world",
+		Runs:        []TextRun{{Text: "Hello "}, {Text: "world", FontWeight: "bold"}},
+	})
+
+	applied, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextInsert, Index: 11, Text: "!", Revision: 0})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(applied) != 1 || applied[0].Revision != 1 {
+		t.Errorf("Expected one operation producing revision 1, got %v", applied)
+	}
+
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextDelete, Index: 3, Length: 5, Revision: 1}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	text := currentText(t, cs)
+	if text.Text != "Helrld!" {
+		t.Errorf("Expected text 'Helrld!', got '%s'", text.Text)
+	}
+	if len(text.Runs) != 2 || text.Runs[0].Text != "Hel" || text.Runs[1].Text != "rld!" {
+		t.Errorf("Expected runs [Hel rld!], got %v", text.Runs)
+	}
+	if text.Runs[1].FontWeight != "bold" {
+		t.Error("Expected inserted text to keep the style of the run it continues")
+	}
+	if text.Revision != 2 {
+		t.Errorf("Expected revision 2, got %d", text.Revision)
+	}
+}
+
+func TestApplyTextOperationConcurrentEdits(t *testing.T) {
+	cs := newTextCanvas(VectorText{VectorShape: VectorShape{ID: "text-1"}, Type: "text", Text: "abcdef"})
+
+	// both users edit revision 0
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextInsert, Index: 0, Text: "XY", Revision: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextInsert, Index: 6, Text: "!", Revision: 0}); err != nil {
+		t.Fatal(err)
+	}
+	if text := currentText(t, cs); text.Text != "XYabcdef!" {
+		t.Errorf("Expected 'XYabcdef!', got '%s'", text.Text)
+	}
+
+	// a deletion spanning a concurrent insertion keeps the inserted text
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextInsert, Index: 5, Text: "--", Revision: 2}); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextDelete, Index: 3, Length: 4, Revision: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Errorf("Expected the deletion to be split in two, got %v", applied)
+	}
+	if text := currentText(t, cs); text.Text != "XYa--f!" {
+		t.Errorf("Expected 'XYa--f!', got '%s'", text.Text)
+	}
+
+	// an insertion inside a concurrently deleted range lands at its start
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextDelete, Index: 0, Length: 3, Revision: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cs.ApplyTextOperation("text-canvas", "text-1", TextOperation{Kind: TextInsert, Index: 1, Text: "Z", Revision: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if text := currentText(t, cs); text.Text != "Z--f!" {
+		t.Errorf("Expected 'Z--f!', got '%s'", text.Text)
+	}
+}
+
+func TestApplyTextOperationErrors(t *testing.T) {
+	cs := newTextCanvas(VectorText{VectorShape: VectorShape{ID: "text-1"}, Type: "text", Text: "abc"})
+	cs.UpdateCanvasElement("text-canvas", VectorRectangle{VectorShape: VectorShape{ID: "rect-1"}, Type: "rectangle"})
+
+	cases := map[string]struct {
+		elementID string
+		op        TextOperation
+	}{
+		"future revision": {"text-1", TextOperation{Kind: TextInsert, Index: 0, Text: "x", Revision: 3}},
+		"out of range":    {"text-1", TextOperation{Kind: TextDelete, Index: 2, Length: 5}},
+		"unknown kind":    {"text-1", TextOperation{Kind: "replace"}},
+		"not a text":      {"rect-1", TextOperation{Kind: TextInsert, Text: "x"}},
+		"missing element": {"missing", TextOperation{Kind: TextInsert, Text: "x"}},
+	}
+	for name, c := range cases {
+		if _, err := cs.ApplyTextOperation("text-canvas", c.elementID, c.op); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if text := currentText(t, cs); text.Text != "abc" || text.Revision != 0 {
+		t.Errorf("Expected text to be untouched, got '%s' at revision %d", text.Text, text.Revision)
+	}
+}
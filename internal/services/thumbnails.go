@@ -0,0 +1,105 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"image"
+	"image/png"
+	"math"
+	"sync"
+)
+
+// ProjectThumbnailSize is the largest side of project thumbnails, in pixels
+const ProjectThumbnailSize = 320
+
+func ProjectThumbnailKey(projectID string) string {
+	return "projects/" + projectID + "/thumbnail.png"
+}
+
+// renderThumbnail draws a canvas scaled down to fit in a size square, false when it has nothing to draw
+func renderThumbnail(v VectorData, size int, images func(assetId string) (image.Image, bool)) ([]byte, bool, error) {
+	if (v.Width <= 0 || v.Height <= 0) && len(v.Elements) == 0 {
+		return nil, false, nil
+	}
+	area := canvasArea(v)
+	side := math.Max(area.Width(), area.Height())
+	// thumbnails never enlarge small canvases
+	img, err := RenderRaster(v, RasterOptions{Scale: math.Min(1, float64(size)/side), Image: images})
+	if err != nil {
+		return nil, false, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, false, err
+	}
+	return buf.Bytes(), true, nil
+}
+
+// ThumbnailCache remembers the canvas each project thumbnail was drawn from, so that persisting a project
+// whose first canvas did not change draws nothing
+type ThumbnailCache struct {
+	mutex   sync.Mutex
+	entries map[string]thumbnailEntry
+}
+
+type thumbnailEntry struct {
+	// sum is the hash of the first canvas, zero for projects without canvases
+	sum   [sha256.Size]byte
+	drawn bool
+}
+
+func NewThumbnailCache() *ThumbnailCache {
+	return &ThumbnailCache{entries: make(map[string]thumbnailEntry)}
+}
+
+// Refresh stores the thumbnail of a project when its first canvas changed since the last one, or deletes it
+// when there is nothing to draw anymore. It returns whether the stored thumbnail changed and whether the
+// project has one
+func (t *ThumbnailCache) Refresh(ctx context.Context, store BlobStore, projectID string, workBoard *CanvasService, images func(assetId string) (image.Image, bool)) (bool, bool, error) {
+	entry := thumbnailEntry{}
+	var canvas Canvas
+	exists := false
+	if ids := workBoard.ListCanvasIDs(); len(ids) > 0 {
+		canvas, exists = workBoard.canvasSnapshot(ids[0])
+	}
+	if exists {
+		data, err := json.Marshal(canvas.VectorData)
+		if err != nil {
+			return false, false, err
+		}
+		entry.sum = sha256.Sum256(data)
+	}
+
+	t.mutex.Lock()
+	previous, known := t.entries[projectID]
+	t.mutex.Unlock()
+	if known && previous.sum == entry.sum {
+		return false, previous.drawn, nil
+	}
+
+	if exists {
+		thumbnail, drawn, err := renderThumbnail(canvas.VectorData, ProjectThumbnailSize, images)
+		if err != nil {
+			return false, false, err
+		}
+		if drawn {
+			if err := store.Put(ctx, ProjectThumbnailKey(projectID), thumbnail, "image/png"); err != nil {
+				return false, false, err
+			}
+		}
+		entry.drawn = drawn
+	}
+	if !entry.drawn {
+		if err := store.Delete(ctx, ProjectThumbnailKey(projectID)); err != nil {
+			return false, false, err
+		}
+	}
+
+	t.mutex.Lock()
+	t.entries[projectID] = entry
+	t.mutex.Unlock()
+	// a thumbnail that keeps on missing is no change
+	return entry.drawn || !known || previous.drawn, entry.drawn, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"testing"
+)
+
+func TestThumbnailCacheRefresh(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewThumbnailCache()
+	workBoard := NewCanvasService()
+
+	if changed, exists, err := cache.Refresh(ctx, store, "p1", workBoard, nil); err != nil || !changed || exists {
+		t.Errorf("Expected projects without canvases to have no thumbnail, got %v %v %v", changed, exists, err)
+	}
+
+	workBoard.AddOrUpdateCanvas(Canvas{ID: "first", VectorData: VectorData{Width: 1280, Height: 640, Elements: []VectorElement{
+		VectorRectangle{VectorShape: VectorShape{ID: "r", Fill: "#ff0000"}, Type: "rectangle", Width: 640, Height: 640},
+	}}})
+	workBoard.AddOrUpdateCanvas(Canvas{ID: "second", VectorData: VectorData{Width: 10, Height: 10}})
+	changed, exists, err := cache.Refresh(ctx, store, "p1", workBoard, nil)
+	if err != nil || !changed || !exists {
+		t.Fatalf("Expected a thumbnail of the first canvas, got %v %v %v", changed, exists, err)
+	}
+	data, err := store.Get(ctx, ProjectThumbnailKey("p1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != ProjectThumbnailSize || img.Bounds().Dy() != ProjectThumbnailSize/2 {
+		t.Errorf("Expected the canvas to fit in the thumbnail size, got %v", img.Bounds())
+	}
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 != 255 {
+		t.Errorf("Expected the rectangle on the left, got %v", img.At(10, 10))
+	}
+
+	// changes to other canvases keep the thumbnail
+	workBoard.UpdateCanvasBackground("second", "#000000")
+	if changed, exists, _ := cache.Refresh(ctx, store, "p1", workBoard, nil); changed || !exists {
+		t.Errorf("Expected the thumbnail to be kept, got %v %v", changed, exists)
+	}
+	workBoard.UpdateCanvasBackground("first", "#000000")
+	if changed, exists, _ := cache.Refresh(ctx, store, "p1", workBoard, nil); !changed || !exists {
+		t.Errorf("Expected the thumbnail to be redrawn, got %v %v", changed, exists)
+	}
+
+	workBoard.RemoveCanvas("first")
+	workBoard.RemoveCanvas("second")
+	if changed, exists, _ := cache.Refresh(ctx, store, "p1", workBoard, nil); !changed || exists {
+		t.Errorf("Expected the thumbnail to be removed, got %v %v", changed, exists)
+	}
+	if _, err := store.Get(ctx, ProjectThumbnailKey("p1")); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Expected the thumbnail to be deleted, got %v", err)
+	}
+	if changed, _, _ := cache.Refresh(ctx, store, "p1", workBoard, nil); changed {
+		t.Error("Expected a missing thumbnail to stay unchanged")
+	}
+}
+
+func TestRenderThumbnailKeepsSmallCanvases(t *testing.T) {
+	data, drawn, err := renderThumbnail(VectorData{Width: 40, Height: 30}, ProjectThumbnailSize, nil)
+	if err != nil || !drawn {
+		t.Fatalf("Expected a thumbnail, got %v %v", drawn, err)
+	}
+	img, _ := png.Decode(bytes.NewReader(data))
+	if img.Bounds().Dx() != 40 || img.Bounds().Dy() != 30 {
+		t.Errorf("Expected small canvases not to be enlarged, got %v", img.Bounds())
+	}
+	if _, drawn, _ := renderThumbnail(VectorData{}, ProjectThumbnailSize, nil); drawn {
+		t.Error("Expected empty canvases without a size to draw nothing")
+	}
+}
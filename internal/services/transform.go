@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// setTransform replaces the transform of an element, dropping it when it is the identity
+func setTransform(element VectorElement, m Matrix) VectorElement {
+	return updateShape(element, func(shape *VectorShape) {
+		if m == Identity() {
+			shape.Transform = nil
+			return
+		}
+		shape.Transform = &m
+	})
+}
+
+// transformElement applies m on top of an element in the coordinates of its container. Translations are
+// baked into the geometry of untransformed elements, anything else is composed with the element transform
+func transformElement(element VectorElement, m Matrix) VectorElement {
+	if m.IsTranslation() {
+		return translateElement(element, m.E, m.F)
+	}
+	return setTransform(element, m.Multiply(elementTransform(element)))
+}
+
+// selectedElements checks that the elements exist and that none of them is inside another selected group,
+// which would transform it twice, and returns the transform of their containers
+func selectedElements(elements []VectorElement, elementIds []string) (map[string]Matrix, error) {
+	ids, err := elementIDSet(elementIds)
+	if err != nil {
+		return nil, err
+	}
+	containers := make(map[string]Matrix, len(elementIds))
+	for _, id := range elementIds {
+		_, world, ancestors, found := findElement(elements, id, Identity(), nil)
+		if !found {
+			return nil, fmt.Errorf("element %s not found", id)
+		}
+		for _, ancestor := range ancestors {
+			if ids[ancestor] {
+				return nil, fmt.Errorf("element %s is inside selected group %s", id, ancestor)
+			}
+		}
+		containers[id] = world
+	}
+	return containers, nil
+}
+
+// TransformElements applies a transform expressed in canvas coordinates to several elements at once;
+// nothing changes when any of them cannot be transformed
+func (c *CanvasService) TransformElements(canvasId string, elementIds []string, m Matrix) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	if !validTransform(&m) {
+		return errors.New("transform is not invertible")
+	}
+	containers, err := selectedElements(canvas.VectorData.Elements, elementIds)
+	if err != nil {
+		return err
+	}
+
+	// the canvas transform is expressed in each container space: world^-1 * m * world
+	local := make(map[string]Matrix, len(containers))
+	for id, world := range containers {
+		inverse, ok := world.Invert()
+		if !ok {
+			return fmt.Errorf("element %s is inside a group that is not invertible", id)
+		}
+		local[id] = inverse.Multiply(m).Multiply(world)
+	}
+	for id, delta := range local {
+		updateElement(canvas.VectorData.Elements, id, func(element VectorElement) VectorElement {
+			return transformElement(element, delta)
+		})
+	}
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
+
+// SetElementTransforms replaces the own transform of several elements at once, nil resets them
+func (c *CanvasService) SetElementTransforms(canvasId string, elementIds []string, m *Matrix) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return fmt.Errorf("canvas %s not found", canvasId)
+	}
+	if !validTransform(m) {
+		return errors.New("transform is not invertible")
+	}
+	if _, err := elementIDSet(elementIds); err != nil {
+		return err
+	}
+	for _, id := range elementIds {
+		if _, _, _, found := findElement(canvas.VectorData.Elements, id, Identity(), nil); !found {
+			return fmt.Errorf("element %s not found", id)
+		}
+	}
+	for _, id := range elementIds {
+		updateElement(canvas.VectorData.Elements, id, func(element VectorElement) VectorElement {
+			return setTransform(element, transformOrIdentity(m))
+		})
+	}
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return nil
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func rotation(angle float64) Matrix {
+	cos, sin := math.Cos(angle), math.Sin(angle)
+	return Matrix{A: cos, B: sin, C: -sin, D: cos}
+}
+
+func nearlyPoint(a, b Point) bool {
+	return math.Abs(a.X-b.X) < 1e-6 && math.Abs(a.Y-b.Y) < 1e-6
+}
+
+func TestParseElementTransform(t *testing.T) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(`{"id":"r1","type":"rectangle","x":0,"y":0,"width":10,"height":10,
+		"transform":{"a":0,"b":1,"c":-1,"d":0,"e":5,"f":0}}`), &raw); err != nil {
+		t.Fatal(err)
+	}
+	r, ok := ParseSingleStrokeFromRaw(raw).(VectorRectangle)
+	if !ok || r.Transform == nil || r.Transform.B != 1 {
+		t.Fatalf("Expected a rotated rectangle, got %+v", r)
+	}
+
+	raw["transform"] = map[string]interface{}{"a": 0, "b": 0, "c": 0, "d": 0}
+	if element := ParseSingleStrokeFromRaw(raw); element != nil {
+		t.Error("Expected a degenerate transform to be rejected")
+	}
+}
+
+func TestTransformElements(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 20, 0))
+
+	// translations are baked into untransformed geometry
+	if err := cs.TransformElements("c1", []string{"a", "b"}, Translate(5, 5)); err != nil {
+		t.Fatalf("TransformElements failed: %v", err)
+	}
+	elements := cs.GetCanvas("c1").VectorData.Elements
+	if a := elements[0].(VectorRectangle); a.X != 5 || a.Y != 5 || a.Transform != nil {
+		t.Errorf("Expected a moved to (5, 5) without transform, got %+v", a)
+	}
+
+	if err := cs.TransformElements("c1", []string{"a"}, rotation(math.Pi/2)); err != nil {
+		t.Fatalf("TransformElements failed: %v", err)
+	}
+	origin, _ := cs.FindElementOrigin("c1", "a")
+	if !nearlyPoint(origin, Point{X: -5, Y: 5}) {
+		t.Errorf("Expected the rotated origin at (-5, 5), got %+v", origin)
+	}
+
+	// nothing changes when one element is missing
+	before := cs.GetCanvas("c1").VectorData.Elements[1].(VectorRectangle)
+	if err := cs.TransformElements("c1", []string{"b", "missing"}, Translate(1, 1)); err == nil {
+		t.Error("Expected an error for a missing element")
+	}
+	if after := cs.GetCanvas("c1").VectorData.Elements[1].(VectorRectangle); after.X != before.X {
+		t.Error("Expected b to stay in place after a failed transform")
+	}
+	if err := cs.TransformElements("c1", []string{"b"}, Matrix{}); err == nil {
+		t.Error("Expected an error for a degenerate transform")
+	}
+
+	if err := cs.SetElementTransforms("c1", []string{"a"}, nil); err != nil {
+		t.Fatalf("SetElementTransforms failed: %v", err)
+	}
+	if a := cs.GetCanvas("c1").VectorData.Elements[0].(VectorRectangle); a.Transform != nil {
+		t.Errorf("Expected the transform to be reset, got %+v", a.Transform)
+	}
+}
+
+func TestTransformNestedElement(t *testing.T) {
+	scaled := Matrix{A: 2, D: 2, E: 10, F: 10}
+	cs := newGroupCanvas(VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &scaled}, Type: "group",
+		Children: []VectorElement{rect("a", 0, 0)}})
+
+	if err := cs.TransformElements("c1", []string{"g", "a"}, Translate(1, 0)); err == nil {
+		t.Error("Expected an error when transforming a group and its child together")
+	}
+	// a canvas translation is halved inside a group scaled twice
+	if err := cs.TransformElements("c1", []string{"a"}, Translate(4, 0)); err != nil {
+		t.Fatalf("TransformElements failed: %v", err)
+	}
+	origin, _ := cs.FindElementOrigin("c1", "a")
+	if !nearlyPoint(origin, Point{X: 14, Y: 10}) {
+		t.Errorf("Expected origin (14, 10), got %+v", origin)
+	}
+}
+
+func TestUngroupRotatedGroup(t *testing.T) {
+	rotated := rotation(math.Pi / 2)
+	cs := newGroupCanvas(VectorGroup{VectorShape: VectorShape{ID: "g", Transform: &rotated}, Type: "group",
+		Children: []VectorElement{rect("a", 10, 0)}})
+
+	before, _ := cs.FindElementOrigin("c1", "a")
+	if err := cs.UngroupElement("c1", "g"); err != nil {
+		t.Fatalf("UngroupElement failed: %v", err)
+	}
+	after, _ := cs.FindElementOrigin("c1", "a")
+	if !nearlyPoint(before, after) || !nearlyPoint(after, Point{X: 0, Y: 10}) {
+		t.Errorf("Expected a to keep its place at (0, 10), got %+v then %+v", before, after)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+// ViewportSubscription is the area of a canvas a client keeps in sync, along with the elements it received
+type ViewportSubscription struct {
+	CanvasId string `json:"canvasId"`
+	Rect
+	known map[string]bool
+}
+
+func NewViewportSubscription(canvasId string, r Rect) *ViewportSubscription {
+	return &ViewportSubscription{CanvasId: canvasId, Rect: r, known: make(map[string]bool)}
+}
+
+// Move changes the synchronized area, the received elements are forgotten when the canvas changes
+func (s *ViewportSubscription) Move(canvasId string, r Rect) {
+	if canvasId != s.CanvasId {
+		s.Reset()
+	}
+	s.CanvasId = canvasId
+	s.Rect = r
+}
+
+// Reset forgets the received elements, the next fetch sends the whole area again
+func (s *ViewportSubscription) Reset() {
+	s.known = make(map[string]bool)
+}
+
+// Knows reports whether the subscriber received an element, nested ones included
+func (s *ViewportSubscription) Knows(elementId string) bool {
+	return s.known[elementId]
+}
+
+func (s *ViewportSubscription) remember(element VectorElement) {
+	s.known[ElementID(element)] = true
+	if group, ok := element.(VectorGroup); ok {
+		for _, child := range group.Children {
+			s.remember(child)
+		}
+	}
+}
+
+// knowsAll reports whether the subscriber has the current version of a whole tree of elements
+func (s *ViewportSubscription) knowsAll(element VectorElement) bool {
+	if !s.known[ElementID(element)] {
+		return false
+	}
+	if group, ok := element.(VectorGroup); ok {
+		for _, child := range group.Children {
+			if !s.knowsAll(child) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// knowsAny reports whether the subscriber has some element of a tree
+func (s *ViewportSubscription) knowsAny(element VectorElement) bool {
+	if s.known[ElementID(element)] {
+		return true
+	}
+	if group, ok := element.(VectorGroup); ok {
+		for _, child := range group.Children {
+			if s.knowsAny(child) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// FetchViewport returns the top level elements intersecting the area of a subscription that its
+// subscriber did not receive yet, bottom to top, and records them as received
+func (c *CanvasService) FetchViewport(s *ViewportSubscription) []VectorElement {
+	missing := []VectorElement{}
+	for _, element := range c.ElementsInRect(s.CanvasId, s.Rect, false) {
+		if !s.knowsAll(element) {
+			missing = append(missing, element)
+			s.remember(element)
+		}
+	}
+	return missing
+}
+
+// ViewportUpdate tells how an operation which changed elements of a canvas reaches a subscriber. The operation
+// is forwarded when it touches an element the subscriber has; the top level elements it must then receive
+// whole are returned, either because they entered its area or because it only has a part of them
+func (c *CanvasService) ViewportUpdate(s *ViewportSubscription, canvasId string, elementIds []string) (bool, []VectorElement) {
+	if canvasId != s.CanvasId {
+		return false, nil
+	}
+	forward := false
+	for _, id := range elementIds {
+		if s.known[id] {
+			forward = true
+		}
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return forward, nil
+	}
+
+	roots := make(map[string]bool)
+	for _, id := range elementIds {
+		_, _, ancestors, found := findElement(canvas.VectorData.Elements, id, Identity(), nil)
+		if !found {
+			continue
+		}
+		if len(ancestors) > 0 {
+			id = ancestors[0]
+		}
+		roots[id] = true
+	}
+
+	upserts := []VectorElement{}
+	for _, element := range canvas.VectorData.Elements {
+		if !roots[ElementID(element)] || s.knowsAll(element) {
+			continue
+		}
+		bounds, ok := ElementBounds(element)
+		if s.knowsAny(element) || (ok && bounds.Intersects(s.Rect)) {
+			upserts = append(upserts, element)
+			s.remember(element)
+		}
+	}
+	return forward, upserts
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+)
+
+func TestFetchViewport(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 100, 0), rect("c", 1000, 0))
+	s := NewViewportSubscription("c1", Rect{MinX: 0, MinY: 0, MaxX: 200, MaxY: 200})
+
+	if ids := elementIDs(cs.FetchViewport(s)); !sameIDs(ids, "a", "b") {
+		t.Errorf("Expected the elements of the area, got %v", ids)
+	}
+	if ids := elementIDs(cs.FetchViewport(s)); len(ids) != 0 {
+		t.Errorf("Expected nothing new in the same area, got %v", ids)
+	}
+
+	s.Move("c1", Rect{MinX: 50, MinY: 0, MaxX: 1050, MaxY: 200})
+	if ids := elementIDs(cs.FetchViewport(s)); !sameIDs(ids, "c") {
+		t.Errorf("Expected only the element coming into view, got %v", ids)
+	}
+
+	cs.AddOrUpdateCanvas(Canvas{ID: "c2", VectorData: VectorData{Elements: []VectorElement{rect("a", 0, 0)}}})
+	s.Move("c2", Rect{MinX: 0, MinY: 0, MaxX: 200, MaxY: 200})
+	if ids := elementIDs(cs.FetchViewport(s)); !sameIDs(ids, "a") {
+		t.Errorf("Expected a canvas change to forget the received elements, got %v", ids)
+	}
+}
+
+func TestViewportUpdate(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("far", 1000, 1000))
+	s := NewViewportSubscription("c1", Rect{MinX: 0, MinY: 0, MaxX: 200, MaxY: 200})
+	cs.FetchViewport(s)
+
+	if forward, elements := cs.ViewportUpdate(s, "c1", []string{"far"}); forward || len(elements) != 0 {
+		t.Errorf("Expected changes out of view to be dropped, got %v %v", forward, elementIDs(elements))
+	}
+	if forward, _ := cs.ViewportUpdate(s, "c2", []string{"a"}); forward {
+		t.Error("Expected changes of another canvas to be dropped")
+	}
+
+	// an element moved into view is sent whole, later changes are forwarded
+	if err := cs.TransformElements("c1", []string{"far"}, Translate(-950, -950)); err != nil {
+		t.Fatal(err)
+	}
+	forward, elements := cs.ViewportUpdate(s, "c1", []string{"far"})
+	if forward || !sameIDs(elementIDs(elements), "far") {
+		t.Errorf("Expected the element entering the view, got %v %v", forward, elementIDs(elements))
+	}
+	if forward, elements := cs.ViewportUpdate(s, "c1", []string{"far"}); !forward || len(elements) != 0 {
+		t.Errorf("Expected the change to be forwarded, got %v %v", forward, elementIDs(elements))
+	}
+
+	// a new group of known elements is forwarded and sent whole as the subscriber lacks its container
+	if err := cs.GroupElements("c1", "g", []string{"a", "far"}); err != nil {
+		t.Fatal(err)
+	}
+	forward, elements = cs.ViewportUpdate(s, "c1", []string{"a", "far", "g"})
+	if !forward || !sameIDs(elementIDs(elements), "g") {
+		t.Errorf("Expected the new group, got %v %v", forward, elementIDs(elements))
+	}
+	if !s.Knows("g") || !s.Knows("a") {
+		t.Error("Expected the group and its children to be known")
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// z-order moves of an element among its siblings
+const (
+	ZOrderForward  = "bring_forward"
+	ZOrderBackward = "send_backward"
+	ZOrderFront    = "to_front"
+	ZOrderBack     = "to_back"
+)
+
+// zIndexDigits are ordered as bytes so that keys compare as plain strings
+const zIndexDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// KeyBetween returns a fractional index key sorting strictly between a and b, an empty a or b meaning no bound.
+// Keys never end with the lowest digit so that there is always room before them
+func KeyBetween(a, b string) (string, error) {
+	if !validZIndex(a) || !validZIndex(b) {
+		return "", fmt.Errorf("invalid z-index key %q/%q", a, b)
+	}
+	if b != "" && a >= b {
+		return "", fmt.Errorf("z-index key %q is not before %q", a, b)
+	}
+	return keyMidpoint(a, b), nil
+}
+
+func validZIndex(key string) bool {
+	if strings.HasSuffix(key, zIndexDigits[:1]) {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if strings.IndexByte(zIndexDigits, key[i]) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// keyMidpoint works digit by digit, a being padded with the lowest digit and an empty b standing for the end
+func keyMidpoint(a, b string) string {
+	digitAt := func(key string, i int) int {
+		if i < len(key) {
+			return strings.IndexByte(zIndexDigits, key[i])
+		}
+		return 0
+	}
+	// keep the common prefix
+	n := 0
+	for n < len(b) && digitAt(a, n) == digitAt(b, n) {
+		n++
+	}
+	if n > 0 {
+		rest := ""
+		if n < len(a) {
+			rest = a[n:]
+		}
+		return b[:n] + keyMidpoint(rest, b[n:])
+	}
+
+	low := digitAt(a, 0)
+	high := len(zIndexDigits)
+	if b != "" {
+		high = digitAt(b, 0)
+	}
+	if high-low > 1 {
+		return string(zIndexDigits[(low+high)/2])
+	}
+	// consecutive digits: a longer b can be cut, otherwise look further into a
+	if len(b) > 1 {
+		return b[:1]
+	}
+	rest := ""
+	if len(a) > 1 {
+		rest = a[1:]
+	}
+	return string(zIndexDigits[low]) + keyMidpoint(rest, "")
+}
+
+func elementZIndex(element VectorElement) string {
+	shape, _ := ElementShape(element)
+	return shape.ZIndex
+}
+
+func withZIndex(element VectorElement, key string) VectorElement {
+	return updateShape(element, func(shape *VectorShape) {
+		shape.ZIndex = key
+	})
+}
+
+// repairZIndexes makes the keys of siblings strictly increasing along the slice, which stays the reference
+// order; only missing or out of order keys change. Groups are repaired recursively
+func repairZIndexes(elements []VectorElement) {
+	previous := ""
+	for i, element := range elements {
+		if group, ok := element.(VectorGroup); ok {
+			repairZIndexes(group.Children)
+		}
+		key := elementZIndex(element)
+		if key != "" && key > previous && validZIndex(key) {
+			previous = key
+			continue
+		}
+		// the next valid key after previous bounds the new one when there is such a key
+		next := ""
+		for _, following := range elements[i+1:] {
+			if candidate := elementZIndex(following); candidate > previous && validZIndex(candidate) {
+				next = candidate
+				break
+			}
+		}
+		previous = keyMidpoint(previous, next)
+		elements[i] = withZIndex(element, previous)
+	}
+}
+
+// insertByZIndex places an element among its siblings according to its key, or on top when it has none
+func insertByZIndex(elements []VectorElement, element VectorElement) []VectorElement {
+	key := elementZIndex(element)
+	if key == "" || !validZIndex(key) {
+		last := ""
+		if len(elements) > 0 {
+			last = elementZIndex(elements[len(elements)-1])
+		}
+		return append(elements, withZIndex(element, keyMidpoint(last, "")))
+	}
+	position := len(elements)
+	for i, sibling := range elements {
+		if elementZIndex(sibling) >= key {
+			position = i
+			break
+		}
+	}
+	// a key already taken moves the element right after its twin
+	if position < len(elements) && elementZIndex(elements[position]) == key {
+		next := ""
+		if position+1 < len(elements) {
+			next = elementZIndex(elements[position+1])
+		}
+		element = withZIndex(element, keyMidpoint(key, next))
+		position++
+	}
+	updated := append([]VectorElement{}, elements[:position]...)
+	updated = append(updated, element)
+	return append(updated, elements[position:]...)
+}
+
+// ReorderElement moves an element among its siblings, skipping the ones on other layers, and returns its new key
+func (c *CanvasService) ReorderElement(canvasId string, elementId string, move string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	canvas, exists := c.canvases[canvasId]
+	if !exists {
+		return "", fmt.Errorf("canvas %s not found", canvasId)
+	}
+	_, _, ancestors, found := findElement(canvas.VectorData.Elements, elementId, Identity(), nil)
+	if !found {
+		return "", fmt.Errorf("element %s not found", elementId)
+	}
+	parent := ""
+	if len(ancestors) > 0 {
+		parent = ancestors[len(ancestors)-1]
+	}
+	v := &canvas.VectorData
+	sameLayer := func(a, b VectorElement) bool {
+		return parent != "" || v.ElementLayer(a).ID == v.ElementLayer(b).ID
+	}
+
+	var key string
+	elements, _, err := withContainer(v.Elements, parent, func(children []VectorElement) ([]VectorElement, error) {
+		index := -1
+		for i, child := range children {
+			if ElementID(child) == elementId {
+				index = i
+			}
+		}
+		element := children[index]
+		others := append(append([]VectorElement{}, children[:index]...), children[index+1:]...)
+		keyAt := func(i int) string {
+			if i < 0 || i >= len(others) {
+				return ""
+			}
+			return elementZIndex(others[i])
+		}
+
+		// position is the index in others the element is inserted at
+		position := index
+		switch move {
+		case ZOrderFront:
+			position = len(others)
+		case ZOrderBack:
+			position = 0
+		case ZOrderForward:
+			for i := index; i < len(others); i++ {
+				if sameLayer(others[i], element) {
+					position = i + 1
+					break
+				}
+			}
+		case ZOrderBackward:
+			for i := index - 1; i >= 0; i-- {
+				if sameLayer(others[i], element) {
+					position = i
+					break
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown z-order move %q", move)
+		}
+		if position == index {
+			key = elementZIndex(element)
+			return children, nil
+		}
+
+		var err error
+		if key, err = KeyBetween(keyAt(position-1), keyAt(position)); err != nil {
+			return nil, errors.New("z-index keys are out of order")
+		}
+		updated := append([]VectorElement{}, others[:position]...)
+		updated = append(updated, withZIndex(element, key))
+		return append(updated, others[position:]...), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	v.Elements = elements
+	c.invalidateIndex(canvasId)
+	c.markChanged(canvasId)
+	return key, nil
+}
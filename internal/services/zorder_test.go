@@ -0,0 +1,138 @@
+package services
+
+import "testing"
+
+func TestKeyBetween(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"", ""},
+		{"V", ""},
+		{"z", ""},
+		{"", "1"},
+		{"0V", "1"},
+		{"V", "VV"},
+		{"V", "W"},
+		{"a", "b"},
+	}
+	for _, tt := range tests {
+		key, err := KeyBetween(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("KeyBetween(%q, %q) failed: %v", tt.a, tt.b, err)
+			continue
+		}
+		if key <= tt.a || (tt.b != "" && key >= tt.b) || !validZIndex(key) {
+			t.Errorf("KeyBetween(%q, %q) = %q is not strictly between", tt.a, tt.b, key)
+		}
+	}
+
+	if _, err := KeyBetween("b", "a"); err == nil {
+		t.Error("Expected an error for reversed bounds")
+	}
+	if _, err := KeyBetween("a0", ""); err == nil {
+		t.Error("Expected an error for a key ending with the lowest digit")
+	}
+
+	// repeated inserts at the same place keep working
+	low, high := "", "V"
+	for i := 0; i < 200; i++ {
+		key, err := KeyBetween(low, high)
+		if err != nil || key <= low || key >= high {
+			t.Fatalf("Insert %d between %q and %q gave %q (%v)", i, low, high, key, err)
+		}
+		high = key
+	}
+}
+
+func zIndexes(elements []VectorElement) []string {
+	keys := []string{}
+	for _, element := range elements {
+		keys = append(keys, elementZIndex(element))
+	}
+	return keys
+}
+
+func TestRepairZIndexes(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), withZIndex(rect("b", 0, 0), "A"), withZIndex(rect("c", 0, 0), "9"), rect("d", 0, 0))
+	keys := zIndexes(cs.GetCanvas("c1").VectorData.Elements)
+	for i := 1; i < len(keys); i++ {
+		if keys[i] <= keys[i-1] {
+			t.Fatalf("Expected increasing keys, got %v", keys)
+		}
+	}
+	if keys[1] != "A" {
+		t.Errorf("Expected valid keys to be kept, got %v", keys)
+	}
+}
+
+func TestUpdateCanvasElementZIndex(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), rect("b", 0, 0))
+	elements := cs.GetCanvas("c1").VectorData.Elements
+	between, _ := KeyBetween(elementZIndex(elements[0]), elementZIndex(elements[1]))
+
+	cs.UpdateCanvasElement("c1", withZIndex(rect("c", 0, 0), between))
+	cs.UpdateCanvasElement("c1", rect("d", 0, 0))
+	cs.UpdateCanvasElement("c1", withZIndex(rect("e", 0, 0), between))
+	elements = cs.GetCanvas("c1").VectorData.Elements
+	if !sameIDs(elementIDs(elements), "a", "c", "e", "b", "d") {
+		t.Errorf("Unexpected order %v", elementIDs(elements))
+	}
+	if elementZIndex(elements[1]) == elementZIndex(elements[2]) {
+		t.Error("Expected a colliding key to be replaced")
+	}
+}
+
+func TestReorderElement(t *testing.T) {
+	cs := newGroupCanvas(rect("a", 0, 0), onLayer(rect("x", 0, 0), "other"), rect("b", 0, 0), rect("c", 0, 0))
+	cs.GetCanvas("c1").VectorData.Layers = []Layer{defaultLayer(), {ID: "other", Name: "Other", Visible: true, Opacity: 1}}
+
+	order := func() []string {
+		return elementIDs(cs.GetCanvas("c1").VectorData.Elements)
+	}
+	steps := []struct {
+		element string
+		move    string
+		expect  []string
+	}{
+		{"a", ZOrderForward, []string{"x", "b", "a", "c"}},
+		{"c", ZOrderBackward, []string{"x", "b", "c", "a"}},
+		{"b", ZOrderFront, []string{"x", "c", "a", "b"}},
+		{"b", ZOrderBack, []string{"b", "x", "c", "a"}},
+		{"b", ZOrderBackward, []string{"b", "x", "c", "a"}},
+	}
+	for _, step := range steps {
+		key, err := cs.ReorderElement("c1", step.element, step.move)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", step.move, step.element, err)
+		}
+		if !sameIDs(order(), step.expect...) {
+			t.Errorf("%s %s: expected %v, got %v", step.move, step.element, step.expect, order())
+		}
+		keys := zIndexes(cs.GetCanvas("c1").VectorData.Elements)
+		for i := 1; i < len(keys); i++ {
+			if keys[i] <= keys[i-1] {
+				t.Errorf("%s %s: keys out of order %v", step.move, step.element, keys)
+			}
+		}
+		element, _, _, _ := findElement(cs.GetCanvas("c1").VectorData.Elements, step.element, Identity(), nil)
+		if elementZIndex(element) != key {
+			t.Errorf("%s %s: returned key %q does not match %q", step.move, step.element, key, elementZIndex(element))
+		}
+	}
+
+	if _, err := cs.ReorderElement("c1", "a", "sideways"); err == nil {
+		t.Error("Expected an error for an unknown move")
+	}
+}
+
+func TestReorderNestedElement(t *testing.T) {
+	cs := newGroupCanvas(VectorGroup{VectorShape: VectorShape{ID: "g"}, Type: "group",
+		Children: []VectorElement{rect("a", 0, 0), rect("b", 0, 0)}})
+	if _, err := cs.ReorderElement("c1", "a", ZOrderFront); err != nil {
+		t.Fatalf("ReorderElement failed: %v", err)
+	}
+	group := cs.GetCanvas("c1").VectorData.Elements[0].(VectorGroup)
+	if !sameIDs(elementIDs(group.Children), "b", "a") {
+		t.Errorf("Unexpected children order %v", elementIDs(group.Children))
+	}
+}
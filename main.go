@@ -15,11 +15,33 @@ func main() {
 	if err != nil {
 		log.Println(err)
 	}
+	err = services.SetupBlobStore()
+	if err != nil {
+		// assets, thumbnails and exports cannot work without a blob store
+		log.Fatal(err)
+	}
 	log.Println("Creating the server on port 8080")
 	mux := http.NewServeMux()
 	// adding all the handlers
 	mux.Handle("/users", &handlers.UserHandler{})
 	mux.Handle("/projects", &handlers.ProjectHandler{})
+	mux.Handle("/projects/import", &handlers.BundleHandler{})
+	mux.Handle("/projects/{pid}/bundle", &handlers.BundleHandler{})
+	mux.Handle("/projects/{pid}/thumbnail.png", &handlers.ThumbnailHandler{})
+	mux.Handle("/projects/{pid}/chat", &handlers.ChatHandler{})
+	mux.Handle("/projects/{pid}/comments", &handlers.CommentHandler{})
+	mux.Handle("/projects/{pid}/comments/{cid}", &handlers.CommentHandler{})
+	mux.Handle("/projects/{pid}/comments/{cid}/{action}", &handlers.CommentHandler{})
+	mux.Handle("/projects/{pid}/comments/{cid}/replies/{rid}", &handlers.CommentHandler{})
+	mux.Handle("/projects/{pid}/assets", &handlers.AssetHandler{})
+	mux.Handle("/projects/{pid}/assets/{aid}", &handlers.AssetHandler{})
+	mux.Handle("/projects/{pid}/assets/{aid}/{variant}", &handlers.AssetHandler{})
+	mux.Handle("/projects/{pid}/styles", &handlers.StyleHandler{})
+	mux.Handle("/projects/{pid}/styles/{kind}", &handlers.StyleHandler{})
+	mux.Handle("/projects/{pid}/styles/{kind}/{sid}", &handlers.StyleHandler{})
+	mux.Handle("/projects/{pid}/canvases/{file}", &handlers.ExportHandler{})
+	mux.Handle("/projects/{pid}/canvases/{cid}/{file}", &handlers.ExportHandler{})
+	mux.Handle("/projects/{pid}/canvases/{cid}/import", &handlers.ImportHandler{})
 	mux.Handle("/invitations/accept", &handlers.InvitationHandler{})
 	mux.Handle("/invitations", &handlers.InvitationHandler{})
 
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Asset is the metadata of an uploaded file, the content itself lives in the blob store
+type Asset struct {
+	ID          string    `firestore:"ID" json:"id"`
+	ProjectID   string    `firestore:"PID" json:"projectId"`
+	UserID      string    `firestore:"UID" json:"userId"`
+	Name        string    `firestore:"Name" json:"name"`
+	ContentType string    `firestore:"ContentType" json:"contentType"`
+	Size        int64     `firestore:"Size" json:"size"`
+	Width       int       `firestore:"Width" json:"width"`
+	Height      int       `firestore:"Height" json:"height"`
+	CreatedAt   time.Time `firestore:"CreatedAt" json:"createdAt"`
+	// ImportedAuthor is the username of the uploader on the server a bundle came from, for display only
+	ImportedAuthor string `firestore:"ImportedAuthor,omitempty" json:"importedAuthor,omitempty"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ChatMessageMaxLength is the maximum number of characters of a single chat message
+const ChatMessageMaxLength = 4000
+
+type ChatMessage struct {
+	ID        string    `firestore:"ID" json:"id"`
+	ProjectID string    `firestore:"PID" json:"projectId"`
+	UserID    string    `firestore:"UID" json:"userId"`
+	Username  string    `firestore:"Username" json:"username"`
+	Text      string    `firestore:"Text" json:"text"`
+	Mentions  []string  `firestore:"Mentions" json:"mentions"`
+	CreatedAt time.Time `firestore:"CreatedAt" json:"createdAt"`
+}
+
+// ValidateChatText Check that a chat message is neither empty nor too long
+func ValidateChatText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("chat message is empty")
+	}
+	if utf8.RuneCountInString(text) > ChatMessageMaxLength {
+		return errors.New("chat message is too long")
+	}
+	return nil
+}
+
+// ParseMentions Return the distinct usernames mentioned as @username in a text, in order of appearance
+func ParseMentions(text string) []string {
+	mentions := []string{}
+	seen := make(map[string]bool)
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		// an @ glued to a previous word is an e-mail address, not a mention
+		if runes[i] != '@' || (i > 0 && isMentionRune(runes[i-1])) {
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && isMentionRune(runes[end]) {
+			end++
+		}
+		// trailing dots belong to the sentence, not to the username
+		for end > i+1 && runes[end-1] == '.' {
+			end--
+		}
+		if end == i+1 {
+			continue
+		}
+		username := string(runes[i+1 : end])
+		if !seen[username] {
+			seen[username] = true
+			mentions = append(mentions, username)
+		}
+		i = end - 1
+	}
+	return mentions
+}
+
+func isMentionRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '-' || r == '.'
+}
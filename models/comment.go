@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CommentMaxLength is the maximum number of characters of a comment or reply
+const CommentMaxLength = 4000
+
+// CommentAnchor pins a comment thread to a point of a canvas or to one of its elements
+type CommentAnchor struct {
+	CanvasID  string `firestore:"CanvasID" json:"canvasId"`
+	ElementID string `firestore:"ElementID" json:"elementId,omitempty"`
+	// X and Y are the absolute position on the canvas, the last known one for element anchors
+	X float64 `firestore:"X" json:"x"`
+	Y float64 `firestore:"Y" json:"y"`
+	// OffsetX and OffsetY are relative to the origin of the anchor element
+	OffsetX  float64 `firestore:"OffsetX" json:"offsetX"`
+	OffsetY  float64 `firestore:"OffsetY" json:"offsetY"`
+	Orphaned bool    `firestore:"Orphaned" json:"orphaned"`
+}
+
+type CommentReply struct {
+	ID        string    `firestore:"ID" json:"id"`
+	UserID    string    `firestore:"UID" json:"userId"`
+	Text      string    `firestore:"Text" json:"text"`
+	CreatedAt time.Time `firestore:"CreatedAt" json:"createdAt"`
+	UpdatedAt time.Time `firestore:"UpdatedAt" json:"updatedAt"`
+	// ImportedAuthor is the username of the author on the server a bundle came from, for display only
+	ImportedAuthor string `firestore:"ImportedAuthor,omitempty" json:"importedAuthor,omitempty"`
+}
+
+// Comment is the root of a comment thread
+type Comment struct {
+	ID         string         `firestore:"ID" json:"id"`
+	ProjectID  string         `firestore:"PID" json:"projectId"`
+	UserID     string         `firestore:"UID" json:"userId"`
+	Text       string         `firestore:"Text" json:"text"`
+	Anchor     CommentAnchor  `firestore:"Anchor" json:"anchor"`
+	Resolved   bool           `firestore:"Resolved" json:"resolved"`
+	ResolvedBy string         `firestore:"ResolvedBy" json:"resolvedBy,omitempty"`
+	ResolvedAt *time.Time     `firestore:"ResolvedAt" json:"resolvedAt,omitempty"`
+	Replies    []CommentReply `firestore:"Replies" json:"replies"`
+	CreatedAt  time.Time      `firestore:"CreatedAt" json:"createdAt"`
+	UpdatedAt  time.Time      `firestore:"UpdatedAt" json:"updatedAt"`
+	// ImportedAuthor is the username of the author on the server a bundle came from, for display only
+	ImportedAuthor string `firestore:"ImportedAuthor,omitempty" json:"importedAuthor,omitempty"`
+}
+
+// ValidateCommentText Check that a comment is neither empty nor too long
+func ValidateCommentText(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return errors.New("comment is empty")
+	}
+	if utf8.RuneCountInString(text) > CommentMaxLength {
+		return errors.New("comment is too long")
+	}
+	return nil
+}
+
+// Attach pins the anchor to an element whose origin is at (originX, originY), keeping its absolute position
+func (a *CommentAnchor) Attach(originX, originY float64) {
+	a.OffsetX = a.X - originX
+	a.OffsetY = a.Y - originY
+	a.Orphaned = false
+}
+
+// Follow moves an element anchor along with its element, or orphans it at its last known position when the
+// element does not exist anymore. It returns true when the anchor changed
+func (a *CommentAnchor) Follow(originX, originY float64, exists bool) bool {
+	if a.ElementID == "" {
+		return false
+	}
+	if !exists {
+		changed := !a.Orphaned
+		a.Orphaned = true
+		return changed
+	}
+	x, y := originX+a.OffsetX, originY+a.OffsetY
+	changed := a.Orphaned || x != a.X || y != a.Y
+	a.X, a.Y = x, y
+	a.Orphaned = false
+	return changed
+}
+
+// Resolve marks the thread as resolved by a user
+func (c *Comment) Resolve(uid string, at time.Time) {
+	c.Resolved = true
+	c.ResolvedBy = uid
+	c.ResolvedAt = &at
+	c.UpdatedAt = at
+}
+
+// Reopen marks a resolved thread as open again
+func (c *Comment) Reopen(at time.Time) {
+	c.Resolved = false
+	c.ResolvedBy = ""
+	c.ResolvedAt = nil
+	c.UpdatedAt = at
+}
+
+// FindReply returns the index of a reply, -1 when it does not exist
+func (c *Comment) FindReply(id string) int {
+	for i, reply := range c.Replies {
+		if reply.ID == id {
+			return i
+		}
+	}
+	return -1
+}
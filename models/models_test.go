@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Test User model
@@ -239,3 +240,93 @@ func TestInvitationModelValidation(t *testing.T) {
 		t.Error("Expected empty ProjectID for partial Invitation")
 	}
 }
+
+// Test Chat model
+func TestParseMentions(t *testing.T) {
+	mentions := ParseMentions("@alice can you check this with @bob.smith and @alice? mail me at carl@example.com @")
+	expected := []string{"alice", "bob.smith"}
+	if len(mentions) != len(expected) {
+		t.Fatalf("Expected %d mentions, got %d: %v", len(expected), len(mentions), mentions)
+	}
+	for i, mention := range expected {
+		if mentions[i] != mention {
+			t.Errorf("Expected mention '%s', got '%s'", mention, mentions[i])
+		}
+	}
+}
+
+func TestParseMentionsTrailingDot(t *testing.T) {
+	mentions := ParseMentions("thanks @dave.")
+	if len(mentions) != 1 || mentions[0] != "dave" {
+		t.Errorf("Expected [dave], got %v", mentions)
+	}
+}
+
+func TestValidateChatText(t *testing.T) {
+	if err := ValidateChatText("hello"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if err := ValidateChatText("   "); err == nil {
+		t.Error("Expected error for blank message, got nil")
+	}
+	if err := ValidateChatText(strings.Repeat("a", ChatMessageMaxLength+1)); err == nil {
+		t.Error("Expected error for too long message, got nil")
+	}
+}
+
+// Test Comment model
+func TestCommentAnchorFollow(t *testing.T) {
+	anchor := CommentAnchor{CanvasID: "canvas-1", ElementID: "rect-1", X: 15, Y: 25}
+	anchor.Attach(10, 20)
+	if anchor.OffsetX != 5 || anchor.OffsetY != 5 {
+		t.Errorf("Expected offset (5, 5), got (%f, %f)", anchor.OffsetX, anchor.OffsetY)
+	}
+
+	if !anchor.Follow(100, 200, true) {
+		t.Error("Expected anchor to change when its element moves")
+	}
+	if anchor.X != 105 || anchor.Y != 205 {
+		t.Errorf("Expected position (105, 205), got (%f, %f)", anchor.X, anchor.Y)
+	}
+	if anchor.Follow(100, 200, true) {
+		t.Error("Expected anchor to be unchanged when its element did not move")
+	}
+
+	if !anchor.Follow(0, 0, false) {
+		t.Error("Expected anchor to change when its element is deleted")
+	}
+	if !anchor.Orphaned {
+		t.Error("Expected anchor to be orphaned")
+	}
+	if anchor.X != 105 || anchor.Y != 205 {
+		t.Errorf("Expected orphaned anchor to keep last position, got (%f, %f)", anchor.X, anchor.Y)
+	}
+}
+
+func TestCommentAnchorFollowCanvasPoint(t *testing.T) {
+	anchor := CommentAnchor{CanvasID: "canvas-1", X: 1, Y: 2}
+	if anchor.Follow(0, 0, false) {
+		t.Error("Expected canvas point anchor to never change")
+	}
+	if anchor.Orphaned {
+		t.Error("Expected canvas point anchor to never be orphaned")
+	}
+}
+
+func TestCommentResolveReopen(t *testing.T) {
+	comment := Comment{ID: "comment-1", Replies: []CommentReply{{ID: "reply-1"}}}
+	comment.Resolve("user-1", time.Now())
+	if !comment.Resolved || comment.ResolvedBy != "user-1" || comment.ResolvedAt == nil {
+		t.Error("Expected comment to be resolved by user-1")
+	}
+	comment.Reopen(time.Now())
+	if comment.Resolved || comment.ResolvedBy != "" || comment.ResolvedAt != nil {
+		t.Error("Expected comment to be reopened")
+	}
+	if comment.FindReply("reply-1") != 0 {
+		t.Error("Expected to find reply-1 at index 0")
+	}
+	if comment.FindReply("missing") != -1 {
+		t.Error("Expected -1 for missing reply")
+	}
+}